@@ -0,0 +1,34 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"log"
+	"os"
+
+	"recipe-backend/internal/services"
+)
+
+// runGarbageCollection implements the "gc" subcommand, which runs a single
+// orphaned file collection and prints the report as JSON.
+func runGarbageCollection(gc *services.GarbageCollector, args []string) {
+	flags := flag.NewFlagSet("gc", flag.ExitOnError)
+	dryRun := flags.Bool("dry-run", false, "report orphaned files without deleting them")
+	flags.Parse(args)
+
+	report, err := gc.Run(context.Background(), *dryRun)
+	if err != nil {
+		log.Fatal("Orphaned file collection failed:", err)
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(report); err != nil {
+		log.Fatal("Failed to write report:", err)
+	}
+
+	if len(report.Errors) > 0 {
+		os.Exit(1)
+	}
+}
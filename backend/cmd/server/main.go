@@ -1,14 +1,14 @@
 package main
 
 import (
+	"context"
 	"log"
 	"os"
-	"time"
-	"context"
 	"recipe-backend/internal/config"
 	"recipe-backend/internal/handlers"
 	"recipe-backend/internal/middleware"
 	"recipe-backend/internal/services"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
@@ -33,8 +33,37 @@ func main() {
 	log.Println("Initializing services...")
 	authService := services.NewAuthService(cfg)
 	fileService := services.NewFileService(cfg)
-	chapaService := services.NewChapaService(cfg)
+	tusService := services.NewTusService(cfg)
+	paymentProvider := services.NewPaymentProvider(cfg)
 	hasuraService := services.NewHasuraService(cfg)
+	quotaService := services.NewQuotaService(cfg, hasuraService)
+	ledgerService := services.NewLedgerService(cfg, hasuraService)
+	invoiceService := services.NewInvoiceService(cfg, hasuraService)
+
+	// Services that send emails do so through the notification handler
+	notificationHandler := handlers.NewNotificationHandler(hasuraService)
+	purchaseService := services.NewPurchaseService(paymentProvider, ledgerService, invoiceService, hasuraService, notificationHandler)
+	refundService := services.NewRefundService(paymentProvider, ledgerService, hasuraService)
+	currencyService := services.NewCurrencyService(cfg, hasuraService)
+	couponService := services.NewCouponService(currencyService, hasuraService)
+	accessService := services.NewAccessService(hasuraService)
+	entitlementService := services.NewEntitlementService(cfg, accessService, hasuraService)
+	giftService := services.NewGiftService(accessService, hasuraService)
+	payoutService := services.NewPayoutService(cfg, services.NewTransferProvider(cfg), ledgerService, hasuraService)
+	garbageCollector := services.NewGarbageCollector(cfg, fileService, hasuraService)
+	purchaseReconciler := services.NewPurchaseReconciler(cfg, purchaseService, hasuraService)
+	subscriptionService := services.NewSubscriptionService(cfg, paymentProvider, ledgerService, hasuraService, notificationHandler)
+	bundleService := services.NewBundleService(currencyService, accessService, hasuraService)
+
+	// Subcommands
+	if len(os.Args) > 1 && os.Args[1] == "gc" {
+		runGarbageCollection(garbageCollector, os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "reconcile" {
+		runReconciliation(purchaseReconciler)
+		return
+	}
 	
 	// Test Hasura connection
 	log.Println("Testing Hasura connection...")
@@ -49,12 +78,45 @@ func main() {
 		log.Println("Hasura connection test successful")
 	}
 
+	// Purge abandoned resumable uploads
+	go func() {
+		ticker := time.NewTicker(time.Hour)
+		defer ticker.Stop()
+		for range ticker.C {
+			purged, err := tusService.PurgeExpired()
+			if err != nil {
+				log.Printf("Failed to purge expired uploads: %v", err)
+			} else if purged > 0 {
+				log.Printf("Purged %d expired uploads", purged)
+			}
+		}
+	}()
+
+	// Collect orphaned files in the background
+	go garbageCollector.Start(context.Background())
+
+	// Settle purchases whose webhook or redirect never arrived
+	go purchaseReconciler.Start(context.Background())
+
+	// Follow payout transfers until they complete or fail
+	go payoutService.Start(context.Background())
+
+	// Start renewal checkouts and end lapsed subscriptions
+	go subscriptionService.Start(context.Background())
+
 	// Initialize handlers
 	log.Println("Initializing handlers...")
 	authHandler := handlers.NewAuthHandler(authService, hasuraService)
-	fileHandler := handlers.NewFileHandler(fileService)
-	paymentHandler := handlers.NewPaymentHandler(chapaService, hasuraService)
-	notificationHandler := handlers.NewNotificationHandler(hasuraService)
+	fileHandler := handlers.NewFileHandler(fileService, tusService, quotaService, accessService, hasuraService)
+	recipeHandler := handlers.NewRecipeHandler(entitlementService, accessService, fileService, hasuraService)
+	earningsHandler := handlers.NewEarningsHandler(ledgerService)
+	payoutHandler := handlers.NewPayoutHandler(cfg, payoutService, hasuraService)
+	couponHandler := handlers.NewCouponHandler(couponService, hasuraService)
+	subscriptionHandler := handlers.NewSubscriptionHandler(subscriptionService, hasuraService)
+	exchangeRateHandler := handlers.NewExchangeRateHandler(currencyService, hasuraService)
+	giftHandler := handlers.NewGiftHandler(giftService)
+	bundleHandler := handlers.NewBundleHandler(bundleService, hasuraService)
+	paymentHandler := handlers.NewPaymentHandler(cfg, paymentProvider, purchaseService, refundService, couponService, currencyService, subscriptionService, bundleService, invoiceService, hasuraService, notificationHandler)
 
 	// Setup Gin router
 	log.Println("Setting up router...")
@@ -82,14 +144,41 @@ func main() {
 			auth.POST("/refresh", authHandler.RefreshToken)
 		}
 
+		// tus discovery needs no authentication
+		api.OPTIONS("/files/tus", fileHandler.TusOptions)
+
 		// File upload routes
 		files := api.Group("/files")
 		files.Use(middleware.AuthRequired(cfg.JWTSecret))
 		{
+			files.GET("", fileHandler.ListFiles)
+			files.GET("/usage", fileHandler.GetUsage)
 			files.POST("/upload", fileHandler.UploadFile)
+			files.GET("/:fileId/url", fileHandler.GetFileURL)
 			files.DELETE("/:fileId", fileHandler.DeleteFile)
+
+			// Resumable uploads (tus 1.0)
+			files.POST("/tus", fileHandler.TusCreateUpload)
+			files.HEAD("/tus/:uploadId", fileHandler.TusUploadOffset)
+			files.PATCH("/tus/:uploadId", fileHandler.TusPatchUpload)
+			files.DELETE("/tus/:uploadId", fileHandler.TusTerminateUpload)
 		}
 
+		// Recipe gallery routes
+		recipes := api.Group("/recipes")
+		recipes.Use(middleware.AuthRequired(cfg.JWTSecret))
+		{
+			recipes.GET("/:id/images", recipeHandler.ListImages)
+			recipes.POST("/:id/images", recipeHandler.AddImage)
+			recipes.PUT("/:id/images/order", recipeHandler.ReorderImages)
+			recipes.PATCH("/:id/images/:imageId", recipeHandler.UpdateImage)
+			recipes.POST("/:id/images/:imageId/featured", recipeHandler.SetFeaturedImage)
+			recipes.DELETE("/:id/images/:imageId", recipeHandler.RemoveImage)
+		}
+
+		// Anyone may read recipe content; signed-in readers may get more of it
+		api.GET("/recipes/:id/content", middleware.AuthOptional(cfg.JWTSecret), recipeHandler.GetContent)
+
 		// Payment routes
 		payments := api.Group("/payments")
 		payments.Use(middleware.AuthRequired(cfg.JWTSecret))
@@ -97,6 +186,92 @@ func main() {
 			payments.POST("/initialize", paymentHandler.InitializePayment)
 			payments.POST("/verify", paymentHandler.VerifyPayment)
 			payments.GET("/status/:transactionId", paymentHandler.GetPaymentStatus)
+			payments.POST("/:transactionId/refund", paymentHandler.RefundPurchase)
+			payments.GET("/:transactionId/receipt", paymentHandler.GetReceipt)
+		}
+
+		// Payment provider callbacks authenticate with a signature instead of a JWT
+		api.POST("/payments/webhook/chapa", paymentHandler.ChapaWebhook)
+
+		// Hosted checkout page of the mock provider, for local development
+		if mock, ok := paymentProvider.(*services.MockPaymentProvider); ok {
+			mockCheckoutHandler := handlers.NewMockCheckoutHandler(mock, purchaseService, subscriptionService)
+			api.GET("/payments/mock/checkout/:txRef", mockCheckoutHandler.ShowCheckout)
+			api.POST("/payments/mock/checkout/:txRef", mockCheckoutHandler.CompleteCheckout)
+		}
+
+		// Gifts
+		gifts := api.Group("/gifts")
+		gifts.Use(middleware.AuthRequired(cfg.JWTSecret))
+		{
+			gifts.POST("/redeem", giftHandler.RedeemGift)
+		}
+
+		// Creator earnings
+		earnings := api.Group("/earnings")
+		earnings.Use(middleware.AuthRequired(cfg.JWTSecret))
+		{
+			earnings.GET("", earningsHandler.GetEarnings)
+		}
+
+		// Creator payouts
+		payouts := api.Group("/payouts")
+		payouts.Use(middleware.AuthRequired(cfg.JWTSecret))
+		{
+			payouts.GET("", payoutHandler.ListPayouts)
+			payouts.POST("", payoutHandler.RequestPayout)
+			payouts.GET("/accounts", payoutHandler.ListAccounts)
+			payouts.POST("/accounts", payoutHandler.AddAccount)
+			payouts.DELETE("/accounts/:accountId", payoutHandler.DeleteAccount)
+		}
+
+		// Coupons
+		coupons := api.Group("/coupons")
+		coupons.Use(middleware.AuthRequired(cfg.JWTSecret))
+		{
+			coupons.GET("", couponHandler.ListCoupons)
+			coupons.POST("", couponHandler.CreateCoupon)
+			coupons.POST("/:couponId/deactivate", couponHandler.DeactivateCoupon)
+		}
+
+		// Subscriptions
+		subscriptions := api.Group("/subscriptions")
+		subscriptions.Use(middleware.AuthRequired(cfg.JWTSecret))
+		{
+			subscriptions.GET("", subscriptionHandler.ListSubscriptions)
+			subscriptions.POST("", subscriptionHandler.Subscribe)
+			subscriptions.GET("/:subscriptionId", subscriptionHandler.GetSubscription)
+			subscriptions.POST("/:subscriptionId/renew", subscriptionHandler.Renew)
+			subscriptions.POST("/:subscriptionId/cancel", subscriptionHandler.Cancel)
+			subscriptions.POST("/plans", subscriptionHandler.CreatePlan)
+			subscriptions.POST("/plans/:planId/deactivate", subscriptionHandler.DeactivatePlan)
+		}
+
+		// Plans are public so they can be shown before signing in
+		api.GET("/subscriptions/plans", subscriptionHandler.ListPlans)
+
+		// Bundles
+		bundles := api.Group("/bundles")
+		bundles.Use(middleware.AuthRequired(cfg.JWTSecret))
+		{
+			bundles.POST("", bundleHandler.CreateBundle)
+			bundles.POST("/:bundleId/deactivate", bundleHandler.DeactivateBundle)
+		}
+
+		// Like plans, bundles can be browsed before signing in
+		api.GET("/bundles", bundleHandler.ListBundles)
+		api.GET("/bundles/:bundleId", bundleHandler.GetBundle)
+
+		// Admin routes
+		admin := api.Group("/admin")
+		admin.Use(middleware.AuthRequired(cfg.JWTSecret), middleware.AdminRequired(hasuraService))
+		{
+			admin.GET("/payouts", payoutHandler.ListQueue)
+			admin.POST("/payouts/:payoutId/approve", payoutHandler.ApprovePayout)
+			admin.POST("/payouts/:payoutId/reject", payoutHandler.RejectPayout)
+			admin.GET("/exchange-rates", exchangeRateHandler.ListRates)
+			admin.PUT("/exchange-rates", exchangeRateHandler.SetRate)
+			admin.POST("/exchange-rates/import", exchangeRateHandler.ImportRates)
 		}
 
 		// Notification routes
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"os"
+
+	"recipe-backend/internal/services"
+)
+
+// runReconciliation implements the "reconcile" subcommand, which verifies
+// pending purchases once and prints the report as JSON.
+func runReconciliation(reconciler *services.PurchaseReconciler) {
+	report, err := reconciler.Run(context.Background())
+	if err != nil {
+		log.Fatal("Purchase reconciliation failed:", err)
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(report); err != nil {
+		log.Fatal("Failed to write report:", err)
+	}
+
+	if len(report.Errors) > 0 || report.Aborted {
+		os.Exit(1)
+	}
+}
@@ -10,6 +10,7 @@ require (
 	github.com/hasura/go-graphql-client v0.10.0
 	github.com/joho/godotenv v1.5.1
 	golang.org/x/crypto v0.17.0
+	golang.org/x/image v0.14.0
 )
 
 require (
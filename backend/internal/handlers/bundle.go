@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+
+	"recipe-backend/internal/models"
+	"recipe-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type BundleHandler struct {
+	bundleService *services.BundleService
+	hasuraService *services.HasuraService
+}
+
+func NewBundleHandler(bundleService *services.BundleService, hasuraService *services.HasuraService) *BundleHandler {
+	return &BundleHandler{
+		bundleService: bundleService,
+		hasuraService: hasuraService,
+	}
+}
+
+// ListBundles returns the bundles on sale, optionally those of one chef.
+func (h *BundleHandler) ListBundles(c *gin.Context) {
+	bundles, err := h.hasuraService.ListBundles(context.Background(), c.Query("chef_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list bundles"})
+		return
+	}
+
+	if bundles == nil {
+		bundles = []services.Bundle{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"bundles": bundles})
+}
+
+// GetBundle returns a bundle on sale with its recipes in order.
+func (h *BundleHandler) GetBundle(c *gin.Context) {
+	bundle, recipes, err := h.bundleService.Get(context.Background(), c.Param("bundleId"))
+	switch {
+	case errors.Is(err, services.ErrBundleNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Bundle not found"})
+	case err != nil:
+		log.Printf("Failed to get bundle %s: %v", c.Param("bundleId"), err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get bundle"})
+	default:
+		if recipes == nil {
+			recipes = []services.Recipe{}
+		}
+		c.JSON(http.StatusOK, gin.H{"bundle": bundle, "recipes": recipes})
+	}
+}
+
+func (h *BundleHandler) CreateBundle(c *gin.Context) {
+	var req models.BundleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	bundle, err := h.bundleService.Create(context.Background(), services.Bundle{
+		ChefID:      c.GetString("user_id"),
+		Title:       req.Title,
+		Description: req.Description,
+		Price:       req.Price,
+		Currency:    req.Currency,
+		RecipeIDs:   req.RecipeIDs,
+	})
+	switch {
+	case errors.Is(err, services.ErrBundleInvalid):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrExchangeRateMissing), errors.Is(err, services.ErrExchangeRateStale):
+		log.Printf("Cannot compare bundle price with its recipes: %v", err)
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Bundles in this currency cannot be created right now"})
+	case err != nil:
+		log.Printf("Failed to create bundle: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create bundle"})
+	default:
+		c.JSON(http.StatusCreated, gin.H{"bundle": bundle})
+	}
+}
+
+func (h *BundleHandler) DeactivateBundle(c *gin.Context) {
+	bundle, err := h.bundleService.Deactivate(context.Background(), c.Param("bundleId"), c.GetString("user_id"))
+	switch {
+	case errors.Is(err, services.ErrBundleNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Bundle not found"})
+	case errors.Is(err, services.ErrBundleForbidden):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case err != nil:
+		log.Printf("Failed to deactivate bundle %s: %v", c.Param("bundleId"), err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to deactivate bundle"})
+	default:
+		c.JSON(http.StatusOK, gin.H{"bundle": bundle})
+	}
+}
@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+
+	"recipe-backend/internal/models"
+	"recipe-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type CouponHandler struct {
+	couponService *services.CouponService
+	hasuraService *services.HasuraService
+}
+
+func NewCouponHandler(couponService *services.CouponService, hasuraService *services.HasuraService) *CouponHandler {
+	return &CouponHandler{
+		couponService: couponService,
+		hasuraService: hasuraService,
+	}
+}
+
+// ListCoupons returns the coupons the caller created, newest first.
+func (h *CouponHandler) ListCoupons(c *gin.Context) {
+	limit, offset, ok := pagination(c)
+	if !ok {
+		return
+	}
+
+	coupons, err := h.hasuraService.ListCoupons(context.Background(), c.GetString("user_id"), limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list coupons"})
+		return
+	}
+
+	if coupons == nil {
+		coupons = []services.Coupon{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"coupons": coupons})
+}
+
+func (h *CouponHandler) CreateCoupon(c *gin.Context) {
+	var req models.CouponRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	coupon, err := h.couponService.Create(context.Background(), services.Coupon{
+		Code:           req.Code,
+		CreatedBy:      c.GetString("user_id"),
+		DiscountType:   req.DiscountType,
+		DiscountValue:  req.DiscountValue,
+		Currency:       req.Currency,
+		Scope:          req.Scope,
+		RecipeID:       req.RecipeID,
+		ExpiresAt:      req.ExpiresAt,
+		MaxUses:        req.MaxUses,
+		MaxUsesPerUser: req.MaxUsesPerUser,
+	})
+	switch {
+	case errors.Is(err, services.ErrCouponInvalid):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrCouponForbidden):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case err != nil:
+		log.Printf("Failed to create coupon: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create coupon"})
+	default:
+		c.JSON(http.StatusCreated, gin.H{"coupon": coupon})
+	}
+}
+
+func (h *CouponHandler) DeactivateCoupon(c *gin.Context) {
+	coupon, err := h.couponService.Deactivate(context.Background(), c.Param("couponId"), c.GetString("user_id"))
+	switch {
+	case errors.Is(err, services.ErrCouponNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Coupon not found"})
+	case errors.Is(err, services.ErrCouponForbidden):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case err != nil:
+		log.Printf("Failed to deactivate coupon %s: %v", c.Param("couponId"), err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to deactivate coupon"})
+	default:
+		c.JSON(http.StatusOK, gin.H{"coupon": coupon})
+	}
+}
@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+
+	"recipe-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type EarningsHandler struct {
+	ledgerService *services.LedgerService
+}
+
+func NewEarningsHandler(ledgerService *services.LedgerService) *EarningsHandler {
+	return &EarningsHandler{
+		ledgerService: ledgerService,
+	}
+}
+
+// GetEarnings returns the caller's earnings from recipe sales: the balance
+// available for payout, earnings still on hold, and their ledger history.
+func (h *EarningsHandler) GetEarnings(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	limit, offset, ok := pagination(c)
+	if !ok {
+		return
+	}
+
+	earnings, err := h.ledgerService.Earnings(context.Background(), userID.(string), limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get earnings"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"balance":            earnings.Balance,
+		"pending":            earnings.Pending,
+		"currency":           earnings.Currency,
+		"commission_percent": earnings.CommissionPercent,
+		"history":            earnings.History,
+		"limit":              limit,
+		"offset":             offset,
+	})
+}
@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+
+	"recipe-backend/internal/models"
+	"recipe-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Rate sheets are a handful of rows; anything larger is a mistake
+const maxRatesCSVSize = 64 << 10
+
+type ExchangeRateHandler struct {
+	currencyService *services.CurrencyService
+	hasuraService   *services.HasuraService
+}
+
+func NewExchangeRateHandler(currencyService *services.CurrencyService, hasuraService *services.HasuraService) *ExchangeRateHandler {
+	return &ExchangeRateHandler{
+		currencyService: currencyService,
+		hasuraService:   hasuraService,
+	}
+}
+
+func (h *ExchangeRateHandler) ListRates(c *gin.Context) {
+	rates, err := h.hasuraService.ListExchangeRates(context.Background())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list exchange rates"})
+		return
+	}
+
+	if rates == nil {
+		rates = []services.ExchangeRate{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"rates": rates})
+}
+
+// SetRate sets the rate of one currency pair.
+func (h *ExchangeRateHandler) SetRate(c *gin.Context) {
+	var req models.ExchangeRateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	h.save(c, []services.ExchangeRate{{
+		BaseCurrency:  req.BaseCurrency,
+		QuoteCurrency: req.QuoteCurrency,
+		Rate:          req.Rate,
+	}}, services.ExchangeRateSourceAdmin)
+}
+
+// ImportRates sets rates from a CSV sheet of base currency, quote currency
+// and rate, uploaded as the "file" form field or sent as the request body.
+func (h *ExchangeRateHandler) ImportRates(c *gin.Context) {
+	var reader io.Reader
+	if strings.HasPrefix(c.ContentType(), "multipart/") {
+		header, err := c.FormFile("file")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "No file uploaded"})
+			return
+		}
+		if header.Size > maxRatesCSVSize {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Rate sheet is too large"})
+			return
+		}
+
+		file, err := header.Open()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read uploaded file"})
+			return
+		}
+		defer file.Close()
+		reader = file
+	} else {
+		reader = io.LimitReader(c.Request.Body, maxRatesCSVSize)
+	}
+
+	rates, err := services.ParseRatesCSV(reader)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	h.save(c, rates, services.ExchangeRateSourceCSV)
+}
+
+func (h *ExchangeRateHandler) save(c *gin.Context, rates []services.ExchangeRate, source string) {
+	saved, err := h.currencyService.SetRates(context.Background(), rates, source, c.GetString("user_id"))
+	switch {
+	case errors.Is(err, services.ErrExchangeRateInvalid), errors.Is(err, services.ErrUnsupportedCurrency):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case err != nil:
+		log.Printf("Failed to save exchange rates: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save exchange rates"})
+	default:
+		c.JSON(http.StatusOK, gin.H{"rates": saved})
+	}
+}
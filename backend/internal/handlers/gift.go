@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+
+	"recipe-backend/internal/models"
+	"recipe-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type GiftHandler struct {
+	giftService *services.GiftService
+}
+
+func NewGiftHandler(giftService *services.GiftService) *GiftHandler {
+	return &GiftHandler{
+		giftService: giftService,
+	}
+}
+
+// RedeemGift gives the caller access to the recipe of a gift code.
+func (h *GiftHandler) RedeemGift(c *gin.Context) {
+	var req models.RedeemGiftRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	purchase, recipe, err := h.giftService.Redeem(context.Background(), c.GetString("user_id"), req.Code)
+	switch {
+	case errors.Is(err, services.ErrGiftNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Gift not found"})
+	case errors.Is(err, services.ErrGiftRedeemed),
+		errors.Is(err, services.ErrGiftAlreadyOwned):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrGiftNotPaid),
+		errors.Is(err, services.ErrGiftExpired),
+		errors.Is(err, services.ErrGiftRefunded):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+	case err != nil:
+		log.Printf("Failed to redeem gift: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to redeem gift"})
+	default:
+		c.JSON(http.StatusOK, gin.H{
+			"recipe_id":    recipe.ID,
+			"recipe_title": recipe.Title,
+			"redeemed_at":  purchase.RedeemedAt,
+		})
+	}
+}
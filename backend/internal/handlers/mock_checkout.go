@@ -0,0 +1,148 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"html/template"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"recipe-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Longest delay the mock checkout page will simulate
+const maxMockPaymentDelay = 10 * time.Minute
+
+// MockCheckoutHandler serves the hosted checkout page of the mock payment
+// provider. Submitting the page settles the purchase or subscription
+// payment the way Chapa's webhook would, then sends the payer back to the
+// return URL.
+type MockCheckoutHandler struct {
+	provider            *services.MockPaymentProvider
+	purchaseService     *services.PurchaseService
+	subscriptionService *services.SubscriptionService
+}
+
+func NewMockCheckoutHandler(provider *services.MockPaymentProvider, purchaseService *services.PurchaseService, subscriptionService *services.SubscriptionService) *MockCheckoutHandler {
+	return &MockCheckoutHandler{
+		provider:            provider,
+		purchaseService:     purchaseService,
+		subscriptionService: subscriptionService,
+	}
+}
+
+var mockCheckoutPage = template.Must(template.New("checkout").Parse(`<!DOCTYPE html>
+<html>
+<head>
+	<meta charset="utf-8">
+	<title>Mock checkout</title>
+	<style>
+		body { font-family: sans-serif; max-width: 420px; margin: 40px auto; color: #222; }
+		.note { background: #fff4d6; padding: 8px 12px; border-radius: 4px; font-size: 14px; }
+		button { display: block; width: 100%; padding: 10px; margin: 8px 0; font-size: 16px; cursor: pointer; }
+		input { width: 60px; }
+	</style>
+</head>
+<body>
+	<p class="note">Mock payment provider &mdash; no money is charged.</p>
+	<h1>{{printf "%.2f" .Amount}} {{.Currency}}</h1>
+	<p>{{.Description}}<br>{{.Email}}<br><small>{{.TxRef}}</small></p>
+	{{if eq .Status "pending"}}{{if .SettlesAt.IsZero}}
+	<form method="post">
+		<button name="outcome" value="success">Pay</button>
+		<button name="outcome" value="failed">Decline</button>
+		<p><label>Delay <input name="delay" type="number" min="1" value="30"> seconds</label></p>
+		<button name="outcome" value="delayed">Pay after the delay</button>
+	</form>
+	{{else}}
+	<p>Payment is processing and will succeed at {{.SettlesAt.Format "15:04:05"}}.</p>
+	{{end}}{{else}}
+	<p>Payment {{.Status}}.</p>
+	{{end}}
+	{{if .ReturnURL}}<p><a href="{{.ReturnURL}}">Return to merchant</a></p>{{end}}
+</body>
+</html>
+`))
+
+func (h *MockCheckoutHandler) ShowCheckout(c *gin.Context) {
+	tx, err := h.provider.Transaction(c.Param("txRef"))
+	if err != nil {
+		c.String(http.StatusNotFound, "Unknown transaction")
+		return
+	}
+
+	h.render(c, http.StatusOK, tx)
+}
+
+func (h *MockCheckoutHandler) CompleteCheckout(c *gin.Context) {
+	txRef := c.Param("txRef")
+	outcome := c.PostForm("outcome")
+
+	var delay time.Duration
+	if outcome == services.MockOutcomeDelayed {
+		seconds, err := strconv.Atoi(c.DefaultPostForm("delay", "30"))
+		if err != nil || seconds < 1 || time.Duration(seconds)*time.Second > maxMockPaymentDelay {
+			c.String(http.StatusBadRequest, "Delay must be between 1 second and %s", maxMockPaymentDelay)
+			return
+		}
+		delay = time.Duration(seconds) * time.Second
+	}
+
+	tx, err := h.provider.Complete(txRef, outcome, delay)
+	if errors.Is(err, services.ErrMockTransactionNotFound) {
+		c.String(http.StatusNotFound, "Unknown transaction")
+		return
+	}
+	if err != nil {
+		c.String(http.StatusConflict, err.Error())
+		return
+	}
+
+	// Deliver the outcome the way a provider webhook would
+	if delay > 0 {
+		time.AfterFunc(delay, func() { h.settle(txRef) })
+	} else {
+		go h.settle(txRef)
+	}
+
+	if tx.ReturnURL == "" {
+		h.render(c, http.StatusOK, tx)
+		return
+	}
+
+	c.Redirect(http.StatusSeeOther, tx.ReturnURL)
+}
+
+func (h *MockCheckoutHandler) settle(txRef string) {
+	if strings.HasPrefix(txRef, services.SubscriptionTxPrefix) {
+		payment, err := h.subscriptionService.Settle(context.Background(), txRef)
+		if err != nil {
+			log.Printf("Mock provider failed to settle %s: %v", txRef, err)
+			return
+		}
+
+		log.Printf("Mock provider settled %s: subscription payment is %s", txRef, payment.Status)
+		return
+	}
+
+	purchase, err := h.purchaseService.Settle(context.Background(), txRef)
+	if err != nil {
+		log.Printf("Mock provider failed to settle %s: %v", txRef, err)
+		return
+	}
+
+	log.Printf("Mock provider settled %s: purchase is %s", txRef, purchase.Status)
+}
+
+func (h *MockCheckoutHandler) render(c *gin.Context, status int, tx *services.MockTransaction) {
+	c.Status(status)
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	if err := mockCheckoutPage.Execute(c.Writer, tx); err != nil {
+		log.Printf("Failed to render mock checkout page: %v", err)
+	}
+}
@@ -1,10 +1,14 @@
 package handlers
 
 import (
+	"bytes"
 	"context"
+	"encoding/base64"
 	"fmt"
+	"mime/multipart"
 	"net/http"
 	"net/smtp"
+	"net/textproto"
 	"os"
 	"strings"
 	"text/template"
@@ -24,6 +28,18 @@ func NewNotificationHandler(hasuraService *services.HasuraService) *Notification
 	}
 }
 
+// serverEmailTypes are only sent for server events, through Notify and
+// NotifyWithAttachments, with data taken from our own records. Clients cannot
+// send them, or anyone could mail such an email with links of their choosing.
+var serverEmailTypes = map[string]bool{
+	"purchase_gift":         true,
+	"purchase_refunded":     true,
+	"recipe_refunded":       true,
+	"subscription_renewal":  true,
+	"subscription_past_due": true,
+	"subscription_expired":  true,
+}
+
 type EmailNotificationRequest struct {
 	RecipientEmail string                 `json:"recipient_email" binding:"required,email"`
 	Type           string                 `json:"type" binding:"required"`
@@ -38,12 +54,17 @@ func (h *NotificationHandler) SendEmailNotification(c *gin.Context) {
 	}
 
 	// Get user ID from context
-	userID, exists := c.Get("user_id")
+	_, exists := c.Get("user_id")
 	if !exists {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
 		return
 	}
 
+	if serverEmailTypes[req.Type] {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid email type or data"})
+		return
+	}
+
 	// Generate email content based on type
 	subject, body, err := h.generateEmailContent(req.Type, req.Data)
 	if err != nil {
@@ -64,6 +85,38 @@ func (h *NotificationHandler) SendEmailNotification(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "Email notification sent successfully"})
 }
 
+// Notify renders an email template, queues it and sends it in the
+// background. Other handlers use it for emails triggered by server events.
+func (h *NotificationHandler) Notify(ctx context.Context, recipientEmail, emailType string, data map[string]interface{}) error {
+	subject, body, err := h.generateEmailContent(emailType, data)
+	if err != nil {
+		return err
+	}
+
+	if err := h.queueEmail(ctx, recipientEmail, subject, body, emailType, data); err != nil {
+		return err
+	}
+
+	go h.sendEmail(recipientEmail, subject, body)
+	return nil
+}
+
+// NotifyWithAttachments is Notify for emails that carry files, such as the
+// invoice sent with a purchase confirmation. Only the text is queued.
+func (h *NotificationHandler) NotifyWithAttachments(ctx context.Context, recipientEmail, emailType string, data map[string]interface{}, attachments []services.EmailAttachment) error {
+	subject, body, err := h.generateEmailContent(emailType, data)
+	if err != nil {
+		return err
+	}
+
+	if err := h.queueEmail(ctx, recipientEmail, subject, body, emailType, data); err != nil {
+		return err
+	}
+
+	go h.sendEmail(recipientEmail, subject, body, attachments...)
+	return nil
+}
+
 func (h *NotificationHandler) generateEmailContent(emailType string, data map[string]interface{}) (string, string, error) {
 	templates := map[string]struct {
 		subject  string
@@ -128,7 +181,7 @@ The RecipeHub Team
 			template: `
 Hello,
 
-Congratulations! {{.purchased_by_name}} (@{{.purchased_by_username}}) just purchased your premium recipe "{{.recipe_title}}" for ${{.amount}}.
+Congratulations! {{.purchased_by_name}} (@{{.purchased_by_username}}) just purchased your premium recipe "{{.recipe_title}}" for {{.amount}} {{or .currency "ETB"}}.
 
 View your recipe: https://recipehub.com/recipes/{{.recipe_id}}
 
@@ -141,13 +194,100 @@ The RecipeHub Team
 			template: `
 Hello,
 
-Thank you for your purchase! You now have access to the premium recipe "{{.recipe_title}}" by {{.seller_name}}.
+{{if .gift_code}}Thank you for your purchase! We have sent the premium recipe "{{.recipe_title}}" by {{.seller_name}} as a gift to {{.recipient_email}}.
 
-Amount paid: ${{.amount}}
+Gift code: {{.gift_code}}
+It can be redeemed until {{.gift_expires_at}}. If nobody redeems it by then, you can ask for a refund.
+{{else if .bundle_id}}Thank you for your purchase! You now have access to every recipe in the bundle "{{.recipe_title}}" by {{.seller_name}}.
+{{else}}Thank you for your purchase! You now have access to the premium recipe "{{.recipe_title}}" by {{.seller_name}}.
+{{end}}
+Amount paid: {{.amount}} {{or .currency "ETB"}}
+{{if .invoice_number}}
+Your invoice {{.invoice_number}} is attached.
+{{end}}
+{{if .bundle_id}}View your recipes: https://recipehub.com/bundles/{{.bundle_id}}{{else}}View your recipe: https://recipehub.com/recipes/{{.recipe_id}}{{end}}
 
-View your recipe: https://recipehub.com/recipes/{{.recipe_id}}
+Enjoy cooking!
+The RecipeHub Team
+			`,
+		},
+		"purchase_gift": {
+			subject: "You received a recipe as a gift - RecipeHub",
+			template: `
+Hello,
+
+{{.sender_name}} has given you the premium recipe "{{.recipe_title}}" by {{.seller_name}}.
+{{if .gift_message}}
+"{{.gift_message}}"
+{{end}}
+Your gift code: {{.gift_code}}
+
+Sign in or create an account and redeem it until {{.gift_expires_at}}: https://recipehub.com/gifts/redeem?code={{.gift_code}}
 
 Enjoy cooking!
+The RecipeHub Team
+			`,
+		},
+		"purchase_refunded": {
+			subject: "Your refund has been processed - RecipeHub",
+			template: `
+Hello,
+
+We have refunded {{.amount}} {{or .currency "ETB"}} of your purchase of "{{.recipe_title}}".
+
+Reason: {{.reason}}
+{{if .access_revoked}}
+{{if .bundle_id}}Your access to the recipes in this bundle has ended.{{else}}Your access to this premium recipe has ended.{{end}}
+{{end}}
+The refund should reach your account within a few business days.
+
+The RecipeHub Team
+			`,
+		},
+		"recipe_refunded": {
+			subject: "A purchase of your recipe was refunded",
+			template: `
+Hello,
+
+A purchase of your {{if .bundle_id}}bundle{{else}}premium recipe{{end}} "{{.recipe_title}}" by {{.buyer_name}} was refunded: {{.amount}} {{or .currency "ETB"}}.
+
+Reason: {{.reason}}
+
+The RecipeHub Team
+			`,
+		},
+		"subscription_renewal": {
+			subject: "Renew your RecipeHub subscription",
+			template: `
+Hello {{.user_name}},
+
+Your subscription "{{.plan_name}}" ends on {{.period_end}}. To keep your access to premium recipes, pay {{.amount}} ETB for the next period:
+
+{{.checkout_url}}
+
+Happy cooking!
+The RecipeHub Team
+			`,
+		},
+		"subscription_past_due": {
+			subject: "Your RecipeHub subscription payment is overdue",
+			template: `
+Hello {{.user_name}},
+
+We have not received the renewal payment for your subscription "{{.plan_name}}". You keep your access until {{.grace_until}}; after that the subscription ends.
+
+You can pay from your subscriptions page: https://recipehub.com/subscriptions/{{.subscription_id}}
+
+The RecipeHub Team
+			`,
+		},
+		"subscription_expired": {
+			subject: "Your RecipeHub subscription has ended",
+			template: `
+Hello {{.user_name}},
+
+Your subscription "{{.plan_name}}" has ended because the renewal was not paid. You can subscribe again at any time.
+
 The RecipeHub Team
 			`,
 		},
@@ -197,7 +337,7 @@ func (h *NotificationHandler) queueEmail(ctx context.Context, recipientEmail, su
 	return err
 }
 
-func (h *NotificationHandler) sendEmail(to, subject, body string) error {
+func (h *NotificationHandler) sendEmail(to, subject, body string, attachments ...services.EmailAttachment) error {
 	// Email configuration from environment variables
 	smtpHost := os.Getenv("SMTP_HOST")
 	smtpPort := os.Getenv("SMTP_PORT")
@@ -208,11 +348,22 @@ func (h *NotificationHandler) sendEmail(to, subject, body string) error {
 	if smtpHost == "" || smtpPort == "" || smtpUser == "" || smtpPass == "" {
 		// If SMTP is not configured, just log the email (for development)
 		fmt.Printf("EMAIL NOTIFICATION:\nTo: %s\nSubject: %s\nBody: %s\n", to, subject, body)
+		for _, attachment := range attachments {
+			fmt.Printf("Attachment: %s (%s, %d bytes)\n", attachment.Filename, attachment.ContentType, len(attachment.Content))
+		}
 		return nil
 	}
 
 	// Create message
 	msg := []byte(fmt.Sprintf("To: %s\r\nSubject: %s\r\n\r\n%s\r\n", to, subject, body))
+	if len(attachments) > 0 {
+		var err error
+		msg, err = multipartMessage(to, subject, body, attachments)
+		if err != nil {
+			fmt.Printf("Failed to build email: %v\n", err)
+			return err
+		}
+	}
 
 	// SMTP authentication
 	auth := smtp.PlainAuth("", smtpUser, smtpPass, smtpHost)
@@ -232,4 +383,48 @@ func (h *NotificationHandler) sendEmail(to, subject, body string) error {
 func (h *NotificationHandler) ProcessEmailQueue() {
 	// This would be implemented as a background worker
 	// For now, emails are sent immediately in the SendEmailNotification handler
+}
+
+// multipartMessage builds a MIME message with the body as its first part and
+// each attachment base64-encoded after it.
+func multipartMessage(to, subject, body string, attachments []services.EmailAttachment) ([]byte, error) {
+	var parts bytes.Buffer
+	writer := multipart.NewWriter(&parts)
+
+	text, err := writer.CreatePart(textproto.MIMEHeader{"Content-Type": {"text/plain; charset=utf-8"}})
+	if err != nil {
+		return nil, err
+	}
+	if _, err := text.Write([]byte(body)); err != nil {
+		return nil, err
+	}
+
+	for _, attachment := range attachments {
+		part, err := writer.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {attachment.ContentType},
+			"Content-Transfer-Encoding": {"base64"},
+			"Content-Disposition":       {fmt.Sprintf("attachment; filename=%q", attachment.Filename)},
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		// Base64 lines may be at most 76 characters long
+		encoded := base64.StdEncoding.EncodeToString(attachment.Content)
+		for len(encoded) > 76 {
+			fmt.Fprintf(part, "%s\r\n", encoded[:76])
+			encoded = encoded[76:]
+		}
+		fmt.Fprintf(part, "%s\r\n", encoded)
+	}
+
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "To: %s\r\nSubject: %s\r\nMIME-Version: 1.0\r\n", to, subject)
+	fmt.Fprintf(&msg, "Content-Type: multipart/mixed; boundary=%s\r\n\r\n", writer.Boundary())
+	msg.Write(parts.Bytes())
+	return msg.Bytes(), nil
 }
\ No newline at end of file
@@ -0,0 +1,38 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Emails for server events cannot be sent through the API. The handler has
+// no Hasura client, so a request that got past the check would panic.
+func TestSendEmailNotificationRejectsServerEmails(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	h := NewNotificationHandler(nil)
+	router := gin.New()
+	router.POST("/notifications/email", func(c *gin.Context) {
+		c.Set("user_id", "user-1")
+		h.SendEmailNotification(c)
+	})
+
+	for emailType := range serverEmailTypes {
+		t.Run(emailType, func(t *testing.T) {
+			body := `{"recipient_email": "victim@example.com", "type": "` + emailType + `", "data": {"checkout_url": "https://evil.example.com"}}`
+			req := httptest.NewRequest(http.MethodPost, "/notifications/email", strings.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+
+			router.ServeHTTP(w, req)
+
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("status = %d, want %d", w.Code, http.StatusBadRequest)
+			}
+		})
+	}
+}
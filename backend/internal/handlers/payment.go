@@ -2,9 +2,20 @@ package handlers
 
 import (
 	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"log"
+	"math"
 	"net/http"
+	"strings"
+	"time"
 
+	"recipe-backend/internal/config"
 	"recipe-backend/internal/models"
 	"recipe-backend/internal/services"
 
@@ -13,14 +24,32 @@ import (
 )
 
 type PaymentHandler struct {
-	chapaService  *services.ChapaService
-	hasuraService *services.HasuraService
+	config              *config.Config
+	paymentProvider     services.PaymentProvider
+	purchaseService     *services.PurchaseService
+	refundService       *services.RefundService
+	couponService       *services.CouponService
+	currencyService     *services.CurrencyService
+	subscriptionService *services.SubscriptionService
+	bundleService       *services.BundleService
+	invoiceService      *services.InvoiceService
+	hasuraService       *services.HasuraService
+	notificationHandler *NotificationHandler
 }
 
-func NewPaymentHandler(chapaService *services.ChapaService, hasuraService *services.HasuraService) *PaymentHandler {
+func NewPaymentHandler(cfg *config.Config, paymentProvider services.PaymentProvider, purchaseService *services.PurchaseService, refundService *services.RefundService, couponService *services.CouponService, currencyService *services.CurrencyService, subscriptionService *services.SubscriptionService, bundleService *services.BundleService, invoiceService *services.InvoiceService, hasuraService *services.HasuraService, notificationHandler *NotificationHandler) *PaymentHandler {
 	return &PaymentHandler{
-		chapaService:  chapaService,
-		hasuraService: hasuraService,
+		config:              cfg,
+		paymentProvider:     paymentProvider,
+		purchaseService:     purchaseService,
+		refundService:       refundService,
+		couponService:       couponService,
+		currencyService:     currencyService,
+		subscriptionService: subscriptionService,
+		bundleService:       bundleService,
+		invoiceService:      invoiceService,
+		hasuraService:       hasuraService,
+		notificationHandler: notificationHandler,
 	}
 }
 
@@ -38,46 +67,475 @@ func (h *PaymentHandler) InitializePayment(c *gin.Context) {
 		return
 	}
 
+	// A recipient email makes the purchase a gift
+	recipientEmail := strings.ToLower(strings.TrimSpace(req.RecipientEmail))
+
+	if req.BundleID != "" && (recipientEmail != "" || req.CouponCode != "") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Bundles cannot be bought as gifts or with coupons"})
+		return
+	}
+
+	// The charge always comes from the recipe or bundle, never from the
+	// client
+	var purchase services.CreatePurchaseInput
+	var item string
+	if req.BundleID != "" {
+		bundle, ok := h.purchasableBundle(c, userID.(string), req.BundleID)
+		if !ok {
+			return
+		}
+
+		if req.Amount > 0 && math.Abs(req.Amount-bundle.Price) >= 0.005 {
+			c.JSON(http.StatusConflict, gin.H{
+				"error":    "Bundle price has changed",
+				"price":    bundle.Price,
+				"currency": bundle.Currency,
+			})
+			return
+		}
+
+		purchase = services.CreatePurchaseInput{
+			UserID:       userID.(string),
+			BundleID:     bundle.ID,
+			Amount:       bundle.Price,
+			Status:       services.PurchasePending,
+			ListPrice:    bundle.Price,
+			ListCurrency: bundle.Currency,
+		}
+		item = "bundle " + bundle.ID
+	} else {
+		recipe, ok := h.purchasableRecipe(c, userID.(string), req.RecipeID, recipientEmail != "")
+		if !ok {
+			return
+		}
+
+		if req.Amount > 0 && math.Abs(req.Amount-recipe.Price) >= 0.005 {
+			c.JSON(http.StatusConflict, gin.H{
+				"error":    "Recipe price has changed",
+				"price":    recipe.Price,
+				"currency": recipe.Currency,
+			})
+			return
+		}
+
+		// The coupon, if any, decides what is charged
+		purchase = services.CreatePurchaseInput{
+			UserID:       userID.(string),
+			RecipeID:     recipe.ID,
+			Amount:       recipe.Price,
+			Status:       services.PurchasePending,
+			ListPrice:    recipe.Price,
+			ListCurrency: recipe.Currency,
+		}
+		if recipientEmail != "" {
+			purchase.RecipientEmail = recipientEmail
+			purchase.GiftMessage = strings.TrimSpace(req.GiftMessage)
+		}
+
+		if req.CouponCode != "" {
+			quote, ok := h.applyCoupon(c, req.CouponCode, userID.(string), recipe)
+			if !ok {
+				return
+			}
+
+			purchase.Amount = quote.Amount
+			purchase.CouponID = quote.Coupon.ID
+			purchase.OriginalAmount = quote.Price
+			purchase.DiscountAmount = quote.Discount
+		}
+		item = "recipe " + recipe.ID
+	}
+
+	ctx := context.Background()
+
+	// The buyer may pay in another currency than the item is priced in
+	currency := req.Currency
+	if currency == "" {
+		currency = purchase.ListCurrency
+	}
+
+	converted, ok := h.convertPrice(c, purchase.Amount, purchase.ListCurrency, currency)
+	if !ok {
+		return
+	}
+
+	purchase.Amount = converted.Amount
+	purchase.Currency = converted.Currency
+	purchase.ExchangeRate = converted.Rate
+	purchase.SettlementAmount = converted.Settlement
+	if purchase.CouponID != "" {
+		purchase.OriginalAmount = converted.Convert(purchase.OriginalAmount)
+		purchase.DiscountAmount = math.Round((purchase.OriginalAmount-purchase.Amount)*100) / 100
+	}
+
+	// Retries of the same request return the checkout it started
+	idempotencyKey := strings.TrimSpace(c.GetHeader("Idempotency-Key"))
+	if len(idempotencyKey) > 255 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Idempotency-Key must be at most 255 characters"})
+		return
+	}
+
+	if idempotencyKey != "" {
+		existing, err := h.hasuraService.GetPurchaseByIdempotencyKey(ctx, userID.(string), idempotencyKey)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to look up purchase"})
+			return
+		}
+
+		if existing != nil {
+			if mismatch := idempotencyMismatch(existing, purchase); mismatch != "" {
+				c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Idempotency-Key was already used for a different " + mismatch})
+				return
+			}
+			h.respondWithCheckout(c, existing)
+			return
+		}
+	}
+
+	// Buying the same recipe or bundle again continues the open checkout,
+	// unless the price, coupon or currency has changed since it was started
+	pending, err := h.hasuraService.GetPendingPurchase(ctx, purchase)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to look up purchase"})
+		return
+	}
+
+	if pending != nil {
+		if math.Abs(pending.Amount-purchase.Amount) < 0.005 && pending.CouponID == purchase.CouponID &&
+			pending.Currency == purchase.Currency && !initializationStalled(pending) {
+			h.respondWithCheckout(c, pending)
+			return
+		}
+
+		err := h.purchaseService.Replace(ctx, pending)
+		switch {
+		case errors.Is(err, services.ErrCheckoutPaid), errors.Is(err, services.ErrPurchaseConflict):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "transaction_id": pending.TransactionID})
+			return
+		case err != nil:
+			log.Printf("Failed to replace pending purchase %s: %v", pending.TransactionID, err)
+			c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to verify the earlier checkout, please try again"})
+			return
+		}
+	}
+
 	// Generate transaction reference
 	txRef := uuid.New().String()
+	purchase.TransactionID = txRef
+	purchase.IdempotencyKey = idempotencyKey
+
+	// The code is only sent to the recipient once the gift is paid for
+	if purchase.RecipientEmail != "" {
+		code, err := services.NewGiftCode()
+		if err != nil {
+			log.Printf("Failed to create gift code for %s: %v", item, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create gift"})
+			return
+		}
+		purchase.GiftCode = code
+		purchase.GiftExpiresAt = time.Now().Add(h.config.GiftRedeemPeriod).UTC().Format(time.RFC3339Nano)
+	}
+
+	// Nothing to pay: the purchase completes without a checkout
+	if purchase.Amount < 0.005 {
+		purchase.Amount = 0
+		purchase.SettlementAmount = 0
+		purchase.Status = services.PurchaseCompleted
+		if err := h.hasuraService.CreatePurchase(ctx, purchase); err != nil {
+			if limitErr := services.CouponLimitError(err); limitErr != nil {
+				c.JSON(http.StatusUnprocessableEntity, gin.H{"error": limitErr.Error()})
+				return
+			}
+			log.Printf("Failed to create free purchase for %s: %v", item, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create purchase record"})
+			return
+		}
+
+		if completed, err := h.hasuraService.GetPurchaseByTransactionID(ctx, txRef); err == nil && completed != nil {
+			h.purchaseService.Confirm(ctx, completed)
+		} else {
+			log.Printf("Failed to look up free purchase %s to confirm it: %v", txRef, err)
+		}
+
+		body := gin.H{
+			"transaction_id":  txRef,
+			"purchase_status": services.PurchaseCompleted,
+			"amount":          0,
+			"currency":        purchase.Currency,
+			"original_amount": purchase.OriginalAmount,
+			"discount":        purchase.DiscountAmount,
+		}
+		if purchase.RecipientEmail != "" {
+			body["recipient_email"] = purchase.RecipientEmail
+		}
+
+		c.JSON(http.StatusOK, body)
+		return
+	}
+
+	// Record the purchase before contacting the provider so no checkout exists
+	// without a purchase
+	purchase.PaymentProvider = h.paymentProvider.Name()
+	err = h.hasuraService.CreatePurchase(ctx, purchase)
+
+	if err != nil {
+		// A concurrent request for the same item may have won the race
+		if pending, lookupErr := h.hasuraService.GetPendingPurchase(ctx, purchase); lookupErr == nil && pending != nil {
+			h.respondWithCheckout(c, pending)
+			return
+		}
 
-	// Initialize payment with Chapa
-	chapaReq := services.InitializePaymentRequest{
-		Amount:      fmt.Sprintf("%.2f", req.Amount),
-		Currency:    "ETB",
+		if limitErr := services.CouponLimitError(err); limitErr != nil {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": limitErr.Error()})
+			return
+		}
+
+		log.Printf("Failed to create purchase for %s: %v", item, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create purchase record"})
+		return
+	}
+
+	description := "Recipe Purchase"
+	switch {
+	case purchase.BundleID != "":
+		description = "Recipe Bundle"
+	case purchase.RecipientEmail != "":
+		description = "Recipe Gift"
+	}
+
+	// Initialize payment with the provider
+	paymentReq := services.InitializePaymentRequest{
+		Amount:      fmt.Sprintf("%.2f", purchase.Amount),
+		Currency:    purchase.Currency,
 		Email:       c.GetString("user_email"),
 		FirstName:   "Recipe",
 		LastName:    "User",
 		TxRef:       txRef,
 		CallbackURL: req.CallbackURL,
 		ReturnURL:   req.ReturnURL,
-		Description: "Recipe Purchase",
+		Description: description,
 	}
 
-	response, err := h.chapaService.InitializePayment(chapaReq)
+	response, err := h.paymentProvider.InitializePayment(paymentReq)
 	if err != nil {
+		log.Printf("Failed to initialize payment %s: %v", txRef, err)
+		if _, err := h.hasuraService.FailPendingPurchase(ctx, txRef); err != nil {
+			log.Printf("Failed to mark purchase %s as failed: %v", txRef, err)
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to initialize payment"})
 		return
 	}
 
-	// Create purchase record in database
-	err = h.hasuraService.CreatePurchase(context.Background(), services.CreatePurchaseInput{
-		UserID:        userID.(string),
-		RecipeID:      req.RecipeID,
-		Amount:        req.Amount,
-		TransactionID: txRef,
-		Status:        "pending",
-	})
-
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create purchase record"})
-		return
+	if err := h.hasuraService.SetPurchaseCheckoutURL(ctx, txRef, response.Data.CheckoutURL); err != nil {
+		// The checkout still works; only retries will not find it
+		log.Printf("Failed to save checkout URL for purchase %s: %v", txRef, err)
 	}
 
-	c.JSON(http.StatusOK, gin.H{
+	body := gin.H{
 		"checkout_url":   response.Data.CheckoutURL,
 		"transaction_id": txRef,
-	})
+		"amount":         purchase.Amount,
+		"currency":       purchase.Currency,
+	}
+	if purchase.Currency != purchase.ListCurrency {
+		body["list_price"] = purchase.ListPrice
+		body["list_currency"] = purchase.ListCurrency
+		body["exchange_rate"] = purchase.ExchangeRate
+	}
+	if purchase.CouponID != "" {
+		body["original_amount"] = purchase.OriginalAmount
+		body["discount"] = purchase.DiscountAmount
+	}
+	if purchase.RecipientEmail != "" {
+		body["recipient_email"] = purchase.RecipientEmail
+	}
+	if purchase.BundleID != "" {
+		body["bundle_id"] = purchase.BundleID
+	}
+
+	c.JSON(http.StatusOK, body)
+}
+
+// applyCoupon prices the recipe with the given coupon code.
+func (h *PaymentHandler) applyCoupon(c *gin.Context, code, userID string, recipe *services.Recipe) (*services.CouponQuote, bool) {
+	quote, err := h.couponService.Apply(context.Background(), code, userID, recipe)
+	switch {
+	case errors.Is(err, services.ErrCouponNotFound):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Coupon not found"})
+	case errors.Is(err, services.ErrCouponExpired),
+		errors.Is(err, services.ErrCouponNotApplicable),
+		errors.Is(err, services.ErrCouponExhausted),
+		errors.Is(err, services.ErrCouponUserLimit):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrExchangeRateMissing), errors.Is(err, services.ErrExchangeRateStale):
+		log.Printf("Cannot convert coupon %q for recipe %s: %v", code, recipe.ID, err)
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Coupon cannot be applied right now"})
+	case err != nil:
+		log.Printf("Failed to apply coupon %q to recipe %s: %v", code, recipe.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to apply coupon"})
+	default:
+		return quote, true
+	}
+	return nil, false
+}
+
+// convertPrice converts a price into the currency the buyer pays in.
+func (h *PaymentHandler) convertPrice(c *gin.Context, amount float64, from, to string) (*services.CurrencyQuote, bool) {
+	quote, err := h.currencyService.Quote(context.Background(), amount, from, to)
+	switch {
+	case errors.Is(err, services.ErrUnsupportedCurrency):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrExchangeRateMissing), errors.Is(err, services.ErrExchangeRateStale):
+		log.Printf("Cannot convert %s to %s: %v", from, to, err)
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": fmt.Sprintf("Payments in %s are not available right now", to)})
+	case err != nil:
+		log.Printf("Failed to convert %s to %s: %v", from, to, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to convert price"})
+	default:
+		return quote, true
+	}
+	return nil, false
+}
+
+// How long a purchase may wait for its checkout URL before it is treated as
+// abandoned, e.g. after a crash while contacting the provider
+const checkoutInitTimeout = 2 * time.Minute
+
+func initializationStalled(purchase *services.Purchase) bool {
+	if purchase.CheckoutURL != "" {
+		return false
+	}
+
+	createdAt, err := time.Parse(time.RFC3339Nano, purchase.CreatedAt)
+	return err == nil && time.Since(createdAt) > checkoutInitTimeout
+}
+
+// idempotencyMismatch names what differs between the purchase an
+// Idempotency-Key was first used for and a request repeating the key, or
+// returns "" for a genuine retry.
+func idempotencyMismatch(existing *services.Purchase, purchase services.CreatePurchaseInput) string {
+	switch {
+	case existing.RecipeID != purchase.RecipeID || existing.BundleID != purchase.BundleID:
+		return "recipe or bundle"
+	case existing.RecipientEmail != purchase.RecipientEmail:
+		return "gift recipient"
+	case existing.CouponID != purchase.CouponID:
+		return "coupon"
+	case existing.Currency != purchase.Currency:
+		return "currency"
+	}
+	return ""
+}
+
+// respondWithCheckout answers a repeated payment request with the purchase
+// it started.
+func (h *PaymentHandler) respondWithCheckout(c *gin.Context, purchase *services.Purchase) {
+	switch {
+	case purchase.Status == services.PurchasePending && purchase.CheckoutURL != "":
+		c.JSON(http.StatusOK, gin.H{
+			"checkout_url":   purchase.CheckoutURL,
+			"transaction_id": purchase.TransactionID,
+			"amount":         purchase.Amount,
+			"currency":       purchase.Currency,
+			"reused":         true,
+		})
+	case purchase.Status == services.PurchasePending:
+		c.JSON(http.StatusConflict, gin.H{
+			"error":          "Payment is already being initialized, please retry shortly",
+			"transaction_id": purchase.TransactionID,
+		})
+	case purchase.Status == services.PurchaseCompleted && purchase.Amount < 0.005:
+		// A fully discounted purchase completed without a checkout
+		c.JSON(http.StatusOK, gin.H{
+			"transaction_id":  purchase.TransactionID,
+			"purchase_status": purchase.Status,
+			"amount":          purchase.Amount,
+			"currency":        purchase.Currency,
+			"reused":          true,
+		})
+	default:
+		c.JSON(http.StatusConflict, gin.H{
+			"error":          fmt.Sprintf("This payment request already finished with status %s", purchase.Status),
+			"transaction_id": purchase.TransactionID,
+			"status":         purchase.Status,
+		})
+	}
+}
+
+// purchasableRecipe loads a recipe the user is allowed to buy: a published
+// premium recipe with a price, owned by someone else and, unless it is
+// bought as a gift, not yet purchased or covered by a subscription.
+func (h *PaymentHandler) purchasableRecipe(c *gin.Context, userID, recipeID string, gift bool) (*services.Recipe, bool) {
+	ctx := context.Background()
+
+	recipe, err := h.hasuraService.GetRecipeByID(ctx, recipeID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to look up recipe"})
+		return nil, false
+	}
+
+	if recipe == nil || !recipe.IsPublished {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Recipe not found"})
+		return nil, false
+	}
+
+	if !recipe.IsPremium || recipe.Price <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "This recipe is free and cannot be purchased"})
+		return nil, false
+	}
+
+	if recipe.UserID == userID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You cannot purchase your own recipe"})
+		return nil, false
+	}
+
+	// The buyer's own access does not matter for gifts
+	if gift {
+		return recipe, true
+	}
+
+	owned, err := h.hasuraService.HasCompletedPurchase(ctx, userID, recipe.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check existing purchases"})
+		return nil, false
+	}
+
+	if owned {
+		c.JSON(http.StatusConflict, gin.H{"error": "You already own this recipe"})
+		return nil, false
+	}
+
+	subscribed, err := h.hasuraService.HasActiveSubscription(ctx, userID, recipe.UserID, time.Now())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check subscriptions"})
+		return nil, false
+	}
+
+	if subscribed {
+		c.JSON(http.StatusConflict, gin.H{"error": "Your subscription already includes this recipe"})
+		return nil, false
+	}
+
+	return recipe, true
+}
+
+// purchasableBundle loads a bundle the user is allowed to buy.
+func (h *PaymentHandler) purchasableBundle(c *gin.Context, userID, bundleID string) (*services.Bundle, bool) {
+	bundle, err := h.bundleService.Purchasable(context.Background(), userID, bundleID)
+	switch {
+	case errors.Is(err, services.ErrBundleNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Bundle not found"})
+	case errors.Is(err, services.ErrOwnBundle):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You cannot purchase your own bundle"})
+	case errors.Is(err, services.ErrBundleOwned):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case err != nil:
+		log.Printf("Failed to check bundle %s for purchase: %v", bundleID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to look up bundle"})
+	default:
+		return bundle, true
+	}
+	return nil, false
 }
 
 func (h *PaymentHandler) VerifyPayment(c *gin.Context) {
@@ -87,30 +545,159 @@ func (h *PaymentHandler) VerifyPayment(c *gin.Context) {
 		return
 	}
 
-	// Verify payment with Chapa
-	response, err := h.chapaService.VerifyPayment(txRef)
+	if strings.HasPrefix(txRef, services.SubscriptionTxPrefix) {
+		payment, err := h.subscriptionService.Settle(context.Background(), txRef)
+		if errors.Is(err, services.ErrSubscriptionPaymentNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Subscription payment not found"})
+			return
+		}
+		if err != nil {
+			log.Printf("Failed to verify subscription payment %s: %v", txRef, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify payment"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"status":          paymentStatus(payment.Status),
+			"payment_status":  payment.Status,
+			"transaction_id":  txRef,
+			"amount":          payment.Amount,
+			"subscription_id": payment.SubscriptionID,
+		})
+		return
+	}
+
+	purchase, err := h.purchaseService.Settle(context.Background(), txRef)
+	if errors.Is(err, services.ErrPurchaseNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Purchase not found"})
+		return
+	}
 	if err != nil {
+		log.Printf("Failed to verify payment %s: %v", txRef, err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify payment"})
 		return
 	}
 
-	// Update purchase status in database
-	status := "failed"
-	if response.Data.Status == "success" {
-		status = "completed"
+	c.JSON(http.StatusOK, gin.H{
+		"status":          paymentStatus(purchase.Status),
+		"purchase_status": purchase.Status,
+		"transaction_id":  txRef,
+		"amount":          purchase.Amount,
+		"currency":        purchase.Currency,
+	})
+}
+
+// ChapaWebhook receives payment events from Chapa. The payload is only
+// trusted to name a transaction: its signature is checked and the outcome
+// is fetched from Chapa again before the purchase is updated.
+func (h *PaymentHandler) ChapaWebhook(c *gin.Context) {
+	if h.config.ChapaWebhookSecret == "" {
+		log.Println("Rejected Chapa webhook: CHAPA_WEBHOOK_SECRET is not configured")
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Webhook not configured"})
+		return
 	}
 
-	err = h.hasuraService.UpdatePurchaseStatus(context.Background(), txRef, status)
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxWebhookBodySize))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update purchase status"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read request body"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"status":         response.Data.Status,
-		"transaction_id": txRef,
-		"amount":         response.Data.Amount,
-	})
+	if !validChapaSignature(h.config.ChapaWebhookSecret, body, c.GetHeader("x-chapa-signature"), c.GetHeader("Chapa-Signature")) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid signature"})
+		return
+	}
+
+	var event struct {
+		Event string `json:"event"`
+		TxRef string `json:"tx_ref"`
+	}
+	if err := json.Unmarshal(body, &event); err != nil || event.TxRef == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid webhook payload"})
+		return
+	}
+
+	if strings.HasPrefix(event.TxRef, services.SubscriptionTxPrefix) {
+		h.subscriptionWebhook(c, event.Event, event.TxRef)
+		return
+	}
+
+	purchase, err := h.purchaseService.Settle(context.Background(), event.TxRef)
+	if errors.Is(err, services.ErrPurchaseNotFound) {
+		// Not one of ours; acknowledge so Chapa stops retrying
+		log.Printf("Ignoring Chapa webhook for unknown transaction %s", event.TxRef)
+		c.JSON(http.StatusOK, gin.H{"message": "Ignored"})
+		return
+	}
+	if err != nil {
+		// A non-2xx response makes Chapa retry later
+		log.Printf("Failed to settle payment %s from webhook: %v", event.TxRef, err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to verify payment"})
+		return
+	}
+
+	log.Printf("Chapa webhook %q for %s: purchase is %s", event.Event, event.TxRef, purchase.Status)
+	c.JSON(http.StatusOK, gin.H{"message": "OK", "status": purchase.Status})
+}
+
+// subscriptionWebhook settles the subscription payment a webhook names.
+func (h *PaymentHandler) subscriptionWebhook(c *gin.Context, event, txRef string) {
+	payment, err := h.subscriptionService.Settle(context.Background(), txRef)
+	if errors.Is(err, services.ErrSubscriptionPaymentNotFound) {
+		log.Printf("Ignoring Chapa webhook for unknown subscription payment %s", txRef)
+		c.JSON(http.StatusOK, gin.H{"message": "Ignored"})
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to settle subscription payment %s from webhook: %v", txRef, err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to verify payment"})
+		return
+	}
+
+	log.Printf("Chapa webhook %q for %s: subscription payment is %s", event, txRef, payment.Status)
+	c.JSON(http.StatusOK, gin.H{"message": "OK", "status": payment.Status})
+}
+
+// Largest webhook payload we accept
+const maxWebhookBodySize = 1 << 20
+
+// validChapaSignature checks the signature headers Chapa sends, both hex
+// HMAC-SHA256 keyed with the webhook secret: x-chapa-signature signs the
+// payload and Chapa-Signature signs the secret itself. At least one must be
+// present and every one present must match. Chapa-Signature alone proves
+// only that the sender knows the secret, not that the payload is unaltered;
+// the payload is only trusted to name a transaction either way.
+func validChapaSignature(secret string, body []byte, xChapaSignature, chapaSignature string) bool {
+	if strings.TrimSpace(xChapaSignature) == "" && strings.TrimSpace(chapaSignature) == "" {
+		return false
+	}
+
+	matches := func(signature string, signed []byte) bool {
+		signature = strings.TrimSpace(signature)
+		if signature == "" {
+			return true
+		}
+
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write(signed)
+		given, err := hex.DecodeString(signature)
+		return err == nil && hmac.Equal(given, mac.Sum(nil))
+	}
+
+	return matches(xChapaSignature, body) && matches(chapaSignature, []byte(secret))
+}
+
+// paymentStatus maps a purchase status to the status names Chapa uses,
+// which clients already understand.
+func paymentStatus(purchaseStatus string) string {
+	switch purchaseStatus {
+	case services.PurchaseCompleted:
+		return "success"
+	case services.PurchaseFailed, services.PurchaseExpired:
+		return "failed"
+	default:
+		return purchaseStatus
+	}
 }
 
 func (h *PaymentHandler) GetPaymentStatus(c *gin.Context) {
@@ -120,12 +707,206 @@ func (h *PaymentHandler) GetPaymentStatus(c *gin.Context) {
 		return
 	}
 
-	// Verify with Chapa
-	response, err := h.chapaService.VerifyPayment(transactionID)
+	// Verify with the payment provider
+	response, err := h.paymentProvider.VerifyPayment(transactionID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get payment status"})
 		return
 	}
 
 	c.JSON(http.StatusOK, response.Data)
+}
+
+// GetReceipt returns the PDF invoice of a completed purchase to its buyer,
+// the recipe's seller or an admin. Purchases completed before invoices were
+// introduced get theirs issued on the first request.
+func (h *PaymentHandler) GetReceipt(c *gin.Context) {
+	userID := c.GetString("user_id")
+	ctx := context.Background()
+
+	purchase, err := h.hasuraService.GetPurchaseByTransactionID(ctx, c.Param("transactionId"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to look up purchase"})
+		return
+	}
+
+	if purchase == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Purchase not found"})
+		return
+	}
+
+	if purchase.UserID != userID {
+		item, err := h.hasuraService.GetPurchaseItem(ctx, purchase)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to look up recipe"})
+			return
+		}
+
+		if item == nil || item.SellerID != userID {
+			isAdmin, err := h.hasuraService.IsAdmin(ctx, userID)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check permissions"})
+				return
+			}
+			if !isAdmin {
+				c.JSON(http.StatusForbidden, gin.H{"error": "Only the buyer, the seller or an admin can download this receipt"})
+				return
+			}
+		}
+	}
+
+	invoice, err := h.invoiceService.Issue(ctx, purchase)
+	switch {
+	case errors.Is(err, services.ErrInvoiceUnavailable):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "status": purchase.Status})
+		return
+	case err != nil:
+		log.Printf("Failed to issue invoice for purchase %s: %v", purchase.TransactionID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to issue invoice"})
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", invoice.Filename()))
+	c.Data(http.StatusOK, "application/pdf", h.invoiceService.RenderPDF(invoice))
+}
+
+// RefundPurchase refunds a completed purchase in full or in part. Only the
+// seller of the recipe and admins may refund, except that buyers may get
+// back gifts nobody redeemed before they expired.
+func (h *PaymentHandler) RefundPurchase(c *gin.Context) {
+	var req models.RefundRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	ctx := context.Background()
+	purchase, err := h.hasuraService.GetPurchaseByTransactionID(ctx, c.Param("transactionId"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to look up purchase"})
+		return
+	}
+
+	if purchase == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Purchase not found"})
+		return
+	}
+
+	item, err := h.hasuraService.GetPurchaseItem(ctx, purchase)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to look up recipe"})
+		return
+	}
+
+	if item == nil || item.SellerID != userID.(string) {
+		if purchase.UserID == userID.(string) && purchase.IsGift() {
+			// Buyers get gifts that expired unredeemed refunded in full
+			if !purchase.GiftRefundable(time.Now()) {
+				c.JSON(http.StatusConflict, gin.H{"error": services.ErrGiftNotRefundable.Error()})
+				return
+			}
+			req.Amount = 0
+		} else {
+			isAdmin, err := h.hasuraService.IsAdmin(ctx, userID.(string))
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check permissions"})
+				return
+			}
+			if !isAdmin {
+				c.JSON(http.StatusForbidden, gin.H{"error": "Only the seller or an admin can refund this purchase"})
+				return
+			}
+		}
+	}
+
+	outcome, err := h.refundService.Refund(ctx, services.RefundRequest{
+		Purchase:     purchase,
+		Amount:       req.Amount,
+		Reason:       req.Reason,
+		RequestedBy:  userID.(string),
+		RevokeAccess: req.RevokeAccess,
+	})
+	switch {
+	case errors.Is(err, services.ErrEarlierRefundRecorded):
+		// The earlier refund is now complete, so its emails go out
+		h.notifyRefund(ctx, purchase, item, outcome, outcome.Refund.Reason)
+		c.JSON(http.StatusConflict, gin.H{
+			"error":   "An earlier refund of this purchase was recorded instead; this request was not processed, request it again if it is still needed",
+			"outcome": outcome,
+		})
+		return
+	case errors.Is(err, services.ErrPurchaseNotRefundable), errors.Is(err, services.ErrInvalidRefundAmount):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, services.ErrRefundUnconfirmed):
+		log.Printf("Refund of purchase %s is unconfirmed: %v", purchase.TransactionID, err)
+		c.JSON(http.StatusConflict, gin.H{"error": "A refund of this purchase is pending until the payment provider confirms it; request the refund again later"})
+		return
+	case errors.Is(err, services.ErrRefundNotRecorded):
+		log.Printf("Failed to record refund of purchase %s: %v", purchase.TransactionID, err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "The payment was refunded but could not be recorded; request the refund again to record it"})
+		return
+	case err != nil:
+		log.Printf("Failed to refund purchase %s: %v", purchase.TransactionID, err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to refund payment"})
+		return
+	}
+
+	h.notifyRefund(ctx, purchase, item, outcome, req.Reason)
+
+	c.JSON(http.StatusOK, outcome)
+}
+
+// notifyRefund emails the buyer and the seller about a refund. Failures are
+// logged; the refund itself has already happened.
+func (h *PaymentHandler) notifyRefund(ctx context.Context, purchase *services.Purchase, item *services.PurchaseItem, outcome *services.RefundOutcome, reason string) {
+	buyer, err := h.hasuraService.GetUserByID(ctx, purchase.UserID)
+	if err != nil || buyer == nil {
+		log.Printf("Failed to look up buyer %s for refund emails: %v", purchase.UserID, err)
+		return
+	}
+
+	// Revoking a purchase nothing was paid for refunds nothing
+	refund := outcome.Refund
+	if refund == nil {
+		refund = &services.Refund{ID: purchase.TransactionID, Reason: reason}
+	}
+
+	data := map[string]interface{}{
+		"recipe_id":      purchase.RecipeID,
+		"bundle_id":      purchase.BundleID,
+		"recipe_title":   "",
+		"amount":         fmt.Sprintf("%.2f", refund.Amount),
+		"currency":       purchase.Currency,
+		"reason":         refund.Reason,
+		"access_revoked": outcome.PurchaseStatus == services.PurchaseRefunded,
+		"buyer_name":     buyer.FullName,
+	}
+	if item != nil {
+		data["recipe_title"] = item.Title
+	}
+
+	if err := h.notificationHandler.Notify(ctx, buyer.Email, "purchase_refunded", data); err != nil {
+		log.Printf("Failed to email buyer about refund %s: %v", refund.ID, err)
+	}
+
+	if item == nil {
+		return
+	}
+
+	seller, err := h.hasuraService.GetUserByID(ctx, item.SellerID)
+	if err != nil || seller == nil {
+		log.Printf("Failed to look up seller %s for refund emails: %v", item.SellerID, err)
+		return
+	}
+
+	if err := h.notificationHandler.Notify(ctx, seller.Email, "recipe_refunded", data); err != nil {
+		log.Printf("Failed to email seller about refund %s: %v", refund.ID, err)
+	}
 }
\ No newline at end of file
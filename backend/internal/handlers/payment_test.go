@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"recipe-backend/internal/config"
+	"recipe-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+const testWebhookSecret = "webhook-secret"
+
+func sign(secret, body string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(body))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestValidChapaSignature(t *testing.T) {
+	body := `{"event":"charge.success","tx_ref":"tx-1"}`
+	payload := sign(testWebhookSecret, body)
+	secret := sign(testWebhookSecret, testWebhookSecret)
+
+	tests := []struct {
+		name            string
+		body            string
+		xChapaSignature string
+		chapaSignature  string
+		want            bool
+	}{
+		{name: "both", body: body, xChapaSignature: payload, chapaSignature: secret, want: true},
+		{name: "payload signature only", body: body, xChapaSignature: payload, want: true},
+		{name: "secret signature only", body: body, chapaSignature: secret, want: true},
+		{name: "valid with whitespace", body: body, xChapaSignature: " " + payload + "\n", want: true},
+		{name: "upper case hex", body: body, xChapaSignature: strings.ToUpper(payload), chapaSignature: strings.ToUpper(secret), want: true},
+		{name: "tampered body", body: strings.Replace(body, "tx-1", "tx-2", 1), xChapaSignature: payload, chapaSignature: secret},
+		{name: "headers swapped", body: body, xChapaSignature: secret, chapaSignature: payload},
+		{name: "payload signature in Chapa-Signature", body: body, chapaSignature: payload},
+		{name: "secret signature in x-chapa-signature", body: body, xChapaSignature: secret},
+		{name: "wrong secret", body: body, xChapaSignature: sign("other-secret", body)},
+		{name: "wrong secret signed", body: body, chapaSignature: sign(testWebhookSecret, "other-secret")},
+		{name: "truncated", body: body, xChapaSignature: payload[:len(payload)-2]},
+		{name: "not hex", body: body, xChapaSignature: "not-a-signature"},
+		{name: "missing", body: body, xChapaSignature: " ", chapaSignature: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := validChapaSignature(testWebhookSecret, []byte(tt.body), tt.xChapaSignature, tt.chapaSignature); got != tt.want {
+				t.Errorf("validChapaSignature() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestChapaWebhookSignature(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// No tx_ref, so a request that passes the signature check stops at
+	// payload validation before any purchase is looked up
+	body := `{"event":"charge.success"}`
+	payload := sign(testWebhookSecret, body)
+	secret := sign(testWebhookSecret, testWebhookSecret)
+
+	tests := []struct {
+		name    string
+		secret  string
+		headers map[string]string
+		want    int
+	}{
+		{name: "both headers", secret: testWebhookSecret, headers: map[string]string{"x-chapa-signature": payload, "Chapa-Signature": secret}, want: http.StatusBadRequest},
+		{name: "x-chapa-signature", secret: testWebhookSecret, headers: map[string]string{"x-chapa-signature": payload}, want: http.StatusBadRequest},
+		{name: "Chapa-Signature", secret: testWebhookSecret, headers: map[string]string{"Chapa-Signature": secret}, want: http.StatusBadRequest},
+		{name: "tampered x-chapa-signature", secret: testWebhookSecret, headers: map[string]string{"x-chapa-signature": sign(testWebhookSecret, body+" ")}, want: http.StatusUnauthorized},
+		{name: "tampered Chapa-Signature", secret: testWebhookSecret, headers: map[string]string{"Chapa-Signature": sign("other-secret", "other-secret")}, want: http.StatusUnauthorized},
+		{name: "tampered payload with valid Chapa-Signature", secret: testWebhookSecret, headers: map[string]string{"x-chapa-signature": "deadbeef", "Chapa-Signature": secret}, want: http.StatusUnauthorized},
+		{name: "missing", secret: testWebhookSecret, want: http.StatusUnauthorized},
+		{name: "secret not configured", headers: map[string]string{"x-chapa-signature": sign("", body)}, want: http.StatusServiceUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &PaymentHandler{config: &config.Config{ChapaWebhookSecret: tt.secret}}
+
+			router := gin.New()
+			router.POST("/webhook", h.ChapaWebhook)
+
+			req := httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader(body))
+			for name, value := range tt.headers {
+				req.Header.Set(name, value)
+			}
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d (%s)", w.Code, tt.want, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestIdempotencyMismatch(t *testing.T) {
+	existing := &services.Purchase{RecipeID: "recipe-1", CouponID: "coupon-1", Currency: "ETB", RecipientEmail: "friend@example.com"}
+	retry := services.CreatePurchaseInput{RecipeID: "recipe-1", CouponID: "coupon-1", Currency: "ETB", RecipientEmail: "friend@example.com"}
+
+	tests := []struct {
+		name   string
+		change func(purchase *services.CreatePurchaseInput)
+		want   string
+	}{
+		{name: "retry", change: func(purchase *services.CreatePurchaseInput) {}},
+		{name: "recipe", change: func(purchase *services.CreatePurchaseInput) { purchase.RecipeID = "recipe-2" }, want: "recipe or bundle"},
+		{name: "bundle", change: func(purchase *services.CreatePurchaseInput) { purchase.RecipeID, purchase.BundleID = "", "bundle-1" }, want: "recipe or bundle"},
+		{name: "recipient", change: func(purchase *services.CreatePurchaseInput) { purchase.RecipientEmail = "" }, want: "gift recipient"},
+		{name: "coupon", change: func(purchase *services.CreatePurchaseInput) { purchase.CouponID = "coupon-2" }, want: "coupon"},
+		{name: "coupon dropped", change: func(purchase *services.CreatePurchaseInput) { purchase.CouponID = "" }, want: "coupon"},
+		{name: "currency", change: func(purchase *services.CreatePurchaseInput) { purchase.Currency = "USD" }, want: "currency"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			purchase := retry
+			tt.change(&purchase)
+			if got := idempotencyMismatch(existing, purchase); got != tt.want {
+				t.Errorf("idempotencyMismatch() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,217 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"recipe-backend/internal/config"
+	"recipe-backend/internal/models"
+	"recipe-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type PayoutHandler struct {
+	config        *config.Config
+	payoutService *services.PayoutService
+	hasuraService *services.HasuraService
+}
+
+func NewPayoutHandler(cfg *config.Config, payoutService *services.PayoutService, hasuraService *services.HasuraService) *PayoutHandler {
+	return &PayoutHandler{
+		config:        cfg,
+		payoutService: payoutService,
+		hasuraService: hasuraService,
+	}
+}
+
+func (h *PayoutHandler) ListAccounts(c *gin.Context) {
+	accounts, err := h.hasuraService.ListPayoutAccounts(context.Background(), c.GetString("user_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list payout accounts"})
+		return
+	}
+
+	if accounts == nil {
+		accounts = []services.PayoutAccount{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"accounts": accounts})
+}
+
+func (h *PayoutHandler) AddAccount(c *gin.Context) {
+	var req models.PayoutAccountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	account, err := h.hasuraService.CreatePayoutAccount(context.Background(), services.PayoutAccount{
+		UserID:        c.GetString("user_id"),
+		Method:        req.Method,
+		BankCode:      req.BankCode,
+		BankName:      req.BankName,
+		AccountName:   req.AccountName,
+		AccountNumber: req.AccountNumber,
+	})
+	if err != nil {
+		log.Printf("Failed to create payout account: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create payout account"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"account": account})
+}
+
+func (h *PayoutHandler) DeleteAccount(c *gin.Context) {
+	deleted, err := h.hasuraService.DeletePayoutAccount(context.Background(), c.GetString("user_id"), c.Param("accountId"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete payout account"})
+		return
+	}
+
+	if !deleted {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Payout account not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Payout account deleted"})
+}
+
+// ListPayouts returns the caller's payouts, newest first.
+func (h *PayoutHandler) ListPayouts(c *gin.Context) {
+	limit, offset, ok := pagination(c)
+	if !ok {
+		return
+	}
+
+	payouts, err := h.hasuraService.ListPayouts(context.Background(), c.GetString("user_id"), "", limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list payouts"})
+		return
+	}
+
+	h.respondWithPayouts(c, payouts)
+}
+
+func (h *PayoutHandler) RequestPayout(c *gin.Context) {
+	var req models.PayoutRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	payout, err := h.payoutService.RequestPayout(context.Background(), c.GetString("user_id"), req.PayoutAccountID, req.Amount)
+	switch {
+	case errors.Is(err, services.ErrPayoutAccountNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Payout account not found"})
+	case errors.Is(err, services.ErrPayoutBelowMinimum):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "minimum": h.config.PayoutMinimum})
+	case errors.Is(err, services.ErrInsufficientBalance):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrPayoutInProgress):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case err != nil:
+		log.Printf("Failed to request payout: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to request payout"})
+	default:
+		c.JSON(http.StatusCreated, gin.H{"payout": payout})
+	}
+}
+
+// ListQueue lists payouts for admins, by default those awaiting review.
+func (h *PayoutHandler) ListQueue(c *gin.Context) {
+	limit, offset, ok := pagination(c)
+	if !ok {
+		return
+	}
+
+	status := c.DefaultQuery("status", services.PayoutRequested)
+	switch status {
+	case services.PayoutRequested, services.PayoutProcessing, services.PayoutCompleted, services.PayoutFailed, services.PayoutRejected:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown payout status"})
+		return
+	}
+
+	payouts, err := h.hasuraService.ListPayouts(context.Background(), "", status, limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list payouts"})
+		return
+	}
+
+	h.respondWithPayouts(c, payouts)
+}
+
+func (h *PayoutHandler) ApprovePayout(c *gin.Context) {
+	payout, err := h.payoutService.Approve(context.Background(), c.Param("payoutId"), c.GetString("user_id"))
+	if !h.reviewed(c, err) {
+		return
+	}
+
+	if payout.Status == services.PayoutFailed {
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Transfer was rejected by the payment provider", "payout": payout})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"payout": payout})
+}
+
+func (h *PayoutHandler) RejectPayout(c *gin.Context) {
+	var req models.RejectPayoutRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	payout, err := h.payoutService.Reject(context.Background(), c.Param("payoutId"), c.GetString("user_id"), req.Reason)
+	if !h.reviewed(c, err) {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"payout": payout})
+}
+
+// reviewed writes the error response for a failed approval or rejection.
+func (h *PayoutHandler) reviewed(c *gin.Context, err error) bool {
+	switch {
+	case errors.Is(err, services.ErrPayoutNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Payout not found"})
+	case errors.Is(err, services.ErrPayoutNotRequested):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case err != nil:
+		log.Printf("Failed to review payout %s: %v", c.Param("payoutId"), err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to review payout"})
+	default:
+		return true
+	}
+	return false
+}
+
+func (h *PayoutHandler) respondWithPayouts(c *gin.Context, payouts []services.Payout) {
+	if payouts == nil {
+		payouts = []services.Payout{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"payouts": payouts, "minimum": h.config.PayoutMinimum})
+}
+
+// pagination reads the limit and offset query parameters.
+func pagination(c *gin.Context) (int, int, bool) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit < 1 || limit > 100 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Limit must be between 1 and 100"})
+		return 0, 0, false
+	}
+
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Offset must be a non-negative number"})
+		return 0, 0, false
+	}
+
+	return limit, offset, true
+}
@@ -0,0 +1,376 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+
+	"recipe-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type RecipeHandler struct {
+	entitlementService *services.EntitlementService
+	accessService      *services.AccessService
+	fileService        *services.FileService
+	hasuraService      *services.HasuraService
+}
+
+func NewRecipeHandler(entitlementService *services.EntitlementService, accessService *services.AccessService, fileService *services.FileService, hasuraService *services.HasuraService) *RecipeHandler {
+	return &RecipeHandler{
+		entitlementService: entitlementService,
+		accessService:      accessService,
+		fileService:        fileService,
+		hasuraService:      hasuraService,
+	}
+}
+
+type AddRecipeImageRequest struct {
+	FileID     string `json:"file_id" binding:"required"`
+	Caption    string `json:"caption"`
+	IsFeatured bool   `json:"is_featured"`
+}
+
+type UpdateRecipeImageRequest struct {
+	Caption *string `json:"caption"`
+}
+
+type ReorderRecipeImagesRequest struct {
+	ImageIDs []string `json:"image_ids" binding:"required"`
+}
+
+// GetContent returns a recipe's ingredients and steps: all of them to
+// readers entitled to the recipe and the premium teaser to everyone else.
+// Signing in is optional.
+func (h *RecipeHandler) GetContent(c *gin.Context) {
+	content, err := h.entitlementService.Content(context.Background(), c.GetString("user_id"), c.Param("id"))
+	switch {
+	case errors.Is(err, services.ErrRecipeNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Recipe not found"})
+	case err != nil:
+		log.Printf("Failed to load content of recipe %s: %v", c.Param("id"), err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load recipe content"})
+	default:
+		c.JSON(http.StatusOK, content)
+	}
+}
+
+// ListImages returns a recipe's gallery. Unpublished recipes are only shown
+// to their owner. Private images are returned with signed URLs to readers
+// with access to the recipe and left out for everyone else.
+func (h *RecipeHandler) ListImages(c *gin.Context) {
+	userID := c.GetString("user_id")
+	ctx := context.Background()
+
+	recipe, err := h.hasuraService.GetRecipeByID(ctx, c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to look up recipe"})
+		return
+	}
+
+	if recipe == nil || (!recipe.IsPublished && recipe.UserID != userID) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Recipe not found"})
+		return
+	}
+
+	images, err := h.hasuraService.ListRecipeImages(ctx, recipe.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list recipe images"})
+		return
+	}
+
+	// Access is only checked when the gallery has private images
+	var checked, allowed bool
+	ttl := h.fileService.SignedURLTTL()
+	visible := images[:0]
+	for _, image := range images {
+		key, private := h.fileService.PrivateKeyFromURL(image.ImageURL)
+		if !private {
+			visible = append(visible, image)
+			continue
+		}
+
+		if !checked {
+			allowed, err = h.accessService.HasAccess(ctx, userID, recipe)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check permissions"})
+				return
+			}
+			checked = true
+		}
+		if !allowed {
+			continue
+		}
+
+		image.ImageURL, err = h.fileService.SignedURL(key, ttl)
+		if err != nil {
+			log.Printf("Failed to sign URL for image %s: %v", image.ID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create image URL"})
+			return
+		}
+		visible = append(visible, image)
+	}
+
+	h.respondWithImages(c, visible)
+}
+
+func (h *RecipeHandler) AddImage(c *gin.Context) {
+	var req AddRecipeImageRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	recipe, ok := h.ownedRecipe(c)
+	if !ok {
+		return
+	}
+
+	ctx := context.Background()
+	file, err := h.hasuraService.GetFileByID(ctx, req.FileID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to look up file"})
+		return
+	}
+
+	if file == nil || file.UserID != c.GetString("user_id") {
+		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+		return
+	}
+
+	images, err := h.hasuraService.ListRecipeImages(ctx, recipe.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list recipe images"})
+		return
+	}
+
+	for _, image := range images {
+		if image.FileID == file.ID {
+			c.JSON(http.StatusConflict, gin.H{"error": "File is already in this recipe's gallery"})
+			return
+		}
+	}
+
+	image, err := h.hasuraService.AddRecipeImage(ctx, services.AddRecipeImageInput{
+		RecipeID: recipe.ID,
+		File:     file,
+		Caption:  req.Caption,
+		Position: len(images),
+	})
+	if err != nil {
+		log.Printf("Failed to add image to recipe %s: %v", recipe.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add recipe image"})
+		return
+	}
+
+	// The first image of a gallery is always featured
+	if req.IsFeatured || len(images) == 0 {
+		if err := h.hasuraService.SetFeaturedRecipeImage(ctx, recipe.ID, image); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to set featured image"})
+			return
+		}
+	}
+
+	h.respondWithGallery(c, recipe.ID, http.StatusCreated)
+}
+
+func (h *RecipeHandler) UpdateImage(c *gin.Context) {
+	var req UpdateRecipeImageRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.Caption == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Nothing to update"})
+		return
+	}
+
+	recipe, ok := h.ownedRecipe(c)
+	if !ok {
+		return
+	}
+
+	updated, err := h.hasuraService.UpdateRecipeImageCaption(context.Background(), recipe.ID, c.Param("imageId"), *req.Caption)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update recipe image"})
+		return
+	}
+
+	if !updated {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Image not found"})
+		return
+	}
+
+	h.respondWithGallery(c, recipe.ID, http.StatusOK)
+}
+
+func (h *RecipeHandler) ReorderImages(c *gin.Context) {
+	var req ReorderRecipeImagesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	recipe, ok := h.ownedRecipe(c)
+	if !ok {
+		return
+	}
+
+	ctx := context.Background()
+	images, err := h.hasuraService.ListRecipeImages(ctx, recipe.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list recipe images"})
+		return
+	}
+
+	// The new order must name every image exactly once
+	remaining := make(map[string]bool, len(images))
+	for _, image := range images {
+		remaining[image.ID] = true
+	}
+	for _, id := range req.ImageIDs {
+		if !remaining[id] {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Image IDs must list every image in the gallery exactly once"})
+			return
+		}
+		delete(remaining, id)
+	}
+	if len(remaining) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Image IDs must list every image in the gallery exactly once"})
+		return
+	}
+
+	if err := h.hasuraService.ReorderRecipeImages(ctx, recipe.ID, req.ImageIDs); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reorder recipe images"})
+		return
+	}
+
+	h.respondWithGallery(c, recipe.ID, http.StatusOK)
+}
+
+func (h *RecipeHandler) SetFeaturedImage(c *gin.Context) {
+	recipe, ok := h.ownedRecipe(c)
+	if !ok {
+		return
+	}
+
+	image, ok := h.galleryImage(c, recipe.ID)
+	if !ok {
+		return
+	}
+
+	if err := h.hasuraService.SetFeaturedRecipeImage(context.Background(), recipe.ID, image); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to set featured image"})
+		return
+	}
+
+	h.respondWithGallery(c, recipe.ID, http.StatusOK)
+}
+
+func (h *RecipeHandler) RemoveImage(c *gin.Context) {
+	recipe, ok := h.ownedRecipe(c)
+	if !ok {
+		return
+	}
+
+	image, ok := h.galleryImage(c, recipe.ID)
+	if !ok {
+		return
+	}
+
+	ctx := context.Background()
+	if err := h.hasuraService.RemoveRecipeImage(ctx, recipe.ID, image.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove recipe image"})
+		return
+	}
+
+	// Keep exactly one featured image while the gallery is not empty
+	if image.IsFeatured {
+		images, err := h.hasuraService.ListRecipeImages(ctx, recipe.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list recipe images"})
+			return
+		}
+
+		if len(images) > 0 {
+			err = h.hasuraService.SetFeaturedRecipeImage(ctx, recipe.ID, &images[0])
+		} else {
+			err = h.hasuraService.ClearFeaturedRecipeImage(ctx, recipe.ID)
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update featured image"})
+			return
+		}
+	}
+
+	h.respondWithGallery(c, recipe.ID, http.StatusOK)
+}
+
+// ownedRecipe loads the recipe in the URL and checks that the caller owns it.
+func (h *RecipeHandler) ownedRecipe(c *gin.Context) (*services.Recipe, bool) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return nil, false
+	}
+
+	recipe, err := h.hasuraService.GetRecipeByID(context.Background(), c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to look up recipe"})
+		return nil, false
+	}
+
+	if recipe == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Recipe not found"})
+		return nil, false
+	}
+
+	if recipe.UserID != userID.(string) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only the recipe owner can change its images"})
+		return nil, false
+	}
+
+	return recipe, true
+}
+
+func (h *RecipeHandler) galleryImage(c *gin.Context, recipeID string) (*services.RecipeImage, bool) {
+	images, err := h.hasuraService.ListRecipeImages(context.Background(), recipeID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list recipe images"})
+		return nil, false
+	}
+
+	for i := range images {
+		if images[i].ID == c.Param("imageId") {
+			return &images[i], true
+		}
+	}
+
+	c.JSON(http.StatusNotFound, gin.H{"error": "Image not found"})
+	return nil, false
+}
+
+func (h *RecipeHandler) respondWithGallery(c *gin.Context, recipeID string, status int) {
+	images, err := h.hasuraService.ListRecipeImages(context.Background(), recipeID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list recipe images"})
+		return
+	}
+
+	if images == nil {
+		images = []services.RecipeImage{}
+	}
+
+	c.JSON(status, gin.H{"images": images})
+}
+
+func (h *RecipeHandler) respondWithImages(c *gin.Context, images []services.RecipeImage) {
+	if images == nil {
+		images = []services.RecipeImage{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"images": images})
+}
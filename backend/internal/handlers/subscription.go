@@ -0,0 +1,198 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+
+	"recipe-backend/internal/models"
+	"recipe-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type SubscriptionHandler struct {
+	subscriptionService *services.SubscriptionService
+	hasuraService       *services.HasuraService
+}
+
+func NewSubscriptionHandler(subscriptionService *services.SubscriptionService, hasuraService *services.HasuraService) *SubscriptionHandler {
+	return &SubscriptionHandler{
+		subscriptionService: subscriptionService,
+		hasuraService:       hasuraService,
+	}
+}
+
+// ListPlans returns the plans open to new subscribers, optionally those of
+// one chef.
+func (h *SubscriptionHandler) ListPlans(c *gin.Context) {
+	plans, err := h.hasuraService.ListSubscriptionPlans(context.Background(), c.Query("chef_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list subscription plans"})
+		return
+	}
+
+	if plans == nil {
+		plans = []services.SubscriptionPlan{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"plans": plans})
+}
+
+func (h *SubscriptionHandler) CreatePlan(c *gin.Context) {
+	var req models.SubscriptionPlanRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	plan, err := h.subscriptionService.CreatePlan(context.Background(), services.SubscriptionPlan{
+		Name:            req.Name,
+		Description:     req.Description,
+		Scope:           req.Scope,
+		Price:           req.Price,
+		BillingInterval: req.BillingInterval,
+		CreatedBy:       c.GetString("user_id"),
+	})
+	switch {
+	case errors.Is(err, services.ErrPlanInvalid):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrPlanForbidden):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case err != nil:
+		log.Printf("Failed to create subscription plan: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create subscription plan"})
+	default:
+		c.JSON(http.StatusCreated, gin.H{"plan": plan})
+	}
+}
+
+func (h *SubscriptionHandler) DeactivatePlan(c *gin.Context) {
+	plan, err := h.subscriptionService.DeactivatePlan(context.Background(), c.Param("planId"), c.GetString("user_id"))
+	switch {
+	case errors.Is(err, services.ErrPlanNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Subscription plan not found"})
+	case errors.Is(err, services.ErrPlanForbidden):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case err != nil:
+		log.Printf("Failed to deactivate subscription plan %s: %v", c.Param("planId"), err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to deactivate subscription plan"})
+	default:
+		c.JSON(http.StatusOK, gin.H{"plan": plan})
+	}
+}
+
+// ListSubscriptions returns the caller's subscriptions, newest first.
+func (h *SubscriptionHandler) ListSubscriptions(c *gin.Context) {
+	subscriptions, err := h.hasuraService.ListSubscriptions(context.Background(), c.GetString("user_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list subscriptions"})
+		return
+	}
+
+	if subscriptions == nil {
+		subscriptions = []services.Subscription{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"subscriptions": subscriptions})
+}
+
+// GetSubscription returns one of the caller's subscriptions with its
+// payments.
+func (h *SubscriptionHandler) GetSubscription(c *gin.Context) {
+	ctx := context.Background()
+
+	subscription, err := h.hasuraService.GetSubscription(ctx, c.Param("subscriptionId"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to look up subscription"})
+		return
+	}
+
+	if subscription == nil || subscription.UserID != c.GetString("user_id") {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Subscription not found"})
+		return
+	}
+
+	payments, err := h.hasuraService.ListSubscriptionPayments(ctx, subscription.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list subscription payments"})
+		return
+	}
+
+	if payments == nil {
+		payments = []services.SubscriptionPayment{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"subscription": subscription, "payments": payments})
+}
+
+// Subscribe starts a subscription and returns the checkout for its first
+// period.
+func (h *SubscriptionHandler) Subscribe(c *gin.Context) {
+	var req models.SubscribeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	subscription, payment, err := h.subscriptionService.Subscribe(context.Background(),
+		c.GetString("user_id"), c.GetString("user_email"), req.PlanID, req.CallbackURL, req.ReturnURL)
+	switch {
+	case errors.Is(err, services.ErrPlanNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Subscription plan not found"})
+	case errors.Is(err, services.ErrOwnPlan):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrAlreadySubscribed):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case err != nil:
+		log.Printf("Failed to subscribe to plan %s: %v", req.PlanID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start subscription"})
+	default:
+		c.JSON(http.StatusOK, gin.H{
+			"subscription":   subscription,
+			"checkout_url":   payment.CheckoutURL,
+			"transaction_id": payment.TransactionID,
+			"amount":         payment.Amount,
+		})
+	}
+}
+
+// Renew returns the checkout for the next period of a subscription that is
+// due for renewal or past due.
+func (h *SubscriptionHandler) Renew(c *gin.Context) {
+	payment, err := h.subscriptionService.Renew(context.Background(),
+		c.Param("subscriptionId"), c.GetString("user_id"), c.GetString("user_email"))
+	switch {
+	case errors.Is(err, services.ErrSubscriptionNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Subscription not found"})
+	case errors.Is(err, services.ErrSubscriptionNotRenewable):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case err != nil:
+		log.Printf("Failed to renew subscription %s: %v", c.Param("subscriptionId"), err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to renew subscription"})
+	default:
+		c.JSON(http.StatusOK, gin.H{
+			"checkout_url":   payment.CheckoutURL,
+			"transaction_id": payment.TransactionID,
+			"amount":         payment.Amount,
+			"period_start":   payment.PeriodStart,
+			"period_end":     payment.PeriodEnd,
+		})
+	}
+}
+
+func (h *SubscriptionHandler) Cancel(c *gin.Context) {
+	subscription, err := h.subscriptionService.Cancel(context.Background(), c.Param("subscriptionId"), c.GetString("user_id"))
+	switch {
+	case errors.Is(err, services.ErrSubscriptionNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Subscription not found"})
+	case errors.Is(err, services.ErrSubscriptionEnded):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case err != nil:
+		log.Printf("Failed to cancel subscription %s: %v", c.Param("subscriptionId"), err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel subscription"})
+	default:
+		c.JSON(http.StatusOK, gin.H{"subscription": subscription})
+	}
+}
@@ -0,0 +1,315 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"recipe-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Resumable uploads following the tus 1.0 protocol (https://tus.io).
+// Supported extensions: creation, termination, expiration.
+
+const (
+	tusVersion    = "1.0.0"
+	tusExtensions = "creation,termination,expiration"
+)
+
+func (h *FileHandler) tusHeaders(c *gin.Context) bool {
+	c.Header("Tus-Resumable", tusVersion)
+
+	if c.GetHeader("Tus-Resumable") != tusVersion {
+		c.Header("Tus-Version", tusVersion)
+		c.AbortWithStatus(http.StatusPreconditionFailed)
+		return false
+	}
+
+	return true
+}
+
+// tusUpload loads an upload and checks that it belongs to the caller.
+// Uploads of other users are reported as missing.
+func (h *FileHandler) tusUpload(c *gin.Context) (*services.TusUpload, bool) {
+	upload, err := h.tusService.Get(c.Param("uploadId"))
+	if err != nil {
+		if errors.Is(err, services.ErrUploadNotFound) {
+			c.AbortWithStatus(http.StatusNotFound)
+			return nil, false
+		}
+		log.Printf("Failed to load upload %s: %v", c.Param("uploadId"), err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return nil, false
+	}
+
+	if upload.UserID != c.GetString("user_id") {
+		c.AbortWithStatus(http.StatusNotFound)
+		return nil, false
+	}
+
+	// Unfinished uploads cannot be resumed past their expiry, even before
+	// they are purged
+	if upload.FileID == "" && !time.Now().Before(upload.ExpiresAt(h.tusService.Expiry())) {
+		c.AbortWithStatus(http.StatusGone)
+		return nil, false
+	}
+
+	return upload, true
+}
+
+// TusOptions answers tus discovery requests. Unlike the other tus requests
+// it does not need a Tus-Resumable header.
+func (h *FileHandler) TusOptions(c *gin.Context) {
+	c.Header("Tus-Resumable", tusVersion)
+	c.Header("Tus-Version", tusVersion)
+	c.Header("Tus-Extension", tusExtensions)
+	c.Header("Tus-Max-Size", strconv.FormatInt(h.fileService.LargestUploadSize(), 10))
+	c.Status(http.StatusNoContent)
+}
+
+func (h *FileHandler) TusCreateUpload(c *gin.Context) {
+	if !h.tusHeaders(c) {
+		return
+	}
+
+	userID := c.GetString("user_id")
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	length, err := strconv.ParseInt(c.GetHeader("Upload-Length"), 10, 64)
+	if err != nil || length <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Valid Upload-Length header required"})
+		return
+	}
+
+	metadata, err := parseTusMetadata(c.GetHeader("Upload-Metadata"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Upload-Metadata header"})
+		return
+	}
+
+	if metadata["filename"] == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Upload-Metadata must include a filename"})
+		return
+	}
+
+	// Videos and images have separate size limits
+	if err := h.fileService.ValidateUpload(metadata["filename"], length); err != nil {
+		status := http.StatusBadRequest
+		if maxSize := h.fileService.MaxUploadSize(metadata["filename"]); length > maxSize {
+			c.Header("Tus-Max-Size", strconv.FormatInt(maxSize, 10))
+			status = http.StatusRequestEntityTooLarge
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Unfinished uploads count against the quota with their full length, so
+	// many of them opened at once cannot fill the disk past it
+	unlock := h.tusService.LockUser(userID)
+	defer unlock()
+
+	open, err := h.tusService.OpenBytes(userID)
+	if err != nil {
+		log.Printf("Failed to sum open uploads for %s: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check storage quota"})
+		return
+	}
+
+	if !h.checkQuota(c, userID, length+open) {
+		return
+	}
+
+	if referenceType := metadata["reference_type"]; referenceType != "" && !validReferenceTypes[referenceType] {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid reference type"})
+		return
+	}
+
+	// Resolve visibility now so the client learns about problems before
+	// sending any data
+	opts, ok := h.uploadOptions(c, userID, metadata["visibility"], metadata["recipe_id"])
+	if !ok {
+		return
+	}
+
+	if !h.checkVideoStep(c, metadata["filename"], metadata["recipe_id"], metadata["reference_type"], metadata["reference_id"]) {
+		return
+	}
+	metadata["visibility"] = services.VisibilityPublic
+	if opts.Private {
+		metadata["visibility"] = services.VisibilityPrivate
+	}
+
+	upload, err := h.tusService.Create(userID, length, metadata)
+	if err != nil {
+		log.Printf("Failed to create upload: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create upload"})
+		return
+	}
+
+	c.Header("Location", strings.TrimSuffix(c.Request.URL.Path, "/")+"/"+upload.ID)
+	c.Header("Upload-Expires", h.tusExpiry(upload))
+	c.Status(http.StatusCreated)
+}
+
+func (h *FileHandler) TusUploadOffset(c *gin.Context) {
+	if !h.tusHeaders(c) {
+		return
+	}
+
+	upload, ok := h.tusUpload(c)
+	if !ok {
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	h.writeTusState(c, upload)
+	c.Status(http.StatusOK)
+}
+
+func (h *FileHandler) TusPatchUpload(c *gin.Context) {
+	if !h.tusHeaders(c) {
+		return
+	}
+
+	if c.ContentType() != "application/offset+octet-stream" {
+		c.AbortWithStatus(http.StatusUnsupportedMediaType)
+		return
+	}
+
+	offset, err := strconv.ParseInt(c.GetHeader("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Valid Upload-Offset header required"})
+		return
+	}
+
+	upload, ok := h.tusUpload(c)
+	if !ok {
+		return
+	}
+
+	upload, err = h.tusService.WriteChunk(upload.ID, offset, c.Request.Body)
+	switch {
+	case errors.Is(err, services.ErrOffsetMismatch), errors.Is(err, services.ErrUploadCompleted):
+		c.AbortWithStatus(http.StatusConflict)
+		return
+	case err != nil:
+		log.Printf("Failed to write chunk for upload: %v", err)
+		if upload != nil {
+			h.writeTusState(c, upload)
+		}
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	if upload.IsComplete() {
+		if !h.storeTusUpload(c, upload) {
+			return
+		}
+	}
+
+	h.writeTusState(c, upload)
+	c.Status(http.StatusNoContent)
+}
+
+func (h *FileHandler) TusTerminateUpload(c *gin.Context) {
+	if !h.tusHeaders(c) {
+		return
+	}
+
+	upload, ok := h.tusUpload(c)
+	if !ok {
+		return
+	}
+
+	if err := h.tusService.Remove(upload.ID); err != nil {
+		log.Printf("Failed to terminate upload %s: %v", upload.ID, err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// storeTusUpload hands a fully received upload to the file service for
+// validation and storage, then records its ownership.
+func (h *FileHandler) storeTusUpload(c *gin.Context, upload *services.TusUpload) bool {
+	content, err := h.tusService.Open(upload.ID)
+	if err != nil {
+		log.Printf("Failed to open completed upload %s: %v", upload.ID, err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return false
+	}
+	defer content.Close()
+
+	opts := services.UploadOptions{Private: upload.Metadata["visibility"] == services.VisibilityPrivate}
+	result, ok := h.storeUpload(c, content, upload.Metadata["filename"], upload.Length, opts, services.CreateFileInput{
+		UserID:        upload.UserID,
+		RecipeID:      upload.Metadata["recipe_id"],
+		ReferenceType: upload.Metadata["reference_type"],
+		ReferenceID:   upload.Metadata["reference_id"],
+	})
+	if !ok {
+		// Every byte has been received, so there is nothing left to resume
+		if err := h.tusService.Remove(upload.ID); err != nil {
+			log.Printf("Failed to remove rejected upload %s: %v", upload.ID, err)
+		}
+		return false
+	}
+
+	if err := h.tusService.MarkStored(upload, result.ID, result.URL); err != nil {
+		log.Printf("Failed to mark upload %s as stored: %v", upload.ID, err)
+	}
+
+	return true
+}
+
+func (h *FileHandler) writeTusState(c *gin.Context, upload *services.TusUpload) {
+	c.Header("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	c.Header("Upload-Length", strconv.FormatInt(upload.Length, 10))
+	c.Header("Upload-Expires", h.tusExpiry(upload))
+
+	if upload.FileID != "" {
+		c.Header("Upload-File-Id", upload.FileID)
+		c.Header("Upload-File-Url", upload.FileURL)
+	}
+}
+
+func (h *FileHandler) tusExpiry(upload *services.TusUpload) string {
+	return upload.ExpiresAt(h.tusService.Expiry()).UTC().Format(http.TimeFormat)
+}
+
+// parseTusMetadata decodes "key base64value,key base64value" pairs.
+func parseTusMetadata(header string) (map[string]string, error) {
+	metadata := map[string]string{}
+	if header == "" {
+		return metadata, nil
+	}
+
+	for _, pair := range strings.Split(header, ",") {
+		parts := strings.Fields(pair)
+		if len(parts) == 0 || len(parts) > 2 {
+			return nil, errors.New("malformed metadata pair")
+		}
+
+		value := ""
+		if len(parts) == 2 {
+			decoded, err := base64.StdEncoding.DecodeString(parts[1])
+			if err != nil {
+				return nil, err
+			}
+			value = string(decoded)
+		}
+		metadata[parts[0]] = value
+	}
+
+	return metadata, nil
+}
@@ -0,0 +1,248 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"recipe-backend/internal/config"
+	"recipe-backend/internal/middleware"
+	"recipe-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+func newTusTestRouter(t *testing.T, expiry time.Duration) (*gin.Engine, *services.TusService) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	cfg := &config.Config{
+		AWSRegion:       "us-east-1",
+		MaxVideoSize:    50 * 1024 * 1024,
+		TusUploadDir:    t.TempDir(),
+		TusUploadExpiry: expiry,
+	}
+	tusService := services.NewTusService(cfg)
+	h := NewFileHandler(services.NewFileService(cfg), tusService, nil, nil, nil)
+
+	r := gin.New()
+	r.Use(middleware.CORS())
+	r.OPTIONS("/files/tus", h.TusOptions)
+
+	files := r.Group("/files")
+	files.Use(func(c *gin.Context) {
+		c.Set("user_id", c.GetHeader("X-Test-User"))
+	})
+	files.POST("/tus", h.TusCreateUpload)
+	files.HEAD("/tus/:uploadId", h.TusUploadOffset)
+	files.PATCH("/tus/:uploadId", h.TusPatchUpload)
+	files.DELETE("/tus/:uploadId", h.TusTerminateUpload)
+
+	return r, tusService
+}
+
+func tusRequest(r *gin.Engine, method, path string, body io.Reader, headers map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, body)
+	req.Header.Set("Tus-Resumable", tusVersion)
+	req.Header.Set("X-Test-User", "user-1")
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestTusOptions(t *testing.T) {
+	r, _ := newTusTestRouter(t, time.Hour)
+
+	req := httptest.NewRequest(http.MethodOptions, "/files/tus", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusNoContent)
+	}
+	for header, want := range map[string]string{
+		"Tus-Resumable": "1.0.0",
+		"Tus-Version":   "1.0.0",
+		"Tus-Extension": "creation,termination,expiration",
+		"Tus-Max-Size":  "52428800",
+	} {
+		if got := w.Header().Get(header); got != want {
+			t.Errorf("%s = %q, want %q", header, got, want)
+		}
+	}
+
+	// A CORS preflight is answered before it reaches the route
+	req = httptest.NewRequest(http.MethodOptions, "/files/tus", nil)
+	req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusNoContent || w.Header().Get("Tus-Extension") != "" {
+		t.Errorf("preflight = %d with Tus-Extension %q, want a bare 204", w.Code, w.Header().Get("Tus-Extension"))
+	}
+}
+
+func TestTusCreateUploadLength(t *testing.T) {
+	r, _ := newTusTestRouter(t, time.Hour)
+
+	tests := []struct {
+		name        string
+		length      string
+		filename    string
+		want        int
+		wantMaxSize string
+	}{
+		{name: "missing", length: "", filename: "photo.jpg", want: http.StatusBadRequest},
+		{name: "not a number", length: "ten", filename: "photo.jpg", want: http.StatusBadRequest},
+		{name: "zero", length: "0", filename: "photo.jpg", want: http.StatusBadRequest},
+		{name: "negative", length: "-1", filename: "photo.jpg", want: http.StatusBadRequest},
+		{name: "overflows int64", length: "9223372036854775808", filename: "photo.jpg", want: http.StatusBadRequest},
+		{name: "largest int64", length: "9223372036854775807", filename: "clip.mp4", want: http.StatusRequestEntityTooLarge, wantMaxSize: "52428800"},
+		{name: "image over limit", length: "10485761", filename: "photo.jpg", want: http.StatusRequestEntityTooLarge, wantMaxSize: "10485760"},
+		{name: "video over limit", length: "52428801", filename: "clip.webm", want: http.StatusRequestEntityTooLarge, wantMaxSize: "52428800"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := tusRequest(r, http.MethodPost, "/files/tus", nil, map[string]string{
+				"Upload-Length":   tt.length,
+				"Upload-Metadata": "filename " + base64.StdEncoding.EncodeToString([]byte(tt.filename)),
+			})
+
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d (%s)", w.Code, tt.want, w.Body.String())
+			}
+			if got := w.Header().Get("Tus-Max-Size"); got != tt.wantMaxSize {
+				t.Errorf("Tus-Max-Size = %q, want %q", got, tt.wantMaxSize)
+			}
+		})
+	}
+}
+
+// failingReader returns its data and then fails, like a dropped connection.
+type failingReader struct {
+	data string
+}
+
+func (r *failingReader) Read(p []byte) (int, error) {
+	if r.data == "" {
+		return 0, errors.New("connection reset by peer")
+	}
+	n := copy(p, r.data)
+	r.data = r.data[n:]
+	return n, nil
+}
+
+func TestTusPatchUpload(t *testing.T) {
+	r, tusService := newTusTestRouter(t, time.Hour)
+
+	upload, err := tusService.Create("user-1", 20, map[string]string{"filename": "photo.jpg"})
+	if err != nil {
+		t.Fatalf("Create() = %v", err)
+	}
+	path := "/files/tus/" + upload.ID
+
+	patch := func(offset string, body io.Reader) *httptest.ResponseRecorder {
+		return tusRequest(r, http.MethodPatch, path, body, map[string]string{
+			"Content-Type":  "application/offset+octet-stream",
+			"Upload-Offset": offset,
+		})
+	}
+	checkOffset := func(want string) {
+		t.Helper()
+		w := tusRequest(r, http.MethodHead, path, nil, nil)
+		if w.Code != http.StatusOK || w.Header().Get("Upload-Offset") != want {
+			t.Fatalf("HEAD = %d with Upload-Offset %q, want 200 with %s", w.Code, w.Header().Get("Upload-Offset"), want)
+		}
+	}
+
+	if w := patch("0", strings.NewReader("0123")); w.Code != http.StatusNoContent || w.Header().Get("Upload-Offset") != "4" {
+		t.Fatalf("first PATCH = %d with Upload-Offset %q, want 204 with 4", w.Code, w.Header().Get("Upload-Offset"))
+	}
+	checkOffset("4")
+
+	// A retry of a chunk that already arrived is refused
+	if w := patch("0", strings.NewReader("0123")); w.Code != http.StatusConflict {
+		t.Errorf("PATCH at a stale offset = %d, want %d", w.Code, http.StatusConflict)
+	}
+	if w := patch("9", strings.NewReader("9")); w.Code != http.StatusConflict {
+		t.Errorf("PATCH past the offset = %d, want %d", w.Code, http.StatusConflict)
+	}
+
+	// What arrived before the connection dropped is kept
+	w := patch("4", &failingReader{data: "456"})
+	if w.Code != http.StatusInternalServerError || w.Header().Get("Upload-Offset") != "7" {
+		t.Fatalf("interrupted PATCH = %d with Upload-Offset %q, want 500 with 7", w.Code, w.Header().Get("Upload-Offset"))
+	}
+	checkOffset("7")
+
+	if w := patch("7", strings.NewReader("789")); w.Code != http.StatusNoContent || w.Header().Get("Upload-Offset") != "10" {
+		t.Fatalf("resumed PATCH = %d with Upload-Offset %q, want 204 with 10", w.Code, w.Header().Get("Upload-Offset"))
+	}
+
+	content, err := tusService.Open(upload.ID)
+	if err != nil {
+		t.Fatalf("Open() = %v", err)
+	}
+	defer content.Close()
+	if data, _ := io.ReadAll(content); string(data) != "0123456789" {
+		t.Errorf("upload content = %q, want the chunks in order", data)
+	}
+
+	if w := tusRequest(r, http.MethodPatch, path, strings.NewReader("x"), map[string]string{"Upload-Offset": "10"}); w.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("PATCH without the tus content type = %d, want %d", w.Code, http.StatusUnsupportedMediaType)
+	}
+
+	// Other users cannot see the upload
+	req := httptest.NewRequest(http.MethodHead, path, nil)
+	req.Header.Set("Tus-Resumable", tusVersion)
+	req.Header.Set("X-Test-User", "user-2")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("HEAD by another user = %d, want %d", w.Code, http.StatusNotFound)
+	}
+}
+
+func TestTusExpiredUpload(t *testing.T) {
+	r, tusService := newTusTestRouter(t, time.Millisecond)
+
+	upload, err := tusService.Create("user-1", 20, map[string]string{"filename": "photo.jpg"})
+	if err != nil {
+		t.Fatalf("Create() = %v", err)
+	}
+	stored, err := tusService.Create("user-1", 20, map[string]string{"filename": "photo.jpg"})
+	if err != nil {
+		t.Fatalf("Create() = %v", err)
+	}
+	if err := tusService.MarkStored(stored, "file-1", "https://example.com/photo.jpg"); err != nil {
+		t.Fatalf("MarkStored() = %v", err)
+	}
+	time.Sleep(5 * time.Millisecond)
+
+	if w := tusRequest(r, http.MethodHead, "/files/tus/"+upload.ID, nil, nil); w.Code != http.StatusGone {
+		t.Errorf("HEAD of an expired upload = %d, want %d", w.Code, http.StatusGone)
+	}
+	w := tusRequest(r, http.MethodPatch, "/files/tus/"+upload.ID, strings.NewReader("0123"), map[string]string{
+		"Content-Type":  "application/offset+octet-stream",
+		"Upload-Offset": "0",
+	})
+	if w.Code != http.StatusGone {
+		t.Errorf("PATCH of an expired upload = %d, want %d", w.Code, http.StatusGone)
+	}
+
+	// A stored upload still reports where its file went
+	w = tusRequest(r, http.MethodHead, "/files/tus/"+stored.ID, nil, nil)
+	if w.Code != http.StatusOK || w.Header().Get("Upload-File-Id") != "file-1" {
+		t.Errorf("HEAD of a stored upload = %d with Upload-File-Id %q, want 200 with file-1", w.Code, w.Header().Get("Upload-File-Id"))
+	}
+}
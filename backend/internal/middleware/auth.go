@@ -1,6 +1,7 @@
 package middleware
 
 import (
+	"context"
 	"net/http"
 
 	"recipe-backend/internal/config"
@@ -36,6 +37,39 @@ func AuthRequired(jwtSecret string) gin.HandlerFunc {
 		// Set user info in context
 		c.Set("user_id", claims.UserID)
 		c.Set("user_email", claims.Email)
+		c.Next()
+	}
+}
+
+// AuthOptional identifies the user when the request carries a token and
+// lets anonymous requests through. An invalid token is still rejected.
+func AuthOptional(jwtSecret string) gin.HandlerFunc {
+	required := AuthRequired(jwtSecret)
+	return func(c *gin.Context) {
+		if c.GetHeader("Authorization") == "" {
+			c.Next()
+			return
+		}
+		required(c)
+	}
+}
+
+// AdminRequired only lets admins through. It must run after AuthRequired.
+func AdminRequired(hasuraService *services.HasuraService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		isAdmin, err := hasuraService.IsAdmin(context.Background(), c.GetString("user_id"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check permissions"})
+			c.Abort()
+			return
+		}
+
+		if !isAdmin {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Admin access required"})
+			c.Abort()
+			return
+		}
+
 		c.Next()
 	}
 }
\ No newline at end of file
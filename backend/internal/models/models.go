@@ -33,8 +33,99 @@ type User struct {
 }
 
 type PaymentRequest struct {
-	RecipeID    string  `json:"recipe_id" binding:"required"`
-	Amount      float64 `json:"amount" binding:"required,gt=0"`
+	// A purchase is of either a recipe or a bundle of recipes
+	RecipeID string `json:"recipe_id" binding:"required_without=BundleID,excluded_with=BundleID"`
+	BundleID string `json:"bundle_id"`
+	// Amount is the price the client showed the buyer. It is optional and
+	// only used to detect price changes; the charge comes from the recipe
+	// or bundle.
+	Amount      float64 `json:"amount" binding:"omitempty,gt=0"`
 	CallbackURL string  `json:"callback_url"`
 	ReturnURL   string  `json:"return_url"`
+	CouponCode  string  `json:"coupon_code" binding:"max=50"`
+	// Currency is what the buyer pays in; it defaults to the recipe's own.
+	Currency string `json:"currency" binding:"omitempty,oneof=ETB USD"`
+	// RecipientEmail makes the purchase a gift: the recipient is emailed a
+	// code to redeem and the buyer does not get access.
+	RecipientEmail string `json:"recipient_email" binding:"omitempty,email,max=254"`
+	GiftMessage    string `json:"gift_message" binding:"max=500"`
+}
+
+type RedeemGiftRequest struct {
+	Code string `json:"code" binding:"required,max=50"`
+}
+
+type RefundRequest struct {
+	// Amount to refund; omit to refund everything not yet refunded
+	Amount       float64 `json:"amount" binding:"omitempty,gt=0"`
+	Reason       string  `json:"reason" binding:"required,max=500"`
+	RevokeAccess bool    `json:"revoke_access"`
+}
+
+// PayoutAccountRequest describes a bank account or mobile money wallet.
+// BankCode is the provider's identifier for the bank or wallet.
+type PayoutAccountRequest struct {
+	Method        string `json:"method" binding:"required,oneof=bank mobile_money"`
+	BankCode      int    `json:"bank_code" binding:"required,gt=0"`
+	BankName      string `json:"bank_name" binding:"max=100"`
+	AccountName   string `json:"account_name" binding:"required,max=100"`
+	AccountNumber string `json:"account_number" binding:"required,max=50"`
+}
+
+type PayoutRequest struct {
+	PayoutAccountID string `json:"payout_account_id" binding:"required"`
+	// Amount to pay out; omit to request the whole available balance
+	Amount float64 `json:"amount" binding:"omitempty,gt=0"`
+}
+
+type RejectPayoutRequest struct {
+	Reason string `json:"reason" binding:"required,max=500"`
+}
+
+// CouponRequest creates a coupon. RecipeID is required for the recipe scope;
+// chef coupons apply to all of the creator's recipes.
+type CouponRequest struct {
+	Code           string  `json:"code" binding:"required,min=3,max=50,alphanum"`
+	DiscountType   string  `json:"discount_type" binding:"required,oneof=percent fixed"`
+	DiscountValue  float64 `json:"discount_value" binding:"required,gt=0"`
+	Currency       string  `json:"currency" binding:"omitempty,oneof=ETB USD"`
+	Scope          string  `json:"scope" binding:"required,oneof=recipe chef sitewide"`
+	RecipeID       string  `json:"recipe_id"`
+	ExpiresAt      string  `json:"expires_at"`
+	MaxUses        int     `json:"max_uses" binding:"omitempty,gt=0"`
+	MaxUsesPerUser int     `json:"max_uses_per_user" binding:"omitempty,gt=0"`
+}
+
+// ExchangeRateRequest sets how many units of QuoteCurrency one unit of
+// BaseCurrency is worth.
+type ExchangeRateRequest struct {
+	BaseCurrency  string  `json:"base_currency" binding:"required,oneof=ETB USD"`
+	QuoteCurrency string  `json:"quote_currency" binding:"required,oneof=ETB USD,nefield=BaseCurrency"`
+	Rate          float64 `json:"rate" binding:"required,gt=0"`
+}
+
+// BundleRequest creates a bundle of the chef's own premium recipes, listed
+// in the order they are shown.
+type BundleRequest struct {
+	Title       string   `json:"title" binding:"required,max=150"`
+	Description string   `json:"description" binding:"max=2000"`
+	Price       float64  `json:"price" binding:"required,gt=0"`
+	Currency    string   `json:"currency" binding:"omitempty,oneof=ETB USD"`
+	RecipeIDs   []string `json:"recipe_ids" binding:"required,min=2,max=20,dive,required"`
+}
+
+// SubscriptionPlanRequest creates a plan. Chef plans cover the creator's
+// premium recipes; all_premium plans are for admins.
+type SubscriptionPlanRequest struct {
+	Name            string  `json:"name" binding:"required,max=100"`
+	Description     string  `json:"description" binding:"max=1000"`
+	Scope           string  `json:"scope" binding:"required,oneof=all_premium chef"`
+	Price           float64 `json:"price" binding:"required,gt=0"`
+	BillingInterval string  `json:"billing_interval" binding:"omitempty,oneof=month year"`
+}
+
+type SubscribeRequest struct {
+	PlanID      string `json:"plan_id" binding:"required"`
+	CallbackURL string `json:"callback_url"`
+	ReturnURL   string `json:"return_url"`
 }
\ No newline at end of file
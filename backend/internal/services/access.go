@@ -0,0 +1,58 @@
+package services
+
+import (
+	"context"
+	"time"
+)
+
+// Reasons a user may read a recipe's premium content
+const (
+	AccessOwner        = "owner"
+	AccessPurchase     = "purchase"
+	AccessSubscription = "subscription"
+)
+
+// AccessService decides who may read a recipe's premium content: its owner,
+// buyers with a completed purchase and subscribers to a plan covering the
+// recipe's chef. An active subscription counts the same as a purchase.
+type AccessService struct {
+	hasuraService *HasuraService
+}
+
+func NewAccessService(hasuraService *HasuraService) *AccessService {
+	return &AccessService{
+		hasuraService: hasuraService,
+	}
+}
+
+// HasAccess reports whether the user owns, bought or subscribes to the
+// recipe. It does not look at whether the recipe is premium.
+func (s *AccessService) HasAccess(ctx context.Context, userID string, recipe *Recipe) (bool, error) {
+	reason, err := s.Access(ctx, userID, recipe)
+	return reason != "", err
+}
+
+// Access returns why the user may read the recipe, or "" when they may
+// not.
+func (s *AccessService) Access(ctx context.Context, userID string, recipe *Recipe) (string, error) {
+	if userID == "" {
+		return "", nil
+	}
+	if recipe.UserID == userID {
+		return AccessOwner, nil
+	}
+
+	purchased, err := s.hasuraService.HasCompletedPurchase(ctx, userID, recipe.ID)
+	if err != nil {
+		return "", err
+	}
+	if purchased {
+		return AccessPurchase, nil
+	}
+
+	subscribed, err := s.hasuraService.HasActiveSubscription(ctx, userID, recipe.UserID, time.Now())
+	if err != nil || !subscribed {
+		return "", err
+	}
+	return AccessSubscription, nil
+}
@@ -0,0 +1,203 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrBundleNotFound  = errors.New("bundle not found")
+	ErrBundleInvalid   = errors.New("invalid bundle")
+	ErrBundleForbidden = errors.New("not allowed to manage this bundle")
+	ErrOwnBundle       = errors.New("you cannot purchase your own bundle")
+	ErrBundleOwned     = errors.New("you already have access to every recipe in this bundle")
+)
+
+// How many recipes a bundle may hold
+const (
+	MinBundleRecipes = 2
+	MaxBundleRecipes = 20
+)
+
+// BundleService sells several premium recipes of one chef together for one
+// price, e.g. a week of fasting dishes. The price must be below what the
+// recipes cost on their own. A bundle is bought through the same checkout
+// as a single recipe; completing it unlocks every recipe in the bundle for
+// the buyer. Bundles cannot be changed once created, only deactivated, so
+// what a buyer paid for stays what they get.
+type BundleService struct {
+	currencyService *CurrencyService
+	accessService   *AccessService
+	hasuraService   *HasuraService
+}
+
+func NewBundleService(currencyService *CurrencyService, accessService *AccessService, hasuraService *HasuraService) *BundleService {
+	return &BundleService{
+		currencyService: currencyService,
+		accessService:   accessService,
+		hasuraService:   hasuraService,
+	}
+}
+
+// Create validates and stores a bundle of the chef's own published premium
+// recipes.
+func (s *BundleService) Create(ctx context.Context, bundle Bundle) (*Bundle, error) {
+	bundle.Title = strings.TrimSpace(bundle.Title)
+	if bundle.Title == "" {
+		return nil, fmt.Errorf("%w: title is required", ErrBundleInvalid)
+	}
+	if bundle.Price <= 0 {
+		return nil, fmt.Errorf("%w: price must be positive", ErrBundleInvalid)
+	}
+	bundle.Price = roundMoney(bundle.Price)
+
+	if bundle.Currency == "" {
+		bundle.Currency = LedgerCurrency
+	}
+	if !SupportedCurrency(bundle.Currency) {
+		return nil, fmt.Errorf("%w: unsupported currency %q", ErrBundleInvalid, bundle.Currency)
+	}
+
+	seen := make(map[string]bool, len(bundle.RecipeIDs))
+	for _, recipeID := range bundle.RecipeIDs {
+		if seen[recipeID] {
+			return nil, fmt.Errorf("%w: recipe %s is listed twice", ErrBundleInvalid, recipeID)
+		}
+		seen[recipeID] = true
+	}
+	if len(bundle.RecipeIDs) < MinBundleRecipes || len(bundle.RecipeIDs) > MaxBundleRecipes {
+		return nil, fmt.Errorf("%w: a bundle holds %d to %d recipes", ErrBundleInvalid, MinBundleRecipes, MaxBundleRecipes)
+	}
+
+	recipes, err := s.hasuraService.GetRecipesByIDs(ctx, bundle.RecipeIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	prices := make(map[string]float64, len(recipes))
+	var listPrice float64
+	for _, recipe := range recipes {
+		if recipe.UserID != bundle.ChefID {
+			return nil, fmt.Errorf("%w: %q is not your recipe", ErrBundleInvalid, recipe.Title)
+		}
+		if !recipe.IsPublished || !recipe.IsPremium || recipe.Price <= 0 {
+			return nil, fmt.Errorf("%w: %q is not a published premium recipe", ErrBundleInvalid, recipe.Title)
+		}
+
+		price, _, err := s.currencyService.Convert(ctx, recipe.Price, recipe.Currency, bundle.Currency)
+		if err != nil {
+			return nil, err
+		}
+		prices[recipe.ID] = price
+		listPrice += price
+	}
+
+	// Each recipe's own price weighs its share of the bundle's sales
+	bundle.ListPrices = make([]float64, len(bundle.RecipeIDs))
+	for i, recipeID := range bundle.RecipeIDs {
+		price, ok := prices[recipeID]
+		if !ok {
+			return nil, fmt.Errorf("%w: recipe %s not found", ErrBundleInvalid, recipeID)
+		}
+		bundle.ListPrices[i] = roundMoney(price)
+	}
+
+	if bundle.Price >= roundMoney(listPrice) {
+		return nil, fmt.Errorf("%w: price must be below %.2f %s, what the recipes cost on their own", ErrBundleInvalid, roundMoney(listPrice), bundle.Currency)
+	}
+
+	bundle.ID = uuid.New().String()
+	return s.hasuraService.CreateBundle(ctx, &bundle)
+}
+
+// Get returns an active bundle and its recipes in order.
+func (s *BundleService) Get(ctx context.Context, bundleID string) (*Bundle, []Recipe, error) {
+	bundle, err := s.hasuraService.GetBundle(ctx, bundleID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if bundle == nil || !bundle.IsActive {
+		return nil, nil, ErrBundleNotFound
+	}
+
+	recipes, err := s.hasuraService.GetRecipesByIDs(ctx, bundle.RecipeIDs)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return bundle, recipes, nil
+}
+
+// Deactivate stops sales of a bundle. Only its chef or an admin may do
+// this.
+func (s *BundleService) Deactivate(ctx context.Context, bundleID, userID string) (*Bundle, error) {
+	bundle, err := s.hasuraService.GetBundle(ctx, bundleID)
+	if err != nil {
+		return nil, err
+	}
+	if bundle == nil {
+		return nil, ErrBundleNotFound
+	}
+
+	if bundle.ChefID != userID {
+		isAdmin, err := s.hasuraService.IsAdmin(ctx, userID)
+		if err != nil {
+			return nil, err
+		}
+		if !isAdmin {
+			return nil, ErrBundleForbidden
+		}
+	}
+
+	if err := s.hasuraService.DeactivateBundle(ctx, bundle.ID); err != nil {
+		return nil, err
+	}
+
+	bundle.IsActive = false
+	return bundle, nil
+}
+
+// Purchasable returns a bundle the user may buy: an active bundle of
+// someone else whose recipes are all still published and premium, and
+// which has at least one recipe the user cannot read yet.
+func (s *BundleService) Purchasable(ctx context.Context, userID, bundleID string) (*Bundle, error) {
+	bundle, recipes, err := s.Get(ctx, bundleID)
+	if err != nil {
+		return nil, err
+	}
+
+	if bundle.ChefID == userID {
+		return nil, ErrOwnBundle
+	}
+
+	// A bundle whose recipes changed since it was created is no longer
+	// sold
+	if len(recipes) != len(bundle.RecipeIDs) {
+		return nil, ErrBundleNotFound
+	}
+
+	owned := 0
+	for i := range recipes {
+		if !recipes[i].IsPublished || !recipes[i].IsPremium {
+			return nil, ErrBundleNotFound
+		}
+
+		access, err := s.accessService.Access(ctx, userID, &recipes[i])
+		if err != nil {
+			return nil, err
+		}
+		if access != "" {
+			owned++
+		}
+	}
+
+	if owned == len(recipes) {
+		return nil, ErrBundleOwned
+	}
+
+	return bundle, nil
+}
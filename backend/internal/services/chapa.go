@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strings"
 
 	"recipe-backend/internal/config"
 )
@@ -19,10 +20,14 @@ func NewChapaService(cfg *config.Config) *ChapaService {
 	return &ChapaService{
 		config:     cfg,
 		httpClient: &http.Client{},
-		baseURL:    "https://api.chapa.co/v1",
+		baseURL:    strings.TrimSuffix(cfg.ChapaBaseURL, "/"),
 	}
 }
 
+func (s *ChapaService) Name() string {
+	return "chapa"
+}
+
 type InitializePaymentRequest struct {
 	Amount      string `json:"amount"`
 	Currency    string `json:"currency"`
@@ -47,14 +52,16 @@ type VerifyPaymentResponse struct {
 	Message string `json:"message"`
 	Status  string `json:"status"`
 	Data    struct {
-		Amount      string `json:"amount"`
-		Currency    string `json:"currency"`
-		Status      string `json:"status"`
-		Reference   string `json:"reference"`
-		TxRef       string `json:"tx_ref"`
-		ChargeID    string `json:"charge_id"`
-		CreatedAt   string `json:"created_at"`
-		UpdatedAt   string `json:"updated_at"`
+		// Chapa sends the amount as a number; json.Number also accepts
+		// it quoted
+		Amount    json.Number `json:"amount"`
+		Currency  string      `json:"currency"`
+		Status    string      `json:"status"`
+		Reference string      `json:"reference"`
+		TxRef     string      `json:"tx_ref"`
+		ChargeID  string      `json:"charge_id"`
+		CreatedAt string      `json:"created_at"`
+		UpdatedAt string      `json:"updated_at"`
 	} `json:"data"`
 }
 
@@ -107,6 +114,107 @@ func (s *ChapaService) VerifyPayment(txRef string) (*VerifyPaymentResponse, erro
 	defer resp.Body.Close()
 
 	var response VerifyPaymentResponse
+	decodeErr := json.NewDecoder(resp.Body).Decode(&response)
+
+	// Chapa only knows a transaction once its checkout has been opened
+	if resp.StatusCode == http.StatusNotFound ||
+		(resp.StatusCode >= 400 && resp.StatusCode < 500 && strings.Contains(strings.ToLower(response.Message), "not found")) {
+		return nil, fmt.Errorf("%w: %s", ErrPaymentNotFound, txRef)
+	}
+	if decodeErr != nil {
+		return nil, decodeErr
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("chapa API error: %s", response.Message)
+	}
+
+	return &response, nil
+}
+
+type RefundPaymentResponse struct {
+	Message string `json:"message"`
+	Status  string `json:"status"`
+	Data    struct {
+		Reference string      `json:"reference"`
+		Amount    json.Number `json:"amount"`
+		Status    string      `json:"status"`
+	} `json:"data"`
+}
+
+type VerifyRefundResponse struct {
+	Message string `json:"message"`
+	Status  string `json:"status"`
+	Data    struct {
+		Status    string      `json:"status"`
+		Amount    json.Number `json:"amount"`
+		Reference string      `json:"reference"`
+	} `json:"data"`
+}
+
+// RefundPayment refunds amount of a successful transaction back to the
+// customer. reference identifies the refund to VerifyRefund. Only a 4xx
+// answer means Chapa refused the refund; after any other error it may
+// still have been made.
+func (s *ChapaService) RefundPayment(txRef, reference string, amount float64, reason string) (*RefundPaymentResponse, error) {
+	jsonData, err := json.Marshal(map[string]string{
+		"amount":    fmt.Sprintf("%.2f", amount),
+		"reason":    reason,
+		"reference": reference,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	httpReq, err := http.NewRequest("POST", fmt.Sprintf("%s/refund/%s", s.baseURL, txRef), bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, err
+	}
+
+	httpReq.Header.Set("Authorization", "Bearer "+s.config.ChapaSecretKey)
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var response RefundPaymentResponse
+	decodeErr := json.NewDecoder(resp.Body).Decode(&response)
+
+	if resp.StatusCode >= 400 && resp.StatusCode < 500 {
+		return nil, fmt.Errorf("%w: chapa API error: %s", ErrRefundRejected, response.Message)
+	}
+	if decodeErr != nil {
+		return nil, decodeErr
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("chapa API error: %s", response.Message)
+	}
+
+	return &response, nil
+}
+
+// VerifyRefund looks up a refund by the reference it was made with.
+func (s *ChapaService) VerifyRefund(reference string) (*VerifyRefundResponse, error) {
+	httpReq, err := http.NewRequest("GET", fmt.Sprintf("%s/refund/verify/%s", s.baseURL, reference), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	httpReq.Header.Set("Authorization", "Bearer "+s.config.ChapaSecretKey)
+
+	resp, err := s.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("%w: %s", ErrRefundNotFound, reference)
+	}
+
+	var response VerifyRefundResponse
 	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
 		return nil, err
 	}
@@ -116,4 +224,103 @@ func (s *ChapaService) VerifyPayment(txRef string) (*VerifyPaymentResponse, erro
 	}
 
 	return &response, nil
-}
\ No newline at end of file
+}
+
+type TransferRequest struct {
+	AccountName   string `json:"account_name"`
+	AccountNumber string `json:"account_number"`
+	Amount        string `json:"amount"`
+	Currency      string `json:"currency"`
+	Reference     string `json:"reference"`
+	BankCode      int    `json:"bank_code"`
+}
+
+type TransferResponse struct {
+	Message string          `json:"message"`
+	Status  string          `json:"status"`
+	Data    json.RawMessage `json:"data"`
+}
+
+type VerifyTransferResponse struct {
+	Message string `json:"message"`
+	Status  string `json:"status"`
+	Data    struct {
+		Status          string `json:"status"`
+		Currency        string `json:"currency"`
+		TxRef           string `json:"tx_ref"`
+		ChapaTransferID string `json:"chapa_transfer_id"`
+		CreatedAt       string `json:"created_at"`
+		UpdatedAt       string `json:"updated_at"`
+	} `json:"data"`
+}
+
+// Transfer sends money from the merchant balance to a bank account or
+// mobile money wallet. Chapa queues transfers; the outcome is known once
+// VerifyTransfer reports it.
+func (s *ChapaService) Transfer(req TransferRequest) (*TransferResponse, error) {
+	jsonData, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	httpReq, err := http.NewRequest("POST", s.baseURL+"/transfers", bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, err
+	}
+
+	httpReq.Header.Set("Authorization", "Bearer "+s.config.ChapaSecretKey)
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var response TransferResponse
+	decodeErr := json.NewDecoder(resp.Body).Decode(&response)
+
+	// Only a client error means the transfer was refused. A server or
+	// gateway error says nothing about whether it was queued.
+	if resp.StatusCode >= 400 && resp.StatusCode < 500 {
+		return nil, fmt.Errorf("%w: chapa API error: %s", ErrTransferRejected, response.Message)
+	}
+	if decodeErr != nil {
+		return nil, decodeErr
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("chapa API error: %s", response.Message)
+	}
+
+	return &response, nil
+}
+
+func (s *ChapaService) VerifyTransfer(reference string) (*VerifyTransferResponse, error) {
+	httpReq, err := http.NewRequest("GET", fmt.Sprintf("%s/transfers/verify/%s", s.baseURL, reference), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	httpReq.Header.Set("Authorization", "Bearer "+s.config.ChapaSecretKey)
+
+	resp, err := s.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("%w: %s", ErrTransferNotFound, reference)
+	}
+
+	var response VerifyTransferResponse
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("chapa API error: %s", response.Message)
+	}
+
+	return &response, nil
+}
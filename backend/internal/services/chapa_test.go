@@ -0,0 +1,76 @@
+package services
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"recipe-backend/internal/config"
+)
+
+// chapaVerifyPayload is a verify response as Chapa sends it, with the
+// amount and charge as JSON numbers.
+const chapaVerifyPayload = `{
+  "message": "Payment details",
+  "status": "success",
+  "data": {
+    "first_name": "Abebe",
+    "last_name": "Bikila",
+    "email": "abebe@example.com",
+    "currency": "ETB",
+    "amount": 100,
+    "charge": 3.5,
+    "mode": "test",
+    "method": "test",
+    "type": "API",
+    "status": "success",
+    "reference": "6jnheVKQEmy",
+    "tx_ref": "tx-1",
+    "customization": {
+      "title": "Payment for Doro Wat",
+      "description": null,
+      "logo": null
+    },
+    "meta": null,
+    "created_at": "2025-02-02T07:05:23.000000Z",
+    "updated_at": "2025-02-02T07:05:23.000000Z"
+  }
+}`
+
+func TestChapaVerifyPayment(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload string
+		want    float64
+	}{
+		{name: "numeric amount", payload: chapaVerifyPayload, want: 100},
+		{name: "quoted amount", payload: `{"status": "success", "data": {"amount": "99.50", "currency": "ETB", "status": "success", "tx_ref": "tx-1"}}`, want: 99.5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/transaction/verify/tx-1" {
+					t.Errorf("path = %s, want /transaction/verify/tx-1", r.URL.Path)
+				}
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte(tt.payload))
+			}))
+			defer server.Close()
+
+			chapa := NewChapaService(&config.Config{ChapaBaseURL: server.URL})
+			response, err := chapa.VerifyPayment("tx-1")
+			if err != nil {
+				t.Fatalf("VerifyPayment() error = %v", err)
+			}
+
+			amount, err := response.Data.Amount.Float64()
+			if err != nil || amount != tt.want {
+				t.Errorf("amount = %v (%v), want %v", amount, err, tt.want)
+			}
+			if response.Data.Status != "success" || response.Data.Currency != "ETB" || response.Data.TxRef != "tx-1" {
+				t.Errorf("data = %+v", response.Data)
+			}
+		})
+	}
+}
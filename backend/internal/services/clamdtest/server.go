@@ -0,0 +1,191 @@
+// Package clamdtest provides a fake ClamAV daemon for tests. It speaks
+// enough of the clamd protocol (PING and INSTREAM) to exercise
+// services.ClamdScanner without a real virus database.
+package clamdtest
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"sync"
+)
+
+// EICAR is the standard antivirus test file. Real and fake scanners both
+// report it as infected.
+const EICAR = `X5O!P%@AP[4\PZX54(P^)7CC)7}$EICAR-STANDARD-ANTIVIRUS-TEST-FILE!$H+H*`
+
+var errSizeLimit = errors.New("INSTREAM size limit exceeded")
+
+// Server is a fake clamd listening on a local TCP port.
+type Server struct {
+	listener net.Listener
+
+	mu         sync.Mutex
+	signatures map[string]string
+	maxLength  int64
+	scans      int
+	wg         sync.WaitGroup
+}
+
+// NewServer starts a fake clamd that reports the EICAR test file as
+// "Eicar-Test-Signature". Callers should Close it when done.
+func NewServer() *Server {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic("clamdtest: failed to listen: " + err.Error())
+	}
+
+	s := &Server{
+		listener:   listener,
+		signatures: map[string]string{EICAR: "Eicar-Test-Signature"},
+	}
+
+	s.wg.Add(1)
+	go s.serve()
+	return s
+}
+
+// Addr returns the address to pass to services.NewClamdScanner.
+func (s *Server) Addr() string {
+	return s.listener.Addr().String()
+}
+
+// AddSignature makes the server report any stream containing pattern as
+// infected with the given signature name.
+func (s *Server) AddSignature(pattern, name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.signatures[pattern] = name
+}
+
+// SetStreamMaxLength makes the server refuse streams longer than n bytes,
+// like clamd's StreamMaxLength setting. Zero means no limit.
+func (s *Server) SetStreamMaxLength(n int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.maxLength = n
+}
+
+// Scans returns how many INSTREAM requests the server has answered.
+func (s *Server) Scans() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.scans
+}
+
+// Close stops the server and waits for open connections to finish.
+func (s *Server) Close() {
+	s.listener.Close()
+	s.wg.Wait()
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			defer conn.Close()
+			s.handle(conn)
+		}()
+	}
+}
+
+func (s *Server) handle(conn net.Conn) {
+	reader := bufio.NewReader(conn)
+
+	command, err := readCommand(reader)
+	if err != nil {
+		return
+	}
+
+	switch command {
+	case "PING":
+		conn.Write([]byte("PONG\x00"))
+	case "INSTREAM":
+		s.mu.Lock()
+		maxLength := s.maxLength
+		s.mu.Unlock()
+
+		// Like clamd, answer and hang up as soon as the limit is passed
+		data, err := readStream(reader, maxLength)
+		if errors.Is(err, errSizeLimit) {
+			conn.Write([]byte("INSTREAM size limit exceeded. ERROR\x00"))
+			return
+		}
+		if err != nil {
+			return
+		}
+		conn.Write([]byte("stream: " + s.scan(data) + "\x00"))
+	default:
+		conn.Write([]byte("UNKNOWN COMMAND\x00"))
+	}
+}
+
+func (s *Server) scan(data []byte) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.scans++
+	for pattern, name := range s.signatures {
+		if bytes.Contains(data, []byte(pattern)) {
+			return name + " FOUND"
+		}
+	}
+	return "OK"
+}
+
+// readCommand reads a "z"-prefixed (NUL terminated) or "n"-prefixed
+// (newline terminated) command.
+func readCommand(reader *bufio.Reader) (string, error) {
+	prefix, err := reader.ReadByte()
+	if err != nil {
+		return "", err
+	}
+
+	delimiter := byte('\n')
+	if prefix == 'z' {
+		delimiter = 0
+	}
+
+	command, err := reader.ReadString(delimiter)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSuffix(command, string(delimiter)), nil
+}
+
+func readStream(reader *bufio.Reader, maxLength int64) ([]byte, error) {
+	var data bytes.Buffer
+	size := make([]byte, 4)
+
+	for {
+		if _, err := io.ReadFull(reader, size); err != nil {
+			return nil, err
+		}
+
+		length := binary.BigEndian.Uint32(size)
+		if length == 0 {
+			return data.Bytes(), nil
+		}
+
+		if maxLength > 0 && int64(data.Len())+int64(length) > maxLength {
+			return nil, errSizeLimit
+		}
+
+		if _, err := io.CopyN(&data, reader, int64(length)); err != nil {
+			return nil, err
+		}
+	}
+}
@@ -0,0 +1,264 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var (
+	ErrCouponNotFound      = errors.New("coupon not found")
+	ErrCouponExpired       = errors.New("coupon has expired")
+	ErrCouponNotApplicable = errors.New("coupon does not apply to this recipe")
+	ErrCouponExhausted     = errors.New("coupon has reached its usage limit")
+	ErrCouponUserLimit     = errors.New("you have already used this coupon the maximum number of times")
+	ErrCouponInvalid       = errors.New("invalid coupon")
+	ErrCouponForbidden     = errors.New("not allowed to manage this coupon")
+)
+
+// CouponService creates coupons and works out the discount they give.
+//
+// Chefs create coupons for one of their recipes or for all of them; admins
+// may also create sitewide coupons. A coupon counts as used by every
+// purchase it was applied to that is still open or was paid for. Limits are
+// checked when a checkout starts, and the database enforces them again when
+// the purchase is recorded, so concurrent checkouts cannot go over them.
+type CouponService struct {
+	currencyService *CurrencyService
+	hasuraService   *HasuraService
+}
+
+func NewCouponService(currencyService *CurrencyService, hasuraService *HasuraService) *CouponService {
+	return &CouponService{
+		currencyService: currencyService,
+		hasuraService:   hasuraService,
+	}
+}
+
+// CouponQuote is the price of a recipe after a coupon.
+type CouponQuote struct {
+	Coupon   *Coupon
+	Price    float64
+	Discount float64
+	Amount   float64
+}
+
+// Apply checks that the coupon with the given code may be used by the user
+// for the recipe and returns the discounted price.
+func (s *CouponService) Apply(ctx context.Context, code, userID string, recipe *Recipe) (*CouponQuote, error) {
+	coupon, err := s.hasuraService.GetCouponByCode(ctx, strings.TrimSpace(code))
+	if err != nil {
+		return nil, err
+	}
+	if coupon == nil || !coupon.IsActive {
+		return nil, ErrCouponNotFound
+	}
+
+	if coupon.ExpiresAt != "" {
+		expiresAt, err := time.Parse(time.RFC3339Nano, coupon.ExpiresAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse coupon expiry: %w", err)
+		}
+		if !time.Now().Before(expiresAt) {
+			return nil, ErrCouponExpired
+		}
+	}
+
+	switch coupon.Scope {
+	case CouponScopeRecipe:
+		if coupon.RecipeID != recipe.ID {
+			return nil, ErrCouponNotApplicable
+		}
+	case CouponScopeChef:
+		if coupon.ChefID != recipe.UserID {
+			return nil, ErrCouponNotApplicable
+		}
+	case CouponScopeSitewide:
+	default:
+		return nil, ErrCouponNotApplicable
+	}
+
+	if coupon.MaxUses > 0 || coupon.MaxUsesPerUser > 0 {
+		total, byUser, err := s.hasuraService.CountCouponUses(ctx, coupon.ID, userID, recipe.ID)
+		if err != nil {
+			return nil, err
+		}
+		if coupon.MaxUses > 0 && total >= coupon.MaxUses {
+			return nil, ErrCouponExhausted
+		}
+		if coupon.MaxUsesPerUser > 0 && byUser >= coupon.MaxUsesPerUser {
+			return nil, ErrCouponUserLimit
+		}
+	}
+
+	// Fixed discounts are converted into the currency the recipe is priced in
+	value := coupon.DiscountValue
+	if coupon.DiscountType == CouponFixed && coupon.Currency != "" && coupon.Currency != recipe.Currency {
+		value, _, err = s.currencyService.Convert(ctx, value, coupon.Currency, recipe.Currency)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	price := roundMoney(recipe.Price)
+	discount := couponDiscount(coupon.DiscountType, value, price)
+
+	return &CouponQuote{
+		Coupon:   coupon,
+		Price:    price,
+		Discount: discount,
+		Amount:   roundMoney(price - discount),
+	}, nil
+}
+
+// CouponLimitError returns ErrCouponUserLimit or ErrCouponExhausted when err
+// is the database rejecting a purchase for taking its coupon past one of its
+// limits, and nil for any other error.
+func CouponLimitError(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case strings.Contains(err.Error(), "has reached its usage limit for user"):
+		return ErrCouponUserLimit
+	case strings.Contains(err.Error(), "has reached its usage limit"):
+		return ErrCouponExhausted
+	}
+	return nil
+}
+
+// couponDiscount returns the discount a coupon of the given type and value
+// gives on a price. It never exceeds the price.
+func couponDiscount(discountType string, value, price float64) float64 {
+	var discount float64
+	switch discountType {
+	case CouponPercent:
+		discount = roundMoney(price * value / 100)
+	case CouponFixed:
+		discount = roundMoney(value)
+	}
+
+	if discount > price {
+		discount = price
+	}
+	return discount
+}
+
+// Create validates and stores a new coupon. Chef coupons are always for the
+// creator's own recipes; recipe coupons must be for a recipe the creator
+// owns unless they are an admin, and only admins may create sitewide ones.
+func (s *CouponService) Create(ctx context.Context, coupon Coupon) (*Coupon, error) {
+	coupon.Code = strings.ToUpper(strings.TrimSpace(coupon.Code))
+	if coupon.Code == "" {
+		return nil, fmt.Errorf("%w: code is required", ErrCouponInvalid)
+	}
+
+	switch coupon.DiscountType {
+	case CouponPercent:
+		if coupon.DiscountValue <= 0 || coupon.DiscountValue > 100 {
+			return nil, fmt.Errorf("%w: percentage must be between 0 and 100", ErrCouponInvalid)
+		}
+	case CouponFixed:
+		if coupon.DiscountValue <= 0 {
+			return nil, fmt.Errorf("%w: discount must be positive", ErrCouponInvalid)
+		}
+	default:
+		return nil, fmt.Errorf("%w: unknown discount type %q", ErrCouponInvalid, coupon.DiscountType)
+	}
+
+	if coupon.ExpiresAt != "" {
+		expiresAt, err := time.Parse(time.RFC3339, coupon.ExpiresAt)
+		if err != nil {
+			return nil, fmt.Errorf("%w: expires_at must be an RFC 3339 time", ErrCouponInvalid)
+		}
+		if !expiresAt.After(time.Now()) {
+			return nil, fmt.Errorf("%w: expires_at must be in the future", ErrCouponInvalid)
+		}
+	}
+
+	isAdmin, err := s.hasuraService.IsAdmin(ctx, coupon.CreatedBy)
+	if err != nil {
+		return nil, err
+	}
+
+	switch coupon.Scope {
+	case CouponScopeRecipe:
+		if coupon.RecipeID == "" {
+			return nil, fmt.Errorf("%w: recipe_id is required", ErrCouponInvalid)
+		}
+		recipe, err := s.hasuraService.GetRecipeByID(ctx, coupon.RecipeID)
+		if err != nil {
+			return nil, err
+		}
+		if recipe == nil {
+			return nil, fmt.Errorf("%w: recipe not found", ErrCouponInvalid)
+		}
+		if recipe.UserID != coupon.CreatedBy && !isAdmin {
+			return nil, ErrCouponForbidden
+		}
+		if coupon.Currency == "" {
+			coupon.Currency = recipe.Currency
+		}
+		coupon.ChefID = ""
+	case CouponScopeChef:
+		coupon.RecipeID = ""
+		coupon.ChefID = coupon.CreatedBy
+	case CouponScopeSitewide:
+		if !isAdmin {
+			return nil, ErrCouponForbidden
+		}
+		coupon.RecipeID = ""
+		coupon.ChefID = ""
+	default:
+		return nil, fmt.Errorf("%w: unknown scope %q", ErrCouponInvalid, coupon.Scope)
+	}
+
+	// Fixed discounts are in this currency; recipe coupons default to the
+	// recipe's own
+	if coupon.Currency == "" {
+		coupon.Currency = LedgerCurrency
+	}
+	if !SupportedCurrency(coupon.Currency) {
+		return nil, fmt.Errorf("%w: unsupported currency %q", ErrCouponInvalid, coupon.Currency)
+	}
+
+	existing, err := s.hasuraService.GetCouponByCode(ctx, coupon.Code)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return nil, fmt.Errorf("%w: code is already taken", ErrCouponInvalid)
+	}
+
+	return s.hasuraService.CreateCoupon(ctx, coupon)
+}
+
+// Deactivate stops a coupon from being applied to new checkouts. Only its
+// creator or an admin may do this.
+func (s *CouponService) Deactivate(ctx context.Context, couponID, userID string) (*Coupon, error) {
+	coupon, err := s.hasuraService.GetCoupon(ctx, couponID)
+	if err != nil {
+		return nil, err
+	}
+	if coupon == nil {
+		return nil, ErrCouponNotFound
+	}
+
+	if coupon.CreatedBy != userID {
+		isAdmin, err := s.hasuraService.IsAdmin(ctx, userID)
+		if err != nil {
+			return nil, err
+		}
+		if !isAdmin {
+			return nil, ErrCouponForbidden
+		}
+	}
+
+	if err := s.hasuraService.DeactivateCoupon(ctx, coupon.ID); err != nil {
+		return nil, err
+	}
+
+	coupon.IsActive = false
+	return coupon, nil
+}
@@ -0,0 +1,52 @@
+package services
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCouponLimitError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want error
+	}{
+		{name: "no error"},
+		{name: "total limit", err: errors.New(`database query error: coupon c1 has reached its usage limit`), want: ErrCouponExhausted},
+		{name: "per-user limit", err: errors.New(`database query error: coupon c1 has reached its usage limit for user u1`), want: ErrCouponUserLimit},
+		{name: "other error", err: errors.New(`database query error: Uniqueness violation`)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := CouponLimitError(tt.err); got != tt.want {
+				t.Errorf("CouponLimitError() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCouponDiscount(t *testing.T) {
+	tests := []struct {
+		name         string
+		discountType string
+		value        float64
+		price        float64
+		want         float64
+	}{
+		{name: "percent", discountType: CouponPercent, value: 20, price: 100, want: 20},
+		{name: "percent rounded to cents", discountType: CouponPercent, value: 15, price: 33.33, want: 5},
+		{name: "full percent", discountType: CouponPercent, value: 100, price: 49.99, want: 49.99},
+		{name: "fixed", discountType: CouponFixed, value: 25, price: 100, want: 25},
+		{name: "fixed above price", discountType: CouponFixed, value: 150, price: 100, want: 100},
+		{name: "unknown type", discountType: "bogus", value: 10, price: 100, want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := couponDiscount(tt.discountType, tt.value, tt.price); got != tt.want {
+				t.Errorf("couponDiscount(%s, %v, %v) = %v, want %v", tt.discountType, tt.value, tt.price, got, tt.want)
+			}
+		})
+	}
+}
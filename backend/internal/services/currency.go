@@ -0,0 +1,246 @@
+package services
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"recipe-backend/internal/config"
+)
+
+const (
+	CurrencyETB = "ETB"
+	CurrencyUSD = "USD"
+
+	// LedgerCurrency is the currency the creator ledger, earnings and
+	// payouts are kept in.
+	LedgerCurrency = CurrencyETB
+)
+
+const (
+	ExchangeRateSourceAdmin = "admin"
+	ExchangeRateSourceCSV   = "csv"
+)
+
+var (
+	ErrUnsupportedCurrency = errors.New("unsupported currency")
+	ErrExchangeRateMissing = errors.New("no exchange rate for currency pair")
+	ErrExchangeRateStale   = errors.New("exchange rate is out of date")
+	ErrExchangeRateInvalid = errors.New("invalid exchange rate")
+)
+
+// SupportedCurrency reports whether recipes may be priced and paid in the
+// currency. Both are currencies Chapa accepts.
+func SupportedCurrency(currency string) bool {
+	return currency == CurrencyETB || currency == CurrencyUSD
+}
+
+// CurrencyService converts prices between currencies using the rates admins
+// keep in the exchange_rates table.
+//
+// A rate stored for one direction of a pair is used for the other direction
+// too, inverted; if both directions are stored, the one updated last wins.
+// Rates older than the configured maximum age are refused so
+// a forgotten rate does not keep pricing checkouts.
+type CurrencyService struct {
+	config        *config.Config
+	hasuraService *HasuraService
+}
+
+func NewCurrencyService(cfg *config.Config, hasuraService *HasuraService) *CurrencyService {
+	return &CurrencyService{
+		config:        cfg,
+		hasuraService: hasuraService,
+	}
+}
+
+// Rate returns how many units of to one unit of from is worth.
+func (s *CurrencyService) Rate(ctx context.Context, from, to string) (float64, error) {
+	if !SupportedCurrency(from) {
+		return 0, fmt.Errorf("%w: %s", ErrUnsupportedCurrency, from)
+	}
+	if !SupportedCurrency(to) {
+		return 0, fmt.Errorf("%w: %s", ErrUnsupportedCurrency, to)
+	}
+	if from == to {
+		return 1, nil
+	}
+
+	direct, err := s.hasuraService.GetExchangeRate(ctx, from, to)
+	if err != nil {
+		return 0, err
+	}
+	reverse, err := s.hasuraService.GetExchangeRate(ctx, to, from)
+	if err != nil {
+		return 0, err
+	}
+
+	// When both directions are stored the one updated last is used, so an
+	// update to either takes effect
+	var rate *ExchangeRate
+	var updatedAt time.Time
+	inverse := false
+	for i, candidate := range []*ExchangeRate{direct, reverse} {
+		if candidate == nil || candidate.Rate <= 0 {
+			continue
+		}
+		at, err := time.Parse(time.RFC3339Nano, candidate.UpdatedAt)
+		if err != nil {
+			return 0, fmt.Errorf("failed to parse exchange rate time: %w", err)
+		}
+		if rate == nil || at.After(updatedAt) {
+			rate, updatedAt, inverse = candidate, at, i == 1
+		}
+	}
+	if rate == nil {
+		return 0, fmt.Errorf("%w: %s/%s", ErrExchangeRateMissing, from, to)
+	}
+
+	if s.config.ExchangeRateMaxAge > 0 && time.Since(updatedAt) > s.config.ExchangeRateMaxAge {
+		return 0, fmt.Errorf("%w: %s/%s was last updated %s", ErrExchangeRateStale,
+			rate.BaseCurrency, rate.QuoteCurrency, updatedAt.Format(time.RFC3339))
+	}
+
+	if inverse {
+		return 1 / rate.Rate, nil
+	}
+	return rate.Rate, nil
+}
+
+// Convert converts an amount and returns it rounded to cents together with
+// the rate used.
+func (s *CurrencyService) Convert(ctx context.Context, amount float64, from, to string) (float64, float64, error) {
+	rate, err := s.Rate(ctx, from, to)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return roundMoney(amount * rate), rate, nil
+}
+
+// CurrencyQuote is a price converted into the currency a buyer pays in.
+type CurrencyQuote struct {
+	Currency   string
+	Rate       float64
+	Amount     float64
+	Settlement float64 // Amount in the ledger currency
+}
+
+// Convert converts another amount listed in the same currency as the quoted
+// price, e.g. the price before a discount.
+func (q *CurrencyQuote) Convert(amount float64) float64 {
+	return roundMoney(amount * q.Rate)
+}
+
+// Quote converts a price from the currency it is listed in into the currency
+// the buyer pays in and works out what it is worth in the ledger currency.
+func (s *CurrencyService) Quote(ctx context.Context, amount float64, from, to string) (*CurrencyQuote, error) {
+	charged, rate, err := s.Convert(ctx, amount, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	quote := &CurrencyQuote{
+		Currency:   to,
+		Rate:       rate,
+		Amount:     charged,
+		Settlement: charged,
+	}
+
+	switch {
+	case to == LedgerCurrency:
+	case from == LedgerCurrency:
+		quote.Settlement = roundMoney(amount)
+	default:
+		quote.Settlement, _, err = s.Convert(ctx, charged, to, LedgerCurrency)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return quote, nil
+}
+
+// SetRates validates and stores rates on behalf of an admin.
+func (s *CurrencyService) SetRates(ctx context.Context, rates []ExchangeRate, source, userID string) ([]ExchangeRate, error) {
+	if len(rates) == 0 {
+		return nil, fmt.Errorf("%w: no rates given", ErrExchangeRateInvalid)
+	}
+
+	seen := make(map[string]bool, len(rates))
+	for i := range rates {
+		rate := &rates[i]
+		rate.BaseCurrency = strings.ToUpper(strings.TrimSpace(rate.BaseCurrency))
+		rate.QuoteCurrency = strings.ToUpper(strings.TrimSpace(rate.QuoteCurrency))
+
+		if !SupportedCurrency(rate.BaseCurrency) || !SupportedCurrency(rate.QuoteCurrency) {
+			return nil, fmt.Errorf("%w: %s/%s", ErrUnsupportedCurrency, rate.BaseCurrency, rate.QuoteCurrency)
+		}
+		if rate.BaseCurrency == rate.QuoteCurrency {
+			return nil, fmt.Errorf("%w: %s/%s converts a currency to itself", ErrExchangeRateInvalid, rate.BaseCurrency, rate.QuoteCurrency)
+		}
+		if rate.Rate <= 0 || math.IsInf(rate.Rate, 0) || math.IsNaN(rate.Rate) {
+			return nil, fmt.Errorf("%w: rate for %s/%s must be positive", ErrExchangeRateInvalid, rate.BaseCurrency, rate.QuoteCurrency)
+		}
+
+		pair := rate.BaseCurrency + "/" + rate.QuoteCurrency
+		if seen[pair] {
+			return nil, fmt.Errorf("%w: %s is given more than once", ErrExchangeRateInvalid, pair)
+		}
+		seen[pair] = true
+	}
+
+	return s.hasuraService.UpsertExchangeRates(ctx, rates, source, userID)
+}
+
+// ParseRatesCSV reads rates from CSV rows of base currency, quote currency
+// and rate. A first row that does not hold a number in the rate column is
+// taken as a header and skipped.
+func ParseRatesCSV(r io.Reader) ([]ExchangeRate, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = 3
+	reader.TrimLeadingSpace = true
+
+	var rates []ExchangeRate
+	for row := 1; ; row++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrExchangeRateInvalid, err)
+		}
+
+		value, err := strconv.ParseFloat(strings.TrimSpace(record[2]), 64)
+		if err != nil {
+			if row == 1 {
+				continue
+			}
+			return nil, fmt.Errorf("%w: row %d: rate %q is not a number", ErrExchangeRateInvalid, row, record[2])
+		}
+
+		rates = append(rates, ExchangeRate{
+			BaseCurrency:  record[0],
+			QuoteCurrency: record[1],
+			Rate:          value,
+		})
+	}
+
+	return rates, nil
+}
+
+// InLedgerCurrency converts an amount charged for the purchase into the
+// ledger currency at the rate the purchase was settled at.
+func (p *Purchase) InLedgerCurrency(amount float64) float64 {
+	if p.Currency == "" || p.Currency == LedgerCurrency || p.Amount <= 0 || p.SettlementAmount <= 0 {
+		return roundMoney(amount)
+	}
+
+	return roundMoney(amount * p.SettlementAmount / p.Amount)
+}
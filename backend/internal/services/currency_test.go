@@ -0,0 +1,188 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"recipe-backend/internal/config"
+)
+
+// newTestCurrencyService answers rate lookups from rates, keyed by
+// "BASE/QUOTE".
+func newTestCurrencyService(t *testing.T, maxAge time.Duration, rates map[string]*ExchangeRate) *CurrencyService {
+	hasura := newFakeHasura(t, func(query string, variables map[string]interface{}) interface{} {
+		if !strings.Contains(query, "GetExchangeRate") {
+			t.Errorf("unexpected query %s", query)
+			return nil
+		}
+		return map[string]interface{}{"exchange_rates_by_pk": rates[variables["base"].(string)+"/"+variables["quote"].(string)]}
+	})
+
+	return NewCurrencyService(&config.Config{ExchangeRateMaxAge: maxAge}, hasura)
+}
+
+func testRate(base, quote string, rate float64, age time.Duration) *ExchangeRate {
+	return &ExchangeRate{
+		BaseCurrency:  base,
+		QuoteCurrency: quote,
+		Rate:          rate,
+		UpdatedAt:     time.Now().Add(-age).UTC().Format(time.RFC3339Nano),
+	}
+}
+
+func TestCurrencyRate(t *testing.T) {
+	tests := []struct {
+		name     string
+		rates    map[string]*ExchangeRate
+		from, to string
+		want     float64
+		wantErr  error
+	}{
+		{name: "same currency", from: "ETB", to: "ETB", want: 1},
+		{name: "stored direction", rates: map[string]*ExchangeRate{"USD/ETB": testRate("USD", "ETB", 125, time.Hour)}, from: "USD", to: "ETB", want: 125},
+		{name: "inverse", rates: map[string]*ExchangeRate{"USD/ETB": testRate("USD", "ETB", 125, time.Hour)}, from: "ETB", to: "USD", want: 0.008},
+		{
+			name: "newer inverse wins",
+			rates: map[string]*ExchangeRate{
+				"USD/ETB": testRate("USD", "ETB", 110, 30*time.Hour),
+				"ETB/USD": testRate("ETB", "USD", 0.008, time.Hour),
+			},
+			from: "USD", to: "ETB", want: 125,
+		},
+		{
+			name: "newer direct wins",
+			rates: map[string]*ExchangeRate{
+				"USD/ETB": testRate("USD", "ETB", 125, time.Hour),
+				"ETB/USD": testRate("ETB", "USD", 0.01, 30*time.Hour),
+			},
+			from: "USD", to: "ETB", want: 125,
+		},
+		{
+			// The fresh rate is used, not refused because of the old one
+			name: "stale and fresh direction",
+			rates: map[string]*ExchangeRate{
+				"USD/ETB": testRate("USD", "ETB", 110, 72*time.Hour),
+				"ETB/USD": testRate("ETB", "USD", 0.008, time.Hour),
+			},
+			from: "ETB", to: "USD", want: 0.008,
+		},
+		{name: "stale", rates: map[string]*ExchangeRate{"USD/ETB": testRate("USD", "ETB", 125, 48*time.Hour)}, from: "ETB", to: "USD", wantErr: ErrExchangeRateStale},
+		{name: "zero rate", rates: map[string]*ExchangeRate{"USD/ETB": testRate("USD", "ETB", 0, time.Hour)}, from: "USD", to: "ETB", wantErr: ErrExchangeRateMissing},
+		{name: "missing", from: "USD", to: "ETB", wantErr: ErrExchangeRateMissing},
+		{name: "unsupported", from: "EUR", to: "ETB", wantErr: ErrUnsupportedCurrency},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestCurrencyService(t, 24*time.Hour, tt.rates)
+
+			got, err := s.Rate(context.Background(), tt.from, tt.to)
+			if !errors.Is(err, tt.wantErr) || (err != nil) != (tt.wantErr != nil) {
+				t.Fatalf("Rate() = %v, %v, want %v", got, err, tt.wantErr)
+			}
+			if math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("Rate() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCurrencyRateNoMaxAge(t *testing.T) {
+	s := newTestCurrencyService(t, 0, map[string]*ExchangeRate{"USD/ETB": testRate("USD", "ETB", 125, 365*24*time.Hour)})
+
+	if got, err := s.Rate(context.Background(), "USD", "ETB"); err != nil || got != 125 {
+		t.Errorf("Rate() = %v, %v, want 125 when rates never go stale", got, err)
+	}
+}
+
+func TestCurrencyQuote(t *testing.T) {
+	s := newTestCurrencyService(t, 24*time.Hour, map[string]*ExchangeRate{"USD/ETB": testRate("USD", "ETB", 125.5, time.Hour)})
+
+	tests := []struct {
+		name     string
+		amount   float64
+		from, to string
+		want     CurrencyQuote
+	}{
+		{
+			name: "paid in the ledger currency", amount: 4, from: "USD", to: "ETB",
+			want: CurrencyQuote{Currency: "ETB", Rate: 125.5, Amount: 502, Settlement: 502},
+		},
+		{
+			// The listed ETB price is what the sale is worth, not the
+			// rounded USD charge converted back
+			name: "listed in the ledger currency", amount: 333, from: "ETB", to: "USD",
+			want: CurrencyQuote{Currency: "USD", Rate: 1 / 125.5, Amount: 2.65, Settlement: 333},
+		},
+		{
+			name: "neither in the ledger currency", amount: 2.5, from: "USD", to: "USD",
+			want: CurrencyQuote{Currency: "USD", Rate: 1, Amount: 2.5, Settlement: 313.75},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.Quote(context.Background(), tt.amount, tt.from, tt.to)
+			if err != nil {
+				t.Fatalf("Quote() error = %v", err)
+			}
+			if *got != tt.want {
+				t.Errorf("Quote() = %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+
+	if _, err := s.Quote(context.Background(), 10, "EUR", "ETB"); !errors.Is(err, ErrUnsupportedCurrency) {
+		t.Errorf("Quote() from EUR = %v, want %v", err, ErrUnsupportedCurrency)
+	}
+}
+
+func TestParseRatesCSV(t *testing.T) {
+	tests := []struct {
+		name    string
+		csv     string
+		want    []ExchangeRate
+		wantErr string
+	}{
+		{
+			name: "with header",
+			csv:  "base,quote,rate\nUSD,ETB,125.50\n",
+			want: []ExchangeRate{{BaseCurrency: "USD", QuoteCurrency: "ETB", Rate: 125.5}},
+		},
+		{
+			name: "without header",
+			csv:  "USD, ETB, 125.5\nETB,USD, 0.008\n",
+			want: []ExchangeRate{
+				{BaseCurrency: "USD", QuoteCurrency: "ETB", Rate: 125.5},
+				{BaseCurrency: "ETB", QuoteCurrency: "USD", Rate: 0.008},
+			},
+		},
+		{name: "header only", csv: "base,quote,rate\n"},
+		{name: "bad rate", csv: "base,quote,rate\nUSD,ETB,lots\n", wantErr: `row 2: rate "lots" is not a number`},
+		{name: "missing column", csv: "USD,ETB\n", wantErr: "wrong number of fields"},
+		{name: "extra column", csv: "USD,ETB,125.5,admin\n", wantErr: "wrong number of fields"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseRatesCSV(strings.NewReader(tt.csv))
+			if tt.wantErr != "" {
+				if !errors.Is(err, ErrExchangeRateInvalid) || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("ParseRatesCSV() = %v, want %v containing %q", err, ErrExchangeRateInvalid, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseRatesCSV() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseRatesCSV() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
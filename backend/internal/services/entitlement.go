@@ -0,0 +1,132 @@
+package services
+
+import (
+	"context"
+	"errors"
+
+	"recipe-backend/internal/config"
+)
+
+var ErrRecipeNotFound = errors.New("recipe not found")
+
+// Premium teasers
+const (
+	TeaserSteps       = "steps"
+	TeaserIngredients = "ingredients"
+)
+
+// How a reader came by the content they were given, besides the reasons
+// AccessService grants access for
+const (
+	AccessFree   = "free"
+	AccessTeaser = "teaser"
+)
+
+// EntitlementService decides how much of a recipe a reader gets. Free
+// recipes are open to everyone. A premium recipe's ingredients and steps
+// go in full to the readers AccessService lets in, that is its owner,
+// buyers and subscribers; everyone else, signed in or not, gets the
+// configured teaser.
+type EntitlementService struct {
+	config        *config.Config
+	accessService *AccessService
+	hasuraService *HasuraService
+}
+
+func NewEntitlementService(cfg *config.Config, accessService *AccessService, hasuraService *HasuraService) *EntitlementService {
+	return &EntitlementService{
+		config:        cfg,
+		accessService: accessService,
+		hasuraService: hasuraService,
+	}
+}
+
+// RecipeContent is what a reader may see of a recipe's ingredients and
+// steps. The totals count everything, including what the teaser leaves out.
+type RecipeContent struct {
+	Recipe           *Recipe            `json:"recipe"`
+	Access           string             `json:"access"`
+	Full             bool               `json:"full"`
+	Teaser           string             `json:"teaser,omitempty"`
+	Steps            []RecipeStep       `json:"steps"`
+	Ingredients      []RecipeIngredient `json:"ingredients"`
+	TotalSteps       int                `json:"total_steps"`
+	TotalIngredients int                `json:"total_ingredients"`
+}
+
+// Entitlement returns why the user may read the whole recipe, or "" when
+// they only get the teaser. userID is empty for anonymous readers.
+func (s *EntitlementService) Entitlement(ctx context.Context, userID string, recipe *Recipe) (string, error) {
+	if !recipe.IsPremium {
+		return AccessFree, nil
+	}
+
+	return s.accessService.Access(ctx, userID, recipe)
+}
+
+// Content returns the part of a recipe's content the user may read.
+// Unpublished recipes are only shown to their owner.
+func (s *EntitlementService) Content(ctx context.Context, userID, recipeID string) (*RecipeContent, error) {
+	recipe, err := s.hasuraService.GetRecipeByID(ctx, recipeID)
+	if err != nil {
+		return nil, err
+	}
+	if recipe == nil || (!recipe.IsPublished && recipe.UserID != userID) {
+		return nil, ErrRecipeNotFound
+	}
+
+	access, err := s.Entitlement(ctx, userID, recipe)
+	if err != nil {
+		return nil, err
+	}
+
+	steps, ingredients, err := s.hasuraService.GetRecipeContent(ctx, recipe.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	content := &RecipeContent{
+		Recipe:           recipe,
+		Access:           access,
+		Full:             access != "",
+		Steps:            steps,
+		Ingredients:      ingredients,
+		TotalSteps:       len(steps),
+		TotalIngredients: len(ingredients),
+	}
+
+	if !content.Full {
+		content.Access = AccessTeaser
+		content.Teaser = s.config.PremiumTeaser
+		content.Steps, content.Ingredients = s.teaser(steps, ingredients)
+	}
+
+	if content.Steps == nil {
+		content.Steps = []RecipeStep{}
+	}
+	if content.Ingredients == nil {
+		content.Ingredients = []RecipeIngredient{}
+	}
+
+	return content, nil
+}
+
+// teaser cuts a premium recipe's content down to the configured teaser.
+func (s *EntitlementService) teaser(steps []RecipeStep, ingredients []RecipeIngredient) ([]RecipeStep, []RecipeIngredient) {
+	if s.config.PremiumTeaser == TeaserIngredients {
+		names := make([]RecipeIngredient, len(ingredients))
+		for i, ingredient := range ingredients {
+			names[i] = RecipeIngredient{
+				ID:       ingredient.ID,
+				RecipeID: ingredient.RecipeID,
+				Name:     ingredient.Name,
+			}
+		}
+		return nil, names
+	}
+
+	if len(steps) > s.config.PremiumTeaserSteps {
+		steps = steps[:s.config.PremiumTeaserSteps]
+	}
+	return steps, nil
+}
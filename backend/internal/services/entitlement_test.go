@@ -0,0 +1,158 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"recipe-backend/internal/config"
+)
+
+// newTestEntitlementService answers recipe queries with recipe, which has
+// three steps and two ingredients. "buyer" bought it and "subscriber"
+// subscribes to its chef.
+func newTestEntitlementService(t *testing.T, cfg *config.Config, recipe *Recipe) *EntitlementService {
+	hasura := newFakeHasura(t, func(query string, variables map[string]interface{}) interface{} {
+		count := func(ok bool) map[string]interface{} {
+			n := 0
+			if ok {
+				n = 1
+			}
+			return map[string]interface{}{"aggregate": map[string]interface{}{"count": n}}
+		}
+
+		switch {
+		case strings.Contains(query, "GetRecipeByID"):
+			return map[string]interface{}{"recipes_by_pk": recipe}
+		case strings.Contains(query, "HasCompletedPurchase"):
+			if variables["user_id"] == "" {
+				t.Errorf("purchase looked up for an anonymous reader")
+			}
+			return map[string]interface{}{
+				"purchases_aggregate":           count(variables["user_id"] == "buyer"),
+				"bundle_entitlements_aggregate": count(false),
+			}
+		case strings.Contains(query, "HasActiveSubscription"):
+			return map[string]interface{}{"subscriptions_aggregate": count(variables["user_id"] == "subscriber")}
+		case strings.Contains(query, "GetRecipeContent"):
+			return map[string]interface{}{
+				"recipe_steps":       testRecipeSteps,
+				"recipe_ingredients": testRecipeIngredients,
+			}
+		}
+		t.Errorf("unexpected query %s", query)
+		return nil
+	})
+
+	return NewEntitlementService(cfg, NewAccessService(hasura), hasura)
+}
+
+var testRecipeSteps = []RecipeStep{
+	{ID: "s1", RecipeID: "recipe-1", StepNumber: 1, Instruction: "Soak the lentils"},
+	{ID: "s2", RecipeID: "recipe-1", StepNumber: 2, Instruction: "Fry the onions"},
+	{ID: "s3", RecipeID: "recipe-1", StepNumber: 3, Instruction: "Simmer with berbere"},
+}
+
+var testRecipeIngredients = []RecipeIngredient{
+	{ID: "i1", RecipeID: "recipe-1", Name: "Red lentils", Amount: "2", Unit: "cups", Notes: "rinsed"},
+	{ID: "i2", RecipeID: "recipe-1", Name: "Berbere", Amount: "3", Unit: "tbsp"},
+}
+
+func TestEntitlementContent(t *testing.T) {
+	premium := &Recipe{ID: "recipe-1", UserID: "chef", IsPremium: true, Price: 50, IsPublished: true}
+	free := &Recipe{ID: "recipe-1", UserID: "chef", IsPublished: true}
+	draft := &Recipe{ID: "recipe-1", UserID: "chef", IsPremium: true, Price: 50}
+
+	stepsTeaser := &config.Config{PremiumTeaser: TeaserSteps, PremiumTeaserSteps: 1}
+	ingredientNames := []RecipeIngredient{
+		{ID: "i1", RecipeID: "recipe-1", Name: "Red lentils"},
+		{ID: "i2", RecipeID: "recipe-1", Name: "Berbere"},
+	}
+
+	tests := []struct {
+		name            string
+		cfg             *config.Config
+		recipe          *Recipe
+		userID          string
+		wantErr         error
+		wantAccess      string
+		wantFull        bool
+		wantSteps       []RecipeStep
+		wantIngredients []RecipeIngredient
+	}{
+		{name: "free recipe", cfg: stepsTeaser, recipe: free, wantAccess: AccessFree, wantFull: true, wantSteps: testRecipeSteps, wantIngredients: testRecipeIngredients},
+		{name: "owner", cfg: stepsTeaser, recipe: premium, userID: "chef", wantAccess: AccessOwner, wantFull: true, wantSteps: testRecipeSteps, wantIngredients: testRecipeIngredients},
+		{name: "buyer", cfg: stepsTeaser, recipe: premium, userID: "buyer", wantAccess: AccessPurchase, wantFull: true, wantSteps: testRecipeSteps, wantIngredients: testRecipeIngredients},
+		{name: "subscriber", cfg: stepsTeaser, recipe: premium, userID: "subscriber", wantAccess: AccessSubscription, wantFull: true, wantSteps: testRecipeSteps, wantIngredients: testRecipeIngredients},
+		{name: "anonymous", cfg: stepsTeaser, recipe: premium, wantAccess: AccessTeaser, wantSteps: testRecipeSteps[:1], wantIngredients: []RecipeIngredient{}},
+		{name: "signed in without access", cfg: stepsTeaser, recipe: premium, userID: "reader", wantAccess: AccessTeaser, wantSteps: testRecipeSteps[:1], wantIngredients: []RecipeIngredient{}},
+		{
+			name:            "steps teaser longer than the recipe",
+			cfg:             &config.Config{PremiumTeaser: TeaserSteps, PremiumTeaserSteps: 5},
+			recipe:          premium,
+			wantAccess:      AccessTeaser,
+			wantSteps:       testRecipeSteps,
+			wantIngredients: []RecipeIngredient{},
+		},
+		{
+			name:            "no steps in the teaser",
+			cfg:             &config.Config{PremiumTeaser: TeaserSteps},
+			recipe:          premium,
+			wantAccess:      AccessTeaser,
+			wantSteps:       []RecipeStep{},
+			wantIngredients: []RecipeIngredient{},
+		},
+		{
+			name:            "ingredients teaser",
+			cfg:             &config.Config{PremiumTeaser: TeaserIngredients, PremiumTeaserSteps: 1},
+			recipe:          premium,
+			userID:          "reader",
+			wantAccess:      AccessTeaser,
+			wantSteps:       []RecipeStep{},
+			wantIngredients: ingredientNames,
+		},
+		{name: "unpublished, owner", cfg: stepsTeaser, recipe: draft, userID: "chef", wantAccess: AccessOwner, wantFull: true, wantSteps: testRecipeSteps, wantIngredients: testRecipeIngredients},
+		{name: "unpublished, buyer", cfg: stepsTeaser, recipe: draft, userID: "buyer", wantErr: ErrRecipeNotFound},
+		{name: "unpublished, anonymous", cfg: stepsTeaser, recipe: draft, wantErr: ErrRecipeNotFound},
+		{name: "missing", cfg: stepsTeaser, userID: "chef", wantErr: ErrRecipeNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestEntitlementService(t, tt.cfg, tt.recipe)
+
+			content, err := s.Content(context.Background(), tt.userID, "recipe-1")
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Content() = %+v, %v, want %v", content, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Content() error = %v", err)
+			}
+
+			if content.Access != tt.wantAccess || content.Full != tt.wantFull {
+				t.Errorf("access = %q, full = %v, want %q, %v", content.Access, content.Full, tt.wantAccess, tt.wantFull)
+			}
+			wantTeaser := tt.cfg.PremiumTeaser
+			if tt.wantFull {
+				wantTeaser = ""
+			}
+			if content.Teaser != wantTeaser {
+				t.Errorf("teaser = %q, want %q", content.Teaser, wantTeaser)
+			}
+			if !reflect.DeepEqual(content.Steps, tt.wantSteps) {
+				t.Errorf("steps = %+v, want %+v", content.Steps, tt.wantSteps)
+			}
+			if !reflect.DeepEqual(content.Ingredients, tt.wantIngredients) {
+				t.Errorf("ingredients = %+v, want %+v", content.Ingredients, tt.wantIngredients)
+			}
+			if content.TotalSteps != 3 || content.TotalIngredients != 2 {
+				t.Errorf("totals = %d steps, %d ingredients, want 3 and 2", content.TotalSteps, content.TotalIngredients)
+			}
+		})
+	}
+}
@@ -1,7 +1,14 @@
 package services
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
+	"log"
 	"mime/multipart"
 	"path/filepath"
 	"strings"
@@ -13,12 +20,12 @@ import (
 	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
-	"github.com/google/uuid"
 )
 
 type FileService struct {
 	config   *config.Config
 	s3Client *s3.S3
+	scanner  *ClamdScanner
 }
 
 func NewFileService(cfg *config.Config) *FileService {
@@ -31,30 +38,58 @@ func NewFileService(cfg *config.Config) *FileService {
 		),
 	}))
 
+	var scanner *ClamdScanner
+	if cfg.ClamdAddress != "" {
+		scanner = NewClamdScanner(cfg.ClamdAddress, cfg.ClamdTimeout)
+	}
+
 	return &FileService{
 		config:   cfg,
 		s3Client: s3.New(sess),
+		scanner:  scanner,
 	}
 }
 
 type UploadResult struct {
-	URL      string `json:"url"`
-	Key      string `json:"key"`
-	FileName string `json:"file_name"`
-	Size     int64  `json:"size"`
+	ID            string  `json:"id,omitempty"`
+	URL           string  `json:"url"`
+	Key           string  `json:"key"`
+	FileName      string  `json:"file_name"`
+	Size          int64   `json:"size"`
+	MimeType      string  `json:"mime_type"`
+	Width         int     `json:"width"`
+	Height        int     `json:"height"`
+	BlurHash      string  `json:"blurhash"`
+	DominantColor string  `json:"dominant_color"`
+	Duration      float64 `json:"duration,omitempty"`
+	VideoCodec    string  `json:"video_codec,omitempty"`
+	AudioCodec    string  `json:"audio_codec,omitempty"`
+	PosterURL     string  `json:"poster_url,omitempty"`
+	Visibility    string  `json:"visibility"`
+	ContentHash   string  `json:"content_hash"`
+	Deduplicated  bool    `json:"deduplicated"`
 }
 
-func (s *FileService) UploadFile(file *multipart.FileHeader, userID string) (*UploadResult, error) {
-	// Validate file type
-	if !s.isValidImageType(file.Filename) {
-		return nil, fmt.Errorf("invalid file type. Only images are allowed")
-	}
+// UploadOptions controls how an uploaded file is stored.
+type UploadOptions struct {
+	// Private files are not publicly readable and can only be fetched
+	// through a signed URL.
+	Private bool
 
-	// Validate file size (max 10MB)
-	if file.Size > 10*1024*1024 {
-		return nil, fmt.Errorf("file size too large. Maximum 10MB allowed")
-	}
+	// ContentHash is the SHA-256 of the content, if the caller already
+	// computed it with ContentHash.
+	ContentHash string
+}
 
+const (
+	VisibilityPublic  = "public"
+	VisibilityPrivate = "private"
+)
+
+// Maximum size of a single uploaded image
+const MaxImageSize = 10 * 1024 * 1024
+
+func (s *FileService) UploadFile(file *multipart.FileHeader, userID string, opts UploadOptions) (*UploadResult, error) {
 	// Open the file
 	src, err := file.Open()
 	if err != nil {
@@ -62,17 +97,73 @@ func (s *FileService) UploadFile(file *multipart.FileHeader, userID string) (*Up
 	}
 	defer src.Close()
 
-	// Generate unique filename
-	ext := filepath.Ext(file.Filename)
-	filename := fmt.Sprintf("%s/%s_%d%s", userID, uuid.New().String(), time.Now().Unix(), ext)
+	return s.UploadContent(src, file.Filename, file.Size, userID, opts)
+}
+
+// UploadContent validates and stores file content that did not arrive as a
+// multipart form, such as a completed resumable upload.
+func (s *FileService) UploadContent(src io.ReadSeeker, fileName string, size int64, userID string, opts UploadOptions) (*UploadResult, error) {
+	if err := s.ValidateUpload(fileName, size); err != nil {
+		return nil, err
+	}
+
+	hash := opts.ContentHash
+	if hash == "" {
+		var err error
+		if hash, err = s.ContentHash(src); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.scan(src, fileName, userID, hash); err != nil {
+		return nil, err
+	}
+
+	ext := strings.ToLower(filepath.Ext(fileName))
+
+	var (
+		info  *ImageInfo
+		video *VideoInfo
+		err   error
+	)
+	if IsVideoFile(fileName) {
+		// Read duration, resolution and codecs from the container, which
+		// also rejects files that are not really videos
+		if video, err = probeVideo(src, ext); err != nil {
+			return nil, err
+		}
+		if err := s.validateVideo(video, ext); err != nil {
+			return nil, err
+		}
+	} else {
+		// Read dimensions and placeholder data, which also rejects files
+		// that are not really images
+		if info, err = analyzeImage(src); err != nil {
+			return nil, err
+		}
+	}
+
+	if _, err := src.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	// Objects are addressed by content so identical uploads share storage
+	filename := fmt.Sprintf("content/%s%s", hash, ext)
+	contentType := s.getContentType(ext)
+
+	acl, visibility := "public-read", VisibilityPublic
+	if opts.Private {
+		filename = "private/" + filename
+		acl, visibility = "private", VisibilityPrivate
+	}
 
 	// Upload to S3
 	_, err = s.s3Client.PutObject(&s3.PutObjectInput{
 		Bucket:      aws.String(s.config.S3Bucket),
 		Key:         aws.String(filename),
 		Body:        src,
-		ContentType: aws.String(s.getContentType(ext)),
-		ACL:         aws.String("public-read"),
+		ContentType: aws.String(contentType),
+		ACL:         aws.String(acl),
 	})
 
 	if err != nil {
@@ -80,14 +171,162 @@ func (s *FileService) UploadFile(file *multipart.FileHeader, userID string) (*Up
 	}
 
 	// Generate public URL
-	url := fmt.Sprintf("https://%s.s3.%s.amazonaws.com/%s", s.config.S3Bucket, s.config.AWSRegion, filename)
+	url := s.ObjectURL(filename)
+
+	result := &UploadResult{
+		URL:         url,
+		Key:         filename,
+		FileName:    fileName,
+		Size:        size,
+		MimeType:    contentType,
+		Visibility:  visibility,
+		ContentHash: hash,
+	}
+
+	if video == nil {
+		result.Width = info.Width
+		result.Height = info.Height
+		result.BlurHash = info.BlurHash
+		result.DominantColor = info.DominantColor
+		return result, nil
+	}
+
+	result.Width = video.Width
+	result.Height = video.Height
+	result.Duration = video.Duration.Seconds()
+	result.VideoCodec = video.VideoCodec
+	result.AudioCodec = video.AudioCodec
+
+	// A clip without a poster is still usable, so failures are only logged
+	if err := s.storePoster(src, filename, acl, result); err != nil {
+		log.Printf("Failed to create poster for %s: %v", filename, err)
+	}
+
+	return result, nil
+}
+
+// storePoster stores the first keyframe of a video next to it and uses it
+// for the video's placeholder data.
+func (s *FileService) storePoster(src io.ReadSeeker, videoKey, acl string, result *UploadResult) error {
+	poster, ok, err := s.extractPoster(src)
+	if err != nil || !ok {
+		return err
+	}
+
+	info, err := analyzeImage(bytes.NewReader(poster))
+	if err != nil {
+		return err
+	}
+
+	key := PosterKey(videoKey)
+	_, err = s.s3Client.PutObject(&s3.PutObjectInput{
+		Bucket:      aws.String(s.config.S3Bucket),
+		Key:         aws.String(key),
+		Body:        bytes.NewReader(poster),
+		ContentType: aws.String("image/jpeg"),
+		ACL:         aws.String(acl),
+	})
+	if err != nil {
+		return err
+	}
+
+	result.PosterURL = s.ObjectURL(key)
+	result.BlurHash = info.BlurHash
+	result.DominantColor = info.DominantColor
+	return nil
+}
+
+// PosterKey returns the key of the poster image stored for a video.
+func PosterKey(videoKey string) string {
+	return strings.TrimSuffix(videoKey, filepath.Ext(videoKey)) + ".poster.jpg"
+}
+
+// IsVideoFile reports whether a file name has a supported video extension.
+func IsVideoFile(fileName string) bool {
+	switch strings.ToLower(filepath.Ext(fileName)) {
+	case ".mp4", ".webm":
+		return true
+	}
+	return false
+}
+
+// scan checks content for malware before it is stored. Infected files are
+// quarantined and rejected with an *InfectedFileError.
+func (s *FileService) scan(src io.ReadSeeker, fileName, userID, contentHash string) error {
+	if s.scanner == nil {
+		return nil
+	}
+
+	err := s.scanner.Scan(src)
+
+	var infected *InfectedFileError
+	switch {
+	case errors.As(err, &infected):
+		if qErr := quarantine(s.config, src, fileName, userID, contentHash, infected.Signature); qErr != nil {
+			log.Printf("Failed to quarantine infected upload %q: %v", fileName, qErr)
+		}
+		return err
+	case errors.Is(err, ErrScannerUnavailable) && s.config.ClamdFailOpen:
+		log.Printf("WARNING: storing %q unscanned: %v", fileName, err)
+	case err != nil:
+		return err
+	}
+
+	_, err = src.Seek(0, io.SeekStart)
+	return err
+}
+
+// ValidateUpload checks the file name and size of an upload before its
+// content is read.
+func (s *FileService) ValidateUpload(fileName string, size int64) error {
+	if IsVideoFile(fileName) {
+		if size > s.config.MaxVideoSize {
+			return fmt.Errorf("video file size too large. Maximum %dMB allowed", s.config.MaxVideoSize/(1024*1024))
+		}
+		return nil
+	}
+
+	// Validate file type
+	if !s.isValidImageType(fileName) {
+		return fmt.Errorf("invalid file type. Only images and MP4 or WebM videos are allowed")
+	}
+
+	// Validate file size (max 10MB)
+	if size > MaxImageSize {
+		return fmt.Errorf("file size too large. Maximum 10MB allowed")
+	}
 
-	return &UploadResult{
-		URL:      url,
-		Key:      filename,
-		FileName: file.Filename,
-		Size:     file.Size,
-	}, nil
+	return nil
+}
+
+// MaxUploadSize returns the largest accepted upload for the file's type.
+func (s *FileService) MaxUploadSize(fileName string) int64 {
+	if IsVideoFile(fileName) {
+		return s.config.MaxVideoSize
+	}
+	return MaxImageSize
+}
+
+// LargestUploadSize returns the largest accepted upload of any type.
+func (s *FileService) LargestUploadSize() int64 {
+	if s.config.MaxVideoSize > MaxImageSize {
+		return s.config.MaxVideoSize
+	}
+	return MaxImageSize
+}
+
+// ContentHash returns the hex SHA-256 of src and rewinds it.
+func (s *FileService) ContentHash(src io.ReadSeeker) (string, error) {
+	hash := sha256.New()
+	if _, err := io.Copy(hash, src); err != nil {
+		return "", err
+	}
+
+	if _, err := src.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
 }
 
 func (s *FileService) DeleteFile(key string) error {
@@ -98,6 +337,77 @@ func (s *FileService) DeleteFile(key string) error {
 	return err
 }
 
+// SignedURLTTL is how long signed URLs stay valid.
+func (s *FileService) SignedURLTTL() time.Duration {
+	return s.config.SignedURLTTL
+}
+
+// SignedURL returns a short-lived URL that grants read access to a private
+// object.
+func (s *FileService) SignedURL(key string, ttl time.Duration) (string, error) {
+	req, _ := s.s3Client.GetObjectRequest(&s3.GetObjectInput{
+		Bucket: aws.String(s.config.S3Bucket),
+		Key:    aws.String(key),
+	})
+	return req.Presign(ttl)
+}
+
+// ObjectURL returns the public URL of a stored object.
+func (s *FileService) ObjectURL(key string) string {
+	return s.urlPrefix() + key
+}
+
+// PrivateKeyFromURL returns the object key for a URL pointing at a private
+// object in our bucket.
+func (s *FileService) PrivateKeyFromURL(url string) (string, bool) {
+	key, ok := s.KeyFromURL(url)
+	if !ok || !strings.HasPrefix(key, "private/") {
+		return "", false
+	}
+	return key, true
+}
+
+// KeyFromURL returns the object key for a URL pointing into our bucket.
+func (s *FileService) KeyFromURL(url string) (string, bool) {
+	if !strings.HasPrefix(url, s.urlPrefix()) {
+		return "", false
+	}
+	return strings.TrimPrefix(url, s.urlPrefix()), true
+}
+
+func (s *FileService) urlPrefix() string {
+	return fmt.Sprintf("https://%s.s3.%s.amazonaws.com/", s.config.S3Bucket, s.config.AWSRegion)
+}
+
+type StoredObject struct {
+	Key          string
+	Size         int64
+	LastModified time.Time
+}
+
+// ListObjects returns every object in the bucket.
+func (s *FileService) ListObjects(ctx context.Context) ([]StoredObject, error) {
+	var objects []StoredObject
+
+	err := s.s3Client.ListObjectsV2PagesWithContext(ctx, &s3.ListObjectsV2Input{
+		Bucket: aws.String(s.config.S3Bucket),
+	}, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+		for _, object := range page.Contents {
+			objects = append(objects, StoredObject{
+				Key:          aws.StringValue(object.Key),
+				Size:         aws.Int64Value(object.Size),
+				LastModified: aws.TimeValue(object.LastModified),
+			})
+		}
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list objects: %w", err)
+	}
+
+	return objects, nil
+}
+
 func (s *FileService) isValidImageType(filename string) bool {
 	ext := strings.ToLower(filepath.Ext(filename))
 	validExts := []string{".jpg", ".jpeg", ".png", ".gif", ".webp"}
@@ -120,6 +430,10 @@ func (s *FileService) getContentType(ext string) string {
 		return "image/gif"
 	case ".webp":
 		return "image/webp"
+	case ".mp4":
+		return "video/mp4"
+	case ".webm":
+		return "video/webm"
 	default:
 		return "application/octet-stream"
 	}
@@ -0,0 +1,184 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"recipe-backend/internal/config"
+)
+
+// Media references and keys of recently recorded files are read this many at
+// a time
+const gcBatchSize = 1000
+
+// GarbageCollector removes stored objects that nothing refers to any more,
+// such as images uploaded for a recipe that was never saved.
+type GarbageCollector struct {
+	config        *config.Config
+	fileService   *FileService
+	hasuraService *HasuraService
+}
+
+func NewGarbageCollector(cfg *config.Config, fileService *FileService, hasuraService *HasuraService) *GarbageCollector {
+	return &GarbageCollector{
+		config:        cfg,
+		fileService:   fileService,
+		hasuraService: hasuraService,
+	}
+}
+
+type OrphanedObject struct {
+	Key          string    `json:"key"`
+	Size         int64     `json:"size"`
+	LastModified time.Time `json:"last_modified"`
+}
+
+type GCReport struct {
+	DryRun         bool             `json:"dry_run"`
+	Scanned        int              `json:"scanned"`
+	Referenced     int              `json:"referenced"`
+	InGracePeriod  int              `json:"in_grace_period"`
+	Orphaned       []OrphanedObject `json:"orphaned"`
+	Deleted        int              `json:"deleted"`
+	BytesReclaimed int64            `json:"bytes_reclaimed"`
+	Errors         []string         `json:"errors,omitempty"`
+}
+
+// Run compares the bucket against every image and video reference in the database and
+// deletes unreferenced objects older than the grace period. In dry-run mode
+// it only reports what would be deleted.
+func (g *GarbageCollector) Run(ctx context.Context, dryRun bool) (*GCReport, error) {
+	// Read references before listing objects so an upload that is saved
+	// while we run is never mistaken for an orphan
+	referenced, err := g.referencedKeys(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	objects, err := g.fileService.ListObjects(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// An upload deduplicated against an old object keeps the object's
+	// modification time, so the grace period also runs from the newest
+	// record of each key. These are read after listing objects so that an
+	// upload recorded while we listed is seen.
+	cutoff := time.Now().Add(-g.config.GCGracePeriod)
+	recent, err := g.recentKeys(ctx, cutoff)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &GCReport{
+		DryRun:   dryRun,
+		Scanned:  len(objects),
+		Orphaned: []OrphanedObject{},
+	}
+
+	for _, object := range objects {
+		if referenced[object.Key] {
+			report.Referenced++
+			continue
+		}
+
+		if object.LastModified.After(cutoff) || recent[object.Key] {
+			report.InGracePeriod++
+			continue
+		}
+
+		report.Orphaned = append(report.Orphaned, OrphanedObject{
+			Key:          object.Key,
+			Size:         object.Size,
+			LastModified: object.LastModified,
+		})
+
+		if dryRun {
+			continue
+		}
+
+		if err := g.fileService.DeleteFile(object.Key); err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("delete %s: %v", object.Key, err))
+			continue
+		}
+
+		if err := g.hasuraService.DeleteFileRecordByKey(ctx, object.Key); err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("delete record %s: %v", object.Key, err))
+		}
+
+		report.Deleted++
+		report.BytesReclaimed += object.Size
+	}
+
+	return report, nil
+}
+
+// referencedKeys returns the keys of every object an image or video
+// reference in the database points to.
+func (g *GarbageCollector) referencedKeys(ctx context.Context) (map[string]bool, error) {
+	referenced := make(map[string]bool)
+	var cursor MediaCursor
+	for {
+		urls, next, more, err := g.hasuraService.ListReferencedMediaURLs(ctx, cursor, gcBatchSize)
+		if err != nil {
+			return nil, err
+		}
+		for _, url := range urls {
+			if key, ok := g.fileService.KeyFromURL(url); ok {
+				referenced[key] = true
+			}
+		}
+		if !more {
+			return referenced, nil
+		}
+		cursor = next
+	}
+}
+
+// recentKeys returns the keys with a file recorded after cutoff.
+func (g *GarbageCollector) recentKeys(ctx context.Context, cutoff time.Time) (map[string]bool, error) {
+	recent := make(map[string]bool)
+	after := ""
+	for {
+		keys, err := g.hasuraService.ListRecentFileKeys(ctx, cutoff, after, gcBatchSize)
+		if err != nil {
+			return nil, err
+		}
+		for _, key := range keys {
+			recent[key] = true
+		}
+		if len(keys) < gcBatchSize {
+			return recent, nil
+		}
+		after = keys[len(keys)-1]
+	}
+}
+
+// Start runs the collector on the configured interval until ctx is done.
+func (g *GarbageCollector) Start(ctx context.Context) {
+	if g.config.GCInterval <= 0 {
+		log.Println("Orphaned file collection disabled")
+		return
+	}
+
+	ticker := time.NewTicker(g.config.GCInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			report, err := g.Run(ctx, g.config.GCDryRun)
+			if err != nil {
+				log.Printf("Orphaned file collection failed: %v", err)
+				continue
+			}
+			log.Printf("Orphaned file collection: scanned=%d referenced=%d grace=%d orphaned=%d deleted=%d reclaimed=%d bytes dry_run=%t errors=%d",
+				report.Scanned, report.Referenced, report.InGracePeriod, len(report.Orphaned),
+				report.Deleted, report.BytesReclaimed, report.DryRun, len(report.Errors))
+		}
+	}
+}
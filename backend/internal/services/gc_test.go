@@ -0,0 +1,70 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"recipe-backend/internal/config"
+)
+
+// More recipe images than fit on a page must all count as referenced, while
+// the other tables are read to their end on the first page.
+func TestReferencedKeysPagesThroughReferences(t *testing.T) {
+	cfg := &config.Config{S3Bucket: "recipes", AWSRegion: "eu-west-1"}
+	prefix := "https://recipes.s3.eu-west-1.amazonaws.com/"
+
+	type image struct {
+		ID       string `json:"id"`
+		ImageURL string `json:"image_url"`
+	}
+	var images []image
+	for i := 0; i < 2*gcBatchSize+5; i++ {
+		images = append(images, image{
+			ID:       fmt.Sprintf("00000000-0000-0000-0000-%012d", i+1),
+			ImageURL: fmt.Sprintf("%simages/%d.jpg", prefix, i),
+		})
+	}
+
+	pages := 0
+	hasura := newFakeHasura(t, func(query string, variables map[string]interface{}) interface{} {
+		if !strings.Contains(query, "ListReferencedMediaURLs") {
+			t.Errorf("unexpected query %s", query)
+			return nil
+		}
+		pages++
+
+		after := variables["recipe_image_id"].(string)
+		page := []image{}
+		for _, image := range images {
+			if image.ID > after && len(page) < int(variables["limit"].(float64)) {
+				page = append(page, image)
+			}
+		}
+
+		recipes := []map[string]string{}
+		if variables["recipe_id"] == "00000000-0000-0000-0000-000000000000" {
+			recipes = append(recipes, map[string]string{"id": "recipe-1", "featured_image_url": prefix + "featured.jpg"})
+		}
+		return map[string]interface{}{
+			"recipes":       recipes,
+			"recipe_images": page,
+			"recipe_steps":  []interface{}{},
+			"users":         []interface{}{},
+		}
+	})
+
+	g := NewGarbageCollector(cfg, &FileService{config: cfg}, hasura)
+	referenced, err := g.referencedKeys(context.Background())
+	if err != nil {
+		t.Fatalf("referencedKeys() = %v", err)
+	}
+
+	if len(referenced) != len(images)+1 || !referenced["featured.jpg"] || !referenced[fmt.Sprintf("images/%d.jpg", len(images)-1)] {
+		t.Errorf("referenced %d keys, want %d", len(referenced), len(images)+1)
+	}
+	if pages != 3 {
+		t.Errorf("read %d pages, want 3", pages)
+	}
+}
@@ -0,0 +1,158 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var (
+	ErrGiftNotFound      = errors.New("gift not found")
+	ErrGiftNotPaid       = errors.New("this gift has not been paid for")
+	ErrGiftRedeemed      = errors.New("this gift has already been redeemed")
+	ErrGiftExpired       = errors.New("this gift has expired")
+	ErrGiftRefunded      = errors.New("this gift was refunded")
+	ErrGiftAlreadyOwned  = errors.New("you already have access to this recipe")
+	ErrGiftNotRefundable = errors.New("only gifts that expired without being redeemed can be refunded by the buyer")
+)
+
+// GiftService redeems recipes bought as gifts. A gift is a purchase with a
+// recipient email and a code; the buyer pays as usual but only whoever
+// redeems the code gets access. Codes are bearer tokens, so they are not
+// tied to the recipient's account or email address.
+type GiftService struct {
+	accessService *AccessService
+	hasuraService *HasuraService
+}
+
+func NewGiftService(accessService *AccessService, hasuraService *HasuraService) *GiftService {
+	return &GiftService{
+		accessService: accessService,
+		hasuraService: hasuraService,
+	}
+}
+
+// Letters and digits that cannot be mistaken for one another
+const giftCodeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+// NewGiftCode returns a random code of the form GIFT-XXXX-XXXX-XXXX.
+func NewGiftCode() (string, error) {
+	random := make([]byte, 12)
+	if _, err := rand.Read(random); err != nil {
+		return "", fmt.Errorf("failed to generate gift code: %w", err)
+	}
+
+	var b strings.Builder
+	b.WriteString("GIFT")
+	for i, value := range random {
+		if i%4 == 0 {
+			b.WriteByte('-')
+		}
+		b.WriteByte(giftCodeAlphabet[int(value)%len(giftCodeAlphabet)])
+	}
+	return b.String(), nil
+}
+
+// NormalizeGiftCode lets codes be typed in lower case and with spaces.
+func NormalizeGiftCode(code string) string {
+	return strings.ToUpper(strings.Join(strings.Fields(code), ""))
+}
+
+// IsGift reports whether the purchase was bought for someone else.
+func (p *Purchase) IsGift() bool {
+	return p.GiftCode != ""
+}
+
+// GiftExpired reports whether the gift can no longer be redeemed at now.
+func (p *Purchase) GiftExpired(now time.Time) bool {
+	expiresAt, err := time.Parse(time.RFC3339Nano, p.GiftExpiresAt)
+	return err == nil && !now.Before(expiresAt)
+}
+
+// GiftRefundable reports whether the buyer may refund the gift: it was paid
+// for but expired without being redeemed.
+func (p *Purchase) GiftRefundable(now time.Time) bool {
+	return p.IsGift() && p.Status == PurchaseCompleted && p.RedeemedBy == "" && p.GiftExpired(now)
+}
+
+// Redeem gives the gift with the code to the user and returns it along with
+// its recipe. Redeeming a gift the user already redeemed succeeds again.
+// Users who own or bought the recipe cannot redeem it, so the code can be
+// passed on instead.
+func (s *GiftService) Redeem(ctx context.Context, userID, code string) (*Purchase, *Recipe, error) {
+	code = NormalizeGiftCode(code)
+
+	purchase, err := s.hasuraService.GetPurchaseByGiftCode(ctx, code)
+	if err != nil {
+		return nil, nil, err
+	}
+	if purchase == nil {
+		return nil, nil, ErrGiftNotFound
+	}
+
+	recipe, err := s.hasuraService.GetRecipeByID(ctx, purchase.RecipeID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if recipe == nil {
+		return nil, nil, ErrGiftNotFound
+	}
+
+	if purchase.RedeemedBy == userID && purchase.Status == PurchaseCompleted {
+		return purchase, recipe, nil
+	}
+
+	now := time.Now()
+	if err := redeemable(purchase, now); err != nil {
+		return nil, nil, err
+	}
+
+	access, err := s.accessService.Access(ctx, userID, recipe)
+	if err != nil {
+		return nil, nil, err
+	}
+	if access == AccessOwner || access == AccessPurchase {
+		return nil, nil, ErrGiftAlreadyOwned
+	}
+
+	redeemed, err := s.hasuraService.RedeemGift(ctx, code, userID, now)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if !redeemed {
+		// Someone else redeemed it or it was refunded in the meantime
+		current, err := s.hasuraService.GetPurchaseByGiftCode(ctx, code)
+		if err != nil {
+			return nil, nil, err
+		}
+		if current != nil {
+			if err := redeemable(current, now); err != nil {
+				return nil, nil, err
+			}
+		}
+		return nil, nil, ErrGiftRedeemed
+	}
+
+	purchase.RedeemedBy = userID
+	purchase.RedeemedAt = now.UTC().Format(time.RFC3339Nano)
+	return purchase, recipe, nil
+}
+
+// redeemable returns why the gift cannot be redeemed at now, if it cannot.
+func redeemable(purchase *Purchase, now time.Time) error {
+	switch {
+	case purchase.Status == PurchaseRefunded:
+		return ErrGiftRefunded
+	case purchase.Status != PurchaseCompleted:
+		return ErrGiftNotPaid
+	case purchase.RedeemedBy != "":
+		return ErrGiftRedeemed
+	case purchase.GiftExpired(now):
+		return ErrGiftExpired
+	}
+	return nil
+}
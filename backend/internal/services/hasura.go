@@ -155,6 +155,7 @@ func (s *HasuraService) GetUserByEmail(ctx context.Context, email string) (*User
 				password_hash
 				avatar_url
 				bio
+				role
 				created_at
 				updated_at
 			}
@@ -196,6 +197,7 @@ func (s *HasuraService) GetUserByUsername(ctx context.Context, username string)
 				password_hash
 				avatar_url
 				bio
+				role
 				created_at
 				updated_at
 			}
@@ -226,7 +228,440 @@ func (s *HasuraService) GetUserByUsername(ctx context.Context, username string)
 	return &result.Users[0], nil
 }
 
+func (s *HasuraService) GetUserByID(ctx context.Context, id string) (*User, error) {
+	query := `
+		query GetUserByID($id: uuid!) {
+			users_by_pk(id: $id) {
+				id
+				email
+				username
+				full_name
+				avatar_url
+				bio
+				role
+				created_at
+				updated_at
+			}
+		}
+	`
+
+	variables := map[string]interface{}{
+		"id": id,
+	}
+
+	resp, err := s.ExecuteQuery(ctx, query, variables)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user by id: %w", err)
+	}
+
+	var result struct {
+		User *User `json:"users_by_pk"`
+	}
+
+	if err := json.Unmarshal(resp.Data, &result); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	return result.User, nil
+}
+
+// IsAdmin reports whether the given user has the admin role.
+func (s *HasuraService) IsAdmin(ctx context.Context, userID string) (bool, error) {
+	user, err := s.GetUserByID(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+
+	return user != nil && user.Role == RoleAdmin, nil
+}
+
+// Recipe operations
+func (s *HasuraService) GetRecipeByID(ctx context.Context, id string) (*Recipe, error) {
+	query := `
+		query GetRecipeByID($id: uuid!) {
+			recipes_by_pk(id: $id) {
+				id
+				user_id
+				title
+				is_premium
+				price
+				currency
+				is_published
+				featured_image_url
+			}
+		}
+	`
+
+	variables := map[string]interface{}{
+		"id": id,
+	}
+
+	resp, err := s.ExecuteQuery(ctx, query, variables)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get recipe by id: %w", err)
+	}
+
+	var result struct {
+		Recipe *Recipe `json:"recipes_by_pk"`
+	}
+
+	if err := json.Unmarshal(resp.Data, &result); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	return result.Recipe, nil
+}
+
 // Purchase operations
+
+// HasCompletedPurchase reports whether the user bought the recipe, alone
+// or in a bundle, or redeemed a gift of it. Gifts the user bought for
+// someone else do not count.
+func (s *HasuraService) HasCompletedPurchase(ctx context.Context, userID, recipeID string) (bool, error) {
+	query := `
+		query HasCompletedPurchase($user_id: uuid!, $recipe_id: uuid!) {
+			purchases_aggregate(
+				where: {
+					recipe_id: {_eq: $recipe_id},
+					status: {_eq: "completed"},
+					_or: [
+						{user_id: {_eq: $user_id}, gift_code: {_is_null: true}},
+						{redeemed_by: {_eq: $user_id}}
+					]
+				}
+			) {
+				aggregate {
+					count
+				}
+			}
+			bundle_entitlements_aggregate(
+				where: {user_id: {_eq: $user_id}, recipe_id: {_eq: $recipe_id}}
+			) {
+				aggregate {
+					count
+				}
+			}
+		}
+	`
+
+	variables := map[string]interface{}{
+		"user_id":   userID,
+		"recipe_id": recipeID,
+	}
+
+	resp, err := s.ExecuteQuery(ctx, query, variables)
+	if err != nil {
+		return false, fmt.Errorf("failed to check purchase: %w", err)
+	}
+
+	var result struct {
+		PurchasesAggregate struct {
+			Aggregate struct {
+				Count int `json:"count"`
+			} `json:"aggregate"`
+		} `json:"purchases_aggregate"`
+		BundleEntitlementsAggregate struct {
+			Aggregate struct {
+				Count int `json:"count"`
+			} `json:"aggregate"`
+		} `json:"bundle_entitlements_aggregate"`
+	}
+
+	if err := json.Unmarshal(resp.Data, &result); err != nil {
+		return false, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	return result.PurchasesAggregate.Aggregate.Count > 0 || result.BundleEntitlementsAggregate.Aggregate.Count > 0, nil
+}
+
+const purchaseFields = `
+	id
+	user_id
+	recipe_id
+	bundle_id
+	amount
+	transaction_id
+	status
+	checkout_url
+	idempotency_key
+	coupon_id
+	original_amount
+	discount_amount
+	currency
+	list_price
+	list_currency
+	exchange_rate
+	settlement_amount
+	provider_reference
+	payment_provider
+	recipient_email
+	gift_message
+	gift_code
+	gift_expires_at
+	redeemed_by
+	redeemed_at
+	created_at
+	updated_at
+`
+
+func (s *HasuraService) GetPurchaseByTransactionID(ctx context.Context, transactionID string) (*Purchase, error) {
+	query := `
+		query GetPurchaseByTransactionID($transaction_id: String!) {
+			purchases(where: {transaction_id: {_eq: $transaction_id}}, limit: 1) {` + purchaseFields + `}
+		}
+	`
+
+	variables := map[string]interface{}{
+		"transaction_id": transactionID,
+	}
+
+	resp, err := s.ExecuteQuery(ctx, query, variables)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get purchase: %w", err)
+	}
+
+	var result struct {
+		Purchases []Purchase `json:"purchases"`
+	}
+
+	if err := json.Unmarshal(resp.Data, &result); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	if len(result.Purchases) == 0 {
+		return nil, nil
+	}
+
+	return &result.Purchases[0], nil
+}
+
+// GetPurchaseByIdempotencyKey returns the purchase a user started with the
+// given Idempotency-Key header, if any.
+func (s *HasuraService) GetPurchaseByIdempotencyKey(ctx context.Context, userID, key string) (*Purchase, error) {
+	query := `
+		query GetPurchaseByIdempotencyKey($user_id: uuid!, $key: String!) {
+			purchases(where: {user_id: {_eq: $user_id}, idempotency_key: {_eq: $key}}, limit: 1) {` + purchaseFields + `}
+		}
+	`
+
+	variables := map[string]interface{}{
+		"user_id": userID,
+		"key":     key,
+	}
+
+	resp, err := s.ExecuteQuery(ctx, query, variables)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get purchase by idempotency key: %w", err)
+	}
+
+	var result struct {
+		Purchases []Purchase `json:"purchases"`
+	}
+
+	if err := json.Unmarshal(resp.Data, &result); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	if len(result.Purchases) == 0 {
+		return nil, nil
+	}
+
+	return &result.Purchases[0], nil
+}
+
+// GetPendingPurchase returns the buyer's open checkout for the recipe or
+// bundle the purchase is for, if any. With a recipient email it looks for a
+// gift to that recipient instead of a purchase for the buyer.
+func (s *HasuraService) GetPendingPurchase(ctx context.Context, purchase CreatePurchaseInput) (*Purchase, error) {
+	query := `
+		query GetPendingPurchase($where: purchases_bool_exp!) {
+			purchases(
+				where: $where,
+				order_by: {created_at: desc},
+				limit: 1
+			) {` + purchaseFields + `}
+		}
+	`
+
+	recipient := map[string]interface{}{"_is_null": true}
+	if purchase.RecipientEmail != "" {
+		recipient = map[string]interface{}{"_eq": purchase.RecipientEmail}
+	}
+
+	where := map[string]interface{}{
+		"user_id":         map[string]interface{}{"_eq": purchase.UserID},
+		"status":          map[string]interface{}{"_eq": PurchasePending},
+		"recipient_email": recipient,
+	}
+	if purchase.BundleID != "" {
+		where["bundle_id"] = map[string]interface{}{"_eq": purchase.BundleID}
+	} else {
+		where["recipe_id"] = map[string]interface{}{"_eq": purchase.RecipeID}
+	}
+
+	variables := map[string]interface{}{
+		"where": where,
+	}
+
+	resp, err := s.ExecuteQuery(ctx, query, variables)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get pending purchase: %w", err)
+	}
+
+	var result struct {
+		Purchases []Purchase `json:"purchases"`
+	}
+
+	if err := json.Unmarshal(resp.Data, &result); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	if len(result.Purchases) == 0 {
+		return nil, nil
+	}
+
+	return &result.Purchases[0], nil
+}
+
+func (s *HasuraService) SetPurchaseCheckoutURL(ctx context.Context, transactionID, checkoutURL string) error {
+	query := `
+		mutation SetPurchaseCheckoutURL($transaction_id: String!, $checkout_url: String!) {
+			update_purchases(
+				where: {transaction_id: {_eq: $transaction_id}},
+				_set: {checkout_url: $checkout_url}
+			) {
+				affected_rows
+			}
+		}
+	`
+
+	variables := map[string]interface{}{
+		"transaction_id": transactionID,
+		"checkout_url":   checkoutURL,
+	}
+
+	_, err := s.ExecuteQuery(ctx, query, variables)
+	return err
+}
+
+// ListPendingPurchases returns up to limit purchases still pending that were
+// created before createdBefore, oldest first. Purchases are ordered by
+// creation time and ID, and only those after the cursor, the created_at and
+// ID of the last purchase of the previous page, are returned, so purchases
+// created at the same instant are not skipped between pages. An empty cursor
+// starts at the oldest purchase.
+func (s *HasuraService) ListPendingPurchases(ctx context.Context, afterCreatedAt, afterID string, createdBefore time.Time, limit int) ([]Purchase, error) {
+	query := `
+		query ListPendingPurchases($where: purchases_bool_exp!, $limit: Int!) {
+			purchases(
+				where: $where,
+				order_by: [{created_at: asc}, {id: asc}],
+				limit: $limit
+			) {` + purchaseFields + `}
+		}
+	`
+
+	where := map[string]interface{}{
+		"status":     map[string]interface{}{"_eq": "pending"},
+		"created_at": map[string]interface{}{"_lt": createdBefore.UTC().Format(time.RFC3339Nano)},
+	}
+	if afterCreatedAt != "" {
+		where["_or"] = []map[string]interface{}{
+			{"created_at": map[string]interface{}{"_gt": afterCreatedAt}},
+			{
+				"created_at": map[string]interface{}{"_eq": afterCreatedAt},
+				"id":         map[string]interface{}{"_gt": afterID},
+			},
+		}
+	}
+
+	resp, err := s.ExecuteQuery(ctx, query, map[string]interface{}{
+		"where": where,
+		"limit": limit,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pending purchases: %w", err)
+	}
+
+	var result struct {
+		Purchases []Purchase `json:"purchases"`
+	}
+
+	if err := json.Unmarshal(resp.Data, &result); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	return result.Purchases, nil
+}
+
+// ExpirePendingPurchase marks a purchase expired if it is still pending and
+// reports whether it was.
+func (s *HasuraService) ExpirePendingPurchase(ctx context.Context, transactionID string) (bool, error) {
+	query := `
+		mutation ExpirePendingPurchase($transaction_id: String!) {
+			update_purchases(
+				where: {transaction_id: {_eq: $transaction_id}, status: {_eq: "pending"}},
+				_set: {status: "expired"}
+			) {
+				affected_rows
+			}
+		}
+	`
+
+	resp, err := s.ExecuteQuery(ctx, query, map[string]interface{}{
+		"transaction_id": transactionID,
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to expire purchase: %w", err)
+	}
+
+	var result struct {
+		UpdatePurchases struct {
+			AffectedRows int `json:"affected_rows"`
+		} `json:"update_purchases"`
+	}
+
+	if err := json.Unmarshal(resp.Data, &result); err != nil {
+		return false, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	return result.UpdatePurchases.AffectedRows > 0, nil
+}
+
+// FailPendingPurchase marks a purchase failed if it is still pending and
+// reports whether it was.
+func (s *HasuraService) FailPendingPurchase(ctx context.Context, transactionID string) (bool, error) {
+	query := `
+		mutation FailPendingPurchase($transaction_id: String!) {
+			update_purchases(
+				where: {transaction_id: {_eq: $transaction_id}, status: {_eq: "pending"}},
+				_set: {status: "failed"}
+			) {
+				affected_rows
+			}
+		}
+	`
+
+	resp, err := s.ExecuteQuery(ctx, query, map[string]interface{}{
+		"transaction_id": transactionID,
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to fail purchase: %w", err)
+	}
+
+	var result struct {
+		UpdatePurchases struct {
+			AffectedRows int `json:"affected_rows"`
+		} `json:"update_purchases"`
+	}
+
+	if err := json.Unmarshal(resp.Data, &result); err != nil {
+		return false, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	return result.UpdatePurchases.AffectedRows > 0, nil
+}
+
 func (s *HasuraService) CreatePurchase(ctx context.Context, purchase CreatePurchaseInput) error {
 	query := `
 		mutation CreatePurchase($purchase: purchases_insert_input!) {
@@ -236,42 +671,611 @@ func (s *HasuraService) CreatePurchase(ctx context.Context, purchase CreatePurch
 		}
 	`
 
+	object := map[string]interface{}{
+		"user_id":           purchase.UserID,
+		"amount":            purchase.Amount,
+		"transaction_id":    purchase.TransactionID,
+		"status":            purchase.Status,
+		"currency":          purchase.Currency,
+		"list_price":        purchase.ListPrice,
+		"list_currency":     purchase.ListCurrency,
+		"exchange_rate":     purchase.ExchangeRate,
+		"settlement_amount": purchase.SettlementAmount,
+	}
+	if purchase.BundleID != "" {
+		object["bundle_id"] = purchase.BundleID
+	} else {
+		object["recipe_id"] = purchase.RecipeID
+	}
+	if purchase.IdempotencyKey != "" {
+		object["idempotency_key"] = purchase.IdempotencyKey
+	}
+	if purchase.PaymentProvider != "" {
+		object["payment_provider"] = purchase.PaymentProvider
+	}
+	if purchase.CouponID != "" {
+		object["coupon_id"] = purchase.CouponID
+		object["original_amount"] = purchase.OriginalAmount
+		object["discount_amount"] = purchase.DiscountAmount
+	}
+	if purchase.GiftCode != "" {
+		object["recipient_email"] = purchase.RecipientEmail
+		object["gift_code"] = purchase.GiftCode
+		object["gift_expires_at"] = purchase.GiftExpiresAt
+		if purchase.GiftMessage != "" {
+			object["gift_message"] = purchase.GiftMessage
+		}
+	}
+
 	variables := map[string]interface{}{
-		"purchase": map[string]interface{}{
-			"user_id":        purchase.UserID,
-			"recipe_id":      purchase.RecipeID,
-			"amount":         purchase.Amount,
-			"transaction_id": purchase.TransactionID,
-			"status":         purchase.Status,
-		},
+		"purchase": object,
 	}
 
 	_, err := s.ExecuteQuery(ctx, query, variables)
 	return err
 }
 
-func (s *HasuraService) UpdatePurchaseStatus(ctx context.Context, transactionID, status string) error {
+// File operations
+func (s *HasuraService) CreateFile(ctx context.Context, file CreateFileInput) (*File, error) {
 	query := `
-		mutation UpdatePurchaseStatus($transaction_id: String!, $status: String!) {
-			update_purchases(
-				where: {transaction_id: {_eq: $transaction_id}}, 
-				_set: {status: $status}
+		mutation CreateFile($file: files_insert_input!) {
+			insert_files_one(object: $file) {
+				id
+				user_id
+				key
+				url
+				file_name
+				size
+				mime_type
+				width
+				height
+				blurhash
+				dominant_color
+				duration
+				video_codec
+				audio_codec
+				poster_url
+				visibility
+				recipe_id
+				content_hash
+				reference_type
+				reference_id
+				created_at
+			}
+		}
+	`
+
+	object := map[string]interface{}{
+		"user_id":   file.UserID,
+		"key":       file.Key,
+		"url":       file.URL,
+		"file_name": file.FileName,
+		"size":      file.Size,
+		"mime_type": file.MimeType,
+	}
+	if file.Width > 0 && file.Height > 0 {
+		object["width"] = file.Width
+		object["height"] = file.Height
+	}
+	if file.BlurHash != "" {
+		object["blurhash"] = file.BlurHash
+	}
+	if file.DominantColor != "" {
+		object["dominant_color"] = file.DominantColor
+	}
+	if file.Duration > 0 {
+		object["duration"] = file.Duration
+	}
+	if file.VideoCodec != "" {
+		object["video_codec"] = file.VideoCodec
+	}
+	if file.AudioCodec != "" {
+		object["audio_codec"] = file.AudioCodec
+	}
+	if file.PosterURL != "" {
+		object["poster_url"] = file.PosterURL
+	}
+	if file.Visibility != "" {
+		object["visibility"] = file.Visibility
+	}
+	if file.RecipeID != "" {
+		object["recipe_id"] = file.RecipeID
+	}
+	if file.ContentHash != "" {
+		object["content_hash"] = file.ContentHash
+	}
+	if file.ReferenceType != "" {
+		object["reference_type"] = file.ReferenceType
+	}
+	if file.ReferenceID != "" {
+		object["reference_id"] = file.ReferenceID
+	}
+
+	resp, err := s.ExecuteQuery(ctx, query, map[string]interface{}{"file": object})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create file record: %w", err)
+	}
+
+	var result struct {
+		InsertFilesOne *File `json:"insert_files_one"`
+	}
+
+	if err := json.Unmarshal(resp.Data, &result); err != nil {
+		return nil, fmt.Errorf("failed to parse create file response: %w", err)
+	}
+
+	if result.InsertFilesOne == nil {
+		return nil, fmt.Errorf("file creation failed: no data returned from database")
+	}
+
+	return result.InsertFilesOne, nil
+}
+
+func (s *HasuraService) GetFileByID(ctx context.Context, id string) (*File, error) {
+	query := `
+		query GetFileByID($id: uuid!) {
+			files_by_pk(id: $id) {
+				id
+				user_id
+				key
+				url
+				file_name
+				size
+				mime_type
+				width
+				height
+				blurhash
+				dominant_color
+				duration
+				video_codec
+				audio_codec
+				poster_url
+				visibility
+				recipe_id
+				content_hash
+				reference_type
+				reference_id
+				created_at
+			}
+		}
+	`
+
+	variables := map[string]interface{}{
+		"id": id,
+	}
+
+	resp, err := s.ExecuteQuery(ctx, query, variables)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get file by id: %w", err)
+	}
+
+	var result struct {
+		File *File `json:"files_by_pk"`
+	}
+
+	if err := json.Unmarshal(resp.Data, &result); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	return result.File, nil
+}
+
+func (s *HasuraService) ListFilesByUser(ctx context.Context, userID string, limit, offset int) ([]File, error) {
+	query := `
+		query ListFilesByUser($user_id: uuid!, $limit: Int!, $offset: Int!) {
+			files(
+				where: {user_id: {_eq: $user_id}},
+				order_by: {created_at: desc},
+				limit: $limit,
+				offset: $offset
+			) {
+				id
+				user_id
+				key
+				url
+				file_name
+				size
+				mime_type
+				width
+				height
+				blurhash
+				dominant_color
+				duration
+				video_codec
+				audio_codec
+				poster_url
+				visibility
+				recipe_id
+				content_hash
+				reference_type
+				reference_id
+				created_at
+			}
+		}
+	`
+
+	variables := map[string]interface{}{
+		"user_id": userID,
+		"limit":   limit,
+		"offset":  offset,
+	}
+
+	resp, err := s.ExecuteQuery(ctx, query, variables)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list files: %w", err)
+	}
+
+	var result struct {
+		Files []File `json:"files"`
+	}
+
+	if err := json.Unmarshal(resp.Data, &result); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	return result.Files, nil
+}
+
+// FindFilesByHash returns every file record holding the given content,
+// oldest first.
+func (s *HasuraService) FindFilesByHash(ctx context.Context, contentHash, visibility string) ([]File, error) {
+	query := `
+		query FindFilesByHash($content_hash: String!, $visibility: String!) {
+			files(
+				where: {content_hash: {_eq: $content_hash}, visibility: {_eq: $visibility}},
+				order_by: {created_at: asc}
+			) {
+				id
+				user_id
+				key
+				url
+				file_name
+				size
+				mime_type
+				width
+				height
+				blurhash
+				dominant_color
+				duration
+				video_codec
+				audio_codec
+				poster_url
+				visibility
+				recipe_id
+				content_hash
+				reference_type
+				reference_id
+				created_at
+			}
+		}
+	`
+
+	variables := map[string]interface{}{
+		"content_hash": contentHash,
+		"visibility":   visibility,
+	}
+
+	resp, err := s.ExecuteQuery(ctx, query, variables)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find files by hash: %w", err)
+	}
+
+	var result struct {
+		Files []File `json:"files"`
+	}
+
+	if err := json.Unmarshal(resp.Data, &result); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	return result.Files, nil
+}
+
+// LinkFileRecipe records that a file is also used in another recipe than the
+// one it was uploaded for. Linking it twice is a no-op.
+func (s *HasuraService) LinkFileRecipe(ctx context.Context, fileID, recipeID string) error {
+	query := `
+		mutation LinkFileRecipe($file_id: uuid!, $recipe_id: uuid!) {
+			insert_file_recipes_one(
+				object: {file_id: $file_id, recipe_id: $recipe_id},
+				on_conflict: {constraint: file_recipes_pkey, update_columns: []}
+			) {
+				file_id
+			}
+		}
+	`
+
+	variables := map[string]interface{}{
+		"file_id":   fileID,
+		"recipe_id": recipeID,
+	}
+
+	_, err := s.ExecuteQuery(ctx, query, variables)
+	if err != nil {
+		return fmt.Errorf("failed to link file to recipe: %w", err)
+	}
+
+	return nil
+}
+
+// GetFileRecipeIDs returns every recipe a file is used in: the one it was
+// uploaded for followed by those linked to it later.
+func (s *HasuraService) GetFileRecipeIDs(ctx context.Context, file *File) ([]string, error) {
+	query := `
+		query GetFileRecipeIDs($file_id: uuid!) {
+			file_recipes(where: {file_id: {_eq: $file_id}}, order_by: {created_at: asc}) {
+				recipe_id
+			}
+		}
+	`
+
+	resp, err := s.ExecuteQuery(ctx, query, map[string]interface{}{"file_id": file.ID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get file recipes: %w", err)
+	}
+
+	var result struct {
+		FileRecipes []struct {
+			RecipeID string `json:"recipe_id"`
+		} `json:"file_recipes"`
+	}
+
+	if err := json.Unmarshal(resp.Data, &result); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	var recipeIDs []string
+	if file.RecipeID != "" {
+		recipeIDs = append(recipeIDs, file.RecipeID)
+	}
+	for _, link := range result.FileRecipes {
+		if link.RecipeID != file.RecipeID {
+			recipeIDs = append(recipeIDs, link.RecipeID)
+		}
+	}
+
+	return recipeIDs, nil
+}
+
+func (s *HasuraService) DeleteFileRecord(ctx context.Context, id string) error {
+	query := `
+		mutation DeleteFileRecord($id: uuid!) {
+			delete_files_by_pk(id: $id) {
+				id
+			}
+		}
+	`
+
+	variables := map[string]interface{}{
+		"id": id,
+	}
+
+	_, err := s.ExecuteQuery(ctx, query, variables)
+	return err
+}
+
+// MediaCursor marks how far ListReferencedMediaURLs has read each table
+// holding media references. The zero value starts at the beginning.
+type MediaCursor struct {
+	RecipeID      string
+	RecipeImageID string
+	RecipeStepID  string
+	UserID        string
+}
+
+// ListReferencedMediaURLs returns the image and video URLs used by up to
+// limit rows of each of recipes, recipe images, recipe steps and users after
+// the cursor, ordered by id, with the cursor to continue from. more reports
+// whether any table had a full page, so there may be more to read.
+func (s *HasuraService) ListReferencedMediaURLs(ctx context.Context, after MediaCursor, limit int) (urls []string, next MediaCursor, more bool, err error) {
+	query := `
+		query ListReferencedMediaURLs($recipe_id: uuid!, $recipe_image_id: uuid!, $recipe_step_id: uuid!, $user_id: uuid!, $limit: Int!) {
+			recipes(
+				where: {featured_image_url: {_is_null: false}, id: {_gt: $recipe_id}},
+				order_by: {id: asc},
+				limit: $limit
+			) {
+				id
+				featured_image_url
+			}
+			recipe_images(where: {id: {_gt: $recipe_image_id}}, order_by: {id: asc}, limit: $limit) {
+				id
+				image_url
+			}
+			recipe_steps(
+				where: {_or: [{image_url: {_is_null: false}}, {video_url: {_is_null: false}}], id: {_gt: $recipe_step_id}},
+				order_by: {id: asc},
+				limit: $limit
+			) {
+				id
+				image_url
+				video_url
+				video_poster_url
+			}
+			users(
+				where: {avatar_url: {_is_null: false}, id: {_gt: $user_id}},
+				order_by: {id: asc},
+				limit: $limit
 			) {
+				id
+				avatar_url
+			}
+		}
+	`
+
+	cursor := func(id string) string {
+		if id == "" {
+			return "00000000-0000-0000-0000-000000000000"
+		}
+		return id
+	}
+
+	resp, err := s.ExecuteQuery(ctx, query, map[string]interface{}{
+		"recipe_id":       cursor(after.RecipeID),
+		"recipe_image_id": cursor(after.RecipeImageID),
+		"recipe_step_id":  cursor(after.RecipeStepID),
+		"user_id":         cursor(after.UserID),
+		"limit":           limit,
+	})
+	if err != nil {
+		return nil, after, false, fmt.Errorf("failed to list referenced media: %w", err)
+	}
+
+	var result struct {
+		Recipes []struct {
+			ID               string `json:"id"`
+			FeaturedImageURL string `json:"featured_image_url"`
+		} `json:"recipes"`
+		RecipeImages []struct {
+			ID       string `json:"id"`
+			ImageURL string `json:"image_url"`
+		} `json:"recipe_images"`
+		RecipeSteps []struct {
+			ID             string `json:"id"`
+			ImageURL       string `json:"image_url"`
+			VideoURL       string `json:"video_url"`
+			VideoPosterURL string `json:"video_poster_url"`
+		} `json:"recipe_steps"`
+		Users []struct {
+			ID        string `json:"id"`
+			AvatarURL string `json:"avatar_url"`
+		} `json:"users"`
+	}
+
+	if err := json.Unmarshal(resp.Data, &result); err != nil {
+		return nil, after, false, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	next = after
+	for _, recipe := range result.Recipes {
+		urls = append(urls, recipe.FeaturedImageURL)
+		next.RecipeID = recipe.ID
+	}
+	for _, image := range result.RecipeImages {
+		urls = append(urls, image.ImageURL)
+		next.RecipeImageID = image.ID
+	}
+	for _, step := range result.RecipeSteps {
+		for _, url := range []string{step.ImageURL, step.VideoURL, step.VideoPosterURL} {
+			if url != "" {
+				urls = append(urls, url)
+			}
+		}
+		next.RecipeStepID = step.ID
+	}
+	for _, user := range result.Users {
+		urls = append(urls, user.AvatarURL)
+		next.UserID = user.ID
+	}
+
+	more = len(result.Recipes) == limit || len(result.RecipeImages) == limit ||
+		len(result.RecipeSteps) == limit || len(result.Users) == limit
+	return urls, next, more, nil
+}
+
+// ListRecentFileKeys returns, in order, up to limit distinct keys after
+// afterKey of files recorded after since. A deduplicated upload reuses an
+// older object, so only its record tells how recently the key was uploaded.
+func (s *HasuraService) ListRecentFileKeys(ctx context.Context, since time.Time, afterKey string, limit int) ([]string, error) {
+	query := `
+		query ListRecentFileKeys($since: timestamptz!, $after_key: String!, $limit: Int!) {
+			files(
+				where: {created_at: {_gt: $since}, key: {_gt: $after_key}},
+				distinct_on: key,
+				order_by: {key: asc},
+				limit: $limit
+			) {
+				key
+			}
+		}
+	`
+
+	resp, err := s.ExecuteQuery(ctx, query, map[string]interface{}{
+		"since":     since.UTC().Format(time.RFC3339Nano),
+		"after_key": afterKey,
+		"limit":     limit,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list recent file keys: %w", err)
+	}
+
+	var result struct {
+		Files []struct {
+			Key string `json:"key"`
+		} `json:"files"`
+	}
+
+	if err := json.Unmarshal(resp.Data, &result); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	keys := make([]string, 0, len(result.Files))
+	for _, file := range result.Files {
+		keys = append(keys, file.Key)
+	}
+	return keys, nil
+}
+
+func (s *HasuraService) DeleteFileRecordByKey(ctx context.Context, key string) error {
+	query := `
+		mutation DeleteFileRecordByKey($key: String!) {
+			delete_files(where: {key: {_eq: $key}}) {
 				affected_rows
 			}
 		}
 	`
 
 	variables := map[string]interface{}{
-		"transaction_id": transactionID,
-		"status":         status,
+		"key": key,
 	}
 
 	_, err := s.ExecuteQuery(ctx, query, variables)
 	return err
 }
 
+func (s *HasuraService) GetStorageUsage(ctx context.Context, userID string) (*StorageUsage, error) {
+	query := `
+		query GetStorageUsage($user_id: uuid!) {
+			user_storage_usage_by_pk(user_id: $user_id) {
+				bytes_used
+				file_count
+			}
+		}
+	`
+
+	variables := map[string]interface{}{
+		"user_id": userID,
+	}
+
+	resp, err := s.ExecuteQuery(ctx, query, variables)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get storage usage: %w", err)
+	}
+
+	var result struct {
+		Usage *StorageUsage `json:"user_storage_usage_by_pk"`
+	}
+
+	if err := json.Unmarshal(resp.Data, &result); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	// Users without uploads have no usage row yet
+	if result.Usage == nil {
+		return &StorageUsage{}, nil
+	}
+
+	return result.Usage, nil
+}
+
 // Types for GraphQL operations
+
+const (
+	RoleFree  = "free"
+	RoleChef  = "chef"
+	RoleAdmin = "admin"
+)
+
 type User struct {
 	ID           string `json:"id"`
 	Email        string `json:"email"`
@@ -280,6 +1284,7 @@ type User struct {
 	PasswordHash string `json:"password_hash"`
 	AvatarURL    string `json:"avatar_url,omitempty"`
 	Bio          string `json:"bio,omitempty"`
+	Role         string `json:"role,omitempty"`
 	CreatedAt    string `json:"created_at"`
 	UpdatedAt    string `json:"updated_at,omitempty"`
 }
@@ -292,10 +1297,128 @@ type CreateUserInput struct {
 	PasswordHash string `json:"password_hash"`
 }
 
+const (
+	PurchasePending   = "pending"
+	PurchaseCompleted = "completed"
+	PurchaseFailed    = "failed"
+	PurchaseRefunded  = "refunded"
+	PurchaseExpired   = "expired"
+)
+
+type Purchase struct {
+	ID             string  `json:"id"`
+	UserID         string  `json:"user_id"`
+	RecipeID       string  `json:"recipe_id,omitempty"`
+	BundleID       string  `json:"bundle_id,omitempty"`
+	Amount         float64 `json:"amount"`
+	TransactionID  string  `json:"transaction_id"`
+	Status         string  `json:"status"`
+	CheckoutURL    string  `json:"checkout_url,omitempty"`
+	IdempotencyKey string  `json:"idempotency_key,omitempty"`
+	CouponID       string  `json:"coupon_id,omitempty"`
+	OriginalAmount float64 `json:"original_amount,omitempty"`
+	DiscountAmount float64 `json:"discount_amount,omitempty"`
+	// Amount is charged in Currency. ListPrice is the recipe's price in its
+	// own currency and ExchangeRate converted it; SettlementAmount is Amount
+	// in the ledger currency.
+	Currency          string  `json:"currency"`
+	ListPrice         float64 `json:"list_price,omitempty"`
+	ListCurrency      string  `json:"list_currency,omitempty"`
+	ExchangeRate      float64 `json:"exchange_rate,omitempty"`
+	SettlementAmount  float64 `json:"settlement_amount,omitempty"`
+	ProviderReference string  `json:"provider_reference,omitempty"`
+	PaymentProvider   string  `json:"payment_provider,omitempty"`
+	RecipientEmail    string  `json:"recipient_email,omitempty"`
+	GiftMessage       string  `json:"gift_message,omitempty"`
+	GiftCode          string  `json:"gift_code,omitempty"`
+	GiftExpiresAt     string  `json:"gift_expires_at,omitempty"`
+	RedeemedBy        string  `json:"redeemed_by,omitempty"`
+	RedeemedAt        string  `json:"redeemed_at,omitempty"`
+	CreatedAt         string  `json:"created_at"`
+	UpdatedAt         string  `json:"updated_at"`
+}
+
 type CreatePurchaseInput struct {
+	UserID           string  `json:"user_id"`
+	RecipeID         string  `json:"recipe_id,omitempty"`
+	BundleID         string  `json:"bundle_id,omitempty"`
+	Amount           float64 `json:"amount"`
+	TransactionID    string  `json:"transaction_id"`
+	Status           string  `json:"status"`
+	IdempotencyKey   string  `json:"idempotency_key,omitempty"`
+	CouponID         string  `json:"coupon_id,omitempty"`
+	OriginalAmount   float64 `json:"original_amount,omitempty"`
+	DiscountAmount   float64 `json:"discount_amount,omitempty"`
+	Currency         string  `json:"currency"`
+	ListPrice        float64 `json:"list_price"`
+	ListCurrency     string  `json:"list_currency"`
+	ExchangeRate     float64 `json:"exchange_rate"`
+	SettlementAmount float64 `json:"settlement_amount"`
+	PaymentProvider  string  `json:"payment_provider,omitempty"`
+	RecipientEmail   string  `json:"recipient_email,omitempty"`
+	GiftMessage      string  `json:"gift_message,omitempty"`
+	GiftCode         string  `json:"gift_code,omitempty"`
+	GiftExpiresAt    string  `json:"gift_expires_at,omitempty"`
+}
+
+type File struct {
+	ID            string  `json:"id"`
 	UserID        string  `json:"user_id"`
-	RecipeID      string  `json:"recipe_id"`
-	Amount        float64 `json:"amount"`
-	TransactionID string  `json:"transaction_id"`
-	Status        string  `json:"status"`
+	Key           string  `json:"key"`
+	URL           string  `json:"url"`
+	FileName      string  `json:"file_name"`
+	Size          int64   `json:"size"`
+	MimeType      string  `json:"mime_type"`
+	Width         int     `json:"width,omitempty"`
+	Height        int     `json:"height,omitempty"`
+	BlurHash      string  `json:"blurhash,omitempty"`
+	DominantColor string  `json:"dominant_color,omitempty"`
+	Duration      float64 `json:"duration,omitempty"`
+	VideoCodec    string  `json:"video_codec,omitempty"`
+	AudioCodec    string  `json:"audio_codec,omitempty"`
+	PosterURL     string  `json:"poster_url,omitempty"`
+	Visibility    string  `json:"visibility,omitempty"`
+	RecipeID      string  `json:"recipe_id,omitempty"`
+	ContentHash   string  `json:"content_hash,omitempty"`
+	ReferenceType string  `json:"reference_type,omitempty"`
+	ReferenceID   string  `json:"reference_id,omitempty"`
+	CreatedAt     string  `json:"created_at"`
+}
+
+type CreateFileInput struct {
+	UserID        string  `json:"user_id"`
+	Key           string  `json:"key"`
+	URL           string  `json:"url"`
+	FileName      string  `json:"file_name"`
+	Size          int64   `json:"size"`
+	MimeType      string  `json:"mime_type"`
+	Width         int     `json:"width,omitempty"`
+	Height        int     `json:"height,omitempty"`
+	BlurHash      string  `json:"blurhash,omitempty"`
+	DominantColor string  `json:"dominant_color,omitempty"`
+	Duration      float64 `json:"duration,omitempty"`
+	VideoCodec    string  `json:"video_codec,omitempty"`
+	AudioCodec    string  `json:"audio_codec,omitempty"`
+	PosterURL     string  `json:"poster_url,omitempty"`
+	Visibility    string  `json:"visibility,omitempty"`
+	RecipeID      string  `json:"recipe_id,omitempty"`
+	ContentHash   string  `json:"content_hash,omitempty"`
+	ReferenceType string  `json:"reference_type,omitempty"`
+	ReferenceID   string  `json:"reference_id,omitempty"`
+}
+
+type Recipe struct {
+	ID               string  `json:"id"`
+	UserID           string  `json:"user_id"`
+	Title            string  `json:"title"`
+	IsPremium        bool    `json:"is_premium"`
+	Price            float64 `json:"price"`
+	Currency         string  `json:"currency"`
+	IsPublished      bool    `json:"is_published"`
+	FeaturedImageURL string  `json:"featured_image_url,omitempty"`
+}
+
+type StorageUsage struct {
+	BytesUsed int64 `json:"bytes_used"`
+	FileCount int   `json:"file_count"`
 }
\ No newline at end of file
@@ -0,0 +1,364 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// Bundle operations
+
+const bundleFields = `
+	id
+	chef_id
+	title
+	description
+	price
+	currency
+	is_active
+	created_at
+	updated_at
+`
+
+// CreateBundle stores a bundle together with its recipes, in the given
+// order, and what each recipe cost on its own. The bundle's ID is chosen by
+// the caller.
+func (s *HasuraService) CreateBundle(ctx context.Context, bundle *Bundle) (*Bundle, error) {
+	query := `
+		mutation CreateBundle($bundle: bundles_insert_input!, $recipes: [bundle_recipes_insert_input!]!) {
+			insert_bundles_one(object: $bundle) {` + bundleFields + `}
+			insert_bundle_recipes(objects: $recipes) {
+				affected_rows
+			}
+		}
+	`
+
+	object := map[string]interface{}{
+		"id":       bundle.ID,
+		"chef_id":  bundle.ChefID,
+		"title":    bundle.Title,
+		"price":    bundle.Price,
+		"currency": bundle.Currency,
+	}
+	if bundle.Description != "" {
+		object["description"] = bundle.Description
+	}
+
+	recipes := make([]map[string]interface{}, len(bundle.RecipeIDs))
+	for i, recipeID := range bundle.RecipeIDs {
+		recipes[i] = map[string]interface{}{
+			"bundle_id": bundle.ID,
+			"recipe_id": recipeID,
+			"position":  i + 1,
+		}
+		if i < len(bundle.ListPrices) {
+			recipes[i]["list_price"] = bundle.ListPrices[i]
+		}
+	}
+
+	resp, err := s.ExecuteQuery(ctx, query, map[string]interface{}{
+		"bundle":  object,
+		"recipes": recipes,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create bundle: %w", err)
+	}
+
+	var result struct {
+		Bundle *Bundle `json:"insert_bundles_one"`
+	}
+
+	if err := json.Unmarshal(resp.Data, &result); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	if result.Bundle == nil {
+		return nil, fmt.Errorf("bundle creation failed: no data returned from database")
+	}
+
+	result.Bundle.RecipeIDs = bundle.RecipeIDs
+	result.Bundle.ListPrices = bundle.ListPrices
+	return result.Bundle, nil
+}
+
+// GetBundle returns a bundle with the IDs and list prices of its recipes in
+// order, or nil when there is none.
+func (s *HasuraService) GetBundle(ctx context.Context, id string) (*Bundle, error) {
+	query := `
+		query GetBundle($id: uuid!) {
+			bundles_by_pk(id: $id) {` + bundleFields + `}
+			bundle_recipes(where: {bundle_id: {_eq: $id}}, order_by: {position: asc}) {
+				recipe_id
+				list_price
+			}
+		}
+	`
+
+	resp, err := s.ExecuteQuery(ctx, query, map[string]interface{}{"id": id})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get bundle: %w", err)
+	}
+
+	var result struct {
+		Bundle  *Bundle `json:"bundles_by_pk"`
+		Recipes []struct {
+			RecipeID  string   `json:"recipe_id"`
+			ListPrice *float64 `json:"list_price"`
+		} `json:"bundle_recipes"`
+	}
+
+	if err := json.Unmarshal(resp.Data, &result); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	if result.Bundle == nil {
+		return nil, nil
+	}
+
+	result.Bundle.RecipeIDs = make([]string, len(result.Recipes))
+	result.Bundle.ListPrices = make([]float64, len(result.Recipes))
+	for i, recipe := range result.Recipes {
+		result.Bundle.RecipeIDs[i] = recipe.RecipeID
+		if recipe.ListPrice != nil {
+			result.Bundle.ListPrices[i] = *recipe.ListPrice
+		}
+	}
+
+	return result.Bundle, nil
+}
+
+// ListBundles returns the active bundles with the IDs of their recipes,
+// limited to one chef's bundles when chefID is not empty.
+func (s *HasuraService) ListBundles(ctx context.Context, chefID string) ([]Bundle, error) {
+	query := `
+		query ListBundles($where: bundles_bool_exp!) {
+			bundles(where: $where, order_by: {created_at: desc}) {` + bundleFields + `}
+		}
+	`
+
+	where := map[string]interface{}{
+		"is_active": map[string]interface{}{"_eq": true},
+	}
+	if chefID != "" {
+		where["chef_id"] = map[string]interface{}{"_eq": chefID}
+	}
+
+	resp, err := s.ExecuteQuery(ctx, query, map[string]interface{}{"where": where})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list bundles: %w", err)
+	}
+
+	var result struct {
+		Bundles []Bundle `json:"bundles"`
+	}
+
+	if err := json.Unmarshal(resp.Data, &result); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	if len(result.Bundles) == 0 {
+		return result.Bundles, nil
+	}
+
+	ids := make([]string, len(result.Bundles))
+	for i, bundle := range result.Bundles {
+		ids[i] = bundle.ID
+	}
+
+	query = `
+		query ListBundleRecipes($bundle_ids: [uuid!]!) {
+			bundle_recipes(where: {bundle_id: {_in: $bundle_ids}}, order_by: [{bundle_id: asc}, {position: asc}]) {
+				bundle_id
+				recipe_id
+			}
+		}
+	`
+
+	resp, err = s.ExecuteQuery(ctx, query, map[string]interface{}{"bundle_ids": ids})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list bundle recipes: %w", err)
+	}
+
+	var recipes struct {
+		BundleRecipes []struct {
+			BundleID string `json:"bundle_id"`
+			RecipeID string `json:"recipe_id"`
+		} `json:"bundle_recipes"`
+	}
+
+	if err := json.Unmarshal(resp.Data, &recipes); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	byBundle := make(map[string][]string)
+	for _, recipe := range recipes.BundleRecipes {
+		byBundle[recipe.BundleID] = append(byBundle[recipe.BundleID], recipe.RecipeID)
+	}
+	for i := range result.Bundles {
+		result.Bundles[i].RecipeIDs = byBundle[result.Bundles[i].ID]
+	}
+
+	return result.Bundles, nil
+}
+
+// DeactivateBundle stops sales of a bundle. Recipes already bought with it
+// stay unlocked.
+func (s *HasuraService) DeactivateBundle(ctx context.Context, id string) error {
+	query := `
+		mutation DeactivateBundle($id: uuid!) {
+			update_bundles_by_pk(pk_columns: {id: $id}, _set: {is_active: false}) {
+				id
+			}
+		}
+	`
+
+	_, err := s.ExecuteQuery(ctx, query, map[string]interface{}{"id": id})
+	if err != nil {
+		return fmt.Errorf("failed to deactivate bundle: %w", err)
+	}
+
+	return nil
+}
+
+// GetRecipesByIDs returns the recipes with the given IDs in the same order.
+// Recipes that do not exist are left out.
+func (s *HasuraService) GetRecipesByIDs(ctx context.Context, ids []string) ([]Recipe, error) {
+	query := `
+		query GetRecipesByIDs($ids: [uuid!]!) {
+			recipes(where: {id: {_in: $ids}}) {
+				id
+				user_id
+				title
+				is_premium
+				price
+				currency
+				is_published
+				featured_image_url
+			}
+		}
+	`
+
+	resp, err := s.ExecuteQuery(ctx, query, map[string]interface{}{"ids": ids})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get recipes: %w", err)
+	}
+
+	var result struct {
+		Recipes []Recipe `json:"recipes"`
+	}
+
+	if err := json.Unmarshal(resp.Data, &result); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	byID := make(map[string]Recipe, len(result.Recipes))
+	for _, recipe := range result.Recipes {
+		byID[recipe.ID] = recipe
+	}
+
+	recipes := make([]Recipe, 0, len(ids))
+	for _, id := range ids {
+		if recipe, ok := byID[id]; ok {
+			recipes = append(recipes, recipe)
+		}
+	}
+
+	return recipes, nil
+}
+
+// GetPurchaseItem returns what a purchase bought, or nil when its recipe no
+// longer exists.
+func (s *HasuraService) GetPurchaseItem(ctx context.Context, purchase *Purchase) (*PurchaseItem, error) {
+	if purchase.BundleID == "" {
+		recipe, err := s.GetRecipeByID(ctx, purchase.RecipeID)
+		if err != nil || recipe == nil {
+			return nil, err
+		}
+
+		return &PurchaseItem{
+			RecipeID: recipe.ID,
+			Title:    recipe.Title,
+			SellerID: recipe.UserID,
+			Recipes:  []Recipe{*recipe},
+		}, nil
+	}
+
+	bundle, err := s.GetBundle(ctx, purchase.BundleID)
+	if err != nil || bundle == nil {
+		return nil, err
+	}
+
+	recipes, err := s.GetRecipesByIDs(ctx, bundle.RecipeIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	listPrices := make(map[string]float64, len(bundle.RecipeIDs))
+	for i, recipeID := range bundle.RecipeIDs {
+		listPrices[recipeID] = bundle.ListPrices[i]
+	}
+
+	weights := make([]float64, len(recipes))
+	for i, recipe := range recipes {
+		weights[i] = listPrices[recipe.ID]
+	}
+
+	return &PurchaseItem{
+		BundleID: bundle.ID,
+		Title:    bundle.Title,
+		SellerID: bundle.ChefID,
+		Recipes:  recipes,
+		Weights:  weights,
+	}, nil
+}
+
+func entitlementObjects(entitlements []BundleEntitlementInput) []map[string]interface{} {
+	objects := make([]map[string]interface{}, 0, len(entitlements))
+	for _, entitlement := range entitlements {
+		objects = append(objects, map[string]interface{}{
+			"purchase_id": entitlement.PurchaseID,
+			"bundle_id":   entitlement.BundleID,
+			"recipe_id":   entitlement.RecipeID,
+			"user_id":     entitlement.UserID,
+		})
+	}
+	return objects
+}
+
+type Bundle struct {
+	ID          string   `json:"id"`
+	ChefID      string   `json:"chef_id"`
+	Title       string   `json:"title"`
+	Description string   `json:"description,omitempty"`
+	Price       float64  `json:"price"`
+	Currency    string   `json:"currency"`
+	IsActive    bool     `json:"is_active"`
+	RecipeIDs   []string `json:"recipe_ids"`
+	CreatedAt   string   `json:"created_at"`
+	UpdatedAt   string   `json:"updated_at"`
+
+	// What each recipe cost on its own, in the bundle's currency, when the
+	// bundle was created
+	ListPrices []float64 `json:"-"`
+}
+
+// PurchaseItem is what a purchase bought: a single recipe, or a bundle and
+// the recipes in it. A bundle's Weights hold what each of its Recipes cost
+// on its own, for splitting the sale between them.
+type PurchaseItem struct {
+	RecipeID string
+	BundleID string
+	Title    string
+	SellerID string
+	Recipes  []Recipe
+	Weights  []float64
+}
+
+// BundleEntitlementInput gives a bundle's buyer access to one of its
+// recipes.
+type BundleEntitlementInput struct {
+	PurchaseID string
+	BundleID   string
+	RecipeID   string
+	UserID     string
+}
@@ -0,0 +1,270 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Coupon operations
+
+const (
+	CouponPercent = "percent"
+	CouponFixed   = "fixed"
+)
+
+const (
+	CouponScopeRecipe   = "recipe"
+	CouponScopeChef     = "chef"
+	CouponScopeSitewide = "sitewide"
+)
+
+const couponFields = `
+	id
+	code
+	created_by
+	discount_type
+	discount_value
+	currency
+	scope
+	recipe_id
+	chef_id
+	expires_at
+	max_uses
+	max_uses_per_user
+	is_active
+	created_at
+	updated_at
+`
+
+func (s *HasuraService) CreateCoupon(ctx context.Context, coupon Coupon) (*Coupon, error) {
+	query := `
+		mutation CreateCoupon($coupon: coupons_insert_input!) {
+			insert_coupons_one(object: $coupon) {` + couponFields + `}
+		}
+	`
+
+	object := map[string]interface{}{
+		"code":           strings.ToUpper(coupon.Code),
+		"created_by":     coupon.CreatedBy,
+		"discount_type":  coupon.DiscountType,
+		"discount_value": coupon.DiscountValue,
+		"scope":          coupon.Scope,
+	}
+	if coupon.Currency != "" {
+		object["currency"] = coupon.Currency
+	}
+	if coupon.RecipeID != "" {
+		object["recipe_id"] = coupon.RecipeID
+	}
+	if coupon.ChefID != "" {
+		object["chef_id"] = coupon.ChefID
+	}
+	if coupon.ExpiresAt != "" {
+		object["expires_at"] = coupon.ExpiresAt
+	}
+	if coupon.MaxUses > 0 {
+		object["max_uses"] = coupon.MaxUses
+	}
+	if coupon.MaxUsesPerUser > 0 {
+		object["max_uses_per_user"] = coupon.MaxUsesPerUser
+	}
+
+	resp, err := s.ExecuteQuery(ctx, query, map[string]interface{}{"coupon": object})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create coupon: %w", err)
+	}
+
+	var result struct {
+		Coupon *Coupon `json:"insert_coupons_one"`
+	}
+
+	if err := json.Unmarshal(resp.Data, &result); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	if result.Coupon == nil {
+		return nil, fmt.Errorf("coupon creation failed: no data returned from database")
+	}
+
+	return result.Coupon, nil
+}
+
+// GetCouponByCode looks a coupon up by its code, ignoring case.
+func (s *HasuraService) GetCouponByCode(ctx context.Context, code string) (*Coupon, error) {
+	query := `
+		query GetCouponByCode($code: String!) {
+			coupons(where: {code: {_eq: $code}}, limit: 1) {` + couponFields + `}
+		}
+	`
+
+	resp, err := s.ExecuteQuery(ctx, query, map[string]interface{}{"code": strings.ToUpper(code)})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get coupon: %w", err)
+	}
+
+	var result struct {
+		Coupons []Coupon `json:"coupons"`
+	}
+
+	if err := json.Unmarshal(resp.Data, &result); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	if len(result.Coupons) == 0 {
+		return nil, nil
+	}
+
+	return &result.Coupons[0], nil
+}
+
+func (s *HasuraService) GetCoupon(ctx context.Context, id string) (*Coupon, error) {
+	query := `
+		query GetCoupon($id: uuid!) {
+			coupons_by_pk(id: $id) {` + couponFields + `}
+		}
+	`
+
+	resp, err := s.ExecuteQuery(ctx, query, map[string]interface{}{"id": id})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get coupon: %w", err)
+	}
+
+	var result struct {
+		Coupon *Coupon `json:"coupons_by_pk"`
+	}
+
+	if err := json.Unmarshal(resp.Data, &result); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	return result.Coupon, nil
+}
+
+// ListCoupons returns the coupons a user created, newest first.
+func (s *HasuraService) ListCoupons(ctx context.Context, createdBy string, limit, offset int) ([]Coupon, error) {
+	query := `
+		query ListCoupons($created_by: uuid!, $limit: Int!, $offset: Int!) {
+			coupons(
+				where: {created_by: {_eq: $created_by}},
+				order_by: {created_at: desc},
+				limit: $limit,
+				offset: $offset
+			) {` + couponFields + `}
+		}
+	`
+
+	resp, err := s.ExecuteQuery(ctx, query, map[string]interface{}{
+		"created_by": createdBy,
+		"limit":      limit,
+		"offset":     offset,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list coupons: %w", err)
+	}
+
+	var result struct {
+		Coupons []Coupon `json:"coupons"`
+	}
+
+	if err := json.Unmarshal(resp.Data, &result); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	return result.Coupons, nil
+}
+
+func (s *HasuraService) DeactivateCoupon(ctx context.Context, id string) error {
+	query := `
+		mutation DeactivateCoupon($id: uuid!) {
+			update_coupons_by_pk(pk_columns: {id: $id}, _set: {is_active: false}) {
+				id
+			}
+		}
+	`
+
+	_, err := s.ExecuteQuery(ctx, query, map[string]interface{}{"id": id})
+	if err != nil {
+		return fmt.Errorf("failed to deactivate coupon: %w", err)
+	}
+
+	return nil
+}
+
+// CountCouponUses counts the purchases a coupon was applied to, in total and
+// by one user. Failed and expired checkouts do not count, and neither does
+// the user's open checkout for recipeID, which a new checkout replaces.
+func (s *HasuraService) CountCouponUses(ctx context.Context, couponID, userID, recipeID string) (total, byUser int, err error) {
+	query := `
+		query CountCouponUses($coupon_id: uuid!, $user_id: uuid!, $recipe_id: uuid!) {
+			total: purchases_aggregate(
+				where: {
+					coupon_id: {_eq: $coupon_id},
+					status: {_in: ["pending", "completed", "refunded"]},
+					_not: {user_id: {_eq: $user_id}, recipe_id: {_eq: $recipe_id}, status: {_eq: "pending"}}
+				}
+			) {
+				aggregate {
+					count
+				}
+			}
+			by_user: purchases_aggregate(
+				where: {
+					coupon_id: {_eq: $coupon_id},
+					user_id: {_eq: $user_id},
+					status: {_in: ["pending", "completed", "refunded"]},
+					_not: {recipe_id: {_eq: $recipe_id}, status: {_eq: "pending"}}
+				}
+			) {
+				aggregate {
+					count
+				}
+			}
+		}
+	`
+
+	resp, err := s.ExecuteQuery(ctx, query, map[string]interface{}{
+		"coupon_id": couponID,
+		"user_id":   userID,
+		"recipe_id": recipeID,
+	})
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to count coupon uses: %w", err)
+	}
+
+	type count struct {
+		Aggregate struct {
+			Count int `json:"count"`
+		} `json:"aggregate"`
+	}
+
+	var result struct {
+		Total  count `json:"total"`
+		ByUser count `json:"by_user"`
+	}
+
+	if err := json.Unmarshal(resp.Data, &result); err != nil {
+		return 0, 0, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	return result.Total.Aggregate.Count, result.ByUser.Aggregate.Count, nil
+}
+
+type Coupon struct {
+	ID             string  `json:"id"`
+	Code           string  `json:"code"`
+	CreatedBy      string  `json:"created_by"`
+	DiscountType   string  `json:"discount_type"`
+	DiscountValue  float64 `json:"discount_value"`
+	Currency       string  `json:"currency"`
+	Scope          string  `json:"scope"`
+	RecipeID       string  `json:"recipe_id,omitempty"`
+	ChefID         string  `json:"chef_id,omitempty"`
+	ExpiresAt      string  `json:"expires_at,omitempty"`
+	MaxUses        int     `json:"max_uses,omitempty"`
+	MaxUsesPerUser int     `json:"max_uses_per_user,omitempty"`
+	IsActive       bool    `json:"is_active"`
+	CreatedAt      string  `json:"created_at"`
+	UpdatedAt      string  `json:"updated_at"`
+}
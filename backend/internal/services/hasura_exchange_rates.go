@@ -0,0 +1,128 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// Exchange rate operations
+
+const exchangeRateFields = `
+	base_currency
+	quote_currency
+	rate
+	source
+	updated_by
+	created_at
+	updated_at
+`
+
+func (s *HasuraService) ListExchangeRates(ctx context.Context) ([]ExchangeRate, error) {
+	query := `
+		query ListExchangeRates {
+			exchange_rates(order_by: [{base_currency: asc}, {quote_currency: asc}]) {` + exchangeRateFields + `}
+		}
+	`
+
+	resp, err := s.ExecuteQuery(ctx, query, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list exchange rates: %w", err)
+	}
+
+	var result struct {
+		Rates []ExchangeRate `json:"exchange_rates"`
+	}
+
+	if err := json.Unmarshal(resp.Data, &result); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	return result.Rates, nil
+}
+
+// GetExchangeRate returns the rate for converting base into quote, or nil
+// when none was set.
+func (s *HasuraService) GetExchangeRate(ctx context.Context, base, quote string) (*ExchangeRate, error) {
+	query := `
+		query GetExchangeRate($base: String!, $quote: String!) {
+			exchange_rates_by_pk(base_currency: $base, quote_currency: $quote) {` + exchangeRateFields + `}
+		}
+	`
+
+	resp, err := s.ExecuteQuery(ctx, query, map[string]interface{}{
+		"base":  base,
+		"quote": quote,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get exchange rate: %w", err)
+	}
+
+	var result struct {
+		Rate *ExchangeRate `json:"exchange_rates_by_pk"`
+	}
+
+	if err := json.Unmarshal(resp.Data, &result); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	return result.Rate, nil
+}
+
+// UpsertExchangeRates stores the given rates in one mutation, replacing any
+// rate already set for the same pair.
+func (s *HasuraService) UpsertExchangeRates(ctx context.Context, rates []ExchangeRate, source, userID string) ([]ExchangeRate, error) {
+	query := `
+		mutation UpsertExchangeRates($rates: [exchange_rates_insert_input!]!) {
+			insert_exchange_rates(
+				objects: $rates,
+				on_conflict: {constraint: exchange_rates_pkey, update_columns: [rate, source, updated_by]}
+			) {
+				returning {` + exchangeRateFields + `}
+			}
+		}
+	`
+
+	objects := make([]map[string]interface{}, 0, len(rates))
+	for _, rate := range rates {
+		object := map[string]interface{}{
+			"base_currency":  rate.BaseCurrency,
+			"quote_currency": rate.QuoteCurrency,
+			"rate":           rate.Rate,
+			"source":         source,
+		}
+		if userID != "" {
+			object["updated_by"] = userID
+		}
+		objects = append(objects, object)
+	}
+
+	resp, err := s.ExecuteQuery(ctx, query, map[string]interface{}{"rates": objects})
+	if err != nil {
+		return nil, fmt.Errorf("failed to save exchange rates: %w", err)
+	}
+
+	var result struct {
+		Insert struct {
+			Returning []ExchangeRate `json:"returning"`
+		} `json:"insert_exchange_rates"`
+	}
+
+	if err := json.Unmarshal(resp.Data, &result); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	return result.Insert.Returning, nil
+}
+
+// ExchangeRate says that one unit of BaseCurrency is worth Rate units of
+// QuoteCurrency.
+type ExchangeRate struct {
+	BaseCurrency  string  `json:"base_currency"`
+	QuoteCurrency string  `json:"quote_currency"`
+	Rate          float64 `json:"rate"`
+	Source        string  `json:"source"`
+	UpdatedBy     string  `json:"updated_by,omitempty"`
+	CreatedAt     string  `json:"created_at"`
+	UpdatedAt     string  `json:"updated_at"`
+}
@@ -0,0 +1,287 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// Recipe gallery operations
+
+const recipeImageFields = `
+	id
+	recipe_id
+	file_id
+	image_url
+	is_featured
+	caption
+	position
+	width
+	height
+	blurhash
+	dominant_color
+	created_at
+`
+
+func (s *HasuraService) ListRecipeImages(ctx context.Context, recipeID string) ([]RecipeImage, error) {
+	query := `
+		query ListRecipeImages($recipe_id: uuid!) {
+			recipe_images(
+				where: {recipe_id: {_eq: $recipe_id}},
+				order_by: [{position: asc}, {created_at: asc}]
+			) {` + recipeImageFields + `}
+		}
+	`
+
+	variables := map[string]interface{}{
+		"recipe_id": recipeID,
+	}
+
+	resp, err := s.ExecuteQuery(ctx, query, variables)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list recipe images: %w", err)
+	}
+
+	var result struct {
+		RecipeImages []RecipeImage `json:"recipe_images"`
+	}
+
+	if err := json.Unmarshal(resp.Data, &result); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	return result.RecipeImages, nil
+}
+
+// AddRecipeImage adds an uploaded file to the end of a recipe's gallery.
+// The file is linked to the recipe alongside any recipe it was uploaded for,
+// so buyers of either can read it, and points at the new image unless it
+// already refers to something else.
+func (s *HasuraService) AddRecipeImage(ctx context.Context, input AddRecipeImageInput) (*RecipeImage, error) {
+	if err := s.LinkFileRecipe(ctx, input.File.ID, input.RecipeID); err != nil {
+		return nil, err
+	}
+
+	query := `
+		mutation AddRecipeImage($image: recipe_images_insert_input!) {
+			insert_recipe_images_one(object: $image) {` + recipeImageFields + `}
+		}
+	`
+
+	image := map[string]interface{}{
+		"recipe_id": input.RecipeID,
+		"file_id":   input.File.ID,
+		"image_url": input.File.URL,
+		"position":  input.Position,
+	}
+	if input.Caption != "" {
+		image["caption"] = input.Caption
+	}
+
+	resp, err := s.ExecuteQuery(ctx, query, map[string]interface{}{"image": image})
+	if err != nil {
+		return nil, fmt.Errorf("failed to add recipe image: %w", err)
+	}
+
+	var result struct {
+		InsertRecipeImagesOne *RecipeImage `json:"insert_recipe_images_one"`
+	}
+
+	if err := json.Unmarshal(resp.Data, &result); err != nil {
+		return nil, fmt.Errorf("failed to parse add recipe image response: %w", err)
+	}
+
+	if result.InsertRecipeImagesOne == nil {
+		return nil, fmt.Errorf("adding recipe image failed: no data returned from database")
+	}
+
+	referenceQuery := `
+		mutation LinkFileToRecipeImage($id: uuid!, $image_id: uuid!) {
+			update_files(
+				where: {id: {_eq: $id}, reference_type: {_is_null: true}},
+				_set: {reference_type: "recipe_image", reference_id: $image_id}
+			) {
+				affected_rows
+			}
+		}
+	`
+
+	_, err = s.ExecuteQuery(ctx, referenceQuery, map[string]interface{}{
+		"id":       input.File.ID,
+		"image_id": result.InsertRecipeImagesOne.ID,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to link file to recipe image: %w", err)
+	}
+
+	return result.InsertRecipeImagesOne, nil
+}
+
+func (s *HasuraService) UpdateRecipeImageCaption(ctx context.Context, recipeID, imageID, caption string) (bool, error) {
+	query := `
+		mutation UpdateRecipeImageCaption($recipe_id: uuid!, $id: uuid!, $caption: String) {
+			update_recipe_images(
+				where: {id: {_eq: $id}, recipe_id: {_eq: $recipe_id}},
+				_set: {caption: $caption}
+			) {
+				affected_rows
+			}
+		}
+	`
+
+	var value interface{}
+	if caption != "" {
+		value = caption
+	}
+
+	resp, err := s.ExecuteQuery(ctx, query, map[string]interface{}{
+		"recipe_id": recipeID,
+		"id":        imageID,
+		"caption":   value,
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to update recipe image caption: %w", err)
+	}
+
+	var result struct {
+		UpdateRecipeImages struct {
+			AffectedRows int `json:"affected_rows"`
+		} `json:"update_recipe_images"`
+	}
+
+	if err := json.Unmarshal(resp.Data, &result); err != nil {
+		return false, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	return result.UpdateRecipeImages.AffectedRows > 0, nil
+}
+
+// ReorderRecipeImages sets each image's position to its index in imageIDs.
+func (s *HasuraService) ReorderRecipeImages(ctx context.Context, recipeID string, imageIDs []string) error {
+	query := `
+		mutation ReorderRecipeImages($updates: [recipe_images_updates!]!) {
+			update_recipe_images_many(updates: $updates) {
+				affected_rows
+			}
+		}
+	`
+
+	updates := make([]map[string]interface{}, 0, len(imageIDs))
+	for position, id := range imageIDs {
+		updates = append(updates, map[string]interface{}{
+			"where": map[string]interface{}{
+				"id":        map[string]interface{}{"_eq": id},
+				"recipe_id": map[string]interface{}{"_eq": recipeID},
+			},
+			"_set": map[string]interface{}{"position": position},
+		})
+	}
+
+	_, err := s.ExecuteQuery(ctx, query, map[string]interface{}{"updates": updates})
+	if err != nil {
+		return fmt.Errorf("failed to reorder recipe images: %w", err)
+	}
+
+	return nil
+}
+
+// SetFeaturedRecipeImage marks one image as featured, clears the flag on the
+// others and copies its URL to recipes.featured_image_url. Hasura runs the
+// mutations in a single transaction.
+func (s *HasuraService) SetFeaturedRecipeImage(ctx context.Context, recipeID string, image *RecipeImage) error {
+	query := `
+		mutation SetFeaturedRecipeImage($recipe_id: uuid!, $id: uuid!, $image_url: String!) {
+			clear: update_recipe_images(
+				where: {recipe_id: {_eq: $recipe_id}, is_featured: {_eq: true}},
+				_set: {is_featured: false}
+			) {
+				affected_rows
+			}
+			feature: update_recipe_images(
+				where: {id: {_eq: $id}, recipe_id: {_eq: $recipe_id}},
+				_set: {is_featured: true}
+			) {
+				affected_rows
+			}
+			update_recipes_by_pk(
+				pk_columns: {id: $recipe_id},
+				_set: {featured_image_url: $image_url}
+			) {
+				id
+			}
+		}
+	`
+
+	_, err := s.ExecuteQuery(ctx, query, map[string]interface{}{
+		"recipe_id": recipeID,
+		"id":        image.ID,
+		"image_url": image.ImageURL,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to set featured recipe image: %w", err)
+	}
+
+	return nil
+}
+
+func (s *HasuraService) ClearFeaturedRecipeImage(ctx context.Context, recipeID string) error {
+	query := `
+		mutation ClearFeaturedRecipeImage($recipe_id: uuid!) {
+			update_recipes_by_pk(
+				pk_columns: {id: $recipe_id},
+				_set: {featured_image_url: null}
+			) {
+				id
+			}
+		}
+	`
+
+	_, err := s.ExecuteQuery(ctx, query, map[string]interface{}{"recipe_id": recipeID})
+	if err != nil {
+		return fmt.Errorf("failed to clear featured recipe image: %w", err)
+	}
+
+	return nil
+}
+
+func (s *HasuraService) RemoveRecipeImage(ctx context.Context, recipeID, imageID string) error {
+	query := `
+		mutation RemoveRecipeImage($recipe_id: uuid!, $id: uuid!) {
+			delete_recipe_images(where: {id: {_eq: $id}, recipe_id: {_eq: $recipe_id}}) {
+				affected_rows
+			}
+		}
+	`
+
+	_, err := s.ExecuteQuery(ctx, query, map[string]interface{}{
+		"recipe_id": recipeID,
+		"id":        imageID,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to remove recipe image: %w", err)
+	}
+
+	return nil
+}
+
+type RecipeImage struct {
+	ID            string `json:"id"`
+	RecipeID      string `json:"recipe_id"`
+	FileID        string `json:"file_id,omitempty"`
+	ImageURL      string `json:"image_url"`
+	IsFeatured    bool   `json:"is_featured"`
+	Caption       string `json:"caption,omitempty"`
+	Position      int    `json:"position"`
+	Width         int    `json:"width,omitempty"`
+	Height        int    `json:"height,omitempty"`
+	BlurHash      string `json:"blurhash,omitempty"`
+	DominantColor string `json:"dominant_color,omitempty"`
+	CreatedAt     string `json:"created_at"`
+}
+
+type AddRecipeImageInput struct {
+	RecipeID string
+	File     *File
+	Caption  string
+	Position int
+}
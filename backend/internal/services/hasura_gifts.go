@@ -0,0 +1,80 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Gift operations
+
+// GetPurchaseByGiftCode returns the gift purchase carrying the code, or nil
+// when there is none.
+func (s *HasuraService) GetPurchaseByGiftCode(ctx context.Context, code string) (*Purchase, error) {
+	query := `
+		query GetPurchaseByGiftCode($gift_code: String!) {
+			purchases(where: {gift_code: {_eq: $gift_code}}, limit: 1) {` + purchaseFields + `}
+		}
+	`
+
+	resp, err := s.ExecuteQuery(ctx, query, map[string]interface{}{"gift_code": code})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get gift: %w", err)
+	}
+
+	var result struct {
+		Purchases []Purchase `json:"purchases"`
+	}
+
+	if err := json.Unmarshal(resp.Data, &result); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	if len(result.Purchases) == 0 {
+		return nil, nil
+	}
+
+	return &result.Purchases[0], nil
+}
+
+// RedeemGift gives the gift to the user if it is paid for, not yet redeemed
+// and not expired at now, and reports whether it did.
+func (s *HasuraService) RedeemGift(ctx context.Context, code, userID string, now time.Time) (bool, error) {
+	query := `
+		mutation RedeemGift($gift_code: String!, $user_id: uuid!, $now: timestamptz!) {
+			update_purchases(
+				where: {
+					gift_code: {_eq: $gift_code},
+					status: {_eq: "completed"},
+					redeemed_by: {_is_null: true},
+					gift_expires_at: {_gt: $now}
+				},
+				_set: {redeemed_by: $user_id, redeemed_at: $now}
+			) {
+				affected_rows
+			}
+		}
+	`
+
+	resp, err := s.ExecuteQuery(ctx, query, map[string]interface{}{
+		"gift_code": code,
+		"user_id":   userID,
+		"now":       now.UTC().Format(time.RFC3339Nano),
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to redeem gift: %w", err)
+	}
+
+	var result struct {
+		UpdatePurchases struct {
+			AffectedRows int `json:"affected_rows"`
+		} `json:"update_purchases"`
+	}
+
+	if err := json.Unmarshal(resp.Data, &result); err != nil {
+		return false, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	return result.UpdatePurchases.AffectedRows > 0, nil
+}
@@ -0,0 +1,160 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// Invoice operations
+
+const invoiceFields = `
+	id
+	number
+	invoice_number
+	purchase_id
+	issued_at
+	issuer_name
+	issuer_tin
+	issuer_address
+	seller_id
+	seller_name
+	seller_email
+	buyer_id
+	buyer_name
+	buyer_email
+	recipe_id
+	bundle_id
+	recipe_title
+	currency
+	total_amount
+	discount_amount
+	vat_rate
+	net_amount
+	vat_amount
+	transaction_id
+	provider_reference
+	payment_provider
+	created_at
+`
+
+// CreateInvoice stores an invoice. The database assigns its number.
+func (s *HasuraService) CreateInvoice(ctx context.Context, invoice *Invoice) (*Invoice, error) {
+	query := `
+		mutation CreateInvoice($invoice: invoices_insert_input!) {
+			insert_invoices_one(object: $invoice) {` + invoiceFields + `}
+		}
+	`
+
+	object := map[string]interface{}{
+		"purchase_id":     invoice.PurchaseID,
+		"issuer_name":     invoice.IssuerName,
+		"seller_name":     invoice.SellerName,
+		"seller_email":    invoice.SellerEmail,
+		"buyer_name":      invoice.BuyerName,
+		"buyer_email":     invoice.BuyerEmail,
+		"recipe_title":    invoice.RecipeTitle,
+		"currency":        invoice.Currency,
+		"total_amount":    invoice.TotalAmount,
+		"discount_amount": invoice.DiscountAmount,
+		"vat_rate":        invoice.VATRate,
+		"net_amount":      invoice.NetAmount,
+		"vat_amount":      invoice.VATAmount,
+		"transaction_id":  invoice.TransactionID,
+	}
+	optional := map[string]string{
+		"issuer_tin":         invoice.IssuerTIN,
+		"issuer_address":     invoice.IssuerAddress,
+		"seller_id":          invoice.SellerID,
+		"buyer_id":           invoice.BuyerID,
+		"recipe_id":          invoice.RecipeID,
+		"bundle_id":          invoice.BundleID,
+		"provider_reference": invoice.ProviderReference,
+		"payment_provider":   invoice.PaymentProvider,
+	}
+	for key, value := range optional {
+		if value != "" {
+			object[key] = value
+		}
+	}
+
+	resp, err := s.ExecuteQuery(ctx, query, map[string]interface{}{"invoice": object})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create invoice: %w", err)
+	}
+
+	var result struct {
+		Invoice *Invoice `json:"insert_invoices_one"`
+	}
+
+	if err := json.Unmarshal(resp.Data, &result); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	if result.Invoice == nil {
+		return nil, fmt.Errorf("invoice creation failed: no data returned from database")
+	}
+
+	return result.Invoice, nil
+}
+
+// GetInvoiceByPurchaseID returns the invoice issued for a purchase, or nil
+// when none was issued yet.
+func (s *HasuraService) GetInvoiceByPurchaseID(ctx context.Context, purchaseID string) (*Invoice, error) {
+	query := `
+		query GetInvoiceByPurchaseID($purchase_id: uuid!) {
+			invoices(where: {purchase_id: {_eq: $purchase_id}}, limit: 1) {` + invoiceFields + `}
+		}
+	`
+
+	resp, err := s.ExecuteQuery(ctx, query, map[string]interface{}{"purchase_id": purchaseID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get invoice: %w", err)
+	}
+
+	var result struct {
+		Invoices []Invoice `json:"invoices"`
+	}
+
+	if err := json.Unmarshal(resp.Data, &result); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	if len(result.Invoices) == 0 {
+		return nil, nil
+	}
+
+	return &result.Invoices[0], nil
+}
+
+// Invoice is the tax invoice for a completed purchase. TotalAmount is what
+// the buyer paid, VAT included.
+type Invoice struct {
+	ID                string  `json:"id"`
+	Number            int64   `json:"number"`
+	InvoiceNumber     string  `json:"invoice_number"`
+	PurchaseID        string  `json:"purchase_id"`
+	IssuedAt          string  `json:"issued_at"`
+	IssuerName        string  `json:"issuer_name"`
+	IssuerTIN         string  `json:"issuer_tin,omitempty"`
+	IssuerAddress     string  `json:"issuer_address,omitempty"`
+	SellerID          string  `json:"seller_id,omitempty"`
+	SellerName        string  `json:"seller_name"`
+	SellerEmail       string  `json:"seller_email"`
+	BuyerID           string  `json:"buyer_id,omitempty"`
+	BuyerName         string  `json:"buyer_name"`
+	BuyerEmail        string  `json:"buyer_email"`
+	RecipeID          string  `json:"recipe_id,omitempty"`
+	BundleID          string  `json:"bundle_id,omitempty"`
+	RecipeTitle       string  `json:"recipe_title"`
+	Currency          string  `json:"currency"`
+	TotalAmount       float64 `json:"total_amount"`
+	DiscountAmount    float64 `json:"discount_amount"`
+	VATRate           float64 `json:"vat_rate"`
+	NetAmount         float64 `json:"net_amount"`
+	VATAmount         float64 `json:"vat_amount"`
+	TransactionID     string  `json:"transaction_id"`
+	ProviderReference string  `json:"provider_reference,omitempty"`
+	PaymentProvider   string  `json:"payment_provider,omitempty"`
+	CreatedAt         string  `json:"created_at"`
+}
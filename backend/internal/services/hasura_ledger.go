@@ -0,0 +1,338 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Ledger operations
+
+// Ledger accounts. Amounts are signed: positive amounts credit an account
+// and negative amounts debit it, and the entries of one journal always sum
+// to zero.
+const (
+	// Money collected by the payment provider on our behalf
+	AccountProviderClearing = "provider_clearing"
+	// The platform's commission
+	AccountPlatformRevenue = "platform_revenue"
+	// What the platform owes a creator; entries carry the creator's user_id
+	AccountCreatorEarnings = "creator_earnings"
+	// Payouts requested by creators that have not been paid out yet
+	AccountPayoutsPayable = "payouts_payable"
+)
+
+const (
+	LedgerEntrySale           = "sale"
+	LedgerEntryRefund         = "refund"
+	LedgerEntryPayout         = "payout"
+	LedgerEntryPayoutReversal = "payout_reversal"
+	LedgerEntrySubscription   = "subscription"
+)
+
+const ledgerEntryFields = `
+	id
+	reference
+	line
+	entry_type
+	account
+	user_id
+	purchase_id
+	refund_id
+	payout_id
+	subscription_payment_id
+	recipe_id
+	amount
+	description
+	available_at
+	created_at
+`
+
+// CompletePurchase marks a pending or expired purchase completed, saves the
+// provider's reference and records its sale journal and, for bundles, the
+// buyer's access to each recipe in the same transaction. Journals are keyed
+// by reference and entitlements by purchase and recipe, so recording the
+// same sale twice has no effect. The database rejects both unless the
+// purchase ends up completed, so a purchase failed in the meantime makes the
+// call fail without recording anything. It reports whether this call
+// completed the purchase.
+func (s *HasuraService) CompletePurchase(ctx context.Context, transactionID, providerReference string, entries []LedgerEntryInput, entitlements []BundleEntitlementInput) (bool, error) {
+	query := `
+		mutation CompletePurchase($transaction_id: String!, $provider_reference: String, $entries: [ledger_entries_insert_input!]!, $entitlements: [bundle_entitlements_insert_input!]!) {
+			insert_ledger_entries(
+				objects: $entries,
+				on_conflict: {constraint: ledger_entries_reference_line_key, update_columns: []}
+			) {
+				affected_rows
+			}
+			insert_bundle_entitlements(
+				objects: $entitlements,
+				on_conflict: {constraint: bundle_entitlements_purchase_id_recipe_id_key, update_columns: []}
+			) {
+				affected_rows
+			}
+			update_purchases(
+				where: {transaction_id: {_eq: $transaction_id}, status: {_in: ["pending", "expired"]}},
+				_set: {status: "completed", provider_reference: $provider_reference}
+			) {
+				affected_rows
+			}
+		}
+	`
+
+	variables := map[string]interface{}{
+		"transaction_id":     transactionID,
+		"provider_reference": nil,
+		"entries":            ledgerObjects(entries),
+		"entitlements":       entitlementObjects(entitlements),
+	}
+	if providerReference != "" {
+		variables["provider_reference"] = providerReference
+	}
+
+	resp, err := s.ExecuteQuery(ctx, query, variables)
+	if err != nil {
+		return false, fmt.Errorf("failed to complete purchase: %w", err)
+	}
+
+	var result struct {
+		UpdatePurchases struct {
+			AffectedRows int `json:"affected_rows"`
+		} `json:"update_purchases"`
+	}
+
+	if err := json.Unmarshal(resp.Data, &result); err != nil {
+		return false, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	return result.UpdatePurchases.AffectedRows > 0, nil
+}
+
+// CompleteRefund marks a refund completed and records the journal that
+// reverses its share of the sale in the same transaction.
+func (s *HasuraService) CompleteRefund(ctx context.Context, refundID, providerReference string, entries []LedgerEntryInput) error {
+	query := `
+		mutation CompleteRefund($id: uuid!, $provider_reference: String, $entries: [ledger_entries_insert_input!]!) {
+			insert_ledger_entries(
+				objects: $entries,
+				on_conflict: {constraint: ledger_entries_reference_line_key, update_columns: []}
+			) {
+				affected_rows
+			}
+			update_refunds_by_pk(
+				pk_columns: {id: $id},
+				_set: {status: "completed", provider_reference: $provider_reference}
+			) {
+				id
+			}
+		}
+	`
+
+	var reference interface{}
+	if providerReference != "" {
+		reference = providerReference
+	}
+
+	_, err := s.ExecuteQuery(ctx, query, map[string]interface{}{
+		"id":                 refundID,
+		"provider_reference": reference,
+		"entries":            ledgerObjects(entries),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to complete refund: %w", err)
+	}
+
+	return nil
+}
+
+func (s *HasuraService) ListPurchaseLedgerEntries(ctx context.Context, purchaseID string) ([]LedgerEntry, error) {
+	query := `
+		query ListPurchaseLedgerEntries($purchase_id: uuid!) {
+			ledger_entries(
+				where: {purchase_id: {_eq: $purchase_id}},
+				order_by: [{created_at: asc}, {line: asc}]
+			) {` + ledgerEntryFields + `}
+		}
+	`
+
+	resp, err := s.ExecuteQuery(ctx, query, map[string]interface{}{"purchase_id": purchaseID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list ledger entries: %w", err)
+	}
+
+	var result struct {
+		Entries []LedgerEntry `json:"ledger_entries"`
+	}
+
+	if err := json.Unmarshal(resp.Data, &result); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	return result.Entries, nil
+}
+
+// ListAccountEntries returns a user's entries in one account, newest first.
+func (s *HasuraService) ListAccountEntries(ctx context.Context, userID, account string, limit, offset int) ([]LedgerEntry, error) {
+	query := `
+		query ListAccountEntries($user_id: uuid!, $account: String!, $limit: Int!, $offset: Int!) {
+			ledger_entries(
+				where: {user_id: {_eq: $user_id}, account: {_eq: $account}},
+				order_by: [{created_at: desc}, {line: desc}],
+				limit: $limit,
+				offset: $offset
+			) {` + ledgerEntryFields + `}
+		}
+	`
+
+	resp, err := s.ExecuteQuery(ctx, query, map[string]interface{}{
+		"user_id": userID,
+		"account": account,
+		"limit":   limit,
+		"offset":  offset,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list ledger entries: %w", err)
+	}
+
+	var result struct {
+		Entries []LedgerEntry `json:"ledger_entries"`
+	}
+
+	if err := json.Unmarshal(resp.Data, &result); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	return result.Entries, nil
+}
+
+// GetAccountBalance sums a user's entries in one account, split into what is
+// available at the given time and what is still on hold.
+func (s *HasuraService) GetAccountBalance(ctx context.Context, userID, account string, at time.Time) (available, pending float64, err error) {
+	query := `
+		query GetAccountBalance($user_id: uuid!, $account: String!, $at: timestamptz!) {
+			available: ledger_entries_aggregate(
+				where: {user_id: {_eq: $user_id}, account: {_eq: $account}, available_at: {_lte: $at}}
+			) {
+				aggregate {
+					sum {
+						amount
+					}
+				}
+			}
+			pending: ledger_entries_aggregate(
+				where: {user_id: {_eq: $user_id}, account: {_eq: $account}, available_at: {_gt: $at}}
+			) {
+				aggregate {
+					sum {
+						amount
+					}
+				}
+			}
+		}
+	`
+
+	resp, err := s.ExecuteQuery(ctx, query, map[string]interface{}{
+		"user_id": userID,
+		"account": account,
+		"at":      at.UTC().Format(time.RFC3339Nano),
+	})
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to get account balance: %w", err)
+	}
+
+	type sum struct {
+		Aggregate struct {
+			Sum struct {
+				Amount *float64 `json:"amount"`
+			} `json:"sum"`
+		} `json:"aggregate"`
+	}
+
+	var result struct {
+		Available sum `json:"available"`
+		Pending   sum `json:"pending"`
+	}
+
+	if err := json.Unmarshal(resp.Data, &result); err != nil {
+		return 0, 0, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	if result.Available.Aggregate.Sum.Amount != nil {
+		available = *result.Available.Aggregate.Sum.Amount
+	}
+	if result.Pending.Aggregate.Sum.Amount != nil {
+		pending = *result.Pending.Aggregate.Sum.Amount
+	}
+
+	return available, pending, nil
+}
+
+func ledgerObjects(entries []LedgerEntryInput) []map[string]interface{} {
+	objects := make([]map[string]interface{}, 0, len(entries))
+	for _, entry := range entries {
+		object := map[string]interface{}{
+			"reference":    entry.Reference,
+			"line":         entry.Line,
+			"entry_type":   entry.EntryType,
+			"account":      entry.Account,
+			"amount":       entry.Amount,
+			"description":  entry.Description,
+			"available_at": entry.AvailableAt.UTC().Format(time.RFC3339Nano),
+		}
+		if entry.UserID != "" {
+			object["user_id"] = entry.UserID
+		}
+		if entry.PurchaseID != "" {
+			object["purchase_id"] = entry.PurchaseID
+		}
+		if entry.RefundID != "" {
+			object["refund_id"] = entry.RefundID
+		}
+		if entry.PayoutID != "" {
+			object["payout_id"] = entry.PayoutID
+		}
+		if entry.SubscriptionPaymentID != "" {
+			object["subscription_payment_id"] = entry.SubscriptionPaymentID
+		}
+		if entry.RecipeID != "" {
+			object["recipe_id"] = entry.RecipeID
+		}
+		objects = append(objects, object)
+	}
+	return objects
+}
+
+type LedgerEntry struct {
+	ID                    string  `json:"id"`
+	Reference             string  `json:"reference"`
+	Line                  int     `json:"line"`
+	EntryType             string  `json:"entry_type"`
+	Account               string  `json:"account"`
+	UserID                string  `json:"user_id,omitempty"`
+	PurchaseID            string  `json:"purchase_id,omitempty"`
+	RefundID              string  `json:"refund_id,omitempty"`
+	PayoutID              string  `json:"payout_id,omitempty"`
+	SubscriptionPaymentID string  `json:"subscription_payment_id,omitempty"`
+	RecipeID              string  `json:"recipe_id,omitempty"`
+	Amount                float64 `json:"amount"`
+	Description           string  `json:"description,omitempty"`
+	AvailableAt           string  `json:"available_at"`
+	CreatedAt             string  `json:"created_at"`
+}
+
+type LedgerEntryInput struct {
+	Reference             string
+	Line                  int
+	EntryType             string
+	Account               string
+	UserID                string
+	PurchaseID            string
+	RefundID              string
+	PayoutID              string
+	SubscriptionPaymentID string
+	RecipeID              string
+	Amount                float64
+	Description           string
+	AvailableAt           time.Time
+}
@@ -0,0 +1,425 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// Payout operations
+
+const (
+	PayoutRequested  = "requested"
+	PayoutProcessing = "processing"
+	PayoutCompleted  = "completed"
+	PayoutFailed     = "failed"
+	PayoutRejected   = "rejected"
+)
+
+const (
+	PayoutMethodBank        = "bank"
+	PayoutMethodMobileMoney = "mobile_money"
+)
+
+const payoutAccountFields = `
+	id
+	user_id
+	method
+	bank_code
+	bank_name
+	account_name
+	account_number
+	created_at
+`
+
+const payoutFields = `
+	id
+	user_id
+	payout_account_id
+	amount
+	currency
+	status
+	method
+	bank_code
+	bank_name
+	account_name
+	account_number
+	provider_reference
+	failure_reason
+	reviewed_by
+	reviewed_at
+	created_at
+	updated_at
+`
+
+func (s *HasuraService) CreatePayoutAccount(ctx context.Context, account PayoutAccount) (*PayoutAccount, error) {
+	query := `
+		mutation CreatePayoutAccount($account: payout_accounts_insert_input!) {
+			insert_payout_accounts_one(object: $account) {` + payoutAccountFields + `}
+		}
+	`
+
+	object := map[string]interface{}{
+		"user_id":        account.UserID,
+		"method":         account.Method,
+		"bank_code":      account.BankCode,
+		"account_name":   account.AccountName,
+		"account_number": account.AccountNumber,
+	}
+	if account.BankName != "" {
+		object["bank_name"] = account.BankName
+	}
+
+	resp, err := s.ExecuteQuery(ctx, query, map[string]interface{}{"account": object})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create payout account: %w", err)
+	}
+
+	var result struct {
+		Account *PayoutAccount `json:"insert_payout_accounts_one"`
+	}
+
+	if err := json.Unmarshal(resp.Data, &result); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	if result.Account == nil {
+		return nil, fmt.Errorf("payout account creation failed: no data returned from database")
+	}
+
+	return result.Account, nil
+}
+
+func (s *HasuraService) GetPayoutAccount(ctx context.Context, id string) (*PayoutAccount, error) {
+	query := `
+		query GetPayoutAccount($id: uuid!) {
+			payout_accounts_by_pk(id: $id) {` + payoutAccountFields + `}
+		}
+	`
+
+	resp, err := s.ExecuteQuery(ctx, query, map[string]interface{}{"id": id})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get payout account: %w", err)
+	}
+
+	var result struct {
+		Account *PayoutAccount `json:"payout_accounts_by_pk"`
+	}
+
+	if err := json.Unmarshal(resp.Data, &result); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	return result.Account, nil
+}
+
+func (s *HasuraService) ListPayoutAccounts(ctx context.Context, userID string) ([]PayoutAccount, error) {
+	query := `
+		query ListPayoutAccounts($user_id: uuid!) {
+			payout_accounts(where: {user_id: {_eq: $user_id}}, order_by: {created_at: desc}) {` + payoutAccountFields + `}
+		}
+	`
+
+	resp, err := s.ExecuteQuery(ctx, query, map[string]interface{}{"user_id": userID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list payout accounts: %w", err)
+	}
+
+	var result struct {
+		Accounts []PayoutAccount `json:"payout_accounts"`
+	}
+
+	if err := json.Unmarshal(resp.Data, &result); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	return result.Accounts, nil
+}
+
+// DeletePayoutAccount removes one of a user's payout accounts and reports
+// whether it existed. Payouts keep a copy of the account details.
+func (s *HasuraService) DeletePayoutAccount(ctx context.Context, userID, id string) (bool, error) {
+	query := `
+		mutation DeletePayoutAccount($id: uuid!, $user_id: uuid!) {
+			delete_payout_accounts(where: {id: {_eq: $id}, user_id: {_eq: $user_id}}) {
+				affected_rows
+			}
+		}
+	`
+
+	resp, err := s.ExecuteQuery(ctx, query, map[string]interface{}{
+		"id":      id,
+		"user_id": userID,
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to delete payout account: %w", err)
+	}
+
+	var result struct {
+		DeletePayoutAccounts struct {
+			AffectedRows int `json:"affected_rows"`
+		} `json:"delete_payout_accounts"`
+	}
+
+	if err := json.Unmarshal(resp.Data, &result); err != nil {
+		return false, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	return result.DeletePayoutAccounts.AffectedRows > 0, nil
+}
+
+// CreatePayout records a payout request together with the journal that
+// reserves its amount from the creator's balance.
+func (s *HasuraService) CreatePayout(ctx context.Context, payout *Payout, entries []LedgerEntryInput) (*Payout, error) {
+	query := `
+		mutation CreatePayout($payout: payouts_insert_input!, $entries: [ledger_entries_insert_input!]!) {
+			insert_payouts_one(object: $payout) {` + payoutFields + `}
+			insert_ledger_entries(objects: $entries) {
+				affected_rows
+			}
+		}
+	`
+
+	object := map[string]interface{}{
+		"id":                payout.ID,
+		"user_id":           payout.UserID,
+		"payout_account_id": payout.PayoutAccountID,
+		"amount":            payout.Amount,
+		"currency":          payout.Currency,
+		"status":            PayoutRequested,
+		"method":            payout.Method,
+		"bank_code":         payout.BankCode,
+		"account_name":      payout.AccountName,
+		"account_number":    payout.AccountNumber,
+	}
+	if payout.BankName != "" {
+		object["bank_name"] = payout.BankName
+	}
+
+	resp, err := s.ExecuteQuery(ctx, query, map[string]interface{}{
+		"payout":  object,
+		"entries": ledgerObjects(entries),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create payout: %w", err)
+	}
+
+	var result struct {
+		Payout *Payout `json:"insert_payouts_one"`
+	}
+
+	if err := json.Unmarshal(resp.Data, &result); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	if result.Payout == nil {
+		return nil, fmt.Errorf("payout creation failed: no data returned from database")
+	}
+
+	return result.Payout, nil
+}
+
+func (s *HasuraService) GetPayout(ctx context.Context, id string) (*Payout, error) {
+	query := `
+		query GetPayout($id: uuid!) {
+			payouts_by_pk(id: $id) {` + payoutFields + `}
+		}
+	`
+
+	resp, err := s.ExecuteQuery(ctx, query, map[string]interface{}{"id": id})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get payout: %w", err)
+	}
+
+	var result struct {
+		Payout *Payout `json:"payouts_by_pk"`
+	}
+
+	if err := json.Unmarshal(resp.Data, &result); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	return result.Payout, nil
+}
+
+// GetOpenPayout returns a user's payout that is still requested or being
+// processed, if any.
+func (s *HasuraService) GetOpenPayout(ctx context.Context, userID string) (*Payout, error) {
+	query := `
+		query GetOpenPayout($user_id: uuid!) {
+			payouts(where: {user_id: {_eq: $user_id}, status: {_in: ["requested", "processing"]}}, limit: 1) {` + payoutFields + `}
+		}
+	`
+
+	resp, err := s.ExecuteQuery(ctx, query, map[string]interface{}{"user_id": userID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get open payout: %w", err)
+	}
+
+	var result struct {
+		Payouts []Payout `json:"payouts"`
+	}
+
+	if err := json.Unmarshal(resp.Data, &result); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	if len(result.Payouts) == 0 {
+		return nil, nil
+	}
+
+	return &result.Payouts[0], nil
+}
+
+// ListPayouts returns payouts newest first, filtered by user, status or both
+// when they are not empty.
+func (s *HasuraService) ListPayouts(ctx context.Context, userID, status string, limit, offset int) ([]Payout, error) {
+	query := `
+		query ListPayouts($where: payouts_bool_exp!, $limit: Int!, $offset: Int!) {
+			payouts(where: $where, order_by: {created_at: desc}, limit: $limit, offset: $offset) {` + payoutFields + `}
+		}
+	`
+
+	where := map[string]interface{}{}
+	if userID != "" {
+		where["user_id"] = map[string]interface{}{"_eq": userID}
+	}
+	if status != "" {
+		where["status"] = map[string]interface{}{"_eq": status}
+	}
+
+	resp, err := s.ExecuteQuery(ctx, query, map[string]interface{}{
+		"where":  where,
+		"limit":  limit,
+		"offset": offset,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list payouts: %w", err)
+	}
+
+	var result struct {
+		Payouts []Payout `json:"payouts"`
+	}
+
+	if err := json.Unmarshal(resp.Data, &result); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	return result.Payouts, nil
+}
+
+// ListProcessingPayouts returns up to limit payouts whose transfer is in
+// progress, oldest first. Payouts are ordered by creation time and ID, and
+// only those after the cursor, the creation time and ID of the last payout
+// of the previous page, are returned. An empty cursor starts at the oldest.
+func (s *HasuraService) ListProcessingPayouts(ctx context.Context, afterCreatedAt, afterID string, limit int) ([]Payout, error) {
+	query := `
+		query ListProcessingPayouts($where: payouts_bool_exp!, $limit: Int!) {
+			payouts(where: $where, order_by: [{created_at: asc}, {id: asc}], limit: $limit) {` + payoutFields + `}
+		}
+	`
+
+	where := map[string]interface{}{
+		"status": map[string]interface{}{"_eq": PayoutProcessing},
+	}
+	if afterCreatedAt != "" {
+		where["_or"] = []map[string]interface{}{
+			{"created_at": map[string]interface{}{"_gt": afterCreatedAt}},
+			{
+				"created_at": map[string]interface{}{"_eq": afterCreatedAt},
+				"id":         map[string]interface{}{"_gt": afterID},
+			},
+		}
+	}
+
+	resp, err := s.ExecuteQuery(ctx, query, map[string]interface{}{
+		"where": where,
+		"limit": limit,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list processing payouts: %w", err)
+	}
+
+	var result struct {
+		Payouts []Payout `json:"payouts"`
+	}
+
+	if err := json.Unmarshal(resp.Data, &result); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	return result.Payouts, nil
+}
+
+// TransitionPayout applies changes to a payout only if it is still in the
+// expected status, and reports whether it was. The journal recording the
+// new status is inserted in the same transaction; the database rejects it,
+// and the whole call fails, when the payout was not moved to that status.
+func (s *HasuraService) TransitionPayout(ctx context.Context, id, from string, changes map[string]interface{}, entries []LedgerEntryInput) (bool, error) {
+	query := `
+		mutation TransitionPayout($id: uuid!, $from: String!, $changes: payouts_set_input!, $entries: [ledger_entries_insert_input!]!) {
+			update_payouts(where: {id: {_eq: $id}, status: {_eq: $from}}, _set: $changes) {
+				affected_rows
+			}
+			insert_ledger_entries(
+				objects: $entries,
+				on_conflict: {constraint: ledger_entries_reference_line_key, update_columns: []}
+			) {
+				affected_rows
+			}
+		}
+	`
+
+	resp, err := s.ExecuteQuery(ctx, query, map[string]interface{}{
+		"id":      id,
+		"from":    from,
+		"changes": changes,
+		"entries": ledgerObjects(entries),
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to update payout: %w", err)
+	}
+
+	var result struct {
+		UpdatePayouts struct {
+			AffectedRows int `json:"affected_rows"`
+		} `json:"update_payouts"`
+	}
+
+	if err := json.Unmarshal(resp.Data, &result); err != nil {
+		return false, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	return result.UpdatePayouts.AffectedRows > 0, nil
+}
+
+type PayoutAccount struct {
+	ID            string `json:"id"`
+	UserID        string `json:"user_id"`
+	Method        string `json:"method"`
+	BankCode      int    `json:"bank_code"`
+	BankName      string `json:"bank_name,omitempty"`
+	AccountName   string `json:"account_name"`
+	AccountNumber string `json:"account_number"`
+	CreatedAt     string `json:"created_at,omitempty"`
+}
+
+type Payout struct {
+	ID                string  `json:"id"`
+	UserID            string  `json:"user_id"`
+	PayoutAccountID   string  `json:"payout_account_id,omitempty"`
+	Amount            float64 `json:"amount"`
+	Currency          string  `json:"currency"`
+	Status            string  `json:"status"`
+	Method            string  `json:"method"`
+	BankCode          int     `json:"bank_code"`
+	BankName          string  `json:"bank_name,omitempty"`
+	AccountName       string  `json:"account_name"`
+	AccountNumber     string  `json:"account_number"`
+	ProviderReference string  `json:"provider_reference,omitempty"`
+	FailureReason     string  `json:"failure_reason,omitempty"`
+	ReviewedBy        string  `json:"reviewed_by,omitempty"`
+	ReviewedAt        string  `json:"reviewed_at,omitempty"`
+	CreatedAt         string  `json:"created_at"`
+	UpdatedAt         string  `json:"updated_at"`
+}
@@ -0,0 +1,217 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// Refund operations
+
+const (
+	// Sent to the provider, or with an outcome still to be verified
+	RefundPending = "pending"
+	// Made by the provider, with its ledger journal still to be recorded
+	RefundProcessed = "processed"
+	RefundCompleted = "completed"
+	RefundFailed    = "failed"
+)
+
+func (s *HasuraService) CreateRefund(ctx context.Context, input CreateRefundInput) (*Refund, error) {
+	query := `
+		mutation CreateRefund($refund: refunds_insert_input!) {
+			insert_refunds_one(object: $refund) {
+				id
+				purchase_id
+				amount
+				reason
+				status
+				provider_reference
+				requested_by
+				created_at
+			}
+		}
+	`
+
+	refund := map[string]interface{}{
+		"purchase_id": input.PurchaseID,
+		"amount":      input.Amount,
+		"reason":      input.Reason,
+		"status":      RefundPending,
+	}
+	if input.RequestedBy != "" {
+		refund["requested_by"] = input.RequestedBy
+	}
+
+	resp, err := s.ExecuteQuery(ctx, query, map[string]interface{}{"refund": refund})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create refund: %w", err)
+	}
+
+	var result struct {
+		InsertRefundsOne *Refund `json:"insert_refunds_one"`
+	}
+
+	if err := json.Unmarshal(resp.Data, &result); err != nil {
+		return nil, fmt.Errorf("failed to parse create refund response: %w", err)
+	}
+
+	if result.InsertRefundsOne == nil {
+		return nil, fmt.Errorf("refund creation failed: no data returned from database")
+	}
+
+	return result.InsertRefundsOne, nil
+}
+
+func (s *HasuraService) UpdateRefundStatus(ctx context.Context, id, status, providerReference string) error {
+	query := `
+		mutation UpdateRefundStatus($id: uuid!, $status: String!, $provider_reference: String) {
+			update_refunds_by_pk(
+				pk_columns: {id: $id},
+				_set: {status: $status, provider_reference: $provider_reference}
+			) {
+				id
+			}
+		}
+	`
+
+	var reference interface{}
+	if providerReference != "" {
+		reference = providerReference
+	}
+
+	_, err := s.ExecuteQuery(ctx, query, map[string]interface{}{
+		"id":                 id,
+		"status":             status,
+		"provider_reference": reference,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update refund status: %w", err)
+	}
+
+	return nil
+}
+
+// RevokePurchase marks a purchase refunded and removes the access to the
+// recipes of its bundle, if it bought one, in the same transaction.
+func (s *HasuraService) RevokePurchase(ctx context.Context, purchase *Purchase) error {
+	query := `
+		mutation RevokePurchase($transaction_id: String!, $purchase_id: uuid!) {
+			update_purchases(
+				where: {transaction_id: {_eq: $transaction_id}},
+				_set: {status: "refunded"}
+			) {
+				affected_rows
+			}
+			delete_bundle_entitlements(where: {purchase_id: {_eq: $purchase_id}}) {
+				affected_rows
+			}
+		}
+	`
+
+	_, err := s.ExecuteQuery(ctx, query, map[string]interface{}{
+		"transaction_id": purchase.TransactionID,
+		"purchase_id":    purchase.ID,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to revoke purchase: %w", err)
+	}
+
+	return nil
+}
+
+// ListRefunds returns the refunds of a purchase in the given status, oldest
+// first.
+func (s *HasuraService) ListRefunds(ctx context.Context, purchaseID, status string) ([]Refund, error) {
+	query := `
+		query ListRefunds($purchase_id: uuid!, $status: String!) {
+			refunds(where: {purchase_id: {_eq: $purchase_id}, status: {_eq: $status}}, order_by: {created_at: asc}) {
+				id
+				purchase_id
+				amount
+				reason
+				status
+				provider_reference
+				requested_by
+				created_at
+			}
+		}
+	`
+
+	resp, err := s.ExecuteQuery(ctx, query, map[string]interface{}{
+		"purchase_id": purchaseID,
+		"status":      status,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list refunds: %w", err)
+	}
+
+	var result struct {
+		Refunds []Refund `json:"refunds"`
+	}
+
+	if err := json.Unmarshal(resp.Data, &result); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	return result.Refunds, nil
+}
+
+// GetRefundedTotal returns the amount of a purchase that has been refunded
+// or is being refunded.
+func (s *HasuraService) GetRefundedTotal(ctx context.Context, purchaseID string) (float64, error) {
+	query := `
+		query GetRefundedTotal($purchase_id: uuid!) {
+			refunds_aggregate(where: {purchase_id: {_eq: $purchase_id}, status: {_in: ["pending", "processed", "completed"]}}) {
+				aggregate {
+					sum {
+						amount
+					}
+				}
+			}
+		}
+	`
+
+	resp, err := s.ExecuteQuery(ctx, query, map[string]interface{}{"purchase_id": purchaseID})
+	if err != nil {
+		return 0, fmt.Errorf("failed to get refunded total: %w", err)
+	}
+
+	var result struct {
+		RefundsAggregate struct {
+			Aggregate struct {
+				Sum struct {
+					Amount *float64 `json:"amount"`
+				} `json:"sum"`
+			} `json:"aggregate"`
+		} `json:"refunds_aggregate"`
+	}
+
+	if err := json.Unmarshal(resp.Data, &result); err != nil {
+		return 0, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	if result.RefundsAggregate.Aggregate.Sum.Amount == nil {
+		return 0, nil
+	}
+
+	return *result.RefundsAggregate.Aggregate.Sum.Amount, nil
+}
+
+type Refund struct {
+	ID                string  `json:"id"`
+	PurchaseID        string  `json:"purchase_id"`
+	Amount            float64 `json:"amount"`
+	Reason            string  `json:"reason"`
+	Status            string  `json:"status"`
+	ProviderReference string  `json:"provider_reference,omitempty"`
+	RequestedBy       string  `json:"requested_by,omitempty"`
+	CreatedAt         string  `json:"created_at"`
+}
+
+type CreateRefundInput struct {
+	PurchaseID  string
+	Amount      float64
+	Reason      string
+	RequestedBy string
+}
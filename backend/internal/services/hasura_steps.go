@@ -0,0 +1,137 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// Recipe step operations
+
+func (s *HasuraService) GetRecipeStep(ctx context.Context, id string) (*RecipeStep, error) {
+	query := `
+		query GetRecipeStep($id: uuid!) {
+			recipe_steps_by_pk(id: $id) {
+				id
+				recipe_id
+				step_number
+				image_url
+				video_url
+				video_poster_url
+				video_duration
+			}
+		}
+	`
+
+	variables := map[string]interface{}{
+		"id": id,
+	}
+
+	resp, err := s.ExecuteQuery(ctx, query, variables)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get recipe step: %w", err)
+	}
+
+	var result struct {
+		Step *RecipeStep `json:"recipe_steps_by_pk"`
+	}
+
+	if err := json.Unmarshal(resp.Data, &result); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	return result.Step, nil
+}
+
+// AttachStepVideo sets the video clip shown with a recipe step.
+func (s *HasuraService) AttachStepVideo(ctx context.Context, stepID, videoURL, posterURL string, duration float64) error {
+	query := `
+		mutation AttachStepVideo($id: uuid!, $video_url: String!, $video_poster_url: String, $video_duration: numeric!) {
+			update_recipe_steps_by_pk(
+				pk_columns: {id: $id},
+				_set: {video_url: $video_url, video_poster_url: $video_poster_url, video_duration: $video_duration}
+			) {
+				id
+			}
+		}
+	`
+
+	var poster interface{}
+	if posterURL != "" {
+		poster = posterURL
+	}
+
+	_, err := s.ExecuteQuery(ctx, query, map[string]interface{}{
+		"id":               stepID,
+		"video_url":        videoURL,
+		"video_poster_url": poster,
+		"video_duration":   duration,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to attach step video: %w", err)
+	}
+
+	return nil
+}
+
+// GetRecipeContent returns a recipe's steps in order and its ingredients.
+func (s *HasuraService) GetRecipeContent(ctx context.Context, recipeID string) ([]RecipeStep, []RecipeIngredient, error) {
+	query := `
+		query GetRecipeContent($recipe_id: uuid!) {
+			recipe_steps(where: {recipe_id: {_eq: $recipe_id}}, order_by: {step_number: asc}) {
+				id
+				recipe_id
+				step_number
+				instruction
+				image_url
+				video_url
+				video_poster_url
+				video_duration
+			}
+			recipe_ingredients(where: {recipe_id: {_eq: $recipe_id}}, order_by: {created_at: asc}) {
+				id
+				recipe_id
+				name
+				amount
+				unit
+				notes
+			}
+		}
+	`
+
+	resp, err := s.ExecuteQuery(ctx, query, map[string]interface{}{"recipe_id": recipeID})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get recipe content: %w", err)
+	}
+
+	var result struct {
+		Steps       []RecipeStep       `json:"recipe_steps"`
+		Ingredients []RecipeIngredient `json:"recipe_ingredients"`
+	}
+
+	if err := json.Unmarshal(resp.Data, &result); err != nil {
+		return nil, nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	return result.Steps, result.Ingredients, nil
+}
+
+type RecipeStep struct {
+	ID             string  `json:"id"`
+	RecipeID       string  `json:"recipe_id"`
+	StepNumber     int     `json:"step_number"`
+	Instruction    string  `json:"instruction,omitempty"`
+	ImageURL       string  `json:"image_url,omitempty"`
+	VideoURL       string  `json:"video_url,omitempty"`
+	VideoPosterURL string  `json:"video_poster_url,omitempty"`
+	VideoDuration  float64 `json:"video_duration,omitempty"`
+}
+
+type RecipeIngredient struct {
+	ID       string `json:"id"`
+	RecipeID string `json:"recipe_id"`
+	Name     string `json:"name"`
+	Amount   string `json:"amount,omitempty"`
+	Unit     string `json:"unit,omitempty"`
+	Notes    string `json:"notes,omitempty"`
+}
@@ -0,0 +1,725 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Subscription operations
+
+const (
+	PlanScopeAllPremium = "all_premium"
+	PlanScopeChef       = "chef"
+)
+
+const (
+	SubscriptionPending  = "pending"
+	SubscriptionActive   = "active"
+	SubscriptionPastDue  = "past_due"
+	SubscriptionCanceled = "canceled"
+	SubscriptionExpired  = "expired"
+)
+
+const (
+	SubscriptionPaymentPending   = "pending"
+	SubscriptionPaymentCompleted = "completed"
+	SubscriptionPaymentFailed    = "failed"
+	SubscriptionPaymentExpired   = "expired"
+)
+
+const subscriptionPlanFields = `
+	id
+	name
+	description
+	scope
+	chef_id
+	price
+	billing_interval
+	is_active
+	created_by
+	created_at
+	updated_at
+`
+
+const subscriptionFields = `
+	id
+	user_id
+	plan_id
+	chef_id
+	status
+	current_period_start
+	current_period_end
+	billing_anchor
+	grace_until
+	cancel_at_period_end
+	canceled_at
+	created_at
+	updated_at
+`
+
+const subscriptionPaymentFields = `
+	id
+	subscription_id
+	user_id
+	amount
+	transaction_id
+	status
+	checkout_url
+	period_start
+	period_end
+	created_at
+	updated_at
+`
+
+func (s *HasuraService) CreateSubscriptionPlan(ctx context.Context, plan SubscriptionPlan) (*SubscriptionPlan, error) {
+	query := `
+		mutation CreateSubscriptionPlan($plan: subscription_plans_insert_input!) {
+			insert_subscription_plans_one(object: $plan) {` + subscriptionPlanFields + `}
+		}
+	`
+
+	object := map[string]interface{}{
+		"name":             plan.Name,
+		"scope":            plan.Scope,
+		"price":            plan.Price,
+		"billing_interval": plan.BillingInterval,
+		"created_by":       plan.CreatedBy,
+	}
+	if plan.Description != "" {
+		object["description"] = plan.Description
+	}
+	if plan.ChefID != "" {
+		object["chef_id"] = plan.ChefID
+	}
+
+	resp, err := s.ExecuteQuery(ctx, query, map[string]interface{}{"plan": object})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create subscription plan: %w", err)
+	}
+
+	var result struct {
+		Plan *SubscriptionPlan `json:"insert_subscription_plans_one"`
+	}
+
+	if err := json.Unmarshal(resp.Data, &result); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	if result.Plan == nil {
+		return nil, fmt.Errorf("subscription plan creation failed: no data returned from database")
+	}
+
+	return result.Plan, nil
+}
+
+func (s *HasuraService) GetSubscriptionPlan(ctx context.Context, id string) (*SubscriptionPlan, error) {
+	query := `
+		query GetSubscriptionPlan($id: uuid!) {
+			subscription_plans_by_pk(id: $id) {` + subscriptionPlanFields + `}
+		}
+	`
+
+	resp, err := s.ExecuteQuery(ctx, query, map[string]interface{}{"id": id})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get subscription plan: %w", err)
+	}
+
+	var result struct {
+		Plan *SubscriptionPlan `json:"subscription_plans_by_pk"`
+	}
+
+	if err := json.Unmarshal(resp.Data, &result); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	return result.Plan, nil
+}
+
+// ListSubscriptionPlans returns the active plans, limited to one chef's
+// plans when chefID is not empty.
+func (s *HasuraService) ListSubscriptionPlans(ctx context.Context, chefID string) ([]SubscriptionPlan, error) {
+	query := `
+		query ListSubscriptionPlans($where: subscription_plans_bool_exp!) {
+			subscription_plans(where: $where, order_by: [{scope: asc}, {price: asc}]) {` + subscriptionPlanFields + `}
+		}
+	`
+
+	where := map[string]interface{}{
+		"is_active": map[string]interface{}{"_eq": true},
+	}
+	if chefID != "" {
+		where["chef_id"] = map[string]interface{}{"_eq": chefID}
+	}
+
+	resp, err := s.ExecuteQuery(ctx, query, map[string]interface{}{"where": where})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list subscription plans: %w", err)
+	}
+
+	var result struct {
+		Plans []SubscriptionPlan `json:"subscription_plans"`
+	}
+
+	if err := json.Unmarshal(resp.Data, &result); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	return result.Plans, nil
+}
+
+// DeactivateSubscriptionPlan stops new subscriptions to a plan. Existing
+// subscriptions keep renewing.
+func (s *HasuraService) DeactivateSubscriptionPlan(ctx context.Context, id string) error {
+	query := `
+		mutation DeactivateSubscriptionPlan($id: uuid!) {
+			update_subscription_plans_by_pk(pk_columns: {id: $id}, _set: {is_active: false}) {
+				id
+			}
+		}
+	`
+
+	_, err := s.ExecuteQuery(ctx, query, map[string]interface{}{"id": id})
+	if err != nil {
+		return fmt.Errorf("failed to deactivate subscription plan: %w", err)
+	}
+
+	return nil
+}
+
+// CreateSubscription records a new subscription together with the payment
+// for its first period.
+func (s *HasuraService) CreateSubscription(ctx context.Context, subscription *Subscription, payment *SubscriptionPayment) error {
+	query := `
+		mutation CreateSubscription($subscription: subscriptions_insert_input!, $payment: subscription_payments_insert_input!) {
+			insert_subscriptions_one(object: $subscription) {
+				id
+			}
+			insert_subscription_payments_one(object: $payment) {
+				id
+			}
+		}
+	`
+
+	object := map[string]interface{}{
+		"id":      subscription.ID,
+		"user_id": subscription.UserID,
+		"plan_id": subscription.PlanID,
+		"status":  SubscriptionPending,
+	}
+	if subscription.ChefID != "" {
+		object["chef_id"] = subscription.ChefID
+	}
+
+	_, err := s.ExecuteQuery(ctx, query, map[string]interface{}{
+		"subscription": object,
+		"payment":      subscriptionPaymentObject(payment),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create subscription: %w", err)
+	}
+
+	return nil
+}
+
+func (s *HasuraService) GetSubscription(ctx context.Context, id string) (*Subscription, error) {
+	query := `
+		query GetSubscription($id: uuid!) {
+			subscriptions_by_pk(id: $id) {` + subscriptionFields + `}
+		}
+	`
+
+	resp, err := s.ExecuteQuery(ctx, query, map[string]interface{}{"id": id})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get subscription: %w", err)
+	}
+
+	var result struct {
+		Subscription *Subscription `json:"subscriptions_by_pk"`
+	}
+
+	if err := json.Unmarshal(resp.Data, &result); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	return result.Subscription, nil
+}
+
+// GetOpenSubscription returns the user's subscription to a plan that is
+// pending, active or past due, if any.
+func (s *HasuraService) GetOpenSubscription(ctx context.Context, userID, planID string) (*Subscription, error) {
+	query := `
+		query GetOpenSubscription($user_id: uuid!, $plan_id: uuid!) {
+			subscriptions(
+				where: {
+					user_id: {_eq: $user_id},
+					plan_id: {_eq: $plan_id},
+					status: {_in: ["pending", "active", "past_due"]}
+				},
+				limit: 1
+			) {` + subscriptionFields + `}
+		}
+	`
+
+	resp, err := s.ExecuteQuery(ctx, query, map[string]interface{}{
+		"user_id": userID,
+		"plan_id": planID,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get open subscription: %w", err)
+	}
+
+	var result struct {
+		Subscriptions []Subscription `json:"subscriptions"`
+	}
+
+	if err := json.Unmarshal(resp.Data, &result); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	if len(result.Subscriptions) == 0 {
+		return nil, nil
+	}
+
+	return &result.Subscriptions[0], nil
+}
+
+// ListSubscriptions returns a user's subscriptions, newest first.
+func (s *HasuraService) ListSubscriptions(ctx context.Context, userID string) ([]Subscription, error) {
+	query := `
+		query ListSubscriptions($user_id: uuid!) {
+			subscriptions(where: {user_id: {_eq: $user_id}}, order_by: {created_at: desc}) {` + subscriptionFields + `}
+		}
+	`
+
+	resp, err := s.ExecuteQuery(ctx, query, map[string]interface{}{"user_id": userID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list subscriptions: %w", err)
+	}
+
+	var result struct {
+		Subscriptions []Subscription `json:"subscriptions"`
+	}
+
+	if err := json.Unmarshal(resp.Data, &result); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	return result.Subscriptions, nil
+}
+
+// ListDueSubscriptions returns up to limit active and past due
+// subscriptions whose current period ends before the given time, oldest
+// first. Subscriptions are ordered by period end and ID, and only those
+// after the cursor, the period end and ID of the last subscription of the
+// previous page, are returned. An empty cursor starts at the oldest.
+func (s *HasuraService) ListDueSubscriptions(ctx context.Context, afterPeriodEnd, afterID string, before time.Time, limit int) ([]Subscription, error) {
+	query := `
+		query ListDueSubscriptions($where: subscriptions_bool_exp!, $limit: Int!) {
+			subscriptions(
+				where: $where,
+				order_by: [{current_period_end: asc}, {id: asc}],
+				limit: $limit
+			) {` + subscriptionFields + `}
+		}
+	`
+
+	where := map[string]interface{}{
+		"status":             map[string]interface{}{"_in": []string{SubscriptionActive, SubscriptionPastDue}},
+		"current_period_end": map[string]interface{}{"_lte": before.UTC().Format(time.RFC3339Nano)},
+	}
+	if afterPeriodEnd != "" {
+		where["_or"] = []map[string]interface{}{
+			{"current_period_end": map[string]interface{}{"_gt": afterPeriodEnd}},
+			{
+				"current_period_end": map[string]interface{}{"_eq": afterPeriodEnd},
+				"id":                 map[string]interface{}{"_gt": afterID},
+			},
+		}
+	}
+
+	resp, err := s.ExecuteQuery(ctx, query, map[string]interface{}{
+		"where": where,
+		"limit": limit,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list due subscriptions: %w", err)
+	}
+
+	var result struct {
+		Subscriptions []Subscription `json:"subscriptions"`
+	}
+
+	if err := json.Unmarshal(resp.Data, &result); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	return result.Subscriptions, nil
+}
+
+// TransitionSubscription applies changes to a subscription only if it is
+// still in the expected status, and reports whether it was.
+func (s *HasuraService) TransitionSubscription(ctx context.Context, id, from string, changes map[string]interface{}) (bool, error) {
+	query := `
+		mutation TransitionSubscription($id: uuid!, $from: String!, $changes: subscriptions_set_input!) {
+			update_subscriptions(where: {id: {_eq: $id}, status: {_eq: $from}}, _set: $changes) {
+				affected_rows
+			}
+		}
+	`
+
+	resp, err := s.ExecuteQuery(ctx, query, map[string]interface{}{
+		"id":      id,
+		"from":    from,
+		"changes": changes,
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to update subscription: %w", err)
+	}
+
+	var result struct {
+		UpdateSubscriptions struct {
+			AffectedRows int `json:"affected_rows"`
+		} `json:"update_subscriptions"`
+	}
+
+	if err := json.Unmarshal(resp.Data, &result); err != nil {
+		return false, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	return result.UpdateSubscriptions.AffectedRows > 0, nil
+}
+
+// HasActiveSubscription reports whether the user has a subscription that
+// covers the premium recipes of the given chef at the given time. A past
+// due subscription still counts during its grace period.
+func (s *HasuraService) HasActiveSubscription(ctx context.Context, userID, chefID string, at time.Time) (bool, error) {
+	query := `
+		query HasActiveSubscription($user_id: uuid!, $chef_id: uuid!, $at: timestamptz!) {
+			subscriptions_aggregate(
+				where: {
+					user_id: {_eq: $user_id},
+					_and: [
+						{_or: [{chef_id: {_is_null: true}}, {chef_id: {_eq: $chef_id}}]},
+						{_or: [
+							{status: {_eq: "active"}, current_period_end: {_gt: $at}},
+							{status: {_eq: "past_due"}, grace_until: {_gt: $at}}
+						]}
+					]
+				}
+			) {
+				aggregate {
+					count
+				}
+			}
+		}
+	`
+
+	resp, err := s.ExecuteQuery(ctx, query, map[string]interface{}{
+		"user_id": userID,
+		"chef_id": chefID,
+		"at":      at.UTC().Format(time.RFC3339Nano),
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to check subscription: %w", err)
+	}
+
+	var result struct {
+		SubscriptionsAggregate struct {
+			Aggregate struct {
+				Count int `json:"count"`
+			} `json:"aggregate"`
+		} `json:"subscriptions_aggregate"`
+	}
+
+	if err := json.Unmarshal(resp.Data, &result); err != nil {
+		return false, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	return result.SubscriptionsAggregate.Aggregate.Count > 0, nil
+}
+
+func (s *HasuraService) CreateSubscriptionPayment(ctx context.Context, payment *SubscriptionPayment) error {
+	query := `
+		mutation CreateSubscriptionPayment($payment: subscription_payments_insert_input!) {
+			insert_subscription_payments_one(object: $payment) {
+				id
+			}
+		}
+	`
+
+	_, err := s.ExecuteQuery(ctx, query, map[string]interface{}{
+		"payment": subscriptionPaymentObject(payment),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create subscription payment: %w", err)
+	}
+
+	return nil
+}
+
+func (s *HasuraService) GetSubscriptionPaymentByTransactionID(ctx context.Context, transactionID string) (*SubscriptionPayment, error) {
+	query := `
+		query GetSubscriptionPaymentByTransactionID($transaction_id: String!) {
+			subscription_payments(where: {transaction_id: {_eq: $transaction_id}}, limit: 1) {` + subscriptionPaymentFields + `}
+		}
+	`
+
+	resp, err := s.ExecuteQuery(ctx, query, map[string]interface{}{"transaction_id": transactionID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get subscription payment: %w", err)
+	}
+
+	var result struct {
+		Payments []SubscriptionPayment `json:"subscription_payments"`
+	}
+
+	if err := json.Unmarshal(resp.Data, &result); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	if len(result.Payments) == 0 {
+		return nil, nil
+	}
+
+	return &result.Payments[0], nil
+}
+
+// GetPendingSubscriptionPayment returns the open payment of a subscription,
+// if any.
+func (s *HasuraService) GetPendingSubscriptionPayment(ctx context.Context, subscriptionID string) (*SubscriptionPayment, error) {
+	query := `
+		query GetPendingSubscriptionPayment($subscription_id: uuid!) {
+			subscription_payments(
+				where: {subscription_id: {_eq: $subscription_id}, status: {_eq: "pending"}},
+				limit: 1
+			) {` + subscriptionPaymentFields + `}
+		}
+	`
+
+	resp, err := s.ExecuteQuery(ctx, query, map[string]interface{}{"subscription_id": subscriptionID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get pending subscription payment: %w", err)
+	}
+
+	var result struct {
+		Payments []SubscriptionPayment `json:"subscription_payments"`
+	}
+
+	if err := json.Unmarshal(resp.Data, &result); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	if len(result.Payments) == 0 {
+		return nil, nil
+	}
+
+	return &result.Payments[0], nil
+}
+
+func (s *HasuraService) ListSubscriptionPayments(ctx context.Context, subscriptionID string) ([]SubscriptionPayment, error) {
+	query := `
+		query ListSubscriptionPayments($subscription_id: uuid!) {
+			subscription_payments(
+				where: {subscription_id: {_eq: $subscription_id}},
+				order_by: {created_at: desc}
+			) {` + subscriptionPaymentFields + `}
+		}
+	`
+
+	resp, err := s.ExecuteQuery(ctx, query, map[string]interface{}{"subscription_id": subscriptionID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list subscription payments: %w", err)
+	}
+
+	var result struct {
+		Payments []SubscriptionPayment `json:"subscription_payments"`
+	}
+
+	if err := json.Unmarshal(resp.Data, &result); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	return result.Payments, nil
+}
+
+func (s *HasuraService) SetSubscriptionPaymentCheckoutURL(ctx context.Context, transactionID, checkoutURL string) error {
+	query := `
+		mutation SetSubscriptionPaymentCheckoutURL($transaction_id: String!, $checkout_url: String!) {
+			update_subscription_payments(
+				where: {transaction_id: {_eq: $transaction_id}},
+				_set: {checkout_url: $checkout_url}
+			) {
+				affected_rows
+			}
+		}
+	`
+
+	_, err := s.ExecuteQuery(ctx, query, map[string]interface{}{
+		"transaction_id": transactionID,
+		"checkout_url":   checkoutURL,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save subscription checkout URL: %w", err)
+	}
+
+	return nil
+}
+
+// CloseSubscriptionPayment moves a pending subscription payment to failed or
+// expired and reports whether it was still pending.
+func (s *HasuraService) CloseSubscriptionPayment(ctx context.Context, transactionID, status string) (bool, error) {
+	query := `
+		mutation CloseSubscriptionPayment($transaction_id: String!, $status: String!) {
+			update_subscription_payments(
+				where: {transaction_id: {_eq: $transaction_id}, status: {_eq: "pending"}},
+				_set: {status: $status}
+			) {
+				affected_rows
+			}
+		}
+	`
+
+	resp, err := s.ExecuteQuery(ctx, query, map[string]interface{}{
+		"transaction_id": transactionID,
+		"status":         status,
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to update subscription payment: %w", err)
+	}
+
+	var result struct {
+		UpdateSubscriptionPayments struct {
+			AffectedRows int `json:"affected_rows"`
+		} `json:"update_subscription_payments"`
+	}
+
+	if err := json.Unmarshal(resp.Data, &result); err != nil {
+		return false, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	return result.UpdateSubscriptionPayments.AffectedRows > 0, nil
+}
+
+// CompleteSubscriptionPayment marks a pending or expired payment completed,
+// applies the period it paid for to the subscription and records its journal
+// in the same transaction. The subscription is only changed when the payment
+// did not extend it already, and journals are keyed by reference, so
+// completing the same payment twice has no effect. The database rejects both
+// unless the payment ends up completed, so a payment failed in the meantime
+// makes the call fail without changing anything. It reports whether this call
+// completed the payment.
+func (s *HasuraService) CompleteSubscriptionPayment(ctx context.Context, payment *SubscriptionPayment, changes map[string]interface{}, entries []LedgerEntryInput) (bool, error) {
+	query := `
+		mutation CompleteSubscriptionPayment(
+			$transaction_id: String!,
+			$subscription_id: uuid!,
+			$payment_id: uuid!,
+			$changes: subscriptions_set_input!,
+			$entries: [ledger_entries_insert_input!]!
+		) {
+			update_subscription_payments(
+				where: {transaction_id: {_eq: $transaction_id}, status: {_in: ["pending", "expired"]}},
+				_set: {status: "completed"}
+			) {
+				affected_rows
+			}
+			update_subscriptions(
+				where: {
+					id: {_eq: $subscription_id},
+					_or: [{last_payment_id: {_is_null: true}}, {last_payment_id: {_neq: $payment_id}}]
+				},
+				_set: $changes
+			) {
+				affected_rows
+			}
+			insert_ledger_entries(
+				objects: $entries,
+				on_conflict: {constraint: ledger_entries_reference_line_key, update_columns: []}
+			) {
+				affected_rows
+			}
+		}
+	`
+
+	resp, err := s.ExecuteQuery(ctx, query, map[string]interface{}{
+		"transaction_id":  payment.TransactionID,
+		"subscription_id": payment.SubscriptionID,
+		"payment_id":      payment.ID,
+		"changes":         changes,
+		"entries":         ledgerObjects(entries),
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to complete subscription payment: %w", err)
+	}
+
+	var result struct {
+		UpdateSubscriptionPayments struct {
+			AffectedRows int `json:"affected_rows"`
+		} `json:"update_subscription_payments"`
+	}
+
+	if err := json.Unmarshal(resp.Data, &result); err != nil {
+		return false, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	return result.UpdateSubscriptionPayments.AffectedRows > 0, nil
+}
+
+func subscriptionPaymentObject(payment *SubscriptionPayment) map[string]interface{} {
+	return map[string]interface{}{
+		"id":              payment.ID,
+		"subscription_id": payment.SubscriptionID,
+		"user_id":         payment.UserID,
+		"amount":          payment.Amount,
+		"transaction_id":  payment.TransactionID,
+		"status":          SubscriptionPaymentPending,
+		"period_start":    payment.PeriodStart,
+		"period_end":      payment.PeriodEnd,
+	}
+}
+
+type SubscriptionPlan struct {
+	ID              string  `json:"id"`
+	Name            string  `json:"name"`
+	Description     string  `json:"description,omitempty"`
+	Scope           string  `json:"scope"`
+	ChefID          string  `json:"chef_id,omitempty"`
+	Price           float64 `json:"price"`
+	BillingInterval string  `json:"billing_interval"`
+	IsActive        bool    `json:"is_active"`
+	CreatedBy       string  `json:"created_by,omitempty"`
+	CreatedAt       string  `json:"created_at"`
+	UpdatedAt       string  `json:"updated_at"`
+}
+
+type Subscription struct {
+	ID                 string `json:"id"`
+	UserID             string `json:"user_id"`
+	PlanID             string `json:"plan_id"`
+	ChefID             string `json:"chef_id,omitempty"`
+	Status             string `json:"status"`
+	CurrentPeriodStart string `json:"current_period_start,omitempty"`
+	CurrentPeriodEnd   string `json:"current_period_end,omitempty"`
+	BillingAnchor      string `json:"billing_anchor,omitempty"`
+	GraceUntil         string `json:"grace_until,omitempty"`
+	CancelAtPeriodEnd  bool   `json:"cancel_at_period_end"`
+	CanceledAt         string `json:"canceled_at,omitempty"`
+	CreatedAt          string `json:"created_at"`
+	UpdatedAt          string `json:"updated_at"`
+}
+
+type SubscriptionPayment struct {
+	ID             string  `json:"id"`
+	SubscriptionID string  `json:"subscription_id"`
+	UserID         string  `json:"user_id"`
+	Amount         float64 `json:"amount"`
+	TransactionID  string  `json:"transaction_id"`
+	Status         string  `json:"status"`
+	CheckoutURL    string  `json:"checkout_url,omitempty"`
+	PeriodStart    string  `json:"period_start"`
+	PeriodEnd      string  `json:"period_end"`
+	CreatedAt      string  `json:"created_at"`
+	UpdatedAt      string  `json:"updated_at"`
+}
@@ -0,0 +1,242 @@
+package services
+
+import (
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"math"
+	"strings"
+
+	_ "golang.org/x/image/webp"
+)
+
+// ImageInfo describes an uploaded image so clients can reserve space and
+// show a placeholder while it loads.
+type ImageInfo struct {
+	Width         int
+	Height        int
+	BlurHash      string
+	DominantColor string
+}
+
+const (
+	// Number of BlurHash components along each axis
+	blurHashComponentsX = 4
+	blurHashComponentsY = 3
+
+	// Longest side of the grid sampled from the image
+	imageSampleSize = 64
+
+	// Largest image decoded, in pixels. Decoding allocates memory for every
+	// pixel, so a small compressed file could otherwise exhaust it.
+	maxImagePixels = 40_000_000
+)
+
+var ErrImageTooLarge = fmt.Errorf("image must be at most %d megapixels", maxImagePixels/1_000_000)
+
+var errInvalidImage error = &MediaError{Reason: "invalid image"}
+
+func analyzeImage(r io.ReadSeeker) (*ImageInfo, error) {
+	start, err := r.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, err
+	}
+
+	// Check the dimensions in the header before decoding anything
+	config, _, err := image.DecodeConfig(r)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errInvalidImage, err)
+	}
+	if config.Width <= 0 || config.Height <= 0 {
+		return nil, fmt.Errorf("%w: empty dimensions", errInvalidImage)
+	}
+	if int64(config.Width)*int64(config.Height) > maxImagePixels {
+		return nil, ErrImageTooLarge
+	}
+
+	if _, err := r.Seek(start, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	img, _, err := image.Decode(r)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errInvalidImage, err)
+	}
+
+	bounds := img.Bounds()
+	if bounds.Dx() == 0 || bounds.Dy() == 0 {
+		return nil, fmt.Errorf("%w: empty dimensions", errInvalidImage)
+	}
+
+	pixels := sampleImage(img)
+
+	return &ImageInfo{
+		Width:         bounds.Dx(),
+		Height:        bounds.Dy(),
+		BlurHash:      encodeBlurHash(pixels, blurHashComponentsX, blurHashComponentsY),
+		DominantColor: dominantColor(pixels),
+	}, nil
+}
+
+// sampleImage reduces an image to a small grid of 8-bit RGB pixels using
+// nearest-neighbour sampling. Placeholders don't need more detail than that.
+func sampleImage(img image.Image) [][][3]uint8 {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+
+	sampleWidth, sampleHeight := width, height
+	if width > imageSampleSize || height > imageSampleSize {
+		if width >= height {
+			sampleWidth = imageSampleSize
+			sampleHeight = int(math.Max(1, math.Round(float64(height)*imageSampleSize/float64(width))))
+		} else {
+			sampleHeight = imageSampleSize
+			sampleWidth = int(math.Max(1, math.Round(float64(width)*imageSampleSize/float64(height))))
+		}
+	}
+
+	pixels := make([][][3]uint8, sampleHeight)
+	for y := 0; y < sampleHeight; y++ {
+		pixels[y] = make([][3]uint8, sampleWidth)
+		srcY := bounds.Min.Y + y*height/sampleHeight
+		for x := 0; x < sampleWidth; x++ {
+			srcX := bounds.Min.X + x*width/sampleWidth
+			r, g, b, _ := img.At(srcX, srcY).RGBA()
+			pixels[y][x] = [3]uint8{uint8(r >> 8), uint8(g >> 8), uint8(b >> 8)}
+		}
+	}
+
+	return pixels
+}
+
+// dominantColor buckets pixels by their top four bits per channel and returns
+// the average colour of the most populated bucket as a hex string.
+func dominantColor(pixels [][][3]uint8) string {
+	type bucket struct {
+		count   int
+		r, g, b int
+	}
+
+	buckets := map[int]*bucket{}
+	var best *bucket
+	for _, row := range pixels {
+		for _, p := range row {
+			key := int(p[0]>>4)<<8 | int(p[1]>>4)<<4 | int(p[2]>>4)
+			b, ok := buckets[key]
+			if !ok {
+				b = &bucket{}
+				buckets[key] = b
+			}
+			b.count++
+			b.r += int(p[0])
+			b.g += int(p[1])
+			b.b += int(p[2])
+			if best == nil || b.count > best.count {
+				best = b
+			}
+		}
+	}
+
+	if best == nil {
+		return "#000000"
+	}
+
+	return fmt.Sprintf("#%02x%02x%02x", best.r/best.count, best.g/best.count, best.b/best.count)
+}
+
+// encodeBlurHash implements the BlurHash algorithm (https://blurha.sh).
+func encodeBlurHash(pixels [][][3]uint8, componentsX, componentsY int) string {
+	height := len(pixels)
+	width := len(pixels[0])
+
+	factors := make([][3]float64, 0, componentsX*componentsY)
+	for j := 0; j < componentsY; j++ {
+		for i := 0; i < componentsX; i++ {
+			normalisation := 2.0
+			if i == 0 && j == 0 {
+				normalisation = 1.0
+			}
+
+			var r, g, b float64
+			for y := 0; y < height; y++ {
+				basisY := math.Cos(math.Pi * float64(j) * float64(y) / float64(height))
+				for x := 0; x < width; x++ {
+					basis := math.Cos(math.Pi*float64(i)*float64(x)/float64(width)) * basisY
+					p := pixels[y][x]
+					r += basis * srgbToLinear(p[0])
+					g += basis * srgbToLinear(p[1])
+					b += basis * srgbToLinear(p[2])
+				}
+			}
+
+			scale := normalisation / float64(width*height)
+			factors = append(factors, [3]float64{r * scale, g * scale, b * scale})
+		}
+	}
+
+	var hash strings.Builder
+	hash.WriteString(encodeBase83((componentsX-1)+(componentsY-1)*9, 1))
+
+	dc, ac := factors[0], factors[1:]
+
+	maximumValue := 1.0
+	if len(ac) > 0 {
+		actualMaximum := 0.0
+		for _, f := range ac {
+			actualMaximum = math.Max(actualMaximum, math.Max(math.Abs(f[0]), math.Max(math.Abs(f[1]), math.Abs(f[2]))))
+		}
+		quantisedMaximum := int(math.Max(0, math.Min(82, math.Floor(actualMaximum*166-0.5))))
+		maximumValue = float64(quantisedMaximum+1) / 166
+		hash.WriteString(encodeBase83(quantisedMaximum, 1))
+	} else {
+		hash.WriteString(encodeBase83(0, 1))
+	}
+
+	dcValue := linearToSRGB(dc[0])<<16 | linearToSRGB(dc[1])<<8 | linearToSRGB(dc[2])
+	hash.WriteString(encodeBase83(dcValue, 4))
+
+	for _, f := range ac {
+		quantR := quantiseAC(f[0], maximumValue)
+		quantG := quantiseAC(f[1], maximumValue)
+		quantB := quantiseAC(f[2], maximumValue)
+		hash.WriteString(encodeBase83(quantR*19*19+quantG*19+quantB, 2))
+	}
+
+	return hash.String()
+}
+
+func quantiseAC(value, maximumValue float64) int {
+	v := value / maximumValue
+	signPow := math.Copysign(math.Pow(math.Abs(v), 0.5), v)
+	return int(math.Max(0, math.Min(18, math.Floor(signPow*9+9.5))))
+}
+
+func srgbToLinear(value uint8) float64 {
+	v := float64(value) / 255
+	if v <= 0.04045 {
+		return v / 12.92
+	}
+	return math.Pow((v+0.055)/1.055, 2.4)
+}
+
+func linearToSRGB(value float64) int {
+	v := math.Max(0, math.Min(1, value))
+	if v <= 0.0031308 {
+		return int(v*12.92*255 + 0.5)
+	}
+	return int((1.055*math.Pow(v, 1/2.4)-0.055)*255 + 0.5)
+}
+
+const base83Characters = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz#$%*+,-.:;=?@[]^_{|}~"
+
+func encodeBase83(value, length int) string {
+	encoded := make([]byte, length)
+	for i := 1; i <= length; i++ {
+		digit := (value / int(math.Pow(83, float64(length-i)))) % 83
+		encoded[i-1] = base83Characters[digit]
+	}
+	return string(encoded)
+}
@@ -0,0 +1,42 @@
+package services
+
+import "testing"
+
+// The expected hashes are what the reference encoder (blurHashForPixels in
+// github.com/woltapp/blurhash, C/encode.c) produces for the same pixels.
+func TestEncodeBlurHash(t *testing.T) {
+	const width, height = 32, 24
+
+	gradient := make([][][3]uint8, height)
+	solid := make([][][3]uint8, height)
+	for y := 0; y < height; y++ {
+		gradient[y] = make([][3]uint8, width)
+		solid[y] = make([][3]uint8, width)
+		for x := 0; x < width; x++ {
+			// A red and green gradient over a blue checkerboard
+			blue := uint8(40)
+			if (x/8+y/8)%2 == 1 {
+				blue = 200
+			}
+			gradient[y][x] = [3]uint8{uint8(x * 255 / (width - 1)), uint8(y * 255 / (height - 1)), blue}
+			solid[y][x] = [3]uint8{230, 120, 30}
+		}
+	}
+
+	tests := []struct {
+		name   string
+		pixels [][][3]uint8
+		want   string
+	}{
+		{name: "gradient", pixels: gradient, want: "L$Hewa2nwxX2l}WDjte;gJfffQfd"},
+		{name: "solid", pixels: solid, want: "LAQYeM^3fQ^3}WoKfQoKfQfQfQfQ"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := encodeBlurHash(tt.pixels, blurHashComponentsX, blurHashComponentsY); got != tt.want {
+				t.Errorf("encodeBlurHash() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
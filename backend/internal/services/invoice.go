@@ -0,0 +1,264 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"recipe-backend/internal/config"
+)
+
+var ErrInvoiceUnavailable = errors.New("invoices are only issued for completed purchases")
+
+// EmailAttachment is a file sent along with an email.
+type EmailAttachment struct {
+	Filename    string
+	ContentType string
+	Content     []byte
+}
+
+// AttachmentNotifier sends emails that may carry attachments.
+type AttachmentNotifier interface {
+	NotifyWithAttachments(ctx context.Context, recipientEmail, emailType string, data map[string]interface{}, attachments []EmailAttachment) error
+}
+
+// InvoiceService issues the tax invoice of a completed purchase and renders
+// it as a PDF.
+//
+// Every purchase gets at most one invoice. The database numbers invoices
+// without gaps in the order they are issued, and the seller, buyer and
+// amounts are copied onto the invoice so it never changes afterwards.
+// Prices include VAT, so the VAT is worked out backwards from what was paid.
+// A refund does not change the invoice.
+type InvoiceService struct {
+	config        *config.Config
+	hasuraService *HasuraService
+}
+
+func NewInvoiceService(cfg *config.Config, hasuraService *HasuraService) *InvoiceService {
+	return &InvoiceService{
+		config:        cfg,
+		hasuraService: hasuraService,
+	}
+}
+
+// Issue returns the purchase's invoice, issuing it first if needed.
+func (s *InvoiceService) Issue(ctx context.Context, purchase *Purchase) (*Invoice, error) {
+	if purchase.Status != PurchaseCompleted && purchase.Status != PurchaseRefunded {
+		return nil, ErrInvoiceUnavailable
+	}
+
+	existing, err := s.hasuraService.GetInvoiceByPurchaseID(ctx, purchase.ID)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return existing, nil
+	}
+
+	item, err := s.hasuraService.GetPurchaseItem(ctx, purchase)
+	if err != nil {
+		return nil, err
+	}
+	if item == nil {
+		return nil, fmt.Errorf("item of purchase %s not found", purchase.TransactionID)
+	}
+
+	buyer, err := s.hasuraService.GetUserByID(ctx, purchase.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if buyer == nil {
+		return nil, fmt.Errorf("buyer %s of purchase %s not found", purchase.UserID, purchase.TransactionID)
+	}
+
+	seller, err := s.hasuraService.GetUserByID(ctx, item.SellerID)
+	if err != nil {
+		return nil, err
+	}
+	if seller == nil {
+		return nil, fmt.Errorf("seller %s of purchase %s not found", item.SellerID, purchase.TransactionID)
+	}
+
+	currency := purchase.Currency
+	if currency == "" {
+		currency = LedgerCurrency
+	}
+
+	total := roundMoney(purchase.Amount)
+	net, vat := vatBreakdown(total, s.config.VATRate)
+
+	invoice, err := s.hasuraService.CreateInvoice(ctx, &Invoice{
+		PurchaseID:        purchase.ID,
+		IssuerName:        s.config.InvoiceIssuerName,
+		IssuerTIN:         s.config.InvoiceIssuerTIN,
+		IssuerAddress:     s.config.InvoiceIssuerAddress,
+		SellerID:          seller.ID,
+		SellerName:        displayName(seller),
+		SellerEmail:       seller.Email,
+		BuyerID:           buyer.ID,
+		BuyerName:         displayName(buyer),
+		BuyerEmail:        buyer.Email,
+		RecipeID:          item.RecipeID,
+		BundleID:          item.BundleID,
+		RecipeTitle:       item.Title,
+		Currency:          currency,
+		TotalAmount:       total,
+		DiscountAmount:    roundMoney(purchase.DiscountAmount),
+		VATRate:           s.config.VATRate,
+		NetAmount:         net,
+		VATAmount:         vat,
+		TransactionID:     purchase.TransactionID,
+		ProviderReference: purchase.ProviderReference,
+		PaymentProvider:   purchase.PaymentProvider,
+	})
+	if err != nil {
+		// A concurrent request may have issued it first
+		if existing, lookupErr := s.hasuraService.GetInvoiceByPurchaseID(ctx, purchase.ID); lookupErr == nil && existing != nil {
+			return existing, nil
+		}
+		return nil, err
+	}
+
+	return invoice, nil
+}
+
+// vatBreakdown splits a price that includes VAT at rate percent into the
+// net amount and the VAT. The two always add up to the total.
+func vatBreakdown(total, rate float64) (net, vat float64) {
+	net = roundMoney(total * 100 / (100 + rate))
+	return net, roundMoney(total - net)
+}
+
+func displayName(user *User) string {
+	if user.FullName != "" {
+		return user.FullName
+	}
+	if user.Username != "" {
+		return user.Username
+	}
+	return user.Email
+}
+
+// Filename returns the name the invoice PDF is downloaded and attached as.
+func (invoice *Invoice) Filename() string {
+	return invoice.InvoiceNumber + ".pdf"
+}
+
+// RenderPDF lays the invoice out on a single A4 page.
+func (s *InvoiceService) RenderPDF(invoice *Invoice) []byte {
+	const (
+		left  = 56.0
+		right = pdfPageWidth - 56
+	)
+
+	page := &pdfPage{}
+	y := pdfPageHeight - 72
+
+	page.Text(left, y, pdfFontBold, 20, "TAX INVOICE")
+	page.Text(right-170, y, pdfFontBold, 11, invoice.InvoiceNumber)
+	y -= 16
+	issuedAt := invoice.IssuedAt
+	if t, err := time.Parse(time.RFC3339Nano, invoice.IssuedAt); err == nil {
+		issuedAt = t.UTC().Format("2 January 2006")
+	}
+	page.Text(right-170, y, pdfFontRegular, 10, "Date: "+issuedAt)
+
+	// Issuer, seller and buyer side by side
+	y -= 40
+	column := func(x float64, heading string, lines ...string) {
+		page.Text(x, y, pdfFontBold, 10, heading)
+		ly := y - 14
+		for _, line := range lines {
+			if line == "" {
+				continue
+			}
+			page.Text(x, ly, pdfFontRegular, 9, truncate(line, 36))
+			ly -= 12
+		}
+	}
+	tin := ""
+	if invoice.IssuerTIN != "" {
+		tin = "TIN: " + invoice.IssuerTIN
+	}
+	column(left, "Issued by", invoice.IssuerName, tin, invoice.IssuerAddress)
+	column(left+165, "Sold by", invoice.SellerName, invoice.SellerEmail)
+	column(left+330, "Bill to", invoice.BuyerName, invoice.BuyerEmail)
+
+	// Line items
+	y -= 80
+	page.Text(left, y, pdfFontBold, 10, "Description")
+	page.Text(right-80, y, pdfFontBold, 10, "Amount")
+	y -= 6
+	page.Line(left, right, y)
+
+	amount := func(value float64) string {
+		return fmt.Sprintf("%.2f %s", value, invoice.Currency)
+	}
+	row := func(font, label, value string) {
+		y -= 16
+		page.Text(left, y, font, 10, label)
+		page.MonoRight(right, y, 10, value)
+	}
+
+	label := "Premium recipe: "
+	if invoice.BundleID != "" {
+		label = "Recipe bundle: "
+	}
+	row(pdfFontRegular, label+truncate(invoice.RecipeTitle, 60), amount(invoice.TotalAmount+invoice.DiscountAmount))
+	if invoice.DiscountAmount > 0 {
+		row(pdfFontRegular, "Discount", "-"+amount(invoice.DiscountAmount))
+	}
+	y -= 6
+	page.Line(left, right, y)
+	row(pdfFontRegular, "Subtotal excluding VAT", amount(invoice.NetAmount))
+	row(pdfFontRegular, fmt.Sprintf("VAT (%s%%)", trimZeros(invoice.VATRate)), amount(invoice.VATAmount))
+	row(pdfFontBold, "Total paid (VAT included)", amount(invoice.TotalAmount))
+
+	// Payment
+	y -= 36
+	page.Text(left, y, pdfFontBold, 10, "Payment")
+	y -= 14
+	if invoice.ProviderReference != "" {
+		paid := "Paid"
+		if invoice.PaymentProvider != "" {
+			paid += " through " + providerDisplayName(invoice.PaymentProvider)
+		}
+		page.Text(left, y, pdfFontRegular, 9, paid+", reference "+invoice.ProviderReference)
+		y -= 12
+	} else if invoice.TotalAmount <= 0 {
+		page.Text(left, y, pdfFontRegular, 9, "No payment was due")
+		y -= 12
+	}
+	page.Text(left, y, pdfFontRegular, 9, "Transaction "+invoice.TransactionID)
+
+	page.Text(left, 56, pdfFontRegular, 8, fmt.Sprintf("Prices include VAT at %s%%. Thank you for buying on %s.",
+		trimZeros(invoice.VATRate), invoice.IssuerName))
+
+	return page.Bytes()
+}
+
+// providerDisplayName is how an invoice names the payment provider called
+// name.
+func providerDisplayName(name string) string {
+	switch name {
+	case "chapa":
+		return "Chapa"
+	case "mock":
+		return "the mock payment provider"
+	}
+	return name
+}
+
+func truncate(text string, max int) string {
+	runes := []rune(text)
+	if len(runes) <= max {
+		return text
+	}
+	return string(runes[:max-3]) + "..."
+}
+
+func trimZeros(value float64) string {
+	return fmt.Sprintf("%g", value)
+}
@@ -0,0 +1,90 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"recipe-backend/internal/config"
+)
+
+// The invoice names the provider the purchase was paid through, as it was
+// when the invoice was issued.
+func TestInvoiceIssueCopiesPaymentProvider(t *testing.T) {
+	var created map[string]interface{}
+	hasura := newFakeHasura(t, func(query string, variables map[string]interface{}) interface{} {
+		switch {
+		case strings.Contains(query, "GetInvoiceByPurchaseID"):
+			return map[string]interface{}{"invoices": []Invoice{}}
+		case strings.Contains(query, "GetRecipeByID"):
+			return map[string]interface{}{"recipes_by_pk": Recipe{ID: "recipe-1", UserID: "chef", Title: "Doro Wat"}}
+		case strings.Contains(query, "GetUserByID"):
+			return map[string]interface{}{"users_by_pk": User{ID: variables["id"].(string), Email: variables["id"].(string) + "@example.com"}}
+		case strings.Contains(query, "CreateInvoice"):
+			created = variables["invoice"].(map[string]interface{})
+			return map[string]interface{}{"insert_invoices_one": Invoice{ID: "invoice-1", PaymentProvider: "mock"}}
+		}
+		t.Errorf("unexpected query %s", query)
+		return nil
+	})
+
+	s := NewInvoiceService(&config.Config{InvoiceIssuerName: "Recipes", VATRate: 15}, hasura)
+	_, err := s.Issue(context.Background(), &Purchase{
+		ID:                "purchase-1",
+		UserID:            "buyer",
+		RecipeID:          "recipe-1",
+		Amount:            115,
+		Currency:          "ETB",
+		TransactionID:     "tx-1",
+		Status:            PurchaseCompleted,
+		ProviderReference: "MOCK1234",
+		PaymentProvider:   "mock",
+	})
+	if err != nil {
+		t.Fatalf("Issue() = %v", err)
+	}
+	if created["payment_provider"] != "mock" || created["provider_reference"] != "MOCK1234" {
+		t.Errorf("invoice stored with provider %v and reference %v, want mock and MOCK1234", created["payment_provider"], created["provider_reference"])
+	}
+}
+
+func TestInvoicePaymentLine(t *testing.T) {
+	tests := []struct {
+		name      string
+		provider  string
+		reference string
+		total     float64
+		want      string
+	}{
+		{name: "chapa", provider: "chapa", reference: "APfa1", total: 115, want: "Paid through Chapa, reference APfa1"},
+		{name: "mock", provider: "mock", reference: "MOCK1234", total: 115, want: "Paid through the mock payment provider, reference MOCK1234"},
+		{name: "unknown provider", provider: "telebirr", reference: "T-9", total: 115, want: "Paid through telebirr, reference T-9"},
+		{name: "provider not recorded", reference: "APfa1", total: 115, want: "Paid, reference APfa1"},
+		{name: "free", total: 0, want: "No payment was due"},
+	}
+
+	s := &InvoiceService{}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lines := parsePDF(t, s.RenderPDF(&Invoice{
+				InvoiceNumber:     "INV-000001",
+				Currency:          "ETB",
+				TotalAmount:       tt.total,
+				TransactionID:     "tx-1",
+				ProviderReference: tt.reference,
+				PaymentProvider:   tt.provider,
+			})).text(t)
+
+			found := false
+			for _, line := range lines {
+				if strings.Contains(line, "Chapa") && tt.provider != "chapa" {
+					t.Errorf("invoice paid through %q mentions Chapa: %q", tt.provider, line)
+				}
+				found = found || line == tt.want
+			}
+			if !found {
+				t.Errorf("invoice text = %q, want a line %q", lines, tt.want)
+			}
+		})
+	}
+}
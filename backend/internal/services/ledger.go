@@ -0,0 +1,343 @@
+package services
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"recipe-backend/internal/config"
+)
+
+// LedgerService builds the double-entry journals for sales, refunds and
+// payouts and reports what creators are owed.
+//
+// A sale debits the provider clearing account with the amount paid, credits
+// the platform with its commission and credits the recipe owner with the
+// rest. The creator's share only becomes available after the hold period,
+// so it can still be refunded. A refund reverses the sale in proportion to
+// the amount refunded. Subscription payments to a chef's plan are split the
+// same way as sales. Payouts move the creator's balance to the payouts
+// payable account until the transfer is confirmed.
+type LedgerService struct {
+	config        *config.Config
+	hasuraService *HasuraService
+}
+
+func NewLedgerService(cfg *config.Config, hasuraService *HasuraService) *LedgerService {
+	return &LedgerService{
+		config:        cfg,
+		hasuraService: hasuraService,
+	}
+}
+
+// SaleEntries returns the journal recording a completed purchase of item.
+// The creator's share of a bundle is split between its recipes in proportion
+// to what each cost on its own when the bundle was created, so earnings can
+// be told apart per recipe; the last recipe gets what rounding leaves over.
+// Free purchases have no journal.
+func (s *LedgerService) SaleEntries(purchase *Purchase, item *PurchaseItem) []LedgerEntryInput {
+	if roundMoney(purchase.Amount) <= 0 {
+		return nil
+	}
+
+	// The ledger is kept in one currency whatever the buyer paid in
+	amount := purchase.InLedgerCurrency(purchase.Amount)
+	commission := roundMoney(amount * s.config.PlatformCommission / 100)
+	share := roundMoney(amount - commission)
+
+	now := time.Now()
+	reference := "purchase:" + purchase.ID
+	entry := func(line int, account, recipeID string, amount float64, description string) LedgerEntryInput {
+		return LedgerEntryInput{
+			Reference:   reference,
+			Line:        line,
+			EntryType:   LedgerEntrySale,
+			Account:     account,
+			PurchaseID:  purchase.ID,
+			RecipeID:    recipeID,
+			Amount:      amount,
+			Description: description,
+			AvailableAt: now,
+		}
+	}
+
+	journal := []LedgerEntryInput{
+		entry(1, AccountProviderClearing, item.RecipeID, -amount, "Payment for "+item.Title),
+		entry(2, AccountPlatformRevenue, item.RecipeID, commission, "Commission on "+item.Title),
+	}
+
+	recipes := item.Recipes
+	if item.BundleID == "" || len(recipes) == 0 {
+		recipes = []Recipe{{ID: item.RecipeID, UserID: item.SellerID}}
+	}
+
+	// A bundle whose recipes' prices are unknown is split evenly
+	weights := item.Weights
+	var totalWeight float64
+	for _, weight := range weights {
+		totalWeight += weight
+	}
+	if len(weights) != len(recipes) || totalWeight <= 0 {
+		weights = make([]float64, len(recipes))
+		for i := range weights {
+			weights[i] = 1
+		}
+		totalWeight = float64(len(recipes))
+	}
+
+	remaining := share
+	for i, recipe := range recipes {
+		recipeShare := roundMoney(share * weights[i] / totalWeight)
+		if i == len(recipes)-1 {
+			recipeShare = remaining
+		}
+		remaining = roundMoney(remaining - recipeShare)
+
+		description := "Sale of " + item.Title
+		if item.BundleID != "" && recipe.ID != "" {
+			description = "Sale of " + recipe.Title + " in " + item.Title
+		}
+
+		creator := entry(len(journal)+1, AccountCreatorEarnings, recipe.ID, recipeShare, description)
+		creator.UserID = recipe.UserID
+		creator.AvailableAt = now.Add(s.config.EarningsHoldPeriod)
+		journal = append(journal, creator)
+	}
+
+	return journal
+}
+
+// RefundEntries returns the journal reversing a refund's share of a sale.
+// The final refund of a purchase reverses whatever is left, so rounding
+// never leaves a balance behind. Purchases completed before the ledger
+// existed have nothing to reverse.
+func (s *LedgerService) RefundEntries(ctx context.Context, purchase *Purchase, refund *Refund, final bool) ([]LedgerEntryInput, error) {
+	entries, err := s.hasuraService.ListPurchaseLedgerEntries(ctx, purchase.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Credits made by the sale, and what is left of them after earlier refunds
+	var sale []LedgerEntry
+	var saleTotal float64
+	net := make(map[string]float64)
+	for _, entry := range entries {
+		if entry.Account == AccountProviderClearing {
+			continue
+		}
+		if entry.EntryType == LedgerEntrySale {
+			sale = append(sale, entry)
+			saleTotal += entry.Amount
+		}
+		net[entry.Account+":"+entry.UserID+":"+entry.RecipeID] += entry.Amount
+	}
+
+	if len(sale) == 0 || saleTotal <= 0 {
+		return nil, nil
+	}
+
+	now := time.Now()
+	amount := purchase.InLedgerCurrency(refund.Amount)
+	reference := "refund:" + refund.ID
+	journal := []LedgerEntryInput{{
+		Reference:   reference,
+		Line:        1,
+		EntryType:   LedgerEntryRefund,
+		Account:     AccountProviderClearing,
+		PurchaseID:  purchase.ID,
+		RefundID:    refund.ID,
+		Amount:      amount,
+		Description: "Refund of " + purchase.TransactionID,
+		AvailableAt: now,
+	}}
+
+	remaining := amount
+	for i, credit := range sale {
+		var reversal float64
+		switch {
+		case final:
+			reversal = roundMoney(net[credit.Account+":"+credit.UserID+":"+credit.RecipeID])
+		case i == len(sale)-1:
+			reversal = remaining
+		default:
+			reversal = roundMoney(amount * credit.Amount / saleTotal)
+		}
+		remaining = roundMoney(remaining - reversal)
+
+		// Reversing a share still on hold reduces what is pending, not the
+		// available balance
+		availableAt := now
+		if saleAvailable, err := time.Parse(time.RFC3339Nano, credit.AvailableAt); err == nil && saleAvailable.After(now) {
+			availableAt = saleAvailable
+		}
+
+		journal = append(journal, LedgerEntryInput{
+			Reference:   reference,
+			Line:        i + 2,
+			EntryType:   LedgerEntryRefund,
+			Account:     credit.Account,
+			UserID:      credit.UserID,
+			PurchaseID:  purchase.ID,
+			RefundID:    refund.ID,
+			RecipeID:    credit.RecipeID,
+			Amount:      -reversal,
+			Description: "Refund: " + refund.Reason,
+			AvailableAt: availableAt,
+		})
+	}
+
+	// A final refund reverses the remaining credits, which must match the
+	// amount returned to the buyer
+	if final {
+		var reversed float64
+		for _, entry := range journal[1:] {
+			reversed -= entry.Amount
+		}
+		journal[0].Amount = roundMoney(reversed)
+	}
+
+	return journal, nil
+}
+
+// SubscriptionEntries returns the journal recording a subscription payment.
+// A chef's plan is split like a sale of one of their recipes; plans
+// covering every premium recipe are platform revenue.
+func (s *LedgerService) SubscriptionEntries(plan *SubscriptionPlan, payment *SubscriptionPayment) []LedgerEntryInput {
+	amount := roundMoney(payment.Amount)
+	if amount <= 0 {
+		return nil
+	}
+
+	now := time.Now()
+	reference := "subscription:" + payment.ID
+	entry := func(line int, account string, amount float64, description string) LedgerEntryInput {
+		return LedgerEntryInput{
+			Reference:             reference,
+			Line:                  line,
+			EntryType:             LedgerEntrySubscription,
+			Account:               account,
+			SubscriptionPaymentID: payment.ID,
+			Amount:                amount,
+			Description:           description,
+			AvailableAt:           now,
+		}
+	}
+
+	journal := []LedgerEntryInput{
+		entry(1, AccountProviderClearing, -amount, "Subscription payment for "+plan.Name),
+	}
+
+	if plan.ChefID == "" {
+		return append(journal, entry(2, AccountPlatformRevenue, amount, "Subscription to "+plan.Name))
+	}
+
+	commission := roundMoney(amount * s.config.PlatformCommission / 100)
+	creator := entry(3, AccountCreatorEarnings, roundMoney(amount-commission), "Subscription to "+plan.Name)
+	creator.UserID = plan.ChefID
+	creator.AvailableAt = now.Add(s.config.EarningsHoldPeriod)
+
+	return append(journal,
+		entry(2, AccountPlatformRevenue, commission, "Commission on subscription to "+plan.Name),
+		creator,
+	)
+}
+
+// PayoutEntries returns the journal reserving a requested payout from the
+// creator's available balance.
+func (s *LedgerService) PayoutEntries(payout *Payout) []LedgerEntryInput {
+	return payoutJournal(payout, "payout:", LedgerEntryPayout,
+		AccountCreatorEarnings, AccountPayoutsPayable, "Payout to "+payoutDestination(payout))
+}
+
+// PayoutPaidEntries returns the journal recording that a payout left the
+// platform's provider balance.
+func (s *LedgerService) PayoutPaidEntries(payout *Payout) []LedgerEntryInput {
+	return payoutJournal(payout, "payout-paid:", LedgerEntryPayout,
+		AccountPayoutsPayable, AccountProviderClearing, "Payout sent to "+payoutDestination(payout))
+}
+
+// PayoutReturnedEntries returns the journal giving the amount of a rejected
+// or failed payout back to the creator.
+func (s *LedgerService) PayoutReturnedEntries(payout *Payout) []LedgerEntryInput {
+	return payoutJournal(payout, "payout-returned:", LedgerEntryPayoutReversal,
+		AccountPayoutsPayable, AccountCreatorEarnings, "Payout "+payout.Status+", returned to balance")
+}
+
+// payoutJournal moves a payout's amount from one account to another.
+func payoutJournal(payout *Payout, prefix, entryType, from, to, description string) []LedgerEntryInput {
+	now := time.Now()
+	amount := roundMoney(payout.Amount)
+	entry := func(line int, account string, amount float64) LedgerEntryInput {
+		entry := LedgerEntryInput{
+			Reference:   prefix + payout.ID,
+			Line:        line,
+			EntryType:   entryType,
+			Account:     account,
+			PayoutID:    payout.ID,
+			Amount:      amount,
+			Description: description,
+			AvailableAt: now,
+		}
+		if account == AccountCreatorEarnings {
+			entry.UserID = payout.UserID
+		}
+		return entry
+	}
+
+	return []LedgerEntryInput{
+		entry(1, from, -amount),
+		entry(2, to, amount),
+	}
+}
+
+func payoutDestination(payout *Payout) string {
+	destination := payout.BankName
+	if destination == "" {
+		destination = payout.Method
+	}
+
+	number := payout.AccountNumber
+	if len(number) > 4 {
+		number = number[len(number)-4:]
+	}
+
+	return destination + " ****" + number
+}
+
+type Earnings struct {
+	Balance           float64       `json:"balance"`
+	Pending           float64       `json:"pending"`
+	Currency          string        `json:"currency"`
+	CommissionPercent float64       `json:"commission_percent"`
+	History           []LedgerEntry `json:"history"`
+}
+
+// Earnings returns a creator's available balance, the earnings still on
+// hold and a page of their ledger history.
+func (s *LedgerService) Earnings(ctx context.Context, userID string, limit, offset int) (*Earnings, error) {
+	available, pending, err := s.hasuraService.GetAccountBalance(ctx, userID, AccountCreatorEarnings, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	history, err := s.hasuraService.ListAccountEntries(ctx, userID, AccountCreatorEarnings, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+
+	if history == nil {
+		history = []LedgerEntry{}
+	}
+
+	return &Earnings{
+		Balance:           roundMoney(available),
+		Pending:           roundMoney(pending),
+		Currency:          LedgerCurrency,
+		CommissionPercent: s.config.PlatformCommission,
+		History:           history,
+	}, nil
+}
+
+func roundMoney(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
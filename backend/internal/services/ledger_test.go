@@ -0,0 +1,403 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"recipe-backend/internal/config"
+)
+
+// newFakeHasura returns a HasuraService talking to a test server that
+// answers every query with the data returned by respond, or with a GraphQL
+// error when respond returns an error.
+func newFakeHasura(t *testing.T, respond func(query string, variables map[string]interface{}) interface{}) *HasuraService {
+	t.Helper()
+
+	// Every query is logged in full
+	log.SetOutput(io.Discard)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req GraphQLRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		data := respond(req.Query, req.Variables)
+		if err, ok := data.(error); ok {
+			json.NewEncoder(w).Encode(map[string]interface{}{"errors": []map[string]interface{}{{"message": err.Error()}}})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": data})
+	}))
+	t.Cleanup(server.Close)
+
+	return NewHasuraService(&config.Config{HasuraEndpoint: server.URL})
+}
+
+// fakeLedger keeps the journals of one purchase as the database would.
+type fakeLedger struct {
+	entries []LedgerEntry
+}
+
+func (l *fakeLedger) record(journal []LedgerEntryInput) {
+	for _, entry := range journal {
+		l.entries = append(l.entries, LedgerEntry{
+			Reference:   entry.Reference,
+			Line:        entry.Line,
+			EntryType:   entry.EntryType,
+			Account:     entry.Account,
+			UserID:      entry.UserID,
+			PurchaseID:  entry.PurchaseID,
+			RefundID:    entry.RefundID,
+			RecipeID:    entry.RecipeID,
+			Amount:      entry.Amount,
+			AvailableAt: entry.AvailableAt.UTC().Format(time.RFC3339Nano),
+		})
+	}
+}
+
+// net returns what is left on each account, creator and recipe. Provider
+// clearing is one balance whatever the recipe.
+func (l *fakeLedger) net() map[string]float64 {
+	net := make(map[string]float64)
+	for _, entry := range l.entries {
+		key := entry.Account + ":" + entry.UserID + ":" + entry.RecipeID
+		if entry.Account == AccountProviderClearing {
+			key = entry.Account
+		}
+		net[key] = roundMoney(net[key] + entry.Amount)
+	}
+	return net
+}
+
+func newTestLedgerService(t *testing.T, ledger *fakeLedger) *LedgerService {
+	t.Helper()
+
+	hasura := newFakeHasura(t, func(query string, variables map[string]interface{}) interface{} {
+		return map[string]interface{}{"ledger_entries": ledger.entries}
+	})
+
+	return NewLedgerService(&config.Config{
+		PlatformCommission: 15,
+		EarningsHoldPeriod: 7 * 24 * time.Hour,
+	}, hasura)
+}
+
+// assertBalanced fails unless the journal sums to zero, has consecutive
+// lines and shares one reference.
+func assertBalanced(t *testing.T, journal []LedgerEntryInput) {
+	t.Helper()
+
+	var sum float64
+	for i, entry := range journal {
+		sum += entry.Amount
+		if entry.Line != i+1 {
+			t.Errorf("entry %d has line %d", i, entry.Line)
+		}
+		if entry.Reference != journal[0].Reference {
+			t.Errorf("entry %d has reference %q, want %q", i, entry.Reference, journal[0].Reference)
+		}
+		if entry.Amount != roundMoney(entry.Amount) {
+			t.Errorf("entry %d amount %v is not in whole cents", i, entry.Amount)
+		}
+	}
+
+	if roundMoney(sum) != 0 {
+		t.Errorf("journal sums to %.2f, want 0: %+v", sum, journal)
+	}
+}
+
+func creatorShares(journal []LedgerEntryInput) []float64 {
+	var shares []float64
+	for _, entry := range journal {
+		if entry.Account == AccountCreatorEarnings {
+			shares = append(shares, entry.Amount)
+		}
+	}
+	return shares
+}
+
+func singleRecipe() *PurchaseItem {
+	return &PurchaseItem{
+		RecipeID: "recipe-1",
+		Title:    "Doro Wat",
+		SellerID: "chef-1",
+		Recipes:  []Recipe{{ID: "recipe-1", UserID: "chef-1", Title: "Doro Wat"}},
+	}
+}
+
+func bundleOfThree() *PurchaseItem {
+	return &PurchaseItem{
+		BundleID: "bundle-1",
+		Title:    "Fasting Week",
+		SellerID: "chef-1",
+		Recipes: []Recipe{
+			{ID: "recipe-1", UserID: "chef-1", Title: "Shiro", Price: 40, Currency: "ETB"},
+			{ID: "recipe-2", UserID: "chef-1", Title: "Misir Wat", Price: 40, Currency: "ETB"},
+			{ID: "recipe-3", UserID: "chef-1", Title: "Gomen", Price: 40, Currency: "ETB"},
+		},
+		Weights: []float64{40, 40, 40},
+	}
+}
+
+// weighted returns item with its recipes weighted by the given list prices.
+func weighted(item *PurchaseItem, weights ...float64) *PurchaseItem {
+	item.Weights = weights
+	return item
+}
+
+func TestSaleEntries(t *testing.T) {
+	tests := []struct {
+		name       string
+		purchase   *Purchase
+		item       *PurchaseItem
+		paid       float64
+		commission float64
+		shares     []float64
+	}{
+		{
+			name:       "recipe",
+			purchase:   &Purchase{ID: "p1", Amount: 100, Currency: "ETB"},
+			item:       singleRecipe(),
+			paid:       100,
+			commission: 15,
+			shares:     []float64{85},
+		},
+		{
+			name:       "commission rounded to cents",
+			purchase:   &Purchase{ID: "p2", Amount: 99.99, Currency: "ETB"},
+			item:       singleRecipe(),
+			paid:       99.99,
+			commission: 15,
+			shares:     []float64{84.99},
+		},
+		{
+			name:       "coupon discount",
+			purchase:   &Purchase{ID: "p3", Amount: 80, OriginalAmount: 100, DiscountAmount: 20, Currency: "ETB"},
+			item:       singleRecipe(),
+			paid:       80,
+			commission: 12,
+			shares:     []float64{68},
+		},
+		{
+			name:       "paid in USD",
+			purchase:   &Purchase{ID: "p4", Amount: 10, Currency: "USD", SettlementAmount: 1250},
+			item:       singleRecipe(),
+			paid:       1250,
+			commission: 187.5,
+			shares:     []float64{1062.5},
+		},
+		{
+			name:       "bundle",
+			purchase:   &Purchase{ID: "p5", Amount: 100, Currency: "ETB"},
+			item:       bundleOfThree(),
+			paid:       100,
+			commission: 15,
+			shares:     []float64{28.33, 28.33, 28.34},
+		},
+		{
+			name:       "bundle split by list price",
+			purchase:   &Purchase{ID: "p6", Amount: 100, Currency: "ETB"},
+			item:       weighted(bundleOfThree(), 10, 30, 60),
+			paid:       100,
+			commission: 15,
+			shares:     []float64{8.5, 25.5, 51},
+		},
+		{
+			name:       "bundle split remainder on last recipe",
+			purchase:   &Purchase{ID: "p7", Amount: 50, Currency: "ETB"},
+			item:       weighted(bundleOfThree(), 25, 35, 60),
+			paid:       50,
+			commission: 7.5,
+			shares:     []float64{8.85, 12.4, 21.25},
+		},
+		{
+			name:       "bundle without list prices",
+			purchase:   &Purchase{ID: "p8", Amount: 100, Currency: "ETB"},
+			item:       weighted(bundleOfThree()),
+			paid:       100,
+			commission: 15,
+			shares:     []float64{28.33, 28.33, 28.34},
+		},
+	}
+
+	ledger := newTestLedgerService(t, &fakeLedger{})
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := time.Now()
+			journal := ledger.SaleEntries(tt.purchase, tt.item)
+			assertBalanced(t, journal)
+
+			if journal[0].Account != AccountProviderClearing || journal[0].Amount != -tt.paid {
+				t.Errorf("line 1 = %s %.2f, want %s %.2f", journal[0].Account, journal[0].Amount, AccountProviderClearing, -tt.paid)
+			}
+			if journal[1].Account != AccountPlatformRevenue || journal[1].Amount != tt.commission {
+				t.Errorf("line 2 = %s %.2f, want %s %.2f", journal[1].Account, journal[1].Amount, AccountPlatformRevenue, tt.commission)
+			}
+
+			shares := creatorShares(journal)
+			if len(shares) != len(tt.shares) {
+				t.Fatalf("creator shares = %v, want %v", shares, tt.shares)
+			}
+			for i := range shares {
+				if shares[i] != tt.shares[i] {
+					t.Errorf("creator shares = %v, want %v", shares, tt.shares)
+					break
+				}
+			}
+
+			for _, entry := range journal[2:] {
+				if entry.UserID != tt.item.SellerID {
+					t.Errorf("creator line for %s credits %q, want %q", entry.RecipeID, entry.UserID, tt.item.SellerID)
+				}
+				if entry.AvailableAt.Before(before.Add(7 * 24 * time.Hour)) {
+					t.Errorf("creator share available at %v, want after the hold period", entry.AvailableAt)
+				}
+			}
+		})
+	}
+}
+
+func TestSaleEntriesFreePurchase(t *testing.T) {
+	ledger := newTestLedgerService(t, &fakeLedger{})
+
+	if journal := ledger.SaleEntries(&Purchase{ID: "p1", Amount: 0}, singleRecipe()); journal != nil {
+		t.Errorf("SaleEntries() = %+v, want no journal for a free purchase", journal)
+	}
+}
+
+func TestRefundEntries(t *testing.T) {
+	tests := []struct {
+		name     string
+		purchase *Purchase
+		item     *PurchaseItem
+		refunds  []float64 // the last one is final
+	}{
+		{
+			name:     "full refund",
+			purchase: &Purchase{ID: "p1", TransactionID: "tx-1", Amount: 100, Currency: "ETB"},
+			item:     singleRecipe(),
+			refunds:  []float64{100},
+		},
+		{
+			name:     "partial refunds",
+			purchase: &Purchase{ID: "p2", TransactionID: "tx-2", Amount: 100, Currency: "ETB"},
+			item:     singleRecipe(),
+			refunds:  []float64{30, 33.33, 36.67},
+		},
+		{
+			name:     "bundle with uneven cents",
+			purchase: &Purchase{ID: "p3", TransactionID: "tx-3", Amount: 99.99, Currency: "ETB"},
+			item:     bundleOfThree(),
+			refunds:  []float64{10, 0.01, 89.98},
+		},
+		{
+			name:     "coupon discount",
+			purchase: &Purchase{ID: "p4", TransactionID: "tx-4", Amount: 33.33, OriginalAmount: 50, DiscountAmount: 16.67, Currency: "ETB"},
+			item:     singleRecipe(),
+			refunds:  []float64{11.11, 22.22},
+		},
+		{
+			name:     "paid in USD",
+			purchase: &Purchase{ID: "p5", TransactionID: "tx-5", Amount: 10, Currency: "USD", SettlementAmount: 1234.56},
+			item:     bundleOfThree(),
+			refunds:  []float64{3, 3, 4},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ledger := &fakeLedger{}
+			s := newTestLedgerService(t, ledger)
+
+			sale := s.SaleEntries(tt.purchase, tt.item)
+			assertBalanced(t, sale)
+			ledger.record(sale)
+
+			for i, amount := range tt.refunds {
+				final := i == len(tt.refunds)-1
+				refund := &Refund{ID: tt.purchase.ID + "-refund-" + string(rune('a'+i)), Amount: amount, Reason: "test"}
+				before := ledger.net()
+
+				journal, err := s.RefundEntries(context.Background(), tt.purchase, refund, final)
+				if err != nil {
+					t.Fatalf("RefundEntries() = %v", err)
+				}
+				assertBalanced(t, journal)
+
+				returned := tt.purchase.InLedgerCurrency(amount)
+				if !final && journal[0].Amount != returned {
+					t.Errorf("refund %d credits provider clearing %.2f, want %.2f", i+1, journal[0].Amount, returned)
+				}
+				// Rounding may leave the final refund off the amount returned
+				// by at most a cent per line of the sale
+				if final && math.Abs(journal[0].Amount-returned) > 0.01*float64(len(sale)) {
+					t.Errorf("final refund credits provider clearing %.2f, returned %.2f", journal[0].Amount, returned)
+				}
+
+				if final {
+					// Exactly what was left of every credit is reversed
+					for _, entry := range journal[1:] {
+						key := entry.Account + ":" + entry.UserID + ":" + entry.RecipeID
+						if roundMoney(entry.Amount+before[key]) != 0 {
+							t.Errorf("final refund reverses %.2f of %s, %.2f was left", -entry.Amount, key, before[key])
+						}
+					}
+				}
+
+				ledger.record(journal)
+			}
+
+			// Nothing of the sale is left on any account
+			for key, amount := range ledger.net() {
+				if amount != 0 {
+					t.Errorf("%s keeps %.2f after the purchase was refunded in full", key, amount)
+				}
+			}
+		})
+	}
+}
+
+func TestRefundEntriesWithoutSale(t *testing.T) {
+	s := newTestLedgerService(t, &fakeLedger{})
+
+	journal, err := s.RefundEntries(context.Background(), &Purchase{ID: "p1", Amount: 100}, &Refund{ID: "r1", Amount: 100}, true)
+	if err != nil {
+		t.Fatalf("RefundEntries() = %v", err)
+	}
+	if journal != nil {
+		t.Errorf("RefundEntries() = %+v, want nothing to reverse for a purchase without a sale journal", journal)
+	}
+}
+
+func TestRefundEntriesKeepsHold(t *testing.T) {
+	ledger := &fakeLedger{}
+	s := newTestLedgerService(t, ledger)
+
+	purchase := &Purchase{ID: "p1", TransactionID: "tx-1", Amount: 100, Currency: "ETB"}
+	sale := s.SaleEntries(purchase, singleRecipe())
+	ledger.record(sale)
+
+	journal, err := s.RefundEntries(context.Background(), purchase, &Refund{ID: "r1", Amount: 50}, false)
+	if err != nil {
+		t.Fatalf("RefundEntries() = %v", err)
+	}
+
+	// A creator share still on hold is reversed from what is pending
+	for _, entry := range journal {
+		if entry.Account == AccountCreatorEarnings && entry.AvailableAt.Before(sale[2].AvailableAt.Add(-time.Second)) {
+			t.Errorf("creator reversal available at %v, want the sale's %v", entry.AvailableAt, sale[2].AvailableAt)
+		}
+	}
+}
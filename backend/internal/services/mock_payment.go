@@ -0,0 +1,236 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"recipe-backend/internal/config"
+
+	"github.com/google/uuid"
+)
+
+// Outcomes the mock checkout page can simulate
+const (
+	MockOutcomeSuccess = "success"
+	MockOutcomeFailed  = "failed"
+	MockOutcomeDelayed = "delayed"
+)
+
+var ErrMockTransactionNotFound = errors.New("mock transaction not found")
+
+// MockPaymentProvider is an in-memory payment gateway for local development
+// and integration tests. Its checkout page is served by this backend and
+// lets the payer choose whether the payment succeeds, fails or only succeeds
+// after a delay. Transactions are lost when the server restarts.
+type MockPaymentProvider struct {
+	config *config.Config
+
+	mu           sync.Mutex
+	transactions map[string]*MockTransaction
+	refunds      map[string]*RefundPaymentResponse
+}
+
+func NewMockPaymentProvider(cfg *config.Config) *MockPaymentProvider {
+	return &MockPaymentProvider{
+		config:       cfg,
+		transactions: make(map[string]*MockTransaction),
+		refunds:      make(map[string]*RefundPaymentResponse),
+	}
+}
+
+// MockTransaction is a payment started with the mock provider.
+type MockTransaction struct {
+	TxRef       string
+	Amount      float64
+	Refunded    float64
+	Currency    string
+	Email       string
+	Description string
+	ReturnURL   string
+	Status      string
+	Reference   string
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+
+	// A delayed payment reports pending until SettlesAt
+	SettlesAt time.Time
+}
+
+func (p *MockPaymentProvider) Name() string {
+	return "mock"
+}
+
+func (p *MockPaymentProvider) InitializePayment(req InitializePaymentRequest) (*InitializePaymentResponse, error) {
+	amount, err := strconv.ParseFloat(req.Amount, 64)
+	if err != nil || amount <= 0 {
+		return nil, fmt.Errorf("mock provider: invalid amount %q", req.Amount)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if _, exists := p.transactions[req.TxRef]; exists {
+		return nil, fmt.Errorf("mock provider: duplicate tx_ref %s", req.TxRef)
+	}
+
+	now := time.Now()
+	p.transactions[req.TxRef] = &MockTransaction{
+		TxRef:       req.TxRef,
+		Amount:      amount,
+		Currency:    req.Currency,
+		Email:       req.Email,
+		Description: req.Description,
+		ReturnURL:   req.ReturnURL,
+		Status:      "pending",
+		Reference:   "MOCK" + strings.ToUpper(uuid.New().String()[:8]),
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+
+	var response InitializePaymentResponse
+	response.Message = "Hosted Link"
+	response.Status = "success"
+	response.Data.CheckoutURL = p.CheckoutURL(req.TxRef)
+	return &response, nil
+}
+
+func (p *MockPaymentProvider) VerifyPayment(txRef string) (*VerifyPaymentResponse, error) {
+	tx, err := p.Transaction(txRef)
+	if errors.Is(err, ErrMockTransactionNotFound) {
+		return nil, fmt.Errorf("%w: %v", ErrPaymentNotFound, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var response VerifyPaymentResponse
+	response.Message = "Payment details"
+	response.Status = "success"
+	response.Data.Amount = json.Number(fmt.Sprintf("%.2f", tx.Amount))
+	response.Data.Currency = tx.Currency
+	response.Data.Status = tx.Status
+	response.Data.Reference = tx.Reference
+	response.Data.TxRef = tx.TxRef
+	response.Data.CreatedAt = tx.CreatedAt.UTC().Format(time.RFC3339)
+	response.Data.UpdatedAt = tx.UpdatedAt.UTC().Format(time.RFC3339)
+	return &response, nil
+}
+
+func (p *MockPaymentProvider) RefundPayment(txRef, reference string, amount float64, reason string) (*RefundPaymentResponse, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if response, ok := p.refunds[reference]; ok {
+		return response, nil
+	}
+
+	tx, ok := p.transactions[txRef]
+	if !ok {
+		return nil, fmt.Errorf("%w: %v", ErrRefundRejected, ErrMockTransactionNotFound)
+	}
+
+	p.settle(tx)
+	if tx.Status != "success" {
+		return nil, fmt.Errorf("%w: mock provider: cannot refund a %s payment", ErrRefundRejected, tx.Status)
+	}
+	if amount <= 0 || tx.Refunded+amount > tx.Amount+0.005 {
+		return nil, fmt.Errorf("%w: mock provider: refund exceeds amount paid", ErrRefundRejected)
+	}
+
+	tx.Refunded += amount
+	tx.UpdatedAt = time.Now()
+	log.Printf("Mock refund of %.2f for %s: %s", amount, txRef, reason)
+
+	var response RefundPaymentResponse
+	response.Message = "Refund processed"
+	response.Status = "success"
+	response.Data.Reference = "MOCKREFUND" + strings.ToUpper(uuid.New().String()[:8])
+	response.Data.Amount = json.Number(fmt.Sprintf("%.2f", amount))
+	response.Data.Status = "success"
+	p.refunds[reference] = &response
+	return &response, nil
+}
+
+func (p *MockPaymentProvider) VerifyRefund(reference string) (*VerifyRefundResponse, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	refund, ok := p.refunds[reference]
+	if !ok {
+		return nil, fmt.Errorf("%w: mock refund %s", ErrRefundNotFound, reference)
+	}
+
+	var response VerifyRefundResponse
+	response.Message = "Refund details"
+	response.Status = "success"
+	response.Data.Status = refund.Data.Status
+	response.Data.Amount = refund.Data.Amount
+	response.Data.Reference = refund.Data.Reference
+	return &response, nil
+}
+
+// CheckoutURL is the hosted checkout page for a transaction.
+func (p *MockPaymentProvider) CheckoutURL(txRef string) string {
+	return strings.TrimSuffix(p.config.PublicURL, "/") + "/api/v1/payments/mock/checkout/" + txRef
+}
+
+// Transaction returns a copy of a transaction's current state.
+func (p *MockPaymentProvider) Transaction(txRef string) (*MockTransaction, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	tx, ok := p.transactions[txRef]
+	if !ok {
+		return nil, ErrMockTransactionNotFound
+	}
+
+	p.settle(tx)
+	copy := *tx
+	return &copy, nil
+}
+
+// Complete records the payer's choice on the checkout page. A delayed
+// payment stays pending for the given delay and then succeeds.
+func (p *MockPaymentProvider) Complete(txRef, outcome string, delay time.Duration) (*MockTransaction, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	tx, ok := p.transactions[txRef]
+	if !ok {
+		return nil, ErrMockTransactionNotFound
+	}
+
+	if tx.Status != "pending" || !tx.SettlesAt.IsZero() {
+		return nil, fmt.Errorf("mock provider: transaction %s is already %s", txRef, tx.Status)
+	}
+
+	switch outcome {
+	case MockOutcomeSuccess:
+		tx.Status = "success"
+	case MockOutcomeFailed:
+		tx.Status = "failed"
+	case MockOutcomeDelayed:
+		tx.SettlesAt = time.Now().Add(delay)
+	default:
+		return nil, fmt.Errorf("mock provider: unknown outcome %q", outcome)
+	}
+
+	tx.UpdatedAt = time.Now()
+	copy := *tx
+	return &copy, nil
+}
+
+// settle completes a delayed payment once its delay has passed. Callers
+// hold p.mu.
+func (p *MockPaymentProvider) settle(tx *MockTransaction) {
+	if tx.Status == "pending" && !tx.SettlesAt.IsZero() && !time.Now().Before(tx.SettlesAt) {
+		tx.Status = "success"
+		tx.UpdatedAt = tx.SettlesAt
+	}
+}
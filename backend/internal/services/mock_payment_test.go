@@ -0,0 +1,194 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"recipe-backend/internal/config"
+)
+
+func newTestMockProvider(t *testing.T, txRefs ...string) *MockPaymentProvider {
+	t.Helper()
+
+	p := NewMockPaymentProvider(&config.Config{PublicURL: "http://localhost:8000/"})
+	for _, txRef := range txRefs {
+		response, err := p.InitializePayment(InitializePaymentRequest{Amount: "100.00", Currency: "ETB", TxRef: txRef})
+		if err != nil {
+			t.Fatalf("InitializePayment(%s) = %v", txRef, err)
+		}
+		if want := "http://localhost:8000/api/v1/payments/mock/checkout/" + txRef; response.Data.CheckoutURL != want {
+			t.Errorf("checkout URL = %s, want %s", response.Data.CheckoutURL, want)
+		}
+	}
+	return p
+}
+
+func TestMockInitializePayment(t *testing.T) {
+	p := newTestMockProvider(t, "tx-1")
+
+	if _, err := p.InitializePayment(InitializePaymentRequest{Amount: "100.00", TxRef: "tx-1"}); err == nil {
+		t.Error("InitializePayment() with a used tx_ref succeeded")
+	}
+	for _, amount := range []string{"", "0", "-5", "lots"} {
+		if _, err := p.InitializePayment(InitializePaymentRequest{Amount: amount, TxRef: "tx-" + amount}); err == nil {
+			t.Errorf("InitializePayment() with amount %q succeeded", amount)
+		}
+	}
+}
+
+func TestMockComplete(t *testing.T) {
+	tests := []struct {
+		outcome    string
+		wantStatus string
+		wantErr    bool
+	}{
+		{outcome: MockOutcomeSuccess, wantStatus: "success"},
+		{outcome: MockOutcomeFailed, wantStatus: "failed"},
+		{outcome: "refund-me", wantStatus: "pending", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.outcome, func(t *testing.T) {
+			p := newTestMockProvider(t, "tx-1")
+
+			_, err := p.Complete("tx-1", tt.outcome, 0)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Complete() = %v, want error %v", err, tt.wantErr)
+			}
+
+			response, err := p.VerifyPayment("tx-1")
+			if err != nil {
+				t.Fatalf("VerifyPayment() = %v", err)
+			}
+			if response.Data.Status != tt.wantStatus || response.Data.Amount != "100.00" {
+				t.Errorf("VerifyPayment() = %s of %s, want %s of 100.00", response.Data.Status, response.Data.Amount, tt.wantStatus)
+			}
+
+			// The payer only gets to choose once
+			if !tt.wantErr {
+				if _, err := p.Complete("tx-1", MockOutcomeSuccess, 0); err == nil {
+					t.Error("second Complete() succeeded")
+				}
+			}
+		})
+	}
+
+	p := newTestMockProvider(t)
+	if _, err := p.Complete("tx-missing", MockOutcomeSuccess, 0); !errors.Is(err, ErrMockTransactionNotFound) {
+		t.Errorf("Complete() of an unknown transaction = %v, want %v", err, ErrMockTransactionNotFound)
+	}
+	if _, err := p.VerifyPayment("tx-missing"); !errors.Is(err, ErrPaymentNotFound) {
+		t.Errorf("VerifyPayment() of an unknown transaction = %v, want %v", err, ErrPaymentNotFound)
+	}
+}
+
+func TestMockDelayedPayment(t *testing.T) {
+	p := newTestMockProvider(t, "tx-1")
+
+	tx, err := p.Complete("tx-1", MockOutcomeDelayed, 50*time.Millisecond)
+	if err != nil {
+		t.Fatalf("Complete() = %v", err)
+	}
+	if tx.Status != "pending" || tx.SettlesAt.IsZero() {
+		t.Fatalf("delayed payment = %s settling at %v, want pending with a settle time", tx.Status, tx.SettlesAt)
+	}
+
+	if _, err := p.Complete("tx-1", MockOutcomeFailed, 0); err == nil {
+		t.Error("Complete() of a delayed payment succeeded")
+	}
+	if _, err := p.RefundPayment("tx-1", "refund-1", 10, "early"); !errors.Is(err, ErrRefundRejected) {
+		t.Errorf("RefundPayment() before the payment settled = %v, want %v", err, ErrRefundRejected)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+
+	response, err := p.VerifyPayment("tx-1")
+	if err != nil {
+		t.Fatalf("VerifyPayment() = %v", err)
+	}
+	if response.Data.Status != "success" {
+		t.Errorf("payment after the delay = %s, want success", response.Data.Status)
+	}
+	if _, err := p.RefundPayment("tx-1", "refund-2", 10, "late"); err != nil {
+		t.Errorf("RefundPayment() after the payment settled = %v", err)
+	}
+}
+
+func TestMockRefundPayment(t *testing.T) {
+	p := newTestMockProvider(t, "tx-paid", "tx-declined")
+	if _, err := p.Complete("tx-paid", MockOutcomeSuccess, 0); err != nil {
+		t.Fatalf("Complete() = %v", err)
+	}
+	if _, err := p.Complete("tx-declined", MockOutcomeFailed, 0); err != nil {
+		t.Fatalf("Complete() = %v", err)
+	}
+
+	steps := []struct {
+		name      string
+		txRef     string
+		reference string
+		amount    float64
+		wantErr   bool
+	}{
+		{name: "partial", txRef: "tx-paid", reference: "refund-1", amount: 60},
+		{name: "more than is left", txRef: "tx-paid", reference: "refund-2", amount: 50, wantErr: true},
+		{name: "retry of a made refund", txRef: "tx-paid", reference: "refund-1", amount: 60},
+		{name: "the rest", txRef: "tx-paid", reference: "refund-3", amount: 40},
+		{name: "nothing left", txRef: "tx-paid", reference: "refund-4", amount: 0.01, wantErr: true},
+		{name: "zero", txRef: "tx-paid", reference: "refund-5", amount: 0, wantErr: true},
+		{name: "declined payment", txRef: "tx-declined", reference: "refund-6", amount: 10, wantErr: true},
+		{name: "unknown payment", txRef: "tx-missing", reference: "refund-7", amount: 10, wantErr: true},
+	}
+
+	for _, step := range steps {
+		response, err := p.RefundPayment(step.txRef, step.reference, step.amount, step.name)
+		if step.wantErr {
+			if !errors.Is(err, ErrRefundRejected) {
+				t.Errorf("%s: RefundPayment() = %v, want %v", step.name, err, ErrRefundRejected)
+			}
+			continue
+		}
+		if err != nil || response.Data.Status != "success" {
+			t.Errorf("%s: RefundPayment() = %+v, %v, want success", step.name, response, err)
+		}
+	}
+
+	tx, err := p.Transaction("tx-paid")
+	if err != nil {
+		t.Fatalf("Transaction() = %v", err)
+	}
+	if tx.Refunded != 100 {
+		t.Errorf("refunded %.2f, want 100.00 with the retried refund counted once", tx.Refunded)
+	}
+}
+
+func TestMockVerifyRefund(t *testing.T) {
+	p := newTestMockProvider(t, "tx-1")
+	if _, err := p.Complete("tx-1", MockOutcomeSuccess, 0); err != nil {
+		t.Fatalf("Complete() = %v", err)
+	}
+
+	made, err := p.RefundPayment("tx-1", "refund-1", 25, "damaged")
+	if err != nil {
+		t.Fatalf("RefundPayment() = %v", err)
+	}
+
+	response, err := p.VerifyRefund("refund-1")
+	if err != nil {
+		t.Fatalf("VerifyRefund() = %v", err)
+	}
+	if response.Data.Status != "success" || response.Data.Amount != "25.00" || response.Data.Reference != made.Data.Reference {
+		t.Errorf("VerifyRefund() = %+v, want the refund of 25.00 with reference %s", response.Data, made.Data.Reference)
+	}
+
+	// A refund that was refused was never made
+	if _, err := p.RefundPayment("tx-1", "refund-2", 500, "too much"); !errors.Is(err, ErrRefundRejected) {
+		t.Fatalf("RefundPayment() = %v, want %v", err, ErrRefundRejected)
+	}
+	for _, reference := range []string{"refund-2", "refund-missing"} {
+		if _, err := p.VerifyRefund(reference); !errors.Is(err, ErrRefundNotFound) {
+			t.Errorf("VerifyRefund(%s) = %v, want %v", reference, err, ErrRefundNotFound)
+		}
+	}
+}
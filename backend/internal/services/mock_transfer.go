@@ -0,0 +1,71 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MockTransferAccountFailing is an account number whose transfers the mock
+// provider accepts and then fails, to exercise the failure path.
+const MockTransferAccountFailing = "0000000000"
+
+// MockTransferProvider accepts every transfer and reports it successful on
+// the first verification, except transfers to MockTransferAccountFailing,
+// which fail. Transfers live in memory.
+type MockTransferProvider struct {
+	mu        sync.Mutex
+	transfers map[string]*TransferRequest
+}
+
+func NewMockTransferProvider() *MockTransferProvider {
+	return &MockTransferProvider{
+		transfers: make(map[string]*TransferRequest),
+	}
+}
+
+func (p *MockTransferProvider) Transfer(req TransferRequest) (*TransferResponse, error) {
+	if strings.TrimSpace(req.AccountNumber) == "" {
+		return nil, fmt.Errorf("%w: account number is required", ErrTransferRejected)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if _, exists := p.transfers[req.Reference]; exists {
+		return nil, fmt.Errorf("%w: duplicate reference %s", ErrTransferRejected, req.Reference)
+	}
+	p.transfers[req.Reference] = &req
+
+	data, _ := json.Marshal(req.Reference)
+	return &TransferResponse{
+		Message: "Transfer Queued Successfully",
+		Status:  "success",
+		Data:    data,
+	}, nil
+}
+
+func (p *MockTransferProvider) VerifyTransfer(reference string) (*VerifyTransferResponse, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	transfer, ok := p.transfers[reference]
+	if !ok {
+		return nil, fmt.Errorf("%w: mock transfer %s", ErrTransferNotFound, reference)
+	}
+
+	var response VerifyTransferResponse
+	response.Message = "Transfer details"
+	response.Status = "success"
+	response.Data.Status = "success"
+	if transfer.AccountNumber == MockTransferAccountFailing {
+		response.Data.Status = "failed"
+	}
+	response.Data.Currency = transfer.Currency
+	response.Data.TxRef = reference
+	response.Data.ChapaTransferID = "mock-transfer-" + reference
+	response.Data.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
+	return &response, nil
+}
@@ -0,0 +1,66 @@
+package services
+
+import (
+	"errors"
+	"log"
+
+	"recipe-backend/internal/config"
+)
+
+// PaymentProvider is a payment gateway that can take, confirm and refund
+// payments. Requests and responses use Chapa's shapes, which the rest of
+// the code already understands.
+type PaymentProvider interface {
+	Name() string
+	InitializePayment(req InitializePaymentRequest) (*InitializePaymentResponse, error)
+	VerifyPayment(txRef string) (*VerifyPaymentResponse, error)
+	RefundPayment(txRef, reference string, amount float64, reason string) (*RefundPaymentResponse, error)
+	VerifyRefund(reference string) (*VerifyRefundResponse, error)
+}
+
+// NewPaymentProvider returns the provider selected by PAYMENT_PROVIDER.
+func NewPaymentProvider(cfg *config.Config) PaymentProvider {
+	switch cfg.PaymentProvider {
+	case "mock":
+		log.Println("WARNING: using the mock payment provider; no real payments are taken")
+		return NewMockPaymentProvider(cfg)
+	case "", "chapa":
+		return NewChapaService(cfg)
+	default:
+		log.Fatalf("Unknown PAYMENT_PROVIDER %q", cfg.PaymentProvider)
+		return nil
+	}
+}
+
+// ErrPaymentNotFound means the provider has no record of a payment, as for
+// a checkout that was never opened.
+var ErrPaymentNotFound = errors.New("payment not found at provider")
+
+// ErrRefundRejected means the provider refused a refund outright, so no
+// money was returned.
+var ErrRefundRejected = errors.New("refund rejected by provider")
+
+// ErrRefundNotFound means the provider has no record of a refund.
+var ErrRefundNotFound = errors.New("refund not found at provider")
+
+// ErrTransferRejected means the provider refused a transfer outright, so no
+// money was sent.
+var ErrTransferRejected = errors.New("transfer rejected by provider")
+
+// ErrTransferNotFound means the provider has no record of a transfer.
+var ErrTransferNotFound = errors.New("transfer not found at provider")
+
+// TransferProvider sends payouts to creators. Transfers are asynchronous:
+// Transfer only queues one and VerifyTransfer reports how it ended.
+type TransferProvider interface {
+	Transfer(req TransferRequest) (*TransferResponse, error)
+	VerifyTransfer(reference string) (*VerifyTransferResponse, error)
+}
+
+// NewTransferProvider returns the transfer provider matching PAYMENT_PROVIDER.
+func NewTransferProvider(cfg *config.Config) TransferProvider {
+	if cfg.PaymentProvider == "mock" {
+		return NewMockTransferProvider()
+	}
+	return NewChapaService(cfg)
+}
@@ -0,0 +1,357 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"recipe-backend/internal/config"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrPayoutNotFound        = errors.New("payout not found")
+	ErrPayoutAccountNotFound = errors.New("payout account not found")
+	ErrPayoutBelowMinimum    = errors.New("payout amount is below the minimum")
+	ErrInsufficientBalance   = errors.New("payout amount exceeds the available balance")
+	ErrPayoutInProgress      = errors.New("another payout is still being processed")
+	ErrPayoutNotRequested    = errors.New("payout is no longer awaiting review")
+)
+
+// How long a transfer the provider has no record of may stay processing
+// before it is treated as failed
+const unknownTransferTimeout = time.Hour
+
+// Processing payouts are verified this many at a time
+const payoutBatchSize = 100
+
+// PayoutService pays creators their earnings. A creator requests a payout
+// to one of their payout accounts, which reserves the amount from their
+// balance. An admin approves the request, which queues a transfer with the
+// provider, or rejects it, which returns the amount. Transfers in progress
+// are verified in the background until they complete or fail.
+type PayoutService struct {
+	config        *config.Config
+	provider      TransferProvider
+	ledgerService *LedgerService
+	hasuraService *HasuraService
+}
+
+func NewPayoutService(cfg *config.Config, provider TransferProvider, ledgerService *LedgerService, hasuraService *HasuraService) *PayoutService {
+	return &PayoutService{
+		config:        cfg,
+		provider:      provider,
+		ledgerService: ledgerService,
+		hasuraService: hasuraService,
+	}
+}
+
+// RequestPayout asks for amount to be paid to one of the user's payout
+// accounts. An amount of zero requests the whole available balance.
+func (s *PayoutService) RequestPayout(ctx context.Context, userID, accountID string, amount float64) (*Payout, error) {
+	account, err := s.hasuraService.GetPayoutAccount(ctx, accountID)
+	if err != nil {
+		return nil, err
+	}
+	if account == nil || account.UserID != userID {
+		return nil, ErrPayoutAccountNotFound
+	}
+
+	open, err := s.hasuraService.GetOpenPayout(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if open != nil {
+		return nil, ErrPayoutInProgress
+	}
+
+	available, _, err := s.hasuraService.GetAccountBalance(ctx, userID, AccountCreatorEarnings, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	available = roundMoney(available)
+
+	amount = roundMoney(amount)
+	if amount == 0 {
+		amount = available
+	}
+	if amount < s.config.PayoutMinimum || amount <= 0 {
+		return nil, ErrPayoutBelowMinimum
+	}
+	if amount > available {
+		return nil, ErrInsufficientBalance
+	}
+
+	payout := &Payout{
+		ID:              uuid.New().String(),
+		UserID:          userID,
+		PayoutAccountID: account.ID,
+		Amount:          amount,
+		Currency:        LedgerCurrency,
+		Status:          PayoutRequested,
+		Method:          account.Method,
+		BankCode:        account.BankCode,
+		BankName:        account.BankName,
+		AccountName:     account.AccountName,
+		AccountNumber:   account.AccountNumber,
+	}
+
+	created, err := s.hasuraService.CreatePayout(ctx, payout, s.ledgerService.PayoutEntries(payout))
+	if err != nil {
+		// Only one payout per creator may be open at a time
+		if strings.Contains(err.Error(), "idx_payouts_open_user") {
+			return nil, ErrPayoutInProgress
+		}
+		return nil, err
+	}
+
+	return created, nil
+}
+
+// Approve queues the transfer for a requested payout. A transfer the
+// provider refuses fails the payout and returns the amount to the creator.
+func (s *PayoutService) Approve(ctx context.Context, payoutID, adminID string) (*Payout, error) {
+	payout, err := s.claim(ctx, payoutID, adminID, PayoutProcessing, "")
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = s.provider.Transfer(TransferRequest{
+		AccountName:   payout.AccountName,
+		AccountNumber: payout.AccountNumber,
+		Amount:        fmt.Sprintf("%.2f", payout.Amount),
+		Currency:      payout.Currency,
+		Reference:     payout.ID,
+		BankCode:      payout.BankCode,
+	})
+	if errors.Is(err, ErrTransferRejected) {
+		return s.fail(ctx, payout, err.Error())
+	}
+	if err != nil {
+		// The transfer may or may not have been queued; verification will
+		// find out
+		log.Printf("Transfer for payout %s did not confirm: %v", payout.ID, err)
+	}
+
+	return payout, nil
+}
+
+// Reject declines a requested payout and returns its amount to the creator.
+func (s *PayoutService) Reject(ctx context.Context, payoutID, adminID, reason string) (*Payout, error) {
+	return s.claim(ctx, payoutID, adminID, PayoutRejected, reason)
+}
+
+// claim moves a requested payout to its review outcome, so two admins
+// cannot act on the same request. A rejected payout's amount is returned to
+// the creator in the same transaction.
+func (s *PayoutService) claim(ctx context.Context, payoutID, adminID, status, reason string) (*Payout, error) {
+	payout, err := s.hasuraService.GetPayout(ctx, payoutID)
+	if err != nil {
+		return nil, err
+	}
+	if payout == nil {
+		return nil, ErrPayoutNotFound
+	}
+
+	now := time.Now().UTC().Format(time.RFC3339Nano)
+	changes := map[string]interface{}{
+		"status":      status,
+		"reviewed_by": adminID,
+		"reviewed_at": now,
+	}
+	if reason != "" {
+		changes["failure_reason"] = reason
+	}
+
+	reviewed := *payout
+	reviewed.Status = status
+	reviewed.ReviewedBy = adminID
+	reviewed.ReviewedAt = now
+	reviewed.FailureReason = reason
+
+	var entries []LedgerEntryInput
+	if status == PayoutRejected {
+		entries = s.ledgerService.PayoutReturnedEntries(&reviewed)
+	}
+
+	claimed, err := s.transition(ctx, payout, PayoutRequested, changes, entries)
+	if err != nil {
+		return nil, err
+	}
+	if !claimed {
+		return nil, ErrPayoutNotRequested
+	}
+
+	return &reviewed, nil
+}
+
+// Verify asks the provider how a processing payout's transfer ended and
+// records the outcome.
+func (s *PayoutService) Verify(ctx context.Context, payout *Payout) (*Payout, error) {
+	if payout.Status != PayoutProcessing {
+		return payout, nil
+	}
+
+	response, err := s.provider.VerifyTransfer(payout.ID)
+	if err != nil {
+		// A transfer that was never queued is unknown to the provider. Any
+		// other error says nothing about the transfer, which may have been
+		// paid, so the payout stays processing and is verified again.
+		reviewedAt, parseErr := time.Parse(time.RFC3339Nano, payout.ReviewedAt)
+		if errors.Is(err, ErrTransferNotFound) && parseErr == nil && time.Since(reviewedAt) > unknownTransferTimeout {
+			return s.fail(ctx, payout, "transfer not found at provider")
+		}
+		return nil, fmt.Errorf("failed to verify transfer: %w", err)
+	}
+
+	switch strings.ToLower(response.Data.Status) {
+	case "success", "successful", "completed":
+		changes := map[string]interface{}{"status": PayoutCompleted}
+		if response.Data.ChapaTransferID != "" {
+			changes["provider_reference"] = response.Data.ChapaTransferID
+		}
+
+		completed := *payout
+		completed.Status = PayoutCompleted
+		completed.ProviderReference = response.Data.ChapaTransferID
+
+		updated, err := s.transition(ctx, payout, PayoutProcessing, changes, s.ledgerService.PayoutPaidEntries(&completed))
+		if err != nil {
+			return nil, err
+		}
+		if updated {
+			*payout = completed
+		}
+	case "failed", "failure", "cancelled", "reversed":
+		return s.fail(ctx, payout, "transfer "+strings.ToLower(response.Data.Status))
+	}
+
+	return payout, nil
+}
+
+// fail marks a processing payout failed and returns its amount to the
+// creator.
+func (s *PayoutService) fail(ctx context.Context, payout *Payout, reason string) (*Payout, error) {
+	failed := *payout
+	failed.Status = PayoutFailed
+	failed.FailureReason = reason
+
+	updated, err := s.transition(ctx, payout, PayoutProcessing, map[string]interface{}{
+		"status":         PayoutFailed,
+		"failure_reason": reason,
+	}, s.ledgerService.PayoutReturnedEntries(&failed))
+	if err != nil {
+		return nil, err
+	}
+	if !updated {
+		return payout, nil
+	}
+
+	*payout = failed
+	return payout, nil
+}
+
+// transition moves a payout on from a status together with the journal
+// recording the move, and reports whether it did. When the journal is
+// rejected because the payout left that status in the meantime, nothing is
+// recorded and the move is reported as not made.
+func (s *PayoutService) transition(ctx context.Context, payout *Payout, from string, changes map[string]interface{}, entries []LedgerEntryInput) (bool, error) {
+	updated, err := s.hasuraService.TransitionPayout(ctx, payout.ID, from, changes, entries)
+	if err == nil {
+		return updated, nil
+	}
+
+	current, getErr := s.hasuraService.GetPayout(ctx, payout.ID)
+	if getErr == nil && current != nil && current.Status != from {
+		return false, nil
+	}
+	return false, err
+}
+
+type PayoutVerifyReport struct {
+	Checked   int      `json:"checked"`
+	Completed int      `json:"completed"`
+	Failed    int      `json:"failed"`
+	Pending   int      `json:"pending"`
+	Errors    []string `json:"errors,omitempty"`
+}
+
+// VerifyProcessing verifies every payout whose transfer is in progress.
+func (s *PayoutService) VerifyProcessing(ctx context.Context) (*PayoutVerifyReport, error) {
+	report := &PayoutVerifyReport{}
+
+	// Payouts still processing after verification stay in the list, so
+	// pages are read by (created_at, id) rather than by offset
+	after, afterID := "", ""
+
+	for {
+		payouts, err := s.hasuraService.ListProcessingPayouts(ctx, after, afterID, payoutBatchSize)
+		if err != nil {
+			return report, err
+		}
+
+		for i := range payouts {
+			if report.Checked > 0 {
+				if err := sleepContext(ctx, time.Second); err != nil {
+					return report, err
+				}
+			}
+
+			report.Checked++
+			after, afterID = payouts[i].CreatedAt, payouts[i].ID
+			payout, err := s.Verify(ctx, &payouts[i])
+			if err != nil {
+				report.Errors = append(report.Errors, fmt.Sprintf("%s: %v", payouts[i].ID, err))
+				continue
+			}
+
+			switch payout.Status {
+			case PayoutCompleted:
+				report.Completed++
+			case PayoutFailed:
+				report.Failed++
+			default:
+				report.Pending++
+			}
+		}
+
+		if len(payouts) < payoutBatchSize {
+			break
+		}
+	}
+
+	return report, nil
+}
+
+// Start verifies processing payouts on the configured interval until ctx is
+// done.
+func (s *PayoutService) Start(ctx context.Context) {
+	if s.config.PayoutVerifyInterval <= 0 {
+		log.Println("Payout verification disabled")
+		return
+	}
+
+	ticker := time.NewTicker(s.config.PayoutVerifyInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			report, err := s.VerifyProcessing(ctx)
+			if err != nil {
+				log.Printf("Payout verification failed: %v", err)
+				continue
+			}
+			if report.Checked > 0 {
+				log.Printf("Payout verification: checked=%d completed=%d failed=%d pending=%d errors=%d",
+					report.Checked, report.Completed, report.Failed, report.Pending, len(report.Errors))
+			}
+		}
+	}
+}
@@ -0,0 +1,255 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"recipe-backend/internal/config"
+)
+
+// stubTransferProvider answers every verification with the same result.
+type stubTransferProvider struct {
+	status string
+	err    error
+}
+
+func (p *stubTransferProvider) Transfer(req TransferRequest) (*TransferResponse, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (p *stubTransferProvider) VerifyTransfer(reference string) (*VerifyTransferResponse, error) {
+	if p.err != nil {
+		return nil, p.err
+	}
+
+	var response VerifyTransferResponse
+	response.Data.Status = p.status
+	return &response, nil
+}
+
+func TestPayoutVerify(t *testing.T) {
+	longAgo := time.Now().Add(-2 * unknownTransferTimeout).UTC().Format(time.RFC3339Nano)
+	recently := time.Now().UTC().Format(time.RFC3339Nano)
+
+	tests := []struct {
+		name       string
+		provider   *stubTransferProvider
+		reviewedAt string
+		want       string
+		wantErr    bool
+	}{
+		{name: "paid", provider: &stubTransferProvider{status: "success"}, reviewedAt: recently, want: PayoutCompleted},
+		{name: "failed", provider: &stubTransferProvider{status: "failed"}, reviewedAt: recently, want: PayoutFailed},
+		{name: "still queued", provider: &stubTransferProvider{status: "pending"}, reviewedAt: longAgo, want: PayoutProcessing},
+		{name: "not found yet", provider: &stubTransferProvider{err: ErrTransferNotFound}, reviewedAt: recently, wantErr: true},
+		{name: "not found after timeout", provider: &stubTransferProvider{err: fmt.Errorf("%w: p1", ErrTransferNotFound)}, reviewedAt: longAgo, want: PayoutFailed},
+		{name: "network error after timeout", provider: &stubTransferProvider{err: errors.New("dial tcp: connection refused")}, reviewedAt: longAgo, wantErr: true},
+		{name: "server error after timeout", provider: &stubTransferProvider{err: errors.New("chapa API error: internal server error")}, reviewedAt: longAgo, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var journals int
+			hasura := newFakeHasura(t, func(query string, variables map[string]interface{}) interface{} {
+				if !strings.Contains(query, "update_payouts") {
+					t.Errorf("unexpected query %s", query)
+					return nil
+				}
+				if !strings.Contains(query, "insert_ledger_entries") {
+					t.Errorf("payout status changed without its journal: %s", query)
+				}
+				if entries, _ := variables["entries"].([]interface{}); len(entries) > 0 {
+					journals++
+				}
+				return map[string]interface{}{
+					"update_payouts":        map[string]interface{}{"affected_rows": 1},
+					"insert_ledger_entries": map[string]interface{}{"affected_rows": 2},
+				}
+			})
+
+			cfg := &config.Config{PlatformCommission: 15}
+			s := NewPayoutService(cfg, tt.provider, NewLedgerService(cfg, hasura), hasura)
+
+			payout := &Payout{ID: "p1", UserID: "chef-1", Amount: 500, Status: PayoutProcessing, ReviewedAt: tt.reviewedAt}
+			got, err := s.Verify(context.Background(), payout)
+
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("Verify() = %s, want an error so the payout is verified again", got.Status)
+				}
+				if payout.Status != PayoutProcessing || journals != 0 {
+					t.Errorf("payout became %s with %d journals, want it left processing", payout.Status, journals)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Verify() = %v", err)
+			}
+			if got.Status != tt.want {
+				t.Errorf("status = %s, want %s", got.Status, tt.want)
+			}
+			if tt.want != PayoutProcessing && journals != 1 {
+				t.Errorf("recorded %d journals, want 1", journals)
+			}
+		})
+	}
+}
+
+func TestPayoutReject(t *testing.T) {
+	var mutations int
+	hasura := newFakeHasura(t, func(query string, variables map[string]interface{}) interface{} {
+		switch {
+		case strings.Contains(query, "payouts_by_pk"):
+			return map[string]interface{}{"payouts_by_pk": map[string]interface{}{
+				"id": "p1", "user_id": "chef-1", "amount": 500, "currency": LedgerCurrency, "status": PayoutRequested,
+			}}
+		case strings.Contains(query, "update_payouts"):
+			mutations++
+			changes := variables["changes"].(map[string]interface{})
+			entries, _ := variables["entries"].([]interface{})
+			if changes["status"] != PayoutRejected || len(entries) != 2 {
+				t.Errorf("rejected with changes %v and %d journal lines, want status %s and 2 lines", changes, len(entries), PayoutRejected)
+			}
+			return map[string]interface{}{
+				"update_payouts":        map[string]interface{}{"affected_rows": 1},
+				"insert_ledger_entries": map[string]interface{}{"affected_rows": 2},
+			}
+		}
+		t.Errorf("unexpected query %s", query)
+		return nil
+	})
+
+	cfg := &config.Config{PlatformCommission: 15}
+	s := NewPayoutService(cfg, &stubTransferProvider{}, NewLedgerService(cfg, hasura), hasura)
+
+	payout, err := s.Reject(context.Background(), "p1", "admin-1", "wrong account")
+	if err != nil {
+		t.Fatalf("Reject() = %v", err)
+	}
+	if payout.Status != PayoutRejected || payout.FailureReason != "wrong account" {
+		t.Errorf("payout = %s %q, want %s %q", payout.Status, payout.FailureReason, PayoutRejected, "wrong account")
+	}
+	if mutations != 1 {
+		t.Errorf("sent %d mutations, want the status and journal in 1", mutations)
+	}
+}
+
+// Only a transfer Chapa refuses with a client error fails the payout. After
+// a server or gateway error the transfer may have been queued, so the payout
+// stays processing for verification to settle.
+func TestPayoutApproveTransferErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		want   string
+	}{
+		{name: "queued", status: http.StatusOK, body: `{"status": "success", "message": "Transfer Queued Successfully"}`, want: PayoutProcessing},
+		{name: "refused", status: http.StatusBadRequest, body: `{"status": "failed", "message": "Insufficient Balance"}`, want: PayoutFailed},
+		{name: "server error", status: http.StatusInternalServerError, body: `{"status": "failed", "message": "Something went wrong"}`, want: PayoutProcessing},
+		{name: "gateway error", status: http.StatusBadGateway, body: `<html>502 Bad Gateway</html>`, want: PayoutProcessing},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			var statuses []string
+			hasura := newFakeHasura(t, func(query string, variables map[string]interface{}) interface{} {
+				switch {
+				case strings.Contains(query, "payouts_by_pk"):
+					return map[string]interface{}{"payouts_by_pk": map[string]interface{}{
+						"id": "p1", "user_id": "chef-1", "amount": 500, "currency": LedgerCurrency, "status": PayoutRequested,
+					}}
+				case strings.Contains(query, "update_payouts"):
+					statuses = append(statuses, variables["changes"].(map[string]interface{})["status"].(string))
+					return map[string]interface{}{
+						"update_payouts":        map[string]interface{}{"affected_rows": 1},
+						"insert_ledger_entries": map[string]interface{}{"affected_rows": 2},
+					}
+				}
+				t.Errorf("unexpected query %s", query)
+				return nil
+			})
+
+			cfg := &config.Config{PlatformCommission: 15, ChapaBaseURL: server.URL}
+			s := NewPayoutService(cfg, NewChapaService(cfg), NewLedgerService(cfg, hasura), hasura)
+
+			payout, err := s.Approve(context.Background(), "p1", "admin-1")
+			if err != nil {
+				t.Fatalf("Approve() = %v", err)
+			}
+			if payout.Status != tt.want || statuses[len(statuses)-1] != tt.want {
+				t.Errorf("payout = %s after %v, want %s", payout.Status, statuses, tt.want)
+			}
+		})
+	}
+}
+
+// A payout completed by another check while this one fails it keeps its
+// status, and the rejected journal is not an error.
+func TestPayoutVerifyLosesRace(t *testing.T) {
+	hasura := newFakeHasura(t, func(query string, variables map[string]interface{}) interface{} {
+		switch {
+		case strings.Contains(query, "update_payouts"):
+			return errors.New("payout p1 was not rejected or failed")
+		case strings.Contains(query, "payouts_by_pk"):
+			return map[string]interface{}{"payouts_by_pk": map[string]interface{}{
+				"id": "p1", "user_id": "chef-1", "amount": 500, "status": PayoutCompleted,
+			}}
+		}
+		t.Errorf("unexpected query %s", query)
+		return nil
+	})
+
+	cfg := &config.Config{PlatformCommission: 15}
+	s := NewPayoutService(cfg, &stubTransferProvider{status: "failed"}, NewLedgerService(cfg, hasura), hasura)
+
+	payout := &Payout{ID: "p1", UserID: "chef-1", Amount: 500, Status: PayoutProcessing}
+	got, err := s.Verify(context.Background(), payout)
+	if err != nil {
+		t.Fatalf("Verify() = %v", err)
+	}
+	if got.Status != PayoutProcessing {
+		t.Errorf("status = %s, want the payout left as this check found it", got.Status)
+	}
+}
+
+// A journal that fails for any other reason leaves the payout unchanged
+// and is reported, so the payout is verified again.
+func TestPayoutVerifyJournalFails(t *testing.T) {
+	hasura := newFakeHasura(t, func(query string, variables map[string]interface{}) interface{} {
+		switch {
+		case strings.Contains(query, "update_payouts"):
+			return errors.New("database unavailable")
+		case strings.Contains(query, "payouts_by_pk"):
+			return map[string]interface{}{"payouts_by_pk": map[string]interface{}{
+				"id": "p1", "user_id": "chef-1", "amount": 500, "status": PayoutProcessing,
+			}}
+		}
+		t.Errorf("unexpected query %s", query)
+		return nil
+	})
+
+	cfg := &config.Config{PlatformCommission: 15}
+	s := NewPayoutService(cfg, &stubTransferProvider{status: "success"}, NewLedgerService(cfg, hasura), hasura)
+
+	payout := &Payout{ID: "p1", UserID: "chef-1", Amount: 500, Status: PayoutProcessing}
+	if _, err := s.Verify(context.Background(), payout); err == nil {
+		t.Fatal("Verify() succeeded, want the failed journal reported")
+	}
+	if payout.Status != PayoutProcessing {
+		t.Errorf("status = %s, want %s", payout.Status, PayoutProcessing)
+	}
+}
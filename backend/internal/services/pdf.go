@@ -0,0 +1,248 @@
+package services
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"sort"
+	"strings"
+	"unicode/utf16"
+)
+
+// A4 in PDF points
+const (
+	pdfPageWidth  = 595.28
+	pdfPageHeight = 841.89
+)
+
+// pdfPage collects the drawing operations of a single-page PDF document
+// using the standard Helvetica and Courier fonts, which every viewer has.
+// Text is WinAnsi-encoded. Characters outside Latin-1, such as Amharic, are
+// set in the embedded Unicode font, which is only added to documents that
+// need it and then only with the glyphs they use. Characters that font
+// lacks too are printed as "?".
+type pdfPage struct {
+	content bytes.Buffer
+
+	// Glyphs used from the Unicode font and the character each one draws
+	glyphs map[uint16]rune
+}
+
+// Fonts as named in the page resources
+const (
+	pdfFontRegular = "F1"
+	pdfFontBold    = "F2"
+	pdfFontMono    = "F3"
+	pdfFontUnicode = "F4"
+)
+
+// Text draws a line of text with its baseline starting at x, y, measured
+// from the bottom left corner of the page. Runs of characters outside
+// Latin-1 switch to the Unicode font; the viewer moves the pen past each
+// run, so they need not be measured.
+func (p *pdfPage) Text(x, y float64, font string, size float64, text string) {
+	fmt.Fprintf(&p.content, "BT /%s %.1f Tf %.2f %.2f Td ", font, size, x, y)
+
+	unicode := unicodeFont()
+	var latin, glyphs strings.Builder
+	flush := func() {
+		if latin.Len() > 0 {
+			fmt.Fprintf(&p.content, "(%s) Tj ", pdfString(latin.String()))
+			latin.Reset()
+		}
+		if glyphs.Len() > 0 {
+			fmt.Fprintf(&p.content, "/%s %.1f Tf <%s> Tj /%s %.1f Tf ", pdfFontUnicode, size, glyphs.String(), font, size)
+			glyphs.Reset()
+		}
+	}
+
+	for _, r := range text {
+		if pdfLatin(r) || unicode == nil {
+			if glyphs.Len() > 0 {
+				flush()
+			}
+			latin.WriteRune(r)
+			continue
+		}
+
+		glyph, ok := unicode.Glyph(r)
+		if !ok {
+			if glyphs.Len() > 0 {
+				flush()
+			}
+			latin.WriteRune('?')
+			continue
+		}
+
+		if latin.Len() > 0 {
+			flush()
+		}
+		if p.glyphs == nil {
+			p.glyphs = make(map[uint16]rune)
+		}
+		p.glyphs[glyph] = r
+		fmt.Fprintf(&glyphs, "%04X", glyph)
+	}
+	flush()
+
+	p.content.WriteString("ET\n")
+}
+
+// MonoRight draws text in the monospaced font so that it ends at x.
+func (p *pdfPage) MonoRight(x, y, size float64, text string) {
+	// Courier glyphs are all 600/1000 em wide
+	width := float64(len([]rune(text))) * size * 0.6
+	p.Text(x-width, y, pdfFontMono, size, text)
+}
+
+// Line draws a thin horizontal rule.
+func (p *pdfPage) Line(x1, x2, y float64) {
+	fmt.Fprintf(&p.content, "0.5 w %.2f %.2f m %.2f %.2f l S\n", x1, y, x2, y)
+}
+
+// Bytes returns the complete PDF file.
+func (p *pdfPage) Bytes() []byte {
+	fonts := fmt.Sprintf("/%s 5 0 R /%s 6 0 R /%s 7 0 R", pdfFontRegular, pdfFontBold, pdfFontMono)
+	unicode := p.unicodeFontObjects(8)
+	if unicode != nil {
+		fonts += fmt.Sprintf(" /%s 8 0 R", pdfFontUnicode)
+	}
+
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.2f %.2f] "+
+			"/Resources << /Font << %s >> >> /Contents 4 0 R >>",
+			pdfPageWidth, pdfPageHeight, fonts),
+		fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", p.content.Len(), p.content.String()),
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>",
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>",
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Courier /Encoding /WinAnsiEncoding >>",
+	}
+	objects = append(objects, unicode...)
+
+	var out bytes.Buffer
+	out.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+
+	offsets := make([]int, len(objects))
+	for i, object := range objects {
+		offsets[i] = out.Len()
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", i+1, object)
+	}
+
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+
+	return out.Bytes()
+}
+
+// unicodeFontObjects returns the objects embedding the glyphs the page uses
+// from the Unicode font, numbered from first: the font, its descendant, its
+// descriptor, the subset font program and the map back to Unicode that lets
+// viewers copy and search the text. It returns nil when the page uses none.
+func (p *pdfPage) unicodeFontObjects(first int) []string {
+	font := unicodeFont()
+	if len(p.glyphs) == 0 || font == nil {
+		return nil
+	}
+
+	glyphs := make([]uint16, 0, len(p.glyphs))
+	for glyph := range p.glyphs {
+		glyphs = append(glyphs, glyph)
+	}
+	sort.Slice(glyphs, func(i, j int) bool { return glyphs[i] < glyphs[j] })
+
+	program, err := font.Subset(glyphs)
+	if err != nil {
+		log.Printf("Failed to subset font %s: %v", font.name, err)
+		return nil
+	}
+
+	var compressed bytes.Buffer
+	zw := zlib.NewWriter(&compressed)
+	zw.Write(program)
+	zw.Close()
+
+	// Subsets are named with a tag unique to their glyphs
+	hash := fnv.New32a()
+	var widths, toUnicode strings.Builder
+	for i, glyph := range glyphs {
+		fmt.Fprintf(hash, "%d,", glyph)
+		fmt.Fprintf(&widths, "%d [%d] ", glyph, font.Advance(glyph))
+
+		if i%100 == 0 {
+			if i > 0 {
+				toUnicode.WriteString("endbfchar\n")
+			}
+			fmt.Fprintf(&toUnicode, "%d beginbfchar\n", min(100, len(glyphs)-i))
+		}
+		fmt.Fprintf(&toUnicode, "<%04X> <", glyph)
+		for _, unit := range utf16.Encode([]rune{p.glyphs[glyph]}) {
+			fmt.Fprintf(&toUnicode, "%04X", unit)
+		}
+		toUnicode.WriteString(">\n")
+	}
+	toUnicode.WriteString("endbfchar\n")
+
+	sum := hash.Sum32()
+	tag := make([]byte, 6)
+	for i := range tag {
+		tag[i] = byte('A' + sum%26)
+		sum /= 26
+	}
+	name := string(tag) + "+" + font.name
+
+	cmap := "/CIDInit /ProcSet findresource begin\n12 dict begin\nbegincmap\n" +
+		"/CIDSystemInfo << /Registry (Adobe) /Ordering (UCS) /Supplement 0 >> def\n" +
+		"/CMapName /Adobe-Identity-UCS def\n/CMapType 2 def\n" +
+		"1 begincodespacerange\n<0000> <FFFF>\nendcodespacerange\n" +
+		toUnicode.String() +
+		"endcmap\nCMapName currentdict /CMap defineresource pop\nend\nend\n"
+
+	box := font.BBox()
+	return []string{
+		fmt.Sprintf("<< /Type /Font /Subtype /Type0 /BaseFont /%s /Encoding /Identity-H "+
+			"/DescendantFonts [%d 0 R] /ToUnicode %d 0 R >>", name, first+1, first+4),
+		fmt.Sprintf("<< /Type /Font /Subtype /CIDFontType2 /BaseFont /%s "+
+			"/CIDSystemInfo << /Registry (Adobe) /Ordering (Identity) /Supplement 0 >> "+
+			"/FontDescriptor %d 0 R /CIDToGIDMap /Identity /W [%s] >>", name, first+2, strings.TrimSpace(widths.String())),
+		fmt.Sprintf("<< /Type /FontDescriptor /FontName /%s /Flags 4 /FontBBox [%d %d %d %d] "+
+			"/ItalicAngle 0 /Ascent %d /Descent %d /CapHeight %d /StemV 80 /FontFile2 %d 0 R >>",
+			name, box[0], box[1], box[2], box[3], font.Ascent(), font.Descent(), font.Ascent(), first+3),
+		fmt.Sprintf("<< /Length %d /Length1 %d /Filter /FlateDecode >>\nstream\n%s\nendstream",
+			compressed.Len(), len(program), compressed.String()),
+		fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", len(cmap), cmap),
+	}
+}
+
+// pdfLatin reports whether pdfString can encode r.
+func pdfLatin(r rune) bool {
+	return (r >= 0x20 && r < 0x7f) || (r >= 0xa0 && r <= 0xff) || r == '\n' || r == '\r' || r == '\t'
+}
+
+// pdfString encodes text for a PDF string literal.
+func pdfString(text string) string {
+	var b strings.Builder
+	for _, r := range text {
+		switch {
+		case r == '\\' || r == '(' || r == ')':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r == '\n' || r == '\r' || r == '\t':
+			b.WriteByte(' ')
+		case r >= 0x20 && r < 0x7f:
+			b.WriteRune(r)
+		case r >= 0xa0 && r <= 0xff:
+			fmt.Fprintf(&b, "\\%03o", r)
+		default:
+			b.WriteByte('?')
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,343 @@
+package services
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"golang.org/x/image/font/sfnt"
+)
+
+// FreeSerif covers Ethiopic, so Amharic names and titles can be printed on
+// invoices. See fonts/README.md for its license.
+//
+//go:embed fonts/FreeSerif.ttf
+var freeSerif []byte
+
+// unicodeFont returns the font that text outside Latin-1 is set in, or nil
+// when it cannot be read.
+var unicodeFont = sync.OnceValue(func() *trueTypeFont {
+	font, err := parseTrueType("FreeSerif", freeSerif)
+	if err != nil {
+		return nil
+	}
+	return font
+})
+
+// trueTypeFont is a TrueType font that PDFs embed subset to the glyphs they
+// use. Glyphs keep their IDs in the subset, so text can address them
+// directly.
+type trueTypeFont struct {
+	name       string
+	cmap       *sfnt.Font
+	tables     map[string][]byte
+	numGlyphs  int
+	unitsPerEm int
+	longLoca   bool
+}
+
+// Tables a PDF viewer needs to render an embedded TrueType font. The cmap
+// is not used through Identity-H, but keeps the subset a valid font.
+var trueTypeSubsetTables = []string{"cmap", "cvt ", "fpgm", "glyf", "head", "hhea", "hmtx", "loca", "maxp", "post", "prep"}
+
+func parseTrueType(name string, data []byte) (*trueTypeFont, error) {
+	cmap, err := sfnt.Parse(data)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) < 12 {
+		return nil, errors.New("truncated font")
+	}
+	numTables := int(binary.BigEndian.Uint16(data[4:]))
+	if len(data) < 12+16*numTables {
+		return nil, errors.New("truncated table directory")
+	}
+
+	tables := make(map[string][]byte, numTables)
+	for i := 0; i < numTables; i++ {
+		record := data[12+16*i:]
+		offset := int(binary.BigEndian.Uint32(record[8:]))
+		length := int(binary.BigEndian.Uint32(record[12:]))
+		if offset < 0 || length < 0 || offset+length > len(data) {
+			return nil, fmt.Errorf("table %q out of bounds", record[:4])
+		}
+		tables[string(record[:4])] = data[offset : offset+length]
+	}
+
+	for _, tag := range []string{"glyf", "head", "hhea", "hmtx", "loca", "maxp"} {
+		if tables[tag] == nil {
+			return nil, fmt.Errorf("font has no %q table", tag)
+		}
+	}
+	if len(tables["head"]) < 54 || len(tables["hhea"]) < 36 || len(tables["maxp"]) < 6 {
+		return nil, errors.New("truncated font header")
+	}
+
+	font := &trueTypeFont{
+		name:       name,
+		cmap:       cmap,
+		tables:     tables,
+		numGlyphs:  int(binary.BigEndian.Uint16(tables["maxp"][4:])),
+		unitsPerEm: int(binary.BigEndian.Uint16(tables["head"][18:])),
+		longLoca:   binary.BigEndian.Uint16(tables["head"][50:]) == 1,
+	}
+
+	locaEntry := 2
+	if font.longLoca {
+		locaEntry = 4
+	}
+	if font.unitsPerEm == 0 || len(tables["loca"]) < (font.numGlyphs+1)*locaEntry {
+		return nil, errors.New("invalid font header")
+	}
+
+	return font, nil
+}
+
+// Glyph returns the glyph that draws r, or false when the font has none.
+func (f *trueTypeFont) Glyph(r rune) (uint16, bool) {
+	glyph, err := f.cmap.GlyphIndex(nil, r)
+	if err != nil || glyph == 0 {
+		return 0, false
+	}
+	return uint16(glyph), true
+}
+
+// Advance returns how far a glyph moves the pen, in thousandths of an em.
+func (f *trueTypeFont) Advance(glyph uint16) int {
+	hmtx := f.tables["hmtx"]
+	metrics := int(binary.BigEndian.Uint16(f.tables["hhea"][34:]))
+	if metrics == 0 {
+		return 0
+	}
+	if int(glyph) >= metrics {
+		glyph = uint16(metrics - 1)
+	}
+	if 4*int(glyph)+2 > len(hmtx) {
+		return 0
+	}
+	return f.scale(int(binary.BigEndian.Uint16(hmtx[4*int(glyph):])))
+}
+
+// BBox returns the bounding box of all glyphs, in thousandths of an em.
+func (f *trueTypeFont) BBox() [4]int {
+	head := f.tables["head"]
+	var box [4]int
+	for i := range box {
+		box[i] = f.scale(int(int16(binary.BigEndian.Uint16(head[36+2*i:]))))
+	}
+	return box
+}
+
+// Ascent and Descent are the font's extent above and below the baseline,
+// in thousandths of an em.
+func (f *trueTypeFont) Ascent() int {
+	return f.scale(int(int16(binary.BigEndian.Uint16(f.tables["hhea"][4:]))))
+}
+
+func (f *trueTypeFont) Descent() int {
+	return f.scale(int(int16(binary.BigEndian.Uint16(f.tables["hhea"][6:]))))
+}
+
+func (f *trueTypeFont) scale(units int) int {
+	return units * 1000 / f.unitsPerEm
+}
+
+// Subset returns a copy of the font in which only the given glyphs, the
+// glyphs they are composed of and the .notdef glyph have outlines. Every
+// other glyph is left empty, so glyph IDs stay the same.
+func (f *trueTypeFont) Subset(glyphs []uint16) ([]byte, error) {
+	keep := map[uint16]bool{0: true}
+	pending := append([]uint16{0}, glyphs...)
+	for len(pending) > 0 {
+		glyph := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+
+		data, err := f.glyphData(glyph)
+		if err != nil {
+			return nil, err
+		}
+		keep[glyph] = true
+
+		components, err := glyphComponents(data)
+		if err != nil {
+			return nil, fmt.Errorf("glyph %d: %w", glyph, err)
+		}
+		for _, component := range components {
+			if !keep[component] {
+				pending = append(pending, component)
+			}
+		}
+	}
+
+	var glyf bytes.Buffer
+	loca := make([]byte, 4*(f.numGlyphs+1))
+	for glyph := 0; glyph < f.numGlyphs; glyph++ {
+		binary.BigEndian.PutUint32(loca[4*glyph:], uint32(glyf.Len()))
+		if !keep[uint16(glyph)] {
+			continue
+		}
+
+		data, err := f.glyphData(uint16(glyph))
+		if err != nil {
+			return nil, err
+		}
+		glyf.Write(data)
+		for glyf.Len()%4 != 0 {
+			glyf.WriteByte(0)
+		}
+	}
+	binary.BigEndian.PutUint32(loca[4*f.numGlyphs:], uint32(glyf.Len()))
+
+	// The new loca table has long offsets, and the checksum adjustment is
+	// recomputed below
+	head := append([]byte(nil), f.tables["head"]...)
+	binary.BigEndian.PutUint32(head[8:], 0)
+	binary.BigEndian.PutUint16(head[50:], 1)
+
+	// Version 3 of the post table keeps the header and drops the glyph
+	// names, which are most of its size
+	var post []byte
+	if len(f.tables["post"]) >= 32 {
+		post = append([]byte(nil), f.tables["post"][:32]...)
+		binary.BigEndian.PutUint32(post, 0x00030000)
+	}
+
+	tables := map[string][]byte{
+		"glyf": glyf.Bytes(),
+		"head": head,
+		"loca": loca,
+		"post": post,
+	}
+	var tags []string
+	for _, tag := range trueTypeSubsetTables {
+		if tables[tag] == nil {
+			tables[tag] = f.tables[tag]
+		}
+		if tables[tag] != nil {
+			tags = append(tags, tag)
+		}
+	}
+	sort.Strings(tags)
+
+	var out bytes.Buffer
+	searchRange, entrySelector := 1, 0
+	for searchRange*2 <= len(tags) {
+		searchRange *= 2
+		entrySelector++
+	}
+	binary.Write(&out, binary.BigEndian, []uint16{
+		1, 0, // version 1.0
+		uint16(len(tags)),
+		uint16(searchRange * 16),
+		uint16(entrySelector),
+		uint16((len(tags) - searchRange) * 16),
+	})
+
+	offset := 12 + 16*len(tags)
+	var headOffset int
+	for _, tag := range tags {
+		if tag == "head" {
+			headOffset = offset
+		}
+		out.WriteString(tag)
+		binary.Write(&out, binary.BigEndian, []uint32{
+			trueTypeChecksum(tables[tag]),
+			uint32(offset),
+			uint32(len(tables[tag])),
+		})
+		offset += (len(tables[tag]) + 3) &^ 3
+	}
+	for _, tag := range tags {
+		out.Write(tables[tag])
+		for out.Len()%4 != 0 {
+			out.WriteByte(0)
+		}
+	}
+
+	font := out.Bytes()
+	binary.BigEndian.PutUint32(font[headOffset+8:], 0xB1B0AFBA-trueTypeChecksum(font))
+	return font, nil
+}
+
+// glyphData returns the outline of a glyph, which is empty for glyphs
+// without one, such as spaces.
+func (f *trueTypeFont) glyphData(glyph uint16) ([]byte, error) {
+	if int(glyph) >= f.numGlyphs {
+		return nil, fmt.Errorf("glyph %d out of range", glyph)
+	}
+
+	loca := f.tables["loca"]
+	var start, end int
+	if f.longLoca {
+		start = int(binary.BigEndian.Uint32(loca[4*int(glyph):]))
+		end = int(binary.BigEndian.Uint32(loca[4*int(glyph)+4:]))
+	} else {
+		start = 2 * int(binary.BigEndian.Uint16(loca[2*int(glyph):]))
+		end = 2 * int(binary.BigEndian.Uint16(loca[2*int(glyph)+2:]))
+	}
+
+	glyf := f.tables["glyf"]
+	if start > end || end > len(glyf) {
+		return nil, fmt.Errorf("glyph %d out of bounds", glyph)
+	}
+	return glyf[start:end], nil
+}
+
+// Flags of a composite glyph's components
+const (
+	glyphArgsAreWords     = 0x0001
+	glyphHasScale         = 0x0008
+	glyphMoreComponents   = 0x0020
+	glyphHasXYScale       = 0x0040
+	glyphHasTwoByTwoScale = 0x0080
+)
+
+// glyphComponents returns the glyphs a composite glyph is built from.
+func glyphComponents(data []byte) ([]uint16, error) {
+	if len(data) < 10 || int16(binary.BigEndian.Uint16(data)) >= 0 {
+		return nil, nil
+	}
+
+	var components []uint16
+	for offset := 10; ; {
+		if offset+4 > len(data) {
+			return nil, errors.New("truncated composite glyph")
+		}
+		flags := binary.BigEndian.Uint16(data[offset:])
+		components = append(components, binary.BigEndian.Uint16(data[offset+2:]))
+		offset += 4
+
+		if flags&glyphArgsAreWords != 0 {
+			offset += 4
+		} else {
+			offset += 2
+		}
+		switch {
+		case flags&glyphHasScale != 0:
+			offset += 2
+		case flags&glyphHasXYScale != 0:
+			offset += 4
+		case flags&glyphHasTwoByTwoScale != 0:
+			offset += 8
+		}
+
+		if flags&glyphMoreComponents == 0 {
+			return components, nil
+		}
+	}
+}
+
+func trueTypeChecksum(data []byte) uint32 {
+	var sum uint32
+	for i := 0; i < len(data); i += 4 {
+		var word [4]byte
+		copy(word[:], data[i:])
+		sum += binary.BigEndian.Uint32(word[:])
+	}
+	return sum
+}
@@ -0,0 +1,299 @@
+package services
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"unicode/utf16"
+
+	"golang.org/x/image/font/sfnt"
+)
+
+// parsedPDF is what the tests read back from a generated PDF.
+type parsedPDF struct {
+	objects map[int]string
+}
+
+// parsePDF reads the objects of a PDF through its cross-reference table,
+// failing the test when the table does not point at them.
+func parsePDF(t *testing.T, data []byte) *parsedPDF {
+	t.Helper()
+
+	if !bytes.HasPrefix(data, []byte("%PDF-1.4\n")) || !bytes.HasSuffix(data, []byte("%%EOF\n")) {
+		t.Fatalf("not a PDF file: %q...", data[:min(len(data), 16)])
+	}
+
+	startxref := bytes.LastIndex(data, []byte("startxref\n"))
+	if startxref < 0 {
+		t.Fatal("no startxref")
+	}
+	var xref int
+	if _, err := fmt.Sscan(string(data[startxref+len("startxref\n"):]), &xref); err != nil || !bytes.HasPrefix(data[xref:], []byte("xref\n")) {
+		t.Fatalf("startxref does not point at the xref table: %v", err)
+	}
+
+	lines := strings.Split(string(data[xref:]), "\n")
+	var count int
+	if _, err := fmt.Sscan(strings.TrimPrefix(lines[1], "0 "), &count); err != nil {
+		t.Fatalf("bad xref header %q", lines[1])
+	}
+
+	pdf := &parsedPDF{objects: make(map[int]string)}
+	for i := 1; i < count; i++ {
+		offset, err := strconv.Atoi(lines[2+i][:10])
+		if err != nil {
+			t.Fatalf("bad xref entry %q", lines[2+i])
+		}
+
+		header := strconv.Itoa(i) + " 0 obj\n"
+		if !bytes.HasPrefix(data[offset:], []byte(header)) {
+			t.Fatalf("xref entry %d points at %q", i, data[offset:offset+10])
+		}
+		end := bytes.Index(data[offset:], []byte("\nendobj\n"))
+		pdf.objects[i] = string(data[offset+len(header) : offset+end])
+	}
+
+	return pdf
+}
+
+// stream returns the decoded content of a stream object.
+func (p *parsedPDF) stream(t *testing.T, object int) []byte {
+	t.Helper()
+
+	body := p.objects[object]
+	start := strings.Index(body, "stream\n")
+	if start < 0 {
+		t.Fatalf("object %d is not a stream", object)
+	}
+	var length int
+	if m := regexp.MustCompile(`/Length (\d+)`).FindStringSubmatch(body); m != nil {
+		length, _ = strconv.Atoi(m[1])
+	}
+	data := []byte(body[start+len("stream\n") : start+len("stream\n")+length])
+
+	if strings.Contains(body[:start], "/FlateDecode") {
+		zr, err := zlib.NewReader(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("object %d: %v", object, err)
+		}
+		if data, err = io.ReadAll(zr); err != nil {
+			t.Fatalf("object %d: %v", object, err)
+		}
+	}
+	return data
+}
+
+// fontObjects maps the page's font names to their objects.
+func (p *parsedPDF) fontObjects() map[string]int {
+	fonts := make(map[string]int)
+	for _, m := range regexp.MustCompile(`/(F\d) (\d+) 0 R`).FindAllStringSubmatch(p.objects[3], -1) {
+		fonts[m[1]], _ = strconv.Atoi(m[2])
+	}
+	return fonts
+}
+
+// toUnicode returns how the Type0 font in object maps its glyphs back to
+// text.
+func (p *parsedPDF) toUnicode(t *testing.T, object int) map[string]string {
+	t.Helper()
+
+	m := regexp.MustCompile(`/ToUnicode (\d+) 0 R`).FindStringSubmatch(p.objects[object])
+	if m == nil {
+		t.Fatalf("font %d has no ToUnicode map", object)
+	}
+	cmapObject, _ := strconv.Atoi(m[1])
+
+	mapping := make(map[string]string)
+	for _, m := range regexp.MustCompile(`<([0-9A-F]{4})> <([0-9A-F]+)>`).FindAllStringSubmatch(string(p.stream(t, cmapObject)), -1) {
+		var units []uint16
+		for i := 0; i+4 <= len(m[2]); i += 4 {
+			unit, _ := strconv.ParseUint(m[2][i:i+4], 16, 16)
+			units = append(units, uint16(unit))
+		}
+		mapping[m[1]] = string(utf16.Decode(units))
+	}
+	return mapping
+}
+
+// text returns the lines of text drawn on the page, decoding each string
+// with the font it is shown in.
+func (p *parsedPDF) text(t *testing.T) []string {
+	t.Helper()
+
+	fonts := p.fontObjects()
+	maps := make(map[string]map[string]string)
+	for name, object := range fonts {
+		if strings.Contains(p.objects[object], "/Type0") {
+			maps[name] = p.toUnicode(t, object)
+		}
+	}
+
+	token := regexp.MustCompile(`/(F\d) [\d.]+ Tf|\(((?:\\.|[^\\)])*)\) Tj|<([0-9A-F]*)> Tj|ET`)
+	var lines []string
+	var line strings.Builder
+	var font string
+	for _, m := range token.FindAllStringSubmatch(string(p.stream(t, 4)), -1) {
+		switch {
+		case m[1] != "":
+			font = m[1]
+		case strings.HasSuffix(m[0], ") Tj"):
+			line.WriteString(decodeWinAnsi(m[2]))
+		case strings.HasSuffix(m[0], "> Tj"):
+			if maps[font] == nil {
+				t.Fatalf("hex string shown in simple font %s", font)
+			}
+			for i := 0; i+4 <= len(m[3]); i += 4 {
+				text, ok := maps[font][m[3][i:i+4]]
+				if !ok {
+					t.Fatalf("glyph %s of %s is not in its ToUnicode map", m[3][i:i+4], font)
+				}
+				line.WriteString(text)
+			}
+		default:
+			lines = append(lines, line.String())
+			line.Reset()
+		}
+	}
+	return lines
+}
+
+// decodeWinAnsi decodes a PDF string literal in the Latin-1 part of
+// WinAnsiEncoding.
+func decodeWinAnsi(literal string) string {
+	var b strings.Builder
+	for i := 0; i < len(literal); i++ {
+		if literal[i] != '\\' {
+			b.WriteByte(literal[i])
+			continue
+		}
+		i++
+		if i+2 < len(literal) && literal[i] >= '0' && literal[i] <= '7' {
+			code, _ := strconv.ParseUint(literal[i:i+3], 8, 8)
+			b.WriteRune(rune(code))
+			i += 2
+			continue
+		}
+		b.WriteByte(literal[i])
+	}
+	return b.String()
+}
+
+func TestPDFLatinText(t *testing.T) {
+	page := &pdfPage{}
+	page.Text(56, 700, pdfFontRegular, 10, `Café (50% off) \ Ü`)
+	page.MonoRight(500, 680, 10, "100.00 ETB")
+
+	pdf := parsePDF(t, page.Bytes())
+
+	if _, ok := pdf.fontObjects()[pdfFontUnicode]; ok {
+		t.Error("Latin-1 text embedded the Unicode font")
+	}
+
+	lines := pdf.text(t)
+	want := []string{`Café (50% off) \ Ü`, "100.00 ETB"}
+	if strings.Join(lines, "|") != strings.Join(want, "|") {
+		t.Errorf("text = %q, want %q", lines, want)
+	}
+}
+
+func TestPDFUnicodeText(t *testing.T) {
+	page := &pdfPage{}
+	page.Text(56, 700, pdfFontRegular, 10, "Bill to አበበ በቀለ")
+	page.Text(56, 680, pdfFontBold, 10, "ዶሮ ወጥ (Doro Wat)")
+	page.Text(56, 660, pdfFontRegular, 10, "Emoji 🍲 not in the font")
+
+	data := page.Bytes()
+	pdf := parsePDF(t, data)
+
+	lines := pdf.text(t)
+	want := []string{"Bill to አበበ በቀለ", "ዶሮ ወጥ (Doro Wat)", "Emoji ? not in the font"}
+	if strings.Join(lines, "|") != strings.Join(want, "|") {
+		t.Errorf("text = %q, want %q", lines, want)
+	}
+
+	// The subset draws the glyphs used and leaves out the rest
+	fonts := pdf.fontObjects()
+	descendant := regexp.MustCompile(`/DescendantFonts \[(\d+) 0 R\]`).FindStringSubmatch(pdf.objects[fonts[pdfFontUnicode]])
+	if descendant == nil {
+		t.Fatal("Unicode font has no descendant font")
+	}
+	object, _ := strconv.Atoi(descendant[1])
+	descriptor := regexp.MustCompile(`/FontDescriptor (\d+) 0 R`).FindStringSubmatch(pdf.objects[object])
+	object, _ = strconv.Atoi(descriptor[1])
+	file := regexp.MustCompile(`/FontFile2 (\d+) 0 R`).FindStringSubmatch(pdf.objects[object])
+	object, _ = strconv.Atoi(file[1])
+
+	program := pdf.stream(t, object)
+	subset, err := sfnt.Parse(program)
+	if err != nil {
+		t.Fatalf("embedded font does not parse: %v", err)
+	}
+
+	var buf sfnt.Buffer
+	outline := func(r rune) int {
+		glyph, err := subset.GlyphIndex(&buf, r)
+		if err != nil || glyph == 0 {
+			t.Fatalf("embedded font has no glyph for %q", r)
+		}
+		segments, err := subset.LoadGlyph(&buf, glyph, 1000, nil)
+		if err != nil {
+			t.Fatalf("glyph for %q does not load: %v", r, err)
+		}
+		return len(segments)
+	}
+	for _, r := range "አበቀለዶሮወጥ" {
+		if outline(r) == 0 {
+			t.Errorf("glyph for %q was left out of the subset", r)
+		}
+	}
+	if outline('ሀ') != 0 {
+		t.Error("unused glyph for 'ሀ' was kept in the subset")
+	}
+
+	if len(data) > 100<<10 {
+		t.Errorf("PDF is %d bytes, want the font subset to keep it small", len(data))
+	}
+}
+
+func TestTrueTypeSubsetComposites(t *testing.T) {
+	font := unicodeFont()
+	if font == nil {
+		t.Fatal("Unicode font does not parse")
+	}
+
+	// Find a composite glyph and check its components are kept
+	for glyph := uint16(1); int(glyph) < font.numGlyphs; glyph++ {
+		data, err := font.glyphData(glyph)
+		if err != nil {
+			t.Fatal(err)
+		}
+		components, err := glyphComponents(data)
+		if err != nil {
+			t.Fatalf("glyph %d: %v", glyph, err)
+		}
+		if len(components) == 0 {
+			continue
+		}
+
+		program, err := font.Subset([]uint16{glyph})
+		if err != nil {
+			t.Fatal(err)
+		}
+		subset, err := parseTrueType("subset", program)
+		if err != nil {
+			t.Fatalf("subset does not parse: %v", err)
+		}
+		for _, component := range components {
+			if data, _ := subset.glyphData(component); len(data) == 0 {
+				t.Errorf("component %d of glyph %d was left out", component, glyph)
+			}
+		}
+		return
+	}
+	t.Skip("font has no composite glyphs")
+}
@@ -0,0 +1,247 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+var (
+	ErrPurchaseNotFound = errors.New("purchase not found")
+	ErrCheckoutPaid     = errors.New("the earlier checkout for this item has already been paid")
+	ErrPurchaseConflict = errors.New("the earlier checkout changed while starting a new one, please try again")
+)
+
+// PurchaseService moves purchases out of pending once the payment provider
+// has confirmed the outcome. Settling is idempotent, so the browser
+// redirect and the provider's webhook can both report the same payment.
+// The buyer is sent a confirmation with the invoice once, by whichever
+// report completes the purchase.
+type PurchaseService struct {
+	provider       PaymentProvider
+	ledgerService  *LedgerService
+	invoiceService *InvoiceService
+	hasuraService  *HasuraService
+	notifier       AttachmentNotifier
+}
+
+func NewPurchaseService(provider PaymentProvider, ledgerService *LedgerService, invoiceService *InvoiceService, hasuraService *HasuraService, notifier AttachmentNotifier) *PurchaseService {
+	return &PurchaseService{
+		provider:       provider,
+		ledgerService:  ledgerService,
+		invoiceService: invoiceService,
+		hasuraService:  hasuraService,
+		notifier:       notifier,
+	}
+}
+
+// Settle verifies a pending purchase with the payment provider and records
+// the result. Expired checkouts are verified too, so a payment that arrives
+// late still completes. Other purchases are returned unchanged.
+func (s *PurchaseService) Settle(ctx context.Context, transactionID string) (*Purchase, error) {
+	purchase, err := s.hasuraService.GetPurchaseByTransactionID(ctx, transactionID)
+	if err != nil {
+		return nil, err
+	}
+
+	if purchase == nil {
+		return nil, ErrPurchaseNotFound
+	}
+
+	if purchase.Status != PurchasePending && purchase.Status != PurchaseExpired {
+		return purchase, nil
+	}
+
+	response, err := s.provider.VerifyPayment(transactionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to verify payment: %w", err)
+	}
+
+	status := purchase.Status
+	switch response.Data.Status {
+	case "success":
+		status = PurchaseCompleted
+
+		// Never grant access for less than the recorded price
+		paid, err := response.Data.Amount.Float64()
+		if err != nil || paid+0.005 < purchase.Amount {
+			log.Printf("Payment %s amount %q does not cover purchase amount %.2f", transactionID, response.Data.Amount, purchase.Amount)
+			status = PurchaseFailed
+		}
+
+		// and never for a payment made in another currency
+		if response.Data.Currency != "" && purchase.Currency != "" && !strings.EqualFold(response.Data.Currency, purchase.Currency) {
+			log.Printf("Payment %s was made in %s, purchase is priced in %s", transactionID, response.Data.Currency, purchase.Currency)
+			status = PurchaseFailed
+		}
+	case "failed":
+		status = PurchaseFailed
+	}
+
+	if status == purchase.Status {
+		return purchase, nil
+	}
+
+	if status == PurchaseCompleted {
+		item, err := s.hasuraService.GetPurchaseItem(ctx, purchase)
+		if err != nil {
+			return nil, err
+		}
+		if item == nil {
+			return nil, fmt.Errorf("item of purchase %s not found", purchase.TransactionID)
+		}
+
+		// The sale is recorded in the ledger, and a bundle's recipes are
+		// unlocked, together with the status, so a completed purchase never
+		// lacks its journal or its entitlements
+		entries := s.ledgerService.SaleEntries(purchase, item)
+		entitlements := bundleEntitlements(purchase, item)
+
+		completed, err := s.hasuraService.CompletePurchase(ctx, transactionID, response.Data.Reference, entries, entitlements)
+		if err != nil {
+			return nil, err
+		}
+
+		purchase.Status = status
+		purchase.ProviderReference = response.Data.Reference
+
+		// Only the report that completed the purchase confirms it
+		if completed {
+			s.Confirm(ctx, purchase)
+		}
+		return purchase, nil
+	}
+
+	// Only a purchase still pending is failed; one completed or replaced in
+	// the meantime, or already expired, keeps its status
+	failed, err := s.hasuraService.FailPendingPurchase(ctx, transactionID)
+	if err != nil {
+		return nil, err
+	}
+	if !failed {
+		return s.hasuraService.GetPurchaseByTransactionID(ctx, transactionID)
+	}
+
+	purchase.Status = status
+	return purchase, nil
+}
+
+// Replace fails a pending purchase so a new checkout can be started for the
+// same item, e.g. after its price changed. A checkout the buyer was sent to
+// is verified with the provider first: if it was paid it is settled and
+// ErrCheckoutPaid returned. ErrPurchaseConflict means the purchase left
+// pending in the meantime.
+func (s *PurchaseService) Replace(ctx context.Context, purchase *Purchase) error {
+	if purchase.CheckoutURL != "" {
+		settled, err := s.Settle(ctx, purchase.TransactionID)
+		if err != nil {
+			return err
+		}
+
+		switch settled.Status {
+		case PurchaseCompleted:
+			return ErrCheckoutPaid
+		case PurchaseFailed:
+			return nil
+		}
+	}
+
+	failed, err := s.hasuraService.FailPendingPurchase(ctx, purchase.TransactionID)
+	if err != nil {
+		return err
+	}
+	if !failed {
+		return ErrPurchaseConflict
+	}
+
+	return nil
+}
+
+// Confirm issues the invoice of a completed purchase and emails it to the
+// buyer with the purchase confirmation. For gifts the recipient is emailed
+// the code to redeem. Failures are logged; the buyer can still download
+// the invoice later.
+func (s *PurchaseService) Confirm(ctx context.Context, purchase *Purchase) {
+	invoice, err := s.invoiceService.Issue(ctx, purchase)
+	if err != nil {
+		log.Printf("Failed to issue invoice for purchase %s: %v", purchase.TransactionID, err)
+		return
+	}
+
+	data := map[string]interface{}{
+		"recipe_id":      invoice.RecipeID,
+		"recipe_title":   invoice.RecipeTitle,
+		"seller_name":    invoice.SellerName,
+		"amount":         fmt.Sprintf("%.2f", invoice.TotalAmount),
+		"currency":       invoice.Currency,
+		"invoice_number": invoice.InvoiceNumber,
+		"transaction_id": purchase.TransactionID,
+	}
+	if invoice.BundleID != "" {
+		data["bundle_id"] = invoice.BundleID
+	}
+	if purchase.IsGift() {
+		data["recipient_email"] = purchase.RecipientEmail
+		data["gift_code"] = purchase.GiftCode
+		data["gift_expires_at"] = giftExpiryDate(purchase)
+	}
+	attachment := EmailAttachment{
+		Filename:    invoice.Filename(),
+		ContentType: "application/pdf",
+		Content:     s.invoiceService.RenderPDF(invoice),
+	}
+
+	if err := s.notifier.NotifyWithAttachments(ctx, invoice.BuyerEmail, "purchase_confirmation", data, []EmailAttachment{attachment}); err != nil {
+		log.Printf("Failed to email purchase confirmation for %s: %v", purchase.TransactionID, err)
+	}
+
+	if !purchase.IsGift() {
+		return
+	}
+
+	gift := map[string]interface{}{
+		"recipe_id":       invoice.RecipeID,
+		"recipe_title":    invoice.RecipeTitle,
+		"seller_name":     invoice.SellerName,
+		"sender_name":     invoice.BuyerName,
+		"gift_message":    purchase.GiftMessage,
+		"gift_code":       purchase.GiftCode,
+		"gift_expires_at": giftExpiryDate(purchase),
+	}
+
+	if err := s.notifier.NotifyWithAttachments(ctx, purchase.RecipientEmail, "purchase_gift", gift, nil); err != nil {
+		log.Printf("Failed to email gift %s to its recipient: %v", purchase.TransactionID, err)
+	}
+}
+
+// bundleEntitlements returns the access a purchase of a bundle gives its
+// buyer to each of the bundle's recipes. Purchases of a single recipe need
+// none.
+func bundleEntitlements(purchase *Purchase, item *PurchaseItem) []BundleEntitlementInput {
+	if item.BundleID == "" {
+		return nil
+	}
+
+	entitlements := make([]BundleEntitlementInput, len(item.Recipes))
+	for i, recipe := range item.Recipes {
+		entitlements[i] = BundleEntitlementInput{
+			PurchaseID: purchase.ID,
+			BundleID:   item.BundleID,
+			RecipeID:   recipe.ID,
+			UserID:     purchase.UserID,
+		}
+	}
+	return entitlements
+}
+
+// giftExpiryDate formats the last day a gift can be redeemed for emails.
+func giftExpiryDate(purchase *Purchase) string {
+	expiresAt, err := time.Parse(time.RFC3339Nano, purchase.GiftExpiresAt)
+	if err != nil {
+		return purchase.GiftExpiresAt
+	}
+	return expiresAt.UTC().Format("2 January 2006")
+}
@@ -0,0 +1,101 @@
+package services
+
+import (
+	"context"
+	"fmt"
+
+	"recipe-backend/internal/config"
+)
+
+// QuotaService enforces how many bytes each user may keep in storage,
+// depending on their role.
+type QuotaService struct {
+	config        *config.Config
+	hasuraService *HasuraService
+}
+
+func NewQuotaService(cfg *config.Config, hasuraService *HasuraService) *QuotaService {
+	return &QuotaService{
+		config:        cfg,
+		hasuraService: hasuraService,
+	}
+}
+
+type QuotaUsage struct {
+	Role           string `json:"role"`
+	UsedBytes      int64  `json:"used_bytes"`
+	FileCount      int    `json:"file_count"`
+	QuotaBytes     int64  `json:"quota_bytes"`
+	RemainingBytes int64  `json:"remaining_bytes"`
+	Unlimited      bool   `json:"unlimited"`
+}
+
+// QuotaExceededError is returned when an upload would take a user over
+// their storage quota.
+type QuotaExceededError struct {
+	Usage     *QuotaUsage
+	Requested int64
+}
+
+func (e *QuotaExceededError) Error() string {
+	return fmt.Sprintf("storage quota exceeded: %d of %d bytes used, %d more requested",
+		e.Usage.UsedBytes, e.Usage.QuotaBytes, e.Requested)
+}
+
+func (s *QuotaService) Usage(ctx context.Context, userID string) (*QuotaUsage, error) {
+	user, err := s.hasuraService.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	role := RoleFree
+	if user != nil && user.Role != "" {
+		role = user.Role
+	}
+
+	stored, err := s.hasuraService.GetStorageUsage(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	usage := &QuotaUsage{
+		Role:       role,
+		UsedBytes:  stored.BytesUsed,
+		FileCount:  stored.FileCount,
+		QuotaBytes: s.quotaFor(role),
+	}
+
+	if usage.QuotaBytes <= 0 {
+		usage.Unlimited = true
+	} else if usage.UsedBytes < usage.QuotaBytes {
+		usage.RemainingBytes = usage.QuotaBytes - usage.UsedBytes
+	}
+
+	return usage, nil
+}
+
+// CheckUpload returns a *QuotaExceededError if storing size more bytes would
+// exceed the user's quota.
+func (s *QuotaService) CheckUpload(ctx context.Context, userID string, size int64) error {
+	usage, err := s.Usage(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	if !usage.Unlimited && size > usage.RemainingBytes {
+		return &QuotaExceededError{Usage: usage, Requested: size}
+	}
+
+	return nil
+}
+
+func (s *QuotaService) quotaFor(role string) int64 {
+	switch role {
+	case RoleAdmin:
+		return s.config.StorageQuotaAdmin
+	case RoleChef:
+		return s.config.StorageQuotaChef
+	default:
+		return s.config.StorageQuotaFree
+	}
+}
@@ -0,0 +1,269 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"recipe-backend/internal/config"
+)
+
+const (
+	// Consecutive provider errors after which a run gives up until the next
+	// interval, so an outage does not burn through the whole backlog
+	maxConsecutiveVerifyErrors = 5
+
+	// Failed verifications after which an expired checkout is given up on
+	// even though the provider never answered for it
+	maxVerifyAttempts = 5
+
+	maxReconcileBackoff = time.Minute
+)
+
+// PurchaseReconciler settles purchases left pending because the provider's
+// webhook and the payer's redirect were both lost. Each purchase older than
+// the minimum age is verified with the provider, at most one request per
+// request interval. Checkouts still unpaid after the expiry cutoff are
+// marked expired.
+type PurchaseReconciler struct {
+	config          *config.Config
+	purchaseService *PurchaseService
+	hasuraService   *HasuraService
+
+	// Purchases whose verification failed are retried with exponential
+	// back-off across runs
+	mu       sync.Mutex
+	failures map[string]*verifyFailure
+}
+
+type verifyFailure struct {
+	attempts    int
+	nextAttempt time.Time
+}
+
+func NewPurchaseReconciler(cfg *config.Config, purchaseService *PurchaseService, hasuraService *HasuraService) *PurchaseReconciler {
+	return &PurchaseReconciler{
+		config:          cfg,
+		purchaseService: purchaseService,
+		hasuraService:   hasuraService,
+		failures:        make(map[string]*verifyFailure),
+	}
+}
+
+type ReconcileReport struct {
+	Scanned      int      `json:"scanned"`
+	Completed    int      `json:"completed"`
+	Failed       int      `json:"failed"`
+	Expired      int      `json:"expired"`
+	StillPending int      `json:"still_pending"`
+	BackingOff   int      `json:"backing_off"`
+	Aborted      bool     `json:"aborted"`
+	Errors       []string `json:"errors,omitempty"`
+}
+
+// Run verifies every purchase that has been pending longer than the minimum
+// age.
+func (r *PurchaseReconciler) Run(ctx context.Context) (*ReconcileReport, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	expireBefore := now.Add(-r.config.ReconcileExpireAfter)
+
+	batchSize := r.config.ReconcileBatchSize
+	if batchSize <= 0 {
+		batchSize = 100
+	}
+
+	limiter := time.NewTicker(r.requestInterval())
+	defer limiter.Stop()
+
+	report := &ReconcileReport{}
+	consecutiveErrors := 0
+	// Pages are read by (created_at, id), so purchases created at the same
+	// instant as the last one of a page are on the next page
+	after, afterID := "", ""
+
+	for {
+		purchases, err := r.hasuraService.ListPendingPurchases(ctx, after, afterID, now.Add(-r.config.ReconcileMinAge), batchSize)
+		if err != nil {
+			return report, err
+		}
+
+		for i := range purchases {
+			purchase := &purchases[i]
+			report.Scanned++
+			after, afterID = purchase.CreatedAt, purchase.ID
+
+			createdAt, err := time.Parse(time.RFC3339Nano, purchase.CreatedAt)
+			if err != nil {
+				report.Errors = append(report.Errors, fmt.Sprintf("%s: invalid created_at %q", purchase.TransactionID, purchase.CreatedAt))
+				continue
+			}
+			expired := createdAt.Before(expireBefore)
+
+			if failure := r.failures[purchase.TransactionID]; failure != nil && now.Before(failure.nextAttempt) {
+				report.BackingOff++
+				continue
+			}
+
+			select {
+			case <-ctx.Done():
+				return report, ctx.Err()
+			case <-limiter.C:
+			}
+
+			settled, err := r.purchaseService.Settle(ctx, purchase.TransactionID)
+			if errors.Is(err, ErrPaymentNotFound) {
+				// The checkout was never opened, so it stays pending
+				// until it expires
+				settled, err = purchase, nil
+			}
+			if err != nil {
+				attempts := r.recordFailure(purchase.TransactionID)
+				report.Errors = append(report.Errors, fmt.Sprintf("%s: %v", purchase.TransactionID, err))
+
+				// A checkout the provider keeps failing to answer for is
+				// given up on in the end
+				if expired && attempts >= maxVerifyAttempts {
+					r.expire(ctx, purchase, report)
+				}
+
+				consecutiveErrors++
+				if consecutiveErrors >= maxConsecutiveVerifyErrors {
+					report.Aborted = true
+					return report, nil
+				}
+
+				if err := sleepContext(ctx, r.backoff(consecutiveErrors)); err != nil {
+					return report, err
+				}
+				continue
+			}
+
+			consecutiveErrors = 0
+			delete(r.failures, purchase.TransactionID)
+
+			switch settled.Status {
+			case PurchaseCompleted:
+				report.Completed++
+			case PurchaseFailed:
+				report.Failed++
+			case PurchasePending:
+				if expired {
+					r.expire(ctx, purchase, report)
+				} else {
+					report.StillPending++
+				}
+			}
+		}
+
+		if len(purchases) < batchSize {
+			break
+		}
+	}
+
+	r.forgetSettled(now)
+	return report, nil
+}
+
+func (r *PurchaseReconciler) expire(ctx context.Context, purchase *Purchase, report *ReconcileReport) {
+	expired, err := r.hasuraService.ExpirePendingPurchase(ctx, purchase.TransactionID)
+	if err != nil {
+		report.Errors = append(report.Errors, fmt.Sprintf("%s: %v", purchase.TransactionID, err))
+		return
+	}
+
+	if expired {
+		report.Expired++
+		delete(r.failures, purchase.TransactionID)
+	}
+}
+
+// recordFailure schedules the next attempt for a purchase whose
+// verification failed and returns how many attempts have failed so far.
+func (r *PurchaseReconciler) recordFailure(transactionID string) int {
+	failure := r.failures[transactionID]
+	if failure == nil {
+		failure = &verifyFailure{}
+		r.failures[transactionID] = failure
+	}
+
+	failure.attempts++
+	delay := r.config.ReconcileInterval << (failure.attempts - 1)
+	if delay <= 0 || delay > 24*time.Hour {
+		delay = 24 * time.Hour
+	}
+	failure.nextAttempt = time.Now().Add(delay)
+
+	return failure.attempts
+}
+
+// forgetSettled drops back-off state for purchases that have not failed for
+// a day, which are no longer pending.
+func (r *PurchaseReconciler) forgetSettled(now time.Time) {
+	for transactionID, failure := range r.failures {
+		if now.Sub(failure.nextAttempt) > 24*time.Hour {
+			delete(r.failures, transactionID)
+		}
+	}
+}
+
+func (r *PurchaseReconciler) requestInterval() time.Duration {
+	if r.config.ReconcileRequestInterval <= 0 {
+		return time.Millisecond
+	}
+	return r.config.ReconcileRequestInterval
+}
+
+// backoff is the pause after the given number of consecutive provider
+// errors, doubling from the request interval up to a minute.
+func (r *PurchaseReconciler) backoff(consecutiveErrors int) time.Duration {
+	delay := r.requestInterval() << consecutiveErrors
+	if delay <= 0 || delay > maxReconcileBackoff {
+		return maxReconcileBackoff
+	}
+	return delay
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// Start runs the reconciler on the configured interval until ctx is done.
+func (r *PurchaseReconciler) Start(ctx context.Context) {
+	if r.config.ReconcileInterval <= 0 {
+		log.Println("Purchase reconciliation disabled")
+		return
+	}
+
+	ticker := time.NewTicker(r.config.ReconcileInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			report, err := r.Run(ctx)
+			if err != nil {
+				log.Printf("Purchase reconciliation failed: %v", err)
+				continue
+			}
+			log.Printf("Purchase reconciliation: scanned=%d completed=%d failed=%d expired=%d pending=%d backing_off=%d aborted=%t errors=%d",
+				report.Scanned, report.Completed, report.Failed, report.Expired,
+				report.StillPending, report.BackingOff, report.Aborted, len(report.Errors))
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"recipe-backend/internal/config"
+)
+
+// Checkouts that were never opened are unknown to the provider. They are
+// the usual abandoned checkout, not a provider outage: they stay pending
+// until they expire, however many of them there are.
+func TestReconcileAbandonedCheckouts(t *testing.T) {
+	now := time.Now().UTC()
+	purchases := map[string]Purchase{}
+	var pending []Purchase
+	for i := 0; i < 2*maxConsecutiveVerifyErrors; i++ {
+		createdAt := now.Add(-time.Hour)
+		if i%2 == 0 {
+			createdAt = now.Add(-48 * time.Hour)
+		}
+		purchase := Purchase{
+			ID:            fmt.Sprintf("p%d", i),
+			TransactionID: fmt.Sprintf("tx-%d", i),
+			Status:        PurchasePending,
+			Amount:        100,
+			CreatedAt:     createdAt.Format(time.RFC3339Nano),
+		}
+		purchases[purchase.TransactionID] = purchase
+		pending = append(pending, purchase)
+	}
+
+	var expired []string
+	hasura := newFakeHasura(t, func(query string, variables map[string]interface{}) interface{} {
+		switch {
+		case strings.Contains(query, "ListPendingPurchases"):
+			return map[string]interface{}{"purchases": pending}
+		case strings.Contains(query, "GetPurchaseByTransactionID"):
+			return map[string]interface{}{"purchases": []Purchase{purchases[variables["transaction_id"].(string)]}}
+		case strings.Contains(query, "ExpirePendingPurchase"):
+			expired = append(expired, variables["transaction_id"].(string))
+			return map[string]interface{}{"update_purchases": map[string]interface{}{"affected_rows": 1}}
+		}
+		t.Errorf("unexpected query %s", query)
+		return nil
+	})
+
+	cfg := &config.Config{
+		ReconcileInterval:    10 * time.Minute,
+		ReconcileMinAge:      15 * time.Minute,
+		ReconcileExpireAfter: 24 * time.Hour,
+	}
+	provider := &stubPaymentProvider{paymentErr: fmt.Errorf("%w: tx", ErrPaymentNotFound)}
+	purchaseService := NewPurchaseService(provider, NewLedgerService(cfg, hasura), nil, hasura, nil)
+
+	report, err := NewPurchaseReconciler(cfg, purchaseService, hasura).Run(context.Background())
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if report.Aborted || len(report.Errors) > 0 {
+		t.Errorf("run aborted = %v with errors %v, want no errors", report.Aborted, report.Errors)
+	}
+	if report.Expired != maxConsecutiveVerifyErrors || report.StillPending != maxConsecutiveVerifyErrors {
+		t.Errorf("expired = %d, still pending = %d, want %d of each", report.Expired, report.StillPending, maxConsecutiveVerifyErrors)
+	}
+	if len(expired) != maxConsecutiveVerifyErrors {
+		t.Errorf("expired %v", expired)
+	}
+}
@@ -0,0 +1,243 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"strings"
+	"time"
+)
+
+var (
+	ErrPurchaseNotRefundable = errors.New("only completed purchases can be refunded")
+	ErrInvalidRefundAmount   = errors.New("refund amount must be positive and no more than the amount left to refund")
+	ErrRefundNotRecorded     = errors.New("refund was made but could not be recorded")
+	ErrRefundUnconfirmed     = errors.New("refund is pending until the payment provider confirms it")
+	ErrEarlierRefundRecorded = errors.New("an earlier refund was recorded instead; this request was not processed")
+)
+
+// Refunds left pending for longer than this are no longer in flight, so
+// their outcome is verified with the provider. One the provider still has
+// no record of after unknownRefundTimeout was never made.
+const (
+	pendingRefundGrace   = 10 * time.Minute
+	unknownRefundTimeout = time.Hour
+)
+
+// RefundService refunds completed purchases in full or in part.
+type RefundService struct {
+	provider      PaymentProvider
+	ledgerService *LedgerService
+	hasuraService *HasuraService
+}
+
+func NewRefundService(provider PaymentProvider, ledgerService *LedgerService, hasuraService *HasuraService) *RefundService {
+	return &RefundService{
+		provider:      provider,
+		ledgerService: ledgerService,
+		hasuraService: hasuraService,
+	}
+}
+
+type RefundRequest struct {
+	Purchase    *Purchase
+	Amount      float64 // zero refunds everything not yet refunded
+	Reason      string
+	RequestedBy string
+
+	// RevokeAccess ends the buyer's access after a partial refund. Full
+	// refunds always end access.
+	RevokeAccess bool
+}
+
+type RefundOutcome struct {
+	Refund         *Refund `json:"refund"`
+	PurchaseStatus string  `json:"purchase_status"`
+	RefundedTotal  float64 `json:"refunded_total"`
+	Remaining      float64 `json:"remaining"`
+}
+
+// Refund records a refund, sends it to the payment provider and marks the
+// purchase refunded once access is revoked. A refund the provider made
+// earlier whose journal could not be recorded, or whose outcome was unknown
+// and has since been confirmed, is recorded instead, and no new refund is
+// started. Unless the request repeats that refund, its outcome is returned
+// with ErrEarlierRefundRecorded, so the caller knows to ask again. A
+// purchase nothing was paid for has its access revoked without contacting
+// the provider.
+func (s *RefundService) Refund(ctx context.Context, req RefundRequest) (*RefundOutcome, error) {
+	purchase := req.Purchase
+	if purchase.Status != PurchaseCompleted {
+		return nil, ErrPurchaseNotRefundable
+	}
+
+	if purchase.Amount < 0.005 {
+		if req.Amount != 0 {
+			return nil, ErrInvalidRefundAmount
+		}
+		if err := s.hasuraService.RevokePurchase(ctx, purchase); err != nil {
+			return nil, err
+		}
+		return &RefundOutcome{PurchaseStatus: PurchaseRefunded}, nil
+	}
+
+	unrecorded, err := s.hasuraService.ListRefunds(ctx, purchase.ID, RefundProcessed)
+	if err != nil {
+		return nil, err
+	}
+
+	// Pending and processed refunds count too. The database checks the
+	// same limit when the refund is added, so concurrent requests that both
+	// pass this check cannot refund more than was paid between them.
+	refunded, err := s.hasuraService.GetRefundedTotal(ctx, purchase.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(unrecorded) > 0 {
+		refund := &unrecorded[0]
+		final := len(unrecorded) == 1 && purchase.Amount-refunded < 0.005
+		return s.recordEarlier(ctx, req, refund, refund.ProviderReference, refunded, final)
+	}
+
+	// A pending refund keeps its amount until the provider says whether it
+	// was made
+	pending, err := s.hasuraService.ListRefunds(ctx, purchase.ID, RefundPending)
+	if err != nil {
+		return nil, err
+	}
+	for i := range pending {
+		refund := &pending[i]
+		createdAt, err := time.Parse(time.RFC3339Nano, refund.CreatedAt)
+		if err != nil || time.Since(createdAt) < pendingRefundGrace {
+			continue
+		}
+
+		reference, made, err := s.verify(ctx, refund, createdAt)
+		if err != nil {
+			return nil, err
+		}
+		if made {
+			final := len(pending) == 1 && purchase.Amount-refunded < 0.005
+			return s.recordEarlier(ctx, req, refund, reference, refunded, final)
+		}
+		refunded -= refund.Amount
+	}
+
+	remaining := purchase.Amount - refunded
+	amount := req.Amount
+	if amount == 0 {
+		amount = remaining
+	}
+	if amount <= 0 || amount > remaining+0.005 {
+		return nil, ErrInvalidRefundAmount
+	}
+
+	refund, err := s.hasuraService.CreateRefund(ctx, CreateRefundInput{
+		PurchaseID:  purchase.ID,
+		Amount:      amount,
+		Reason:      req.Reason,
+		RequestedBy: req.RequestedBy,
+	})
+	if err != nil {
+		if strings.Contains(err.Error(), "exceeds the amount left to refund") {
+			return nil, ErrInvalidRefundAmount
+		}
+		return nil, err
+	}
+
+	response, err := s.provider.RefundPayment(purchase.TransactionID, refund.ID, amount, req.Reason)
+	if errors.Is(err, ErrRefundRejected) {
+		if updateErr := s.hasuraService.UpdateRefundStatus(ctx, refund.ID, RefundFailed, ""); updateErr != nil {
+			log.Printf("Failed to mark refund %s as failed: %v", refund.ID, updateErr)
+		}
+		return nil, fmt.Errorf("payment provider refused refund: %w", err)
+	}
+	if err != nil {
+		// The provider may have made the refund anyway, so it stays pending
+		// and keeps its amount until verified
+		return nil, fmt.Errorf("%w: %v", ErrRefundUnconfirmed, err)
+	}
+
+	final := remaining-amount < 0.005
+	return s.record(ctx, purchase, refund, response.Data.Reference, refunded+amount, final, req.RevokeAccess)
+}
+
+// recordEarlier records a refund made before req in its place. Retrying a
+// request whose refund could not be recorded records it; any other request
+// is reported as not processed rather than silently dropped.
+func (s *RefundService) recordEarlier(ctx context.Context, req RefundRequest, refund *Refund, reference string, refundedTotal float64, final bool) (*RefundOutcome, error) {
+	sameAmount := math.Abs(req.Amount-refund.Amount) < 0.005 || (req.Amount == 0 && final)
+	repeated := sameAmount && req.Reason == refund.Reason
+
+	outcome, err := s.record(ctx, req.Purchase, refund, reference, refundedTotal, final, repeated && req.RevokeAccess)
+	if err != nil || repeated {
+		return outcome, err
+	}
+	return outcome, ErrEarlierRefundRecorded
+}
+
+// verify asks the provider whether a pending refund was made. A refund it
+// reports failed, or still has no record of after unknownRefundTimeout, is
+// marked failed, which releases its amount. Until the outcome is known the
+// refund stays pending and ErrRefundUnconfirmed is returned.
+func (s *RefundService) verify(ctx context.Context, refund *Refund, createdAt time.Time) (reference string, made bool, err error) {
+	response, err := s.provider.VerifyRefund(refund.ID)
+	if err != nil {
+		if !errors.Is(err, ErrRefundNotFound) || time.Since(createdAt) < unknownRefundTimeout {
+			return "", false, fmt.Errorf("%w: %v", ErrRefundUnconfirmed, err)
+		}
+	} else {
+		switch strings.ToLower(response.Data.Status) {
+		case "success", "successful", "completed", "refunded":
+			return response.Data.Reference, true, nil
+		case "failed", "rejected", "cancelled":
+		default:
+			return "", false, fmt.Errorf("%w: provider reports %q", ErrRefundUnconfirmed, response.Data.Status)
+		}
+	}
+
+	if err := s.hasuraService.UpdateRefundStatus(ctx, refund.ID, RefundFailed, ""); err != nil {
+		return "", false, err
+	}
+	return "", false, nil
+}
+
+// record completes a refund the provider has made together with the
+// journal reversing its share of the sale. If that fails the refund is kept
+// processed, so the next refund of the purchase records it; a refund is
+// never completed without its journal.
+func (s *RefundService) record(ctx context.Context, purchase *Purchase, refund *Refund, reference string, refundedTotal float64, final, revokeAccess bool) (*RefundOutcome, error) {
+	entries, err := s.ledgerService.RefundEntries(ctx, purchase, refund, final)
+	if err == nil {
+		err = s.hasuraService.CompleteRefund(ctx, refund.ID, reference, entries)
+	}
+	if err != nil {
+		if refund.Status != RefundProcessed {
+			if updateErr := s.hasuraService.UpdateRefundStatus(ctx, refund.ID, RefundProcessed, reference); updateErr != nil {
+				log.Printf("Failed to mark refund %s as processed: %v", refund.ID, updateErr)
+			}
+		}
+		return nil, fmt.Errorf("%w: %v", ErrRefundNotRecorded, err)
+	}
+	refund.Status = RefundCompleted
+	refund.ProviderReference = reference
+
+	outcome := &RefundOutcome{
+		Refund:         refund,
+		PurchaseStatus: purchase.Status,
+		RefundedTotal:  refundedTotal,
+		Remaining:      roundMoney(purchase.Amount - refundedTotal),
+	}
+
+	if final || revokeAccess {
+		if err := s.hasuraService.RevokePurchase(ctx, purchase); err != nil {
+			return nil, err
+		}
+		outcome.PurchaseStatus = PurchaseRefunded
+	}
+
+	return outcome, nil
+}
@@ -0,0 +1,295 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"recipe-backend/internal/config"
+)
+
+// stubPaymentProvider records the refunds it is asked to make and reports
+// the refunds in verified as having ended with the given status. Payment
+// verifications return payment, or fail with paymentErr.
+type stubPaymentProvider struct {
+	refunds    []float64
+	refundErr  error
+	verified   map[string]string
+	payment    *VerifyPaymentResponse
+	paymentErr error
+}
+
+func (p *stubPaymentProvider) Name() string { return "stub" }
+
+func (p *stubPaymentProvider) InitializePayment(req InitializePaymentRequest) (*InitializePaymentResponse, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (p *stubPaymentProvider) VerifyPayment(txRef string) (*VerifyPaymentResponse, error) {
+	if p.paymentErr != nil {
+		return nil, p.paymentErr
+	}
+	if p.payment != nil {
+		return p.payment, nil
+	}
+	return nil, errors.New("not implemented")
+}
+
+func (p *stubPaymentProvider) RefundPayment(txRef, reference string, amount float64, reason string) (*RefundPaymentResponse, error) {
+	if p.refundErr != nil {
+		return nil, p.refundErr
+	}
+	p.refunds = append(p.refunds, amount)
+	return &RefundPaymentResponse{}, nil
+}
+
+func (p *stubPaymentProvider) VerifyRefund(reference string) (*VerifyRefundResponse, error) {
+	status, ok := p.verified[reference]
+	if !ok {
+		return nil, ErrRefundNotFound
+	}
+
+	var response VerifyRefundResponse
+	response.Data.Status = status
+	return &response, nil
+}
+
+// fakeRefunds answers the refund queries of one purchase with the given
+// pending and processed refunds and records the statuses refunds are moved
+// to.
+type fakeRefunds struct {
+	pending   []Refund
+	processed []Refund
+	statuses  map[string]string
+	revoked  bool
+}
+
+func (f *fakeRefunds) respond(t *testing.T) func(query string, variables map[string]interface{}) interface{} {
+	return func(query string, variables map[string]interface{}) interface{} {
+		switch {
+		case strings.Contains(query, "ListRefunds"):
+			refunds := []Refund{}
+			switch variables["status"] {
+			case RefundPending:
+				refunds = f.pending
+			case RefundProcessed:
+				refunds = f.processed
+			}
+			return map[string]interface{}{"refunds": refunds}
+		case strings.Contains(query, "GetRefundedTotal"):
+			var total interface{}
+			for _, refund := range append(f.pending, f.processed...) {
+				if f.statuses[refund.ID] == "" {
+					if total == nil {
+						total = 0.0
+					}
+					total = total.(float64) + refund.Amount
+				}
+			}
+			return map[string]interface{}{"refunds_aggregate": map[string]interface{}{"aggregate": map[string]interface{}{"sum": map[string]interface{}{"amount": total}}}}
+		case strings.Contains(query, "CreateRefund"):
+			return map[string]interface{}{"insert_refunds_one": Refund{ID: "r-new", PurchaseID: "p1", Status: RefundPending}}
+		case strings.Contains(query, "UpdateRefundStatus"):
+			f.statuses[variables["id"].(string)] = variables["status"].(string)
+			return map[string]interface{}{"update_refunds_by_pk": map[string]interface{}{"id": variables["id"]}}
+		case strings.Contains(query, "RevokePurchase"):
+			f.revoked = true
+			return map[string]interface{}{}
+		case strings.Contains(query, "CompleteRefund"):
+			f.statuses[variables["id"].(string)] = RefundCompleted
+			return map[string]interface{}{"update_refunds_by_pk": map[string]interface{}{"id": variables["id"]}}
+		case strings.Contains(query, "ListPurchaseLedgerEntries"):
+			return map[string]interface{}{"ledger_entries": []interface{}{}}
+		}
+		t.Errorf("unexpected query %s", query)
+		return nil
+	}
+}
+
+func newTestRefundService(t *testing.T, provider PaymentProvider, refunds *fakeRefunds) *RefundService {
+	refunds.statuses = make(map[string]string)
+	hasura := newFakeHasura(t, refunds.respond(t))
+	cfg := &config.Config{PlatformCommission: 15}
+	return NewRefundService(provider, NewLedgerService(cfg, hasura), hasura)
+}
+
+// A refund the database turns away, because a concurrent refund already
+// took what was left, never reaches the provider.
+func TestRefundRejectedByDatabase(t *testing.T) {
+	hasura := newFakeHasura(t, func(query string, variables map[string]interface{}) interface{} {
+		switch {
+		case strings.Contains(query, "ListRefunds"):
+			return map[string]interface{}{"refunds": []interface{}{}}
+		case strings.Contains(query, "GetRefundedTotal"):
+			return map[string]interface{}{"refunds_aggregate": map[string]interface{}{"aggregate": map[string]interface{}{"sum": map[string]interface{}{"amount": nil}}}}
+		case strings.Contains(query, "CreateRefund"):
+			return errors.New(`database query error: refund exceeds the amount left to refund on purchase p1`)
+		}
+		t.Errorf("unexpected query %s", query)
+		return nil
+	})
+
+	provider := &stubPaymentProvider{}
+	cfg := &config.Config{PlatformCommission: 15}
+	s := NewRefundService(provider, NewLedgerService(cfg, hasura), hasura)
+
+	_, err := s.Refund(context.Background(), RefundRequest{
+		Purchase: &Purchase{ID: "p1", TransactionID: "tx-1", Amount: 100, Status: PurchaseCompleted},
+		Amount:   60,
+		Reason:   "duplicate",
+	})
+	if !errors.Is(err, ErrInvalidRefundAmount) {
+		t.Errorf("Refund() = %v, want %v", err, ErrInvalidRefundAmount)
+	}
+	if len(provider.refunds) != 0 {
+		t.Errorf("provider refunded %v, want nothing", provider.refunds)
+	}
+}
+
+// Only a refund the provider refused releases its amount; one whose outcome
+// is unknown stays pending.
+func TestRefundProviderError(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantErr    error
+		wantStatus string
+	}{
+		{name: "rejected", err: ErrRefundRejected, wantErr: ErrRefundRejected, wantStatus: RefundFailed},
+		{name: "timeout", err: errors.New("context deadline exceeded"), wantErr: ErrRefundUnconfirmed},
+		{name: "server error", err: errors.New("chapa API error: internal error"), wantErr: ErrRefundUnconfirmed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			refunds := &fakeRefunds{}
+			s := newTestRefundService(t, &stubPaymentProvider{refundErr: tt.err}, refunds)
+
+			_, err := s.Refund(context.Background(), RefundRequest{
+				Purchase: &Purchase{ID: "p1", TransactionID: "tx-1", Amount: 100, Status: PurchaseCompleted},
+				Reason:   "duplicate",
+			})
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Refund() = %v, want %v", err, tt.wantErr)
+			}
+			if got := refunds.statuses["r-new"]; got != tt.wantStatus {
+				t.Errorf("refund status set to %q, want %q", got, tt.wantStatus)
+			}
+		})
+	}
+}
+
+// A pending refund holds its amount until the provider says how it ended.
+func TestRefundVerifiesPendingRefunds(t *testing.T) {
+	stale := time.Now().Add(-2 * unknownRefundTimeout).UTC().Format(time.RFC3339Nano)
+	recent := time.Now().Add(-2 * pendingRefundGrace).UTC().Format(time.RFC3339Nano)
+	inFlight := time.Now().UTC().Format(time.RFC3339Nano)
+
+	tests := []struct {
+		name        string
+		createdAt   string
+		verified    map[string]string
+		wantErr     error
+		wantStatus  string
+		wantRefunds int
+	}{
+		{name: "made at provider", createdAt: recent, verified: map[string]string{"r-old": "success"}, wantStatus: RefundCompleted},
+		{name: "failed at provider", createdAt: recent, verified: map[string]string{"r-old": "failed"}, wantStatus: RefundFailed, wantRefunds: 1},
+		{name: "never reached provider", createdAt: stale, wantStatus: RefundFailed, wantRefunds: 1},
+		{name: "not found yet", createdAt: recent, wantErr: ErrRefundUnconfirmed},
+		{name: "still processing", createdAt: stale, verified: map[string]string{"r-old": "pending"}, wantErr: ErrRefundUnconfirmed},
+		{name: "in flight", createdAt: inFlight, wantErr: ErrInvalidRefundAmount},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := &stubPaymentProvider{verified: tt.verified}
+			refunds := &fakeRefunds{pending: []Refund{{ID: "r-old", PurchaseID: "p1", Amount: 100, Reason: "duplicate", Status: RefundPending, CreatedAt: tt.createdAt}}}
+			s := newTestRefundService(t, provider, refunds)
+
+			_, err := s.Refund(context.Background(), RefundRequest{
+				Purchase: &Purchase{ID: "p1", TransactionID: "tx-1", Amount: 100, Status: PurchaseCompleted},
+				Reason:   "duplicate",
+			})
+			if !errors.Is(err, tt.wantErr) || (err != nil) != (tt.wantErr != nil) {
+				t.Errorf("Refund() = %v, want %v", err, tt.wantErr)
+			}
+			if got := refunds.statuses["r-old"]; got != tt.wantStatus {
+				t.Errorf("pending refund status set to %q, want %q", got, tt.wantStatus)
+			}
+			if len(provider.refunds) != tt.wantRefunds {
+				t.Errorf("provider refunded %v, want %d refunds", provider.refunds, tt.wantRefunds)
+			}
+		})
+	}
+}
+
+// A refund made earlier but never recorded is recorded first. Unless the
+// request repeats it, the request is reported as not processed.
+func TestRefundRecordsEarlierRefund(t *testing.T) {
+	tests := []struct {
+		name        string
+		amount      float64
+		reason      string
+		wantErr     error
+		wantRevoked bool
+	}{
+		{name: "retried", amount: 40, reason: "damaged", wantRevoked: true},
+		{name: "different amount", amount: 60, reason: "damaged", wantErr: ErrEarlierRefundRecorded},
+		{name: "rest of the purchase", reason: "damaged", wantErr: ErrEarlierRefundRecorded},
+		{name: "different reason", amount: 40, reason: "late delivery", wantErr: ErrEarlierRefundRecorded},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := &stubPaymentProvider{}
+			refunds := &fakeRefunds{processed: []Refund{{ID: "r-old", PurchaseID: "p1", Amount: 40, Reason: "damaged", Status: RefundProcessed, ProviderReference: "ref-1"}}}
+			s := newTestRefundService(t, provider, refunds)
+
+			outcome, err := s.Refund(context.Background(), RefundRequest{
+				Purchase:     &Purchase{ID: "p1", TransactionID: "tx-1", Amount: 100, Status: PurchaseCompleted},
+				Amount:       tt.amount,
+				Reason:       tt.reason,
+				RevokeAccess: true,
+			})
+			if !errors.Is(err, tt.wantErr) || (err != nil) != (tt.wantErr != nil) {
+				t.Fatalf("Refund() = %v, want %v", err, tt.wantErr)
+			}
+			if outcome == nil || outcome.Refund.ID != "r-old" || outcome.RefundedTotal != 40 || outcome.Remaining != 60 {
+				t.Errorf("outcome = %+v, want the earlier refund of 40", outcome)
+			}
+			if got := refunds.statuses["r-old"]; got != RefundCompleted {
+				t.Errorf("earlier refund status set to %q, want %q", got, RefundCompleted)
+			}
+			if refunds.revoked != tt.wantRevoked {
+				t.Errorf("access revoked = %v, want %v", refunds.revoked, tt.wantRevoked)
+			}
+			if len(provider.refunds) != 0 {
+				t.Errorf("provider refunded %v, want nothing new", provider.refunds)
+			}
+		})
+	}
+}
+
+// Access to a purchase nothing was paid for is revoked without a refund.
+func TestRefundFreePurchase(t *testing.T) {
+	provider := &stubPaymentProvider{}
+	refunds := &fakeRefunds{}
+	s := newTestRefundService(t, provider, refunds)
+
+	outcome, err := s.Refund(context.Background(), RefundRequest{
+		Purchase: &Purchase{ID: "p1", TransactionID: "tx-1", Amount: 0, Status: PurchaseCompleted},
+		Reason:   "abuse",
+	})
+	if err != nil {
+		t.Fatalf("Refund() error = %v", err)
+	}
+	if outcome.PurchaseStatus != PurchaseRefunded || outcome.Refund != nil || !refunds.revoked {
+		t.Errorf("outcome = %+v, revoked = %v, want access revoked without a refund", outcome, refunds.revoked)
+	}
+	if len(provider.refunds) != 0 {
+		t.Errorf("provider refunded %v, want nothing", provider.refunds)
+	}
+}
@@ -0,0 +1,199 @@
+package services
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"recipe-backend/internal/config"
+)
+
+// Size of each chunk sent to clamd. Must stay below clamd's StreamMaxLength.
+const clamdChunkSize = 64 * 1024
+
+var ErrScannerUnavailable = errors.New("malware scanner unavailable")
+
+// ErrScanTooLarge is returned when clamd refuses a stream longer than its
+// StreamMaxLength. clamd.conf must set StreamMaxLength to at least the
+// largest upload limit (MAX_VIDEO_SIZE_MB), or such uploads can never be
+// scanned.
+var ErrScanTooLarge = errors.New("file too large for the malware scanner")
+
+// InfectedFileError is returned when the scanner finds malware in an upload.
+type InfectedFileError struct {
+	Signature string
+}
+
+func (e *InfectedFileError) Error() string {
+	return fmt.Sprintf("file rejected: malware detected (%s)", e.Signature)
+}
+
+// ClamdScanner streams files to a ClamAV daemon using the INSTREAM command.
+type ClamdScanner struct {
+	network string
+	address string
+	timeout time.Duration
+}
+
+// NewClamdScanner creates a scanner for a clamd address such as
+// "localhost:3310" or "unix:/var/run/clamav/clamd.ctl".
+func NewClamdScanner(address string, timeout time.Duration) *ClamdScanner {
+	network := "tcp"
+	if strings.HasPrefix(address, "unix:") {
+		network = "unix"
+		address = strings.TrimPrefix(address, "unix:")
+	}
+
+	return &ClamdScanner{
+		network: network,
+		address: address,
+		timeout: timeout,
+	}
+}
+
+// Scan sends r to clamd. It returns an *InfectedFileError if malware was
+// found, ErrScanTooLarge if clamd refused the stream as too long and an
+// error wrapping ErrScannerUnavailable if the scan could not be completed.
+//
+// The timeout applies to each chunk and to the final reply rather than to
+// the whole scan, so large uploads are not cut off while clamd keeps
+// accepting data.
+func (s *ClamdScanner) Scan(r io.Reader) error {
+	conn, err := net.DialTimeout(s.network, s.address, s.timeout)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrScannerUnavailable, err)
+	}
+	defer conn.Close()
+
+	reader := bufio.NewReader(conn)
+
+	if err := s.write(conn, []byte("zINSTREAM\x00")); err != nil {
+		return fmt.Errorf("%w: %v", ErrScannerUnavailable, err)
+	}
+
+	// Each chunk is prefixed with its length
+	chunk := make([]byte, 4+clamdChunkSize)
+	for {
+		n, readErr := r.Read(chunk[4:])
+		if n > 0 {
+			binary.BigEndian.PutUint32(chunk, uint32(n))
+			if err := s.write(conn, chunk[:4+n]); err != nil {
+				return s.streamFailed(conn, reader, err)
+			}
+		}
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil {
+			return readErr
+		}
+	}
+
+	// A zero-length chunk ends the stream
+	if err := s.write(conn, []byte{0, 0, 0, 0}); err != nil {
+		return s.streamFailed(conn, reader, err)
+	}
+
+	reply, err := s.readReply(conn, reader)
+	if err != nil && reply == "" {
+		return fmt.Errorf("%w: %v", ErrScannerUnavailable, err)
+	}
+
+	return parseClamdReply(reply)
+}
+
+func (s *ClamdScanner) write(conn net.Conn, p []byte) error {
+	if err := conn.SetDeadline(time.Now().Add(s.timeout)); err != nil {
+		return err
+	}
+	_, err := conn.Write(p)
+	return err
+}
+
+func (s *ClamdScanner) readReply(conn net.Conn, reader *bufio.Reader) (string, error) {
+	if err := conn.SetDeadline(time.Now().Add(s.timeout)); err != nil {
+		return "", err
+	}
+	reply, err := reader.ReadString(0)
+	return strings.TrimRight(reply, "\x00\n"), err
+}
+
+// streamFailed explains a failed write. clamd answers and closes the
+// connection as soon as a stream exceeds StreamMaxLength, so the reply may
+// already be waiting.
+func (s *ClamdScanner) streamFailed(conn net.Conn, reader *bufio.Reader, err error) error {
+	if reply, _ := s.readReply(conn, reader); reply != "" {
+		if replyErr := parseClamdReply(reply); errors.Is(replyErr, ErrScanTooLarge) {
+			return replyErr
+		}
+	}
+	return fmt.Errorf("%w: %v", ErrScannerUnavailable, err)
+}
+
+// parseClamdReply interprets replies such as "stream: OK" or
+// "stream: Eicar-Test-Signature FOUND".
+func parseClamdReply(reply string) error {
+	result := strings.TrimSpace(strings.TrimPrefix(reply, "stream:"))
+
+	switch {
+	case result == "OK":
+		return nil
+	case strings.HasSuffix(result, " FOUND"):
+		return &InfectedFileError{Signature: strings.TrimSuffix(result, " FOUND")}
+	case strings.HasPrefix(result, "INSTREAM size limit exceeded"):
+		return ErrScanTooLarge
+	default:
+		return fmt.Errorf("%w: unexpected reply %q", ErrScannerUnavailable, reply)
+	}
+}
+
+// quarantine keeps a copy of a rejected file, with a description of why it
+// was rejected, outside the bucket for later inspection.
+func quarantine(cfg *config.Config, src io.ReadSeeker, fileName, userID, contentHash, signature string) error {
+	if err := os.MkdirAll(cfg.QuarantineDir, 0o700); err != nil {
+		return err
+	}
+
+	if _, err := src.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	base := filepath.Join(cfg.QuarantineDir, fmt.Sprintf("%d_%s", time.Now().Unix(), contentHash))
+
+	data, err := os.OpenFile(base+".bin", os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	defer data.Close()
+
+	if _, err := io.Copy(data, src); err != nil {
+		return err
+	}
+
+	details, err := json.Marshal(map[string]interface{}{
+		"user_id":      userID,
+		"file_name":    fileName,
+		"content_hash": contentHash,
+		"signature":    signature,
+		"detected_at":  time.Now().UTC().Format(time.RFC3339),
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(base+".json", details, 0o600); err != nil {
+		return err
+	}
+
+	log.Printf("Quarantined upload %q from user %s: %s", fileName, userID, signature)
+	return nil
+}
@@ -0,0 +1,322 @@
+package services
+
+import (
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"recipe-backend/internal/config"
+	"recipe-backend/internal/services/clamdtest"
+)
+
+func newScanningFileService(t *testing.T, address string, failOpen bool) *FileService {
+	t.Helper()
+
+	return NewFileService(&config.Config{
+		AWSRegion:     "us-east-1",
+		ClamdAddress:  address,
+		ClamdTimeout:  200 * time.Millisecond,
+		ClamdFailOpen: failOpen,
+		QuarantineDir: t.TempDir(),
+	})
+}
+
+// hangingClamd accepts connections and never replies.
+func hangingClamd(t *testing.T) string {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+
+	var mu sync.Mutex
+	var conns []net.Conn
+	t.Cleanup(func() {
+		listener.Close()
+		mu.Lock()
+		defer mu.Unlock()
+		for _, conn := range conns {
+			conn.Close()
+		}
+	})
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			mu.Lock()
+			conns = append(conns, conn)
+			mu.Unlock()
+		}
+	}()
+
+	return listener.Addr().String()
+}
+
+// closedAddress returns an address nothing listens on.
+func closedAddress(t *testing.T) string {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	address := listener.Addr().String()
+	listener.Close()
+	return address
+}
+
+func TestClamdScannerScan(t *testing.T) {
+	server := clamdtest.NewServer()
+	defer server.Close()
+	server.AddSignature("bad-macro", "Doc-Macro-Test")
+
+	tests := []struct {
+		name      string
+		content   string
+		signature string
+	}{
+		{name: "clean", content: "just a photo of doro wat"},
+		{name: "eicar", content: clamdtest.EICAR, signature: "Eicar-Test-Signature"},
+		{name: "custom signature", content: "header bad-macro trailer", signature: "Doc-Macro-Test"},
+		{name: "larger than one chunk", content: strings.Repeat("a", 3*clamdChunkSize+7) + clamdtest.EICAR, signature: "Eicar-Test-Signature"},
+	}
+
+	scanner := NewClamdScanner(server.Addr(), time.Second)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := scanner.Scan(strings.NewReader(tt.content))
+
+			if tt.signature == "" {
+				if err != nil {
+					t.Fatalf("Scan() = %v, want nil", err)
+				}
+				return
+			}
+
+			var infected *InfectedFileError
+			if !errors.As(err, &infected) {
+				t.Fatalf("Scan() = %v, want *InfectedFileError", err)
+			}
+			if infected.Signature != tt.signature {
+				t.Errorf("signature = %q, want %q", infected.Signature, tt.signature)
+			}
+		})
+	}
+
+	if got := server.Scans(); got != len(tests) {
+		t.Errorf("server answered %d scans, want %d", got, len(tests))
+	}
+}
+
+func TestClamdScannerUnavailable(t *testing.T) {
+	tests := []struct {
+		name    string
+		address string
+	}{
+		{name: "connection refused", address: closedAddress(t)},
+		{name: "timeout", address: hangingClamd(t)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scanner := NewClamdScanner(tt.address, 200*time.Millisecond)
+
+			start := time.Now()
+			err := scanner.Scan(strings.NewReader("content"))
+			if !errors.Is(err, ErrScannerUnavailable) {
+				t.Fatalf("Scan() = %v, want ErrScannerUnavailable", err)
+			}
+			if elapsed := time.Since(start); elapsed > 2*time.Second {
+				t.Errorf("Scan() took %v, want it bounded by the timeout", elapsed)
+			}
+		})
+	}
+}
+
+func TestClamdScannerStreamMaxLength(t *testing.T) {
+	server := clamdtest.NewServer()
+	defer server.Close()
+	server.SetStreamMaxLength(2 * clamdChunkSize)
+
+	scanner := NewClamdScanner(server.Addr(), time.Second)
+
+	if err := scanner.Scan(strings.NewReader(strings.Repeat("a", 2*clamdChunkSize))); err != nil {
+		t.Fatalf("Scan() at the limit = %v, want nil", err)
+	}
+
+	// clamd hangs up while the rest of the upload is still being sent
+	err := scanner.Scan(strings.NewReader(strings.Repeat("a", 64*clamdChunkSize)))
+	if !errors.Is(err, ErrScanTooLarge) {
+		t.Fatalf("Scan() past the limit = %v, want ErrScanTooLarge", err)
+	}
+}
+
+// slowReader returns one chunk per read after a delay, like an upload
+// arriving over a slow connection.
+type slowReader struct {
+	chunks int
+	delay  time.Duration
+}
+
+func (r *slowReader) Read(p []byte) (int, error) {
+	if r.chunks == 0 {
+		return 0, io.EOF
+	}
+	r.chunks--
+	time.Sleep(r.delay)
+	return copy(p, strings.Repeat("a", 1024)), nil
+}
+
+func TestClamdScannerTimeoutPerChunk(t *testing.T) {
+	server := clamdtest.NewServer()
+	defer server.Close()
+
+	// The whole scan takes well over the timeout, but no single step does
+	scanner := NewClamdScanner(server.Addr(), 200*time.Millisecond)
+	if err := scanner.Scan(&slowReader{chunks: 6, delay: 80 * time.Millisecond}); err != nil {
+		t.Fatalf("Scan() = %v, want nil", err)
+	}
+}
+
+func TestParseClamdReply(t *testing.T) {
+	tests := []struct {
+		reply       string
+		signature   string
+		tooLarge    bool
+		unavailable bool
+	}{
+		{reply: "stream: OK"},
+		{reply: "stream: Win.Test.EICAR_HDB-1 FOUND", signature: "Win.Test.EICAR_HDB-1"},
+		{reply: "INSTREAM size limit exceeded. ERROR", tooLarge: true},
+		{reply: "", unavailable: true},
+	}
+
+	for _, tt := range tests {
+		err := parseClamdReply(tt.reply)
+
+		var infected *InfectedFileError
+		switch {
+		case tt.tooLarge:
+			if !errors.Is(err, ErrScanTooLarge) || errors.Is(err, ErrScannerUnavailable) {
+				t.Errorf("parseClamdReply(%q) = %v, want ErrScanTooLarge", tt.reply, err)
+			}
+		case tt.unavailable:
+			if !errors.Is(err, ErrScannerUnavailable) {
+				t.Errorf("parseClamdReply(%q) = %v, want ErrScannerUnavailable", tt.reply, err)
+			}
+		case tt.signature != "":
+			if !errors.As(err, &infected) || infected.Signature != tt.signature {
+				t.Errorf("parseClamdReply(%q) = %v, want signature %q", tt.reply, err, tt.signature)
+			}
+		case err != nil:
+			t.Errorf("parseClamdReply(%q) = %v, want nil", tt.reply, err)
+		}
+	}
+}
+
+func TestFileServiceScanQuarantinesInfectedFiles(t *testing.T) {
+	server := clamdtest.NewServer()
+	defer server.Close()
+
+	s := newScanningFileService(t, server.Addr(), false)
+
+	err := s.scan(strings.NewReader(clamdtest.EICAR), "menu.pdf", "user-1", "abc123")
+	var infected *InfectedFileError
+	if !errors.As(err, &infected) {
+		t.Fatalf("scan() = %v, want *InfectedFileError", err)
+	}
+
+	data, err := filepath.Glob(filepath.Join(s.config.QuarantineDir, "*_abc123.bin"))
+	if err != nil || len(data) != 1 {
+		t.Fatalf("quarantined files = %v (%v), want one", data, err)
+	}
+
+	content, err := os.ReadFile(data[0])
+	if err != nil {
+		t.Fatalf("failed to read quarantined file: %v", err)
+	}
+	if string(content) != clamdtest.EICAR {
+		t.Errorf("quarantined content = %q, want the whole upload", content)
+	}
+
+	details, err := os.ReadFile(strings.TrimSuffix(data[0], ".bin") + ".json")
+	if err != nil {
+		t.Fatalf("failed to read quarantine details: %v", err)
+	}
+	for _, want := range []string{`"user_id":"user-1"`, `"file_name":"menu.pdf"`, `"signature":"Eicar-Test-Signature"`} {
+		if !strings.Contains(string(details), want) {
+			t.Errorf("quarantine details %s missing %s", details, want)
+		}
+	}
+}
+
+func TestFileServiceScanCleanFile(t *testing.T) {
+	server := clamdtest.NewServer()
+	defer server.Close()
+
+	s := newScanningFileService(t, server.Addr(), false)
+
+	src := strings.NewReader("a clean upload")
+	if err := s.scan(src, "photo.jpg", "user-1", "abc123"); err != nil {
+		t.Fatalf("scan() = %v, want nil", err)
+	}
+
+	// The content is read again when it is stored
+	if src.Len() != len("a clean upload") {
+		t.Errorf("scan() left the reader at offset %d, want it rewound", int(src.Size())-src.Len())
+	}
+
+	entries, _ := os.ReadDir(s.config.QuarantineDir)
+	if len(entries) != 0 {
+		t.Errorf("clean file was quarantined: %v", entries)
+	}
+}
+
+func TestFileServiceScanUnavailable(t *testing.T) {
+	tests := []struct {
+		name     string
+		address  string
+		failOpen bool
+	}{
+		{name: "refused, fail closed", address: closedAddress(t)},
+		{name: "refused, fail open", address: closedAddress(t), failOpen: true},
+		{name: "timeout, fail closed", address: hangingClamd(t)},
+		{name: "timeout, fail open", address: hangingClamd(t), failOpen: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newScanningFileService(t, tt.address, tt.failOpen)
+
+			err := s.scan(strings.NewReader("content"), "photo.jpg", "user-1", "abc123")
+
+			if tt.failOpen {
+				if err != nil {
+					t.Fatalf("scan() = %v, want the file stored unscanned", err)
+				}
+				return
+			}
+			if !errors.Is(err, ErrScannerUnavailable) {
+				t.Fatalf("scan() = %v, want ErrScannerUnavailable", err)
+			}
+		})
+	}
+}
+
+func TestFileServiceScanDisabled(t *testing.T) {
+	s := newScanningFileService(t, "", false)
+
+	if err := s.scan(strings.NewReader(clamdtest.EICAR), "menu.pdf", "user-1", "abc123"); err != nil {
+		t.Fatalf("scan() = %v, want nil when no scanner is configured", err)
+	}
+}
@@ -0,0 +1,751 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"recipe-backend/internal/config"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrPlanNotFound                = errors.New("subscription plan not found")
+	ErrPlanInvalid                 = errors.New("invalid subscription plan")
+	ErrPlanForbidden               = errors.New("not allowed to manage this subscription plan")
+	ErrOwnPlan                     = errors.New("you cannot subscribe to your own plan")
+	ErrAlreadySubscribed           = errors.New("you are already subscribed to this plan")
+	ErrSubscriptionNotFound        = errors.New("subscription not found")
+	ErrSubscriptionNotRenewable    = errors.New("subscription has no renewal to pay")
+	ErrSubscriptionPaymentNotFound = errors.New("subscription payment not found")
+	ErrSubscriptionEnded           = errors.New("subscription has already ended")
+)
+
+// Transaction references of subscription payments start with this prefix,
+// so provider callbacks can be told apart from recipe purchases.
+const SubscriptionTxPrefix = "sub-"
+
+// How many due subscriptions are read at a time
+const renewalBatchSize = 100
+
+// Notifier sends the emails that background jobs trigger.
+type Notifier interface {
+	Notify(ctx context.Context, recipientEmail, emailType string, data map[string]interface{}) error
+}
+
+// SubscriptionService sells subscriptions to plans covering every premium
+// recipe or all premium recipes of one chef.
+//
+// The provider has no stored cards, so each billing period is paid through
+// a checkout of its own. Subscribing starts the checkout for the first
+// period. Shortly before a period ends the renewal checkout is started and
+// its link emailed to the subscriber. A subscription whose renewal is not
+// paid by the end of the period becomes past due and keeps its access for
+// the grace period, then expires. Cancelling stops renewals; access lasts
+// until the end of the period already paid for.
+type SubscriptionService struct {
+	config        *config.Config
+	provider      PaymentProvider
+	ledgerService *LedgerService
+	hasuraService *HasuraService
+	notifier      Notifier
+}
+
+func NewSubscriptionService(cfg *config.Config, provider PaymentProvider, ledgerService *LedgerService, hasuraService *HasuraService, notifier Notifier) *SubscriptionService {
+	return &SubscriptionService{
+		config:        cfg,
+		provider:      provider,
+		ledgerService: ledgerService,
+		hasuraService: hasuraService,
+		notifier:      notifier,
+	}
+}
+
+// CreatePlan validates and stores a plan. Chefs create plans for their own
+// recipes; only admins may create plans covering every premium recipe.
+func (s *SubscriptionService) CreatePlan(ctx context.Context, plan SubscriptionPlan) (*SubscriptionPlan, error) {
+	plan.Name = strings.TrimSpace(plan.Name)
+	if plan.Name == "" {
+		return nil, fmt.Errorf("%w: name is required", ErrPlanInvalid)
+	}
+	if plan.Price <= 0 {
+		return nil, fmt.Errorf("%w: price must be positive", ErrPlanInvalid)
+	}
+	plan.Price = roundMoney(plan.Price)
+
+	if plan.BillingInterval == "" {
+		plan.BillingInterval = "month"
+	}
+	if plan.BillingInterval != "month" && plan.BillingInterval != "year" {
+		return nil, fmt.Errorf("%w: billing interval must be month or year", ErrPlanInvalid)
+	}
+
+	switch plan.Scope {
+	case PlanScopeChef:
+		plan.ChefID = plan.CreatedBy
+	case PlanScopeAllPremium:
+		isAdmin, err := s.hasuraService.IsAdmin(ctx, plan.CreatedBy)
+		if err != nil {
+			return nil, err
+		}
+		if !isAdmin {
+			return nil, ErrPlanForbidden
+		}
+		plan.ChefID = ""
+	default:
+		return nil, fmt.Errorf("%w: unknown scope %q", ErrPlanInvalid, plan.Scope)
+	}
+
+	return s.hasuraService.CreateSubscriptionPlan(ctx, plan)
+}
+
+// DeactivatePlan stops new subscriptions to a plan. Only its creator or an
+// admin may do this.
+func (s *SubscriptionService) DeactivatePlan(ctx context.Context, planID, userID string) (*SubscriptionPlan, error) {
+	plan, err := s.hasuraService.GetSubscriptionPlan(ctx, planID)
+	if err != nil {
+		return nil, err
+	}
+	if plan == nil {
+		return nil, ErrPlanNotFound
+	}
+
+	if plan.CreatedBy != userID {
+		isAdmin, err := s.hasuraService.IsAdmin(ctx, userID)
+		if err != nil {
+			return nil, err
+		}
+		if !isAdmin {
+			return nil, ErrPlanForbidden
+		}
+	}
+
+	if err := s.hasuraService.DeactivateSubscriptionPlan(ctx, plan.ID); err != nil {
+		return nil, err
+	}
+
+	plan.IsActive = false
+	return plan, nil
+}
+
+// Subscribe starts a subscription to a plan and the checkout for its first
+// period. Subscribing again while the first checkout is open returns it.
+func (s *SubscriptionService) Subscribe(ctx context.Context, userID, email, planID, callbackURL, returnURL string) (*Subscription, *SubscriptionPayment, error) {
+	plan, err := s.hasuraService.GetSubscriptionPlan(ctx, planID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if plan == nil || !plan.IsActive {
+		return nil, nil, ErrPlanNotFound
+	}
+	if plan.ChefID == userID {
+		return nil, nil, ErrOwnPlan
+	}
+
+	open, err := s.hasuraService.GetOpenSubscription(ctx, userID, plan.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if open != nil {
+		if open.Status != SubscriptionPending {
+			return nil, nil, ErrAlreadySubscribed
+		}
+
+		payment, err := s.hasuraService.GetPendingSubscriptionPayment(ctx, open.ID)
+		if err != nil {
+			return nil, nil, err
+		}
+		if payment != nil && payment.CheckoutURL != "" {
+			return open, payment, nil
+		}
+
+		// The first checkout was never started; give up on it
+		if err := s.end(ctx, open, SubscriptionExpired); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	now := time.Now().UTC()
+	subscription := &Subscription{
+		ID:     uuid.New().String(),
+		UserID: userID,
+		PlanID: plan.ID,
+		ChefID: plan.ChefID,
+		Status: SubscriptionPending,
+	}
+	payment := s.newPayment(subscription, plan, now)
+
+	if err := s.hasuraService.CreateSubscription(ctx, subscription, payment); err != nil {
+		// Only one open subscription per user and plan
+		if strings.Contains(err.Error(), "idx_subscriptions_open_user_plan") {
+			return nil, nil, ErrAlreadySubscribed
+		}
+		return nil, nil, err
+	}
+
+	if err := s.startCheckout(ctx, payment, plan, email, callbackURL, returnURL); err != nil {
+		if _, closeErr := s.hasuraService.CloseSubscriptionPayment(ctx, payment.TransactionID, SubscriptionPaymentFailed); closeErr != nil {
+			log.Printf("Failed to mark subscription payment %s as failed: %v", payment.TransactionID, closeErr)
+		}
+		if endErr := s.end(ctx, subscription, SubscriptionExpired); endErr != nil {
+			log.Printf("Failed to expire subscription %s: %v", subscription.ID, endErr)
+		}
+		return nil, nil, err
+	}
+
+	return subscription, payment, nil
+}
+
+// Renew returns the open renewal checkout of a subscription, starting one if
+// the current period is about to end or already has.
+func (s *SubscriptionService) Renew(ctx context.Context, subscriptionID, userID, email string) (*SubscriptionPayment, error) {
+	subscription, err := s.hasuraService.GetSubscription(ctx, subscriptionID)
+	if err != nil {
+		return nil, err
+	}
+	if subscription == nil || subscription.UserID != userID {
+		return nil, ErrSubscriptionNotFound
+	}
+
+	if subscription.Status != SubscriptionActive && subscription.Status != SubscriptionPastDue {
+		return nil, ErrSubscriptionNotRenewable
+	}
+	if subscription.CancelAtPeriodEnd {
+		return nil, ErrSubscriptionNotRenewable
+	}
+
+	periodEnd, err := time.Parse(time.RFC3339Nano, subscription.CurrentPeriodEnd)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse period end: %w", err)
+	}
+	if time.Until(periodEnd) > s.config.SubscriptionRenewalNotice {
+		return nil, ErrSubscriptionNotRenewable
+	}
+
+	payment, _, err := s.renewal(ctx, subscription, email)
+	return payment, err
+}
+
+// renewal returns the open payment for the period after the current one,
+// starting its checkout if there is none yet. It reports whether a new
+// checkout was started.
+func (s *SubscriptionService) renewal(ctx context.Context, subscription *Subscription, email string) (*SubscriptionPayment, bool, error) {
+	payment, err := s.hasuraService.GetPendingSubscriptionPayment(ctx, subscription.ID)
+	if err != nil {
+		return nil, false, err
+	}
+	if payment != nil && payment.CheckoutURL != "" {
+		return payment, false, nil
+	}
+	if payment != nil {
+		// A checkout that never got its URL cannot be paid
+		if _, err := s.hasuraService.CloseSubscriptionPayment(ctx, payment.TransactionID, SubscriptionPaymentFailed); err != nil {
+			return nil, false, err
+		}
+	}
+
+	plan, err := s.hasuraService.GetSubscriptionPlan(ctx, subscription.PlanID)
+	if err != nil {
+		return nil, false, err
+	}
+	if plan == nil {
+		return nil, false, ErrPlanNotFound
+	}
+
+	periodEnd, err := time.Parse(time.RFC3339Nano, subscription.CurrentPeriodEnd)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to parse period end: %w", err)
+	}
+
+	payment = s.newPayment(subscription, plan, periodEnd)
+	if err := s.hasuraService.CreateSubscriptionPayment(ctx, payment); err != nil {
+		return nil, false, err
+	}
+
+	if err := s.startCheckout(ctx, payment, plan, email, "", ""); err != nil {
+		if _, closeErr := s.hasuraService.CloseSubscriptionPayment(ctx, payment.TransactionID, SubscriptionPaymentFailed); closeErr != nil {
+			log.Printf("Failed to mark subscription payment %s as failed: %v", payment.TransactionID, closeErr)
+		}
+		return nil, false, err
+	}
+
+	return payment, true, nil
+}
+
+// newPayment prepares the payment for the billing period starting at start.
+func (s *SubscriptionService) newPayment(subscription *Subscription, plan *SubscriptionPlan, start time.Time) *SubscriptionPayment {
+	return &SubscriptionPayment{
+		ID:             uuid.New().String(),
+		SubscriptionID: subscription.ID,
+		UserID:         subscription.UserID,
+		Amount:         plan.Price,
+		TransactionID:  SubscriptionTxPrefix + uuid.New().String(),
+		Status:         SubscriptionPaymentPending,
+		PeriodStart:    start.UTC().Format(time.RFC3339Nano),
+		PeriodEnd:      nextPeriod(billingAnchor(subscription, start), start, plan.BillingInterval).UTC().Format(time.RFC3339Nano),
+	}
+}
+
+// startCheckout initializes the payment with the provider and saves the
+// checkout URL on it.
+func (s *SubscriptionService) startCheckout(ctx context.Context, payment *SubscriptionPayment, plan *SubscriptionPlan, email, callbackURL, returnURL string) error {
+	response, err := s.provider.InitializePayment(InitializePaymentRequest{
+		Amount:      fmt.Sprintf("%.2f", payment.Amount),
+		Currency:    LedgerCurrency,
+		Email:       email,
+		FirstName:   "Recipe",
+		LastName:    "User",
+		TxRef:       payment.TransactionID,
+		CallbackURL: callbackURL,
+		ReturnURL:   returnURL,
+		Description: "Subscription " + plan.Name,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to initialize payment: %w", err)
+	}
+
+	payment.CheckoutURL = response.Data.CheckoutURL
+	if err := s.hasuraService.SetSubscriptionPaymentCheckoutURL(ctx, payment.TransactionID, payment.CheckoutURL); err != nil {
+		// The checkout still works; only retries will not find it
+		log.Printf("Failed to save checkout URL for subscription payment %s: %v", payment.TransactionID, err)
+	}
+
+	return nil
+}
+
+// Settle verifies a pending subscription payment with the payment provider
+// and records the result. A completed payment extends the subscription by
+// the period it paid for. Settling is idempotent, like settling purchases.
+func (s *SubscriptionService) Settle(ctx context.Context, transactionID string) (*SubscriptionPayment, error) {
+	payment, err := s.hasuraService.GetSubscriptionPaymentByTransactionID(ctx, transactionID)
+	if err != nil {
+		return nil, err
+	}
+	if payment == nil {
+		return nil, ErrSubscriptionPaymentNotFound
+	}
+
+	// Expired renewals are verified too, so a late payment still counts
+	if payment.Status != SubscriptionPaymentPending && payment.Status != SubscriptionPaymentExpired {
+		return payment, nil
+	}
+
+	response, err := s.provider.VerifyPayment(transactionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to verify payment: %w", err)
+	}
+
+	switch response.Data.Status {
+	case "success":
+		paid, err := response.Data.Amount.Float64()
+		if err != nil || paid+0.005 < payment.Amount {
+			log.Printf("Subscription payment %s amount %q does not cover %.2f", transactionID, response.Data.Amount, payment.Amount)
+			return s.fail(ctx, payment)
+		}
+		return s.complete(ctx, payment)
+	case "failed":
+		return s.fail(ctx, payment)
+	}
+
+	return payment, nil
+}
+
+// complete records a paid period on the subscription.
+func (s *SubscriptionService) complete(ctx context.Context, payment *SubscriptionPayment) (*SubscriptionPayment, error) {
+	subscription, err := s.hasuraService.GetSubscription(ctx, payment.SubscriptionID)
+	if err != nil {
+		return nil, err
+	}
+	if subscription == nil {
+		return nil, ErrSubscriptionNotFound
+	}
+
+	plan, err := s.hasuraService.GetSubscriptionPlan(ctx, subscription.PlanID)
+	if err != nil {
+		return nil, err
+	}
+	if plan == nil {
+		return nil, ErrPlanNotFound
+	}
+
+	// A first payment, or one arriving after the subscription ended, starts
+	// the period when it is paid. A renewal continues the paid period.
+	start, err := time.Parse(time.RFC3339Nano, payment.PeriodStart)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse period start: %w", err)
+	}
+	restarted := subscription.Status != SubscriptionActive && subscription.Status != SubscriptionPastDue
+	if restarted {
+		start = time.Now().UTC()
+	}
+
+	// Periods are counted from the first one, so an end clamped to a short
+	// month does not move the following ends
+	anchor := billingAnchor(subscription, start)
+	if restarted {
+		anchor = start
+	}
+	end := nextPeriod(anchor, start, plan.BillingInterval)
+
+	changes := map[string]interface{}{
+		"status":               SubscriptionActive,
+		"current_period_start": start.UTC().Format(time.RFC3339Nano),
+		"current_period_end":   end.UTC().Format(time.RFC3339Nano),
+		"billing_anchor":       anchor.UTC().Format(time.RFC3339Nano),
+		"grace_until":          nil,
+		"last_payment_id":      payment.ID,
+	}
+	if subscription.Status == SubscriptionCanceled {
+		// A late payment after cancelling still buys the period, but does
+		// not resume renewals
+		changes["cancel_at_period_end"] = true
+	}
+
+	completed, err := s.hasuraService.CompleteSubscriptionPayment(ctx, payment, changes, s.ledgerService.SubscriptionEntries(plan, payment))
+	if err != nil {
+		return nil, err
+	}
+	if !completed {
+		// Settled concurrently; report the payment as it was recorded
+		return s.hasuraService.GetSubscriptionPaymentByTransactionID(ctx, payment.TransactionID)
+	}
+
+	payment.Status = SubscriptionPaymentCompleted
+	payment.PeriodStart = start.UTC().Format(time.RFC3339Nano)
+	payment.PeriodEnd = end.UTC().Format(time.RFC3339Nano)
+	return payment, nil
+}
+
+// fail records a declined payment. A subscription whose first payment fails
+// never started and expires; a failed renewal leaves the subscription to
+// run into its grace period.
+func (s *SubscriptionService) fail(ctx context.Context, payment *SubscriptionPayment) (*SubscriptionPayment, error) {
+	if _, err := s.hasuraService.CloseSubscriptionPayment(ctx, payment.TransactionID, SubscriptionPaymentFailed); err != nil {
+		return nil, err
+	}
+	payment.Status = SubscriptionPaymentFailed
+
+	subscription, err := s.hasuraService.GetSubscription(ctx, payment.SubscriptionID)
+	if err != nil {
+		return nil, err
+	}
+	if subscription != nil && subscription.Status == SubscriptionPending {
+		if _, err := s.hasuraService.TransitionSubscription(ctx, subscription.ID, SubscriptionPending, map[string]interface{}{
+			"status": SubscriptionExpired,
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	return payment, nil
+}
+
+// Cancel stops a subscription from renewing. A paid period runs to its end;
+// a subscription that has not been paid for, or is past due, ends now.
+func (s *SubscriptionService) Cancel(ctx context.Context, subscriptionID, userID string) (*Subscription, error) {
+	subscription, err := s.hasuraService.GetSubscription(ctx, subscriptionID)
+	if err != nil {
+		return nil, err
+	}
+	if subscription == nil || subscription.UserID != userID {
+		return nil, ErrSubscriptionNotFound
+	}
+
+	now := time.Now().UTC().Format(time.RFC3339Nano)
+	switch subscription.Status {
+	case SubscriptionActive:
+		if subscription.CancelAtPeriodEnd {
+			return subscription, nil
+		}
+
+		updated, err := s.hasuraService.TransitionSubscription(ctx, subscription.ID, SubscriptionActive, map[string]interface{}{
+			"cancel_at_period_end": true,
+			"canceled_at":          now,
+		})
+		if err != nil {
+			return nil, err
+		}
+		if !updated {
+			return nil, ErrSubscriptionEnded
+		}
+
+		// An open renewal checkout must not be paid any more
+		if err := s.closeOpenPayment(ctx, subscription.ID, SubscriptionPaymentExpired); err != nil {
+			return nil, err
+		}
+
+		subscription.CancelAtPeriodEnd = true
+		subscription.CanceledAt = now
+	case SubscriptionPending, SubscriptionPastDue:
+		if err := s.end(ctx, subscription, SubscriptionCanceled); err != nil {
+			return nil, err
+		}
+		subscription.CanceledAt = now
+	default:
+		return nil, ErrSubscriptionEnded
+	}
+
+	return subscription, nil
+}
+
+// end closes a pending or past due subscription and its open payment.
+func (s *SubscriptionService) end(ctx context.Context, subscription *Subscription, status string) error {
+	changes := map[string]interface{}{"status": status}
+	if status == SubscriptionCanceled {
+		changes["canceled_at"] = time.Now().UTC().Format(time.RFC3339Nano)
+	}
+
+	updated, err := s.hasuraService.TransitionSubscription(ctx, subscription.ID, subscription.Status, changes)
+	if err != nil {
+		return err
+	}
+	if !updated {
+		return ErrSubscriptionEnded
+	}
+
+	subscription.Status = status
+	return s.closeOpenPayment(ctx, subscription.ID, SubscriptionPaymentExpired)
+}
+
+func (s *SubscriptionService) closeOpenPayment(ctx context.Context, subscriptionID, status string) error {
+	payment, err := s.hasuraService.GetPendingSubscriptionPayment(ctx, subscriptionID)
+	if err != nil {
+		return err
+	}
+	if payment == nil {
+		return nil
+	}
+
+	_, err = s.hasuraService.CloseSubscriptionPayment(ctx, payment.TransactionID, status)
+	return err
+}
+
+type SubscriptionRenewReport struct {
+	Checked  int      `json:"checked"`
+	Renewing int      `json:"renewing"`
+	Renewed  int      `json:"renewed"`
+	PastDue  int      `json:"past_due"`
+	Ended    int      `json:"ended"`
+	Errors   []string `json:"errors,omitempty"`
+}
+
+// ProcessRenewals moves subscriptions through their billing cycle: it
+// starts renewal checkouts for periods about to end, settles renewals that
+// were paid, makes unpaid subscriptions past due and ends those whose grace
+// period is over or that were cancelled. Every due subscription is checked,
+// a page at a time, so those waiting out their grace period never hold up
+// the ones behind them.
+func (s *SubscriptionService) ProcessRenewals(ctx context.Context) (*SubscriptionRenewReport, error) {
+	now := time.Now()
+	report := &SubscriptionRenewReport{}
+
+	// Pages are read by (current_period_end, id), so subscriptions whose
+	// periods end at the same instant are not skipped between pages
+	after, afterID := "", ""
+
+	for {
+		subscriptions, err := s.hasuraService.ListDueSubscriptions(ctx, after, afterID, now.Add(s.config.SubscriptionRenewalNotice), renewalBatchSize)
+		if err != nil {
+			return report, err
+		}
+
+		for i := range subscriptions {
+			if ctx.Err() != nil {
+				return report, ctx.Err()
+			}
+
+			report.Checked++
+			after, afterID = subscriptions[i].CurrentPeriodEnd, subscriptions[i].ID
+			if err := s.process(ctx, &subscriptions[i], now, report); err != nil {
+				report.Errors = append(report.Errors, fmt.Sprintf("%s: %v", subscriptions[i].ID, err))
+			}
+		}
+
+		if len(subscriptions) < renewalBatchSize {
+			break
+		}
+	}
+
+	return report, nil
+}
+
+func (s *SubscriptionService) process(ctx context.Context, subscription *Subscription, now time.Time, report *SubscriptionRenewReport) error {
+	periodEnd, err := time.Parse(time.RFC3339Nano, subscription.CurrentPeriodEnd)
+	if err != nil {
+		return fmt.Errorf("failed to parse period end: %w", err)
+	}
+
+	// A renewal may have been paid without the provider's callback arriving
+	if periodEnd.Before(now) {
+		payment, err := s.hasuraService.GetPendingSubscriptionPayment(ctx, subscription.ID)
+		if err != nil {
+			return err
+		}
+		if payment != nil {
+			settled, err := s.Settle(ctx, payment.TransactionID)
+			if err != nil {
+				log.Printf("Failed to verify subscription payment %s: %v", payment.TransactionID, err)
+			} else if settled.Status == SubscriptionPaymentCompleted {
+				report.Renewed++
+				return nil
+			}
+		}
+	}
+
+	switch {
+	case subscription.CancelAtPeriodEnd && periodEnd.Before(now):
+		if err := s.end(ctx, subscription, SubscriptionCanceled); err != nil {
+			return err
+		}
+		report.Ended++
+
+	case subscription.CancelAtPeriodEnd:
+		// Runs out at the end of the period
+
+	case subscription.Status == SubscriptionActive && periodEnd.Before(now):
+		graceUntil := periodEnd.Add(s.config.SubscriptionGracePeriod)
+		updated, err := s.hasuraService.TransitionSubscription(ctx, subscription.ID, SubscriptionActive, map[string]interface{}{
+			"status":      SubscriptionPastDue,
+			"grace_until": graceUntil.UTC().Format(time.RFC3339Nano),
+		})
+		if err != nil {
+			return err
+		}
+		if updated {
+			report.PastDue++
+			s.notify(ctx, subscription, "subscription_past_due", map[string]interface{}{
+				"grace_until": graceUntil.Format("January 2, 2006"),
+			})
+		}
+
+	case subscription.Status == SubscriptionPastDue:
+		graceUntil, err := time.Parse(time.RFC3339Nano, subscription.GraceUntil)
+		if err != nil || !graceUntil.After(now) {
+			if err := s.end(ctx, subscription, SubscriptionExpired); err != nil {
+				return err
+			}
+			report.Ended++
+			s.notify(ctx, subscription, "subscription_expired", nil)
+		}
+
+	default:
+		// The period ends soon; make sure the renewal checkout exists
+		user, err := s.hasuraService.GetUserByID(ctx, subscription.UserID)
+		if err != nil {
+			return err
+		}
+		if user == nil {
+			return fmt.Errorf("subscriber %s not found", subscription.UserID)
+		}
+
+		payment, started, err := s.renewal(ctx, subscription, user.Email)
+		if err != nil {
+			return err
+		}
+		if started {
+			report.Renewing++
+			s.notify(ctx, subscription, "subscription_renewal", map[string]interface{}{
+				"checkout_url": payment.CheckoutURL,
+				"amount":       fmt.Sprintf("%.2f", payment.Amount),
+				"period_end":   periodEnd.Format("January 2, 2006"),
+			})
+		}
+	}
+
+	return nil
+}
+
+// notify emails the subscriber; failures are only logged.
+func (s *SubscriptionService) notify(ctx context.Context, subscription *Subscription, emailType string, data map[string]interface{}) {
+	if s.notifier == nil {
+		return
+	}
+
+	user, err := s.hasuraService.GetUserByID(ctx, subscription.UserID)
+	if err != nil || user == nil {
+		log.Printf("Failed to look up subscriber of %s: %v", subscription.ID, err)
+		return
+	}
+
+	plan, err := s.hasuraService.GetSubscriptionPlan(ctx, subscription.PlanID)
+	if err != nil || plan == nil {
+		log.Printf("Failed to look up plan of subscription %s: %v", subscription.ID, err)
+		return
+	}
+
+	if data == nil {
+		data = map[string]interface{}{}
+	}
+	data["user_name"] = user.FullName
+	data["plan_name"] = plan.Name
+	data["subscription_id"] = subscription.ID
+
+	if err := s.notifier.Notify(ctx, user.Email, emailType, data); err != nil {
+		log.Printf("Failed to email subscriber of %s: %v", subscription.ID, err)
+	}
+}
+
+// Start processes renewals on the configured interval until ctx is done.
+func (s *SubscriptionService) Start(ctx context.Context) {
+	if s.config.SubscriptionRenewInterval <= 0 {
+		log.Println("Subscription renewals disabled")
+		return
+	}
+
+	ticker := time.NewTicker(s.config.SubscriptionRenewInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			report, err := s.ProcessRenewals(ctx)
+			if err != nil {
+				log.Printf("Subscription renewals failed: %v", err)
+				continue
+			}
+			if report.Checked > 0 {
+				log.Printf("Subscription renewals: checked=%d renewing=%d renewed=%d past_due=%d ended=%d errors=%d",
+					report.Checked, report.Renewing, report.Renewed, report.PastDue, report.Ended, len(report.Errors))
+			}
+		}
+	}
+}
+
+// nextPeriod returns the end of the billing period starting at start for a
+// subscription billed from anchor. Periods end on the anchor's day of the
+// month, or on the last day of months that do not have it, so a
+// subscription started on January 31 renews on February 28 and then on
+// March 31.
+func nextPeriod(anchor, start time.Time, interval string) time.Time {
+	months := 1
+	if interval == "year" {
+		months = 12
+	}
+
+	// Whole months from the anchor to the start of this period
+	elapsed := (start.Year()-anchor.Year())*12 + int(start.Month()-anchor.Month())
+	months += elapsed
+
+	first := time.Date(anchor.Year(), anchor.Month()+time.Month(months), 1,
+		anchor.Hour(), anchor.Minute(), anchor.Second(), anchor.Nanosecond(), anchor.Location())
+	day := anchor.Day()
+	if last := first.AddDate(0, 1, -1).Day(); day > last {
+		day = last
+	}
+	return first.AddDate(0, 0, day-1)
+}
+
+// billingAnchor returns the time a subscription's billing periods are
+// counted from, or start if it has not been paid for yet.
+func billingAnchor(subscription *Subscription, start time.Time) time.Time {
+	if anchor, err := time.Parse(time.RFC3339Nano, subscription.BillingAnchor); err == nil {
+		return anchor
+	}
+	return start
+}
@@ -0,0 +1,219 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"recipe-backend/internal/config"
+)
+
+// dueSubscriptions answers ListDueSubscriptions like Hasura would, one page
+// at a time after the cursor in the where clause.
+func dueSubscriptions(subscriptions []Subscription, variables map[string]interface{}) []Subscription {
+	where := variables["where"].(map[string]interface{})
+	limit := int(variables["limit"].(float64))
+
+	var afterEnd, afterID string
+	if or, ok := where["_or"].([]interface{}); ok {
+		afterEnd = or[0].(map[string]interface{})["current_period_end"].(map[string]interface{})["_gt"].(string)
+		afterID = or[1].(map[string]interface{})["id"].(map[string]interface{})["_gt"].(string)
+	}
+
+	var page []Subscription
+	for _, subscription := range subscriptions {
+		if afterEnd != "" && (subscription.CurrentPeriodEnd < afterEnd || (subscription.CurrentPeriodEnd == afterEnd && subscription.ID <= afterID)) {
+			continue
+		}
+		if len(page) == limit {
+			break
+		}
+		page = append(page, subscription)
+	}
+	return page
+}
+
+// Past due subscriptions waiting out their grace period are older than any
+// other due subscription, so they come first on every run. More of them
+// than fit on a page must not keep later subscriptions from being handled.
+func TestProcessRenewalsPagesPastGracePeriods(t *testing.T) {
+	now := time.Now().UTC()
+	periodEnd := now.Add(-48 * time.Hour).Format(time.RFC3339Nano)
+	graceUntil := now.Add(72 * time.Hour).Format(time.RFC3339Nano)
+
+	var subscriptions []Subscription
+	for i := 0; i < 2*renewalBatchSize+10; i++ {
+		subscriptions = append(subscriptions, Subscription{
+			ID:               fmt.Sprintf("sub-%03d", i),
+			UserID:           "reader-1",
+			PlanID:           "plan-1",
+			Status:           SubscriptionPastDue,
+			CurrentPeriodEnd: periodEnd,
+			GraceUntil:       graceUntil,
+		})
+	}
+	subscriptions = append(subscriptions, Subscription{
+		ID:               "sub-unpaid",
+		UserID:           "reader-2",
+		PlanID:           "plan-1",
+		Status:           SubscriptionActive,
+		CurrentPeriodEnd: now.Add(-time.Hour).Format(time.RFC3339Nano),
+	})
+	sort.Slice(subscriptions, func(i, j int) bool {
+		if subscriptions[i].CurrentPeriodEnd != subscriptions[j].CurrentPeriodEnd {
+			return subscriptions[i].CurrentPeriodEnd < subscriptions[j].CurrentPeriodEnd
+		}
+		return subscriptions[i].ID < subscriptions[j].ID
+	})
+
+	var madePastDue []string
+	hasura := newFakeHasura(t, func(query string, variables map[string]interface{}) interface{} {
+		switch {
+		case strings.Contains(query, "ListDueSubscriptions"):
+			return map[string]interface{}{"subscriptions": dueSubscriptions(subscriptions, variables)}
+		case strings.Contains(query, "GetPendingSubscriptionPayment"):
+			return map[string]interface{}{"subscription_payments": []interface{}{}}
+		case strings.Contains(query, "TransitionSubscription"):
+			madePastDue = append(madePastDue, variables["id"].(string))
+			return map[string]interface{}{"update_subscriptions": map[string]interface{}{"affected_rows": 1}}
+		}
+		t.Errorf("unexpected query %s", query)
+		return nil
+	})
+
+	cfg := &config.Config{
+		PlatformCommission:        15,
+		SubscriptionRenewalNotice: 72 * time.Hour,
+		SubscriptionGracePeriod:   5 * 24 * time.Hour,
+	}
+	s := NewSubscriptionService(cfg, &stubPaymentProvider{}, NewLedgerService(cfg, hasura), hasura, nil)
+
+	report, err := s.ProcessRenewals(context.Background())
+	if err != nil {
+		t.Fatalf("ProcessRenewals() = %v", err)
+	}
+
+	if report.Checked != len(subscriptions) {
+		t.Errorf("checked %d subscriptions, want all %d", report.Checked, len(subscriptions))
+	}
+	if len(madePastDue) != 1 || madePastDue[0] != "sub-unpaid" {
+		t.Errorf("made %v past due, want [sub-unpaid]", madePastDue)
+	}
+}
+
+func TestNextPeriod(t *testing.T) {
+	tests := []struct {
+		name     string
+		anchor   string
+		start    string
+		interval string
+		want     string
+	}{
+		{name: "month", anchor: "2025-03-15T10:00:00Z", start: "2025-03-15T10:00:00Z", interval: "month", want: "2025-04-15T10:00:00Z"},
+		{name: "month end", anchor: "2025-01-31T10:00:00Z", start: "2025-01-31T10:00:00Z", interval: "month", want: "2025-02-28T10:00:00Z"},
+		{name: "after a short month", anchor: "2025-01-31T10:00:00Z", start: "2025-02-28T10:00:00Z", interval: "month", want: "2025-03-31T10:00:00Z"},
+		{name: "into a 30-day month", anchor: "2025-01-31T10:00:00Z", start: "2025-03-31T10:00:00Z", interval: "month", want: "2025-04-30T10:00:00Z"},
+		{name: "month end in leap year", anchor: "2024-01-31T10:00:00Z", start: "2024-01-31T10:00:00Z", interval: "month", want: "2024-02-29T10:00:00Z"},
+		{name: "december", anchor: "2025-10-31T10:00:00Z", start: "2025-12-31T10:00:00Z", interval: "month", want: "2026-01-31T10:00:00Z"},
+		{name: "anchored on the 30th", anchor: "2025-01-30T10:00:00Z", start: "2025-02-28T10:00:00Z", interval: "month", want: "2025-03-30T10:00:00Z"},
+		{name: "year", anchor: "2025-06-01T10:00:00Z", start: "2025-06-01T10:00:00Z", interval: "year", want: "2026-06-01T10:00:00Z"},
+		{name: "leap day", anchor: "2024-02-29T10:00:00Z", start: "2024-02-29T10:00:00Z", interval: "year", want: "2025-02-28T10:00:00Z"},
+		{name: "leap day, next leap year", anchor: "2024-02-29T10:00:00Z", start: "2027-02-28T10:00:00Z", interval: "year", want: "2028-02-29T10:00:00Z"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			anchor, _ := time.Parse(time.RFC3339, tt.anchor)
+			start, _ := time.Parse(time.RFC3339, tt.start)
+			if got := nextPeriod(anchor, start, tt.interval).Format(time.RFC3339); got != tt.want {
+				t.Errorf("nextPeriod(%s, %s, %s) = %s, want %s", tt.anchor, tt.start, tt.interval, got, tt.want)
+			}
+		})
+	}
+}
+
+// Renewing a subscription anchored on the 31st runs each period to the
+// anchor day, not to the day the previous period was clamped to.
+func TestRenewalKeepsBillingAnchor(t *testing.T) {
+	s := &SubscriptionService{}
+	subscription := &Subscription{ID: "sub-1", BillingAnchor: "2025-01-31T10:00:00Z"}
+	plan := &SubscriptionPlan{BillingInterval: "month", Price: 100}
+
+	start, _ := time.Parse(time.RFC3339, "2025-02-28T10:00:00Z")
+	payment := s.newPayment(subscription, plan, start)
+	if payment.PeriodEnd != "2025-03-31T10:00:00Z" {
+		t.Errorf("renewal period ends %s, want 2025-03-31T10:00:00Z", payment.PeriodEnd)
+	}
+
+	// Not paid for yet: the first period anchors the subscription
+	first := s.newPayment(&Subscription{ID: "sub-2"}, plan, start)
+	if first.PeriodEnd != "2025-03-28T10:00:00Z" {
+		t.Errorf("first period ends %s, want 2025-03-28T10:00:00Z", first.PeriodEnd)
+	}
+}
+
+// A payment settled by the webhook and a verification at the same time is
+// completed by only one of them. The other must report the payment as
+// recorded rather than the period it computed itself.
+func TestSettleSubscriptionPaymentCompletedConcurrently(t *testing.T) {
+	payment := SubscriptionPayment{
+		ID:             "payment-1",
+		SubscriptionID: "sub-1",
+		UserID:         "reader-1",
+		Amount:         100,
+		TransactionID:  "tx-1",
+		Status:         SubscriptionPaymentPending,
+		PeriodStart:    "2025-01-31T10:00:00Z",
+	}
+	recorded := payment
+	recorded.Status = SubscriptionPaymentCompleted
+	recorded.PeriodEnd = "2025-02-28T10:00:00Z"
+
+	completed := false
+	hasura := newFakeHasura(t, func(query string, variables map[string]interface{}) interface{} {
+		switch {
+		case strings.Contains(query, "GetSubscriptionPaymentByTransactionID"):
+			if completed {
+				return map[string]interface{}{"subscription_payments": []SubscriptionPayment{recorded}}
+			}
+			return map[string]interface{}{"subscription_payments": []SubscriptionPayment{payment}}
+		case strings.Contains(query, "GetSubscriptionPlan"):
+			return map[string]interface{}{"subscription_plans_by_pk": SubscriptionPlan{ID: "plan-1", Scope: PlanScopeAllPremium, Price: 100, BillingInterval: "month"}}
+		case strings.Contains(query, "GetSubscription"):
+			return map[string]interface{}{"subscriptions_by_pk": Subscription{ID: "sub-1", UserID: "reader-1", PlanID: "plan-1", Status: SubscriptionActive}}
+		case strings.Contains(query, "CompleteSubscriptionPayment"):
+			if variables["payment_id"] != "payment-1" {
+				t.Errorf("payment_id = %v, want payment-1", variables["payment_id"])
+			}
+			changes := variables["changes"].(map[string]interface{})
+			if changes["last_payment_id"] != "payment-1" {
+				t.Errorf("last_payment_id = %v, want payment-1", changes["last_payment_id"])
+			}
+			if changes["billing_anchor"] != "2025-01-31T10:00:00Z" || changes["current_period_end"] != "2025-02-28T10:00:00Z" {
+				t.Errorf("billing anchor and period end = %v, %v, want the period starting on the anchor", changes["billing_anchor"], changes["current_period_end"])
+			}
+			completed = true
+			return map[string]interface{}{"update_subscription_payments": map[string]interface{}{"affected_rows": 0}}
+		}
+		t.Errorf("unexpected query %s", query)
+		return nil
+	})
+
+	provider := &stubPaymentProvider{payment: &VerifyPaymentResponse{}}
+	provider.payment.Data.Status = "success"
+	provider.payment.Data.Amount = "100"
+
+	cfg := &config.Config{PlatformCommission: 15}
+	s := NewSubscriptionService(cfg, provider, NewLedgerService(cfg, hasura), hasura, nil)
+
+	got, err := s.Settle(context.Background(), "tx-1")
+	if err != nil {
+		t.Fatalf("Settle() = %v", err)
+	}
+	if got.Status != SubscriptionPaymentCompleted || got.PeriodEnd != recorded.PeriodEnd {
+		t.Errorf("Settle() = %s until %s, want %s until %s", got.Status, got.PeriodEnd, recorded.Status, recorded.PeriodEnd)
+	}
+}
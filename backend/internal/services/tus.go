@@ -0,0 +1,380 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"recipe-backend/internal/config"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrUploadNotFound  = errors.New("upload not found")
+	ErrOffsetMismatch  = errors.New("upload offset does not match")
+	ErrUploadCompleted = errors.New("upload already completed")
+)
+
+// TusService keeps partially uploaded files on disk until every chunk has
+// arrived, following the tus 1.0 resumable upload protocol.
+type TusService struct {
+	config *config.Config
+	dir    string
+	locks  sync.Map
+
+	// Uploads not stored yet, by user and upload ID, so quota checks do not
+	// read every info file. Loaded from disk on first use.
+	indexMu sync.Mutex
+	index   map[string]map[string]TusUpload
+	owners  map[string]string
+}
+
+func NewTusService(cfg *config.Config) *TusService {
+	if err := os.MkdirAll(cfg.TusUploadDir, 0o700); err != nil {
+		log.Printf("WARNING: failed to create tus upload directory %s: %v", cfg.TusUploadDir, err)
+	}
+
+	return &TusService{
+		config: cfg,
+		dir:    cfg.TusUploadDir,
+	}
+}
+
+// Expiry is how long an unfinished upload is kept before it is purged.
+func (s *TusService) Expiry() time.Duration {
+	return s.config.TusUploadExpiry
+}
+
+type TusUpload struct {
+	ID        string            `json:"id"`
+	UserID    string            `json:"user_id"`
+	Length    int64             `json:"length"`
+	Offset    int64             `json:"offset"`
+	Metadata  map[string]string `json:"metadata"`
+	CreatedAt time.Time         `json:"created_at"`
+	FileID    string            `json:"file_id,omitempty"`
+	FileURL   string            `json:"file_url,omitempty"`
+}
+
+func (u *TusUpload) IsComplete() bool {
+	return u.Offset == u.Length
+}
+
+func (u *TusUpload) ExpiresAt(expiry time.Duration) time.Time {
+	return u.CreatedAt.Add(expiry)
+}
+
+func (s *TusService) Create(userID string, length int64, metadata map[string]string) (*TusUpload, error) {
+	upload := &TusUpload{
+		ID:        uuid.New().String(),
+		UserID:    userID,
+		Length:    length,
+		Metadata:  metadata,
+		CreatedAt: time.Now().UTC(),
+	}
+
+	data, err := os.OpenFile(s.dataPath(upload.ID), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create upload file: %w", err)
+	}
+	data.Close()
+
+	if err := s.save(upload); err != nil {
+		os.Remove(s.dataPath(upload.ID))
+		return nil, err
+	}
+
+	return upload, nil
+}
+
+func (s *TusService) Get(id string) (*TusUpload, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, ErrUploadNotFound
+	}
+
+	raw, err := os.ReadFile(s.infoPath(id))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrUploadNotFound
+		}
+		return nil, fmt.Errorf("failed to read upload info: %w", err)
+	}
+
+	var upload TusUpload
+	if err := json.Unmarshal(raw, &upload); err != nil {
+		return nil, fmt.Errorf("failed to parse upload info: %w", err)
+	}
+
+	return &upload, nil
+}
+
+// WriteChunk appends data at the given offset. Whatever was received before a
+// dropped connection is kept, so the client can resume from the new offset.
+func (s *TusService) WriteChunk(id string, offset int64, r io.Reader) (*TusUpload, error) {
+	unlock := s.lock(id)
+	defer unlock()
+
+	upload, err := s.Get(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if upload.IsComplete() {
+		return upload, ErrUploadCompleted
+	}
+
+	if upload.Offset != offset {
+		return upload, ErrOffsetMismatch
+	}
+
+	data, err := os.OpenFile(s.dataPath(id), os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open upload file: %w", err)
+	}
+	defer data.Close()
+
+	if _, err := data.Seek(offset, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("failed to seek upload file: %w", err)
+	}
+
+	n, copyErr := io.Copy(data, io.LimitReader(r, upload.Length-offset))
+	upload.Offset += n
+
+	if err := s.save(upload); err != nil {
+		return nil, err
+	}
+
+	if copyErr != nil {
+		return upload, fmt.Errorf("upload interrupted: %w", copyErr)
+	}
+
+	return upload, nil
+}
+
+// Open returns the assembled content of an upload.
+func (s *TusService) Open(id string) (*os.File, error) {
+	return os.Open(s.dataPath(id))
+}
+
+// MarkStored records where a completed upload ended up and drops its content
+// from disk. The info file is kept so HEAD requests can still report it.
+func (s *TusService) MarkStored(upload *TusUpload, fileID, fileURL string) error {
+	unlock := s.lock(upload.ID)
+	defer unlock()
+
+	upload.FileID = fileID
+	upload.FileURL = fileURL
+	if err := s.save(upload); err != nil {
+		return err
+	}
+
+	if err := os.Remove(s.dataPath(upload.ID)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove upload file: %w", err)
+	}
+
+	return nil
+}
+
+func (s *TusService) Remove(id string) error {
+	unlock := s.lock(id)
+	defer unlock()
+
+	for _, path := range []string{s.dataPath(id), s.infoPath(id)} {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove upload: %w", err)
+		}
+	}
+
+	s.indexMu.Lock()
+	if s.index != nil {
+		s.unindex(id)
+	}
+	s.indexMu.Unlock()
+
+	s.locks.Delete(id)
+	return nil
+}
+
+// OpenBytes sums the declared lengths of a user's unexpired uploads that have
+// not been stored yet. Their content is not counted in the user's storage
+// usage until it is stored, but it already takes up space on disk.
+func (s *TusService) OpenBytes(userID string) (int64, error) {
+	s.indexMu.Lock()
+	defer s.indexMu.Unlock()
+
+	if err := s.loadIndex(); err != nil {
+		return 0, err
+	}
+
+	var total int64
+	now := time.Now()
+	for _, upload := range s.index[userID] {
+		if now.Before(upload.ExpiresAt(s.Expiry())) {
+			total += upload.Length
+		}
+	}
+
+	return total, nil
+}
+
+// loadIndex reads the info file of every upload once. From then on save and
+// Remove keep the index current. The caller must hold indexMu.
+func (s *TusService) loadIndex() error {
+	if s.index != nil {
+		return nil
+	}
+
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return fmt.Errorf("failed to read upload directory: %w", err)
+	}
+
+	index := make(map[string]map[string]TusUpload)
+	owners := make(map[string]string)
+	for _, entry := range entries {
+		if !strings.HasSuffix(entry.Name(), ".info") {
+			continue
+		}
+
+		upload, err := s.Get(strings.TrimSuffix(entry.Name(), ".info"))
+		if err != nil {
+			if errors.Is(err, ErrUploadNotFound) {
+				continue
+			}
+			return err
+		}
+
+		if upload.FileID == "" {
+			if index[upload.UserID] == nil {
+				index[upload.UserID] = make(map[string]TusUpload)
+			}
+			index[upload.UserID][upload.ID] = *upload
+			owners[upload.ID] = upload.UserID
+		}
+	}
+
+	s.index = index
+	s.owners = owners
+	return nil
+}
+
+// indexUpload records the state of an upload just saved. Until the index is
+// loaded the info file on disk is enough.
+func (s *TusService) indexUpload(upload *TusUpload) {
+	s.indexMu.Lock()
+	defer s.indexMu.Unlock()
+
+	if s.index == nil {
+		return
+	}
+
+	if upload.FileID != "" {
+		s.unindex(upload.ID)
+		return
+	}
+
+	if s.index[upload.UserID] == nil {
+		s.index[upload.UserID] = make(map[string]TusUpload)
+	}
+	s.index[upload.UserID][upload.ID] = *upload
+	s.owners[upload.ID] = upload.UserID
+}
+
+// unindex drops an upload from the index. The caller must hold indexMu.
+func (s *TusService) unindex(id string) {
+	userID, ok := s.owners[id]
+	if !ok {
+		return
+	}
+
+	delete(s.owners, id)
+	delete(s.index[userID], id)
+	if len(s.index[userID]) == 0 {
+		delete(s.index, userID)
+	}
+}
+
+// LockUser serialises the uploads of one user from their quota check until
+// they are recorded, so uploads at the same time cannot each be granted the
+// same remaining quota.
+func (s *TusService) LockUser(userID string) func() {
+	return s.lock("user:" + userID)
+}
+
+// PurgeExpired removes uploads older than the configured expiry.
+func (s *TusService) PurgeExpired() (int, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read upload directory: %w", err)
+	}
+
+	purged := 0
+	now := time.Now()
+	for _, entry := range entries {
+		if !strings.HasSuffix(entry.Name(), ".info") {
+			continue
+		}
+
+		id := strings.TrimSuffix(entry.Name(), ".info")
+		upload, err := s.Get(id)
+		if err != nil {
+			log.Printf("Skipping unreadable upload %s: %v", id, err)
+			continue
+		}
+
+		if now.Before(upload.ExpiresAt(s.Expiry())) {
+			continue
+		}
+
+		if err := s.Remove(id); err != nil {
+			log.Printf("Failed to purge upload %s: %v", id, err)
+			continue
+		}
+		purged++
+	}
+
+	return purged, nil
+}
+
+func (s *TusService) save(upload *TusUpload) error {
+	raw, err := json.Marshal(upload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal upload info: %w", err)
+	}
+
+	// Write atomically so a crash never leaves a truncated info file
+	tmp := s.infoPath(upload.ID) + ".tmp"
+	if err := os.WriteFile(tmp, raw, 0o600); err != nil {
+		return fmt.Errorf("failed to write upload info: %w", err)
+	}
+
+	if err := os.Rename(tmp, s.infoPath(upload.ID)); err != nil {
+		return fmt.Errorf("failed to write upload info: %w", err)
+	}
+
+	s.indexUpload(upload)
+	return nil
+}
+
+func (s *TusService) lock(id string) func() {
+	value, _ := s.locks.LoadOrStore(id, &sync.Mutex{})
+	mu := value.(*sync.Mutex)
+	mu.Lock()
+	return mu.Unlock
+}
+
+func (s *TusService) dataPath(id string) string {
+	return filepath.Join(s.dir, id+".bin")
+}
+
+func (s *TusService) infoPath(id string) string {
+	return filepath.Join(s.dir, id+".info")
+}
@@ -0,0 +1,74 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"recipe-backend/internal/config"
+)
+
+func TestTusOpenBytes(t *testing.T) {
+	cfg := &config.Config{TusUploadDir: t.TempDir(), TusUploadExpiry: time.Hour}
+	s := NewTusService(cfg)
+
+	var uploads []*TusUpload
+	for _, length := range []int64{100, 250} {
+		upload, err := s.Create("user-1", length, map[string]string{"filename": "a.jpg"})
+		if err != nil {
+			t.Fatalf("Create() = %v", err)
+		}
+		uploads = append(uploads, upload)
+	}
+	if _, err := s.Create("user-2", 1000, nil); err != nil {
+		t.Fatalf("Create() = %v", err)
+	}
+
+	stored, err := s.Create("user-1", 400, nil)
+	if err != nil {
+		t.Fatalf("Create() = %v", err)
+	}
+	if err := s.MarkStored(stored, "file-1", "https://example.com/a.jpg"); err != nil {
+		t.Fatalf("MarkStored() = %v", err)
+	}
+
+	expired, err := s.Create("user-1", 800, nil)
+	if err != nil {
+		t.Fatalf("Create() = %v", err)
+	}
+	expired.CreatedAt = time.Now().Add(-2 * time.Hour)
+	if err := s.save(expired); err != nil {
+		t.Fatalf("save() = %v", err)
+	}
+
+	open, err := s.OpenBytes("user-1")
+	if err != nil {
+		t.Fatalf("OpenBytes() = %v", err)
+	}
+	if open != 350 {
+		t.Errorf("OpenBytes() = %d, want 350 from the two unfinished uploads", open)
+	}
+
+	// After the first call the index is kept up to date without reading
+	// the upload directory again
+	if err := s.Remove(uploads[0].ID); err != nil {
+		t.Fatalf("Remove() = %v", err)
+	}
+	if _, err := s.Create("user-1", 30, nil); err != nil {
+		t.Fatalf("Create() = %v", err)
+	}
+	if err := s.MarkStored(uploads[1], "file-2", "https://example.com/b.jpg"); err != nil {
+		t.Fatalf("MarkStored() = %v", err)
+	}
+
+	if open, err := s.OpenBytes("user-1"); err != nil || open != 30 {
+		t.Errorf("OpenBytes() = %d, %v, want 30 after removing and storing uploads", open, err)
+	}
+
+	// A restarted server rebuilds the index from disk
+	restarted := NewTusService(cfg)
+	for userID, want := range map[string]int64{"user-1": 30, "user-2": 1000, "user-3": 0} {
+		if open, err := restarted.OpenBytes(userID); err != nil || open != want {
+			t.Errorf("OpenBytes(%s) after restart = %d, %v, want %d", userID, open, err, want)
+		}
+	}
+}
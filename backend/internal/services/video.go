@@ -0,0 +1,834 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"os/exec"
+	"time"
+)
+
+// VideoInfo describes a video clip read from its container headers.
+type VideoInfo struct {
+	Width      int
+	Height     int
+	Duration   time.Duration
+	VideoCodec string
+	AudioCodec string
+}
+
+// Codecs browsers can play back, by container
+var (
+	mp4VideoCodecs  = map[string]bool{"avc1": true, "avc3": true, "av01": true}
+	mp4AudioCodecs  = map[string]bool{"mp4a": true, "Opus": true}
+	webmVideoCodecs = map[string]bool{"V_VP8": true, "V_VP9": true, "V_AV1": true}
+	webmAudioCodecs = map[string]bool{"A_OPUS": true, "A_VORBIS": true}
+)
+
+// Largest container header we are willing to read into memory
+const maxVideoHeaderSize = 16 * 1024 * 1024
+
+// MediaError reports an upload that is not an acceptable image or video,
+// such as a corrupt file, an unsupported codec or a clip of the wrong length.
+type MediaError struct {
+	Reason string
+}
+
+func (e *MediaError) Error() string {
+	return e.Reason
+}
+
+var errInvalidVideo error = &MediaError{Reason: "invalid video file"}
+
+// probeVideo reads the duration, resolution and codecs of an MP4 or WebM
+// clip without decoding it and rewinds r.
+func probeVideo(r io.ReadSeeker, ext string) (*VideoInfo, error) {
+	var (
+		info *VideoInfo
+		err  error
+	)
+
+	switch ext {
+	case ".mp4":
+		info, err = probeMP4(r)
+	case ".webm":
+		info, err = probeWebM(r)
+	default:
+		return nil, &MediaError{Reason: fmt.Sprintf("unsupported video type %s", ext)}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	return info, nil
+}
+
+// validateVideo checks a probed clip against the configured limits.
+func (s *FileService) validateVideo(info *VideoInfo, ext string) error {
+	videoCodecs, audioCodecs := mp4VideoCodecs, mp4AudioCodecs
+	if ext == ".webm" {
+		videoCodecs, audioCodecs = webmVideoCodecs, webmAudioCodecs
+	}
+
+	if info.VideoCodec == "" {
+		return &MediaError{Reason: "video file has no video track"}
+	}
+	if !videoCodecs[info.VideoCodec] {
+		return &MediaError{Reason: fmt.Sprintf("unsupported video codec %s", info.VideoCodec)}
+	}
+	if info.AudioCodec != "" && !audioCodecs[info.AudioCodec] {
+		return &MediaError{Reason: fmt.Sprintf("unsupported audio codec %s", info.AudioCodec)}
+	}
+
+	if info.Duration < s.config.VideoMinDuration || info.Duration > s.config.VideoMaxDuration {
+		return &MediaError{Reason: fmt.Sprintf("video must be between %s and %s long", s.config.VideoMinDuration, s.config.VideoMaxDuration)}
+	}
+
+	if info.Width <= 0 || info.Height <= 0 {
+		return &MediaError{Reason: "could not determine video resolution"}
+	}
+	if info.Width > s.config.VideoMaxResolution || info.Height > s.config.VideoMaxResolution {
+		return &MediaError{Reason: fmt.Sprintf("video resolution too large. Maximum %dpx on either side allowed", s.config.VideoMaxResolution)}
+	}
+
+	return nil
+}
+
+// extractPoster returns the first keyframe of a clip as a JPEG. It needs
+// ffmpeg; ok is false when no poster could be made.
+func (s *FileService) extractPoster(src io.ReadSeeker) (poster []byte, ok bool, err error) {
+	if s.config.FFmpegPath == "" {
+		return nil, false, nil
+	}
+
+	ffmpeg, err := exec.LookPath(s.config.FFmpegPath)
+	if err != nil {
+		return nil, false, nil
+	}
+
+	// ffmpeg needs to seek around MP4 files, so give it a path
+	input, cleanup, err := videoInputPath(src)
+	if err != nil {
+		return nil, false, err
+	}
+	defer cleanup()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, ffmpeg,
+		"-v", "error",
+		"-skip_frame", "nokey",
+		"-i", input,
+		"-frames:v", "1",
+		"-vf", "scale='min(1280,iw)':-2",
+		"-f", "image2",
+		"-c:v", "mjpeg",
+		"-q:v", "3",
+		"pipe:1",
+	)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return nil, false, fmt.Errorf("ffmpeg: %v: %s", err, bytes.TrimSpace(stderr.Bytes()))
+	}
+
+	if _, err := src.Seek(0, io.SeekStart); err != nil {
+		return nil, false, err
+	}
+
+	if stdout.Len() == 0 {
+		return nil, false, nil
+	}
+
+	return stdout.Bytes(), true, nil
+}
+
+// videoInputPath returns a file path holding the content of src, copying it
+// to a temporary file unless it already is one.
+func videoInputPath(src io.ReadSeeker) (string, func(), error) {
+	if f, ok := src.(*os.File); ok {
+		return f.Name(), func() {}, nil
+	}
+
+	if _, err := src.Seek(0, io.SeekStart); err != nil {
+		return "", nil, err
+	}
+
+	tmp, err := os.CreateTemp("", "recipe-video-*")
+	if err != nil {
+		return "", nil, err
+	}
+	cleanup := func() {
+		tmp.Close()
+		os.Remove(tmp.Name())
+	}
+
+	if _, err := io.Copy(tmp, src); err != nil {
+		cleanup()
+		return "", nil, err
+	}
+
+	return tmp.Name(), cleanup, nil
+}
+
+// MP4 (ISO base media file format)
+
+type mp4Box struct {
+	kind string
+	data []byte
+}
+
+// probeMP4 reads the moov box, skipping media data wherever it appears.
+func probeMP4(r io.ReadSeeker) (*VideoInfo, error) {
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, 16)
+	sawFtyp := false
+
+	for {
+		if _, err := io.ReadFull(r, header[:8]); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil, fmt.Errorf("%w: no moov box", errInvalidVideo)
+			}
+			return nil, fmt.Errorf("%w: %v", errInvalidVideo, err)
+		}
+
+		size := int64(binary.BigEndian.Uint32(header[:4]))
+		kind := string(header[4:8])
+		headerLen := int64(8)
+
+		switch size {
+		case 0:
+			// Box extends to the end of the file
+			size = math.MaxInt64
+		case 1:
+			if _, err := io.ReadFull(r, header[8:16]); err != nil {
+				return nil, fmt.Errorf("%w: %v", errInvalidVideo, err)
+			}
+			size = int64(binary.BigEndian.Uint64(header[8:16]))
+			headerLen = 16
+		}
+
+		if size < headerLen {
+			return nil, fmt.Errorf("%w: bad box size", errInvalidVideo)
+		}
+
+		if !sawFtyp {
+			if kind != "ftyp" {
+				return nil, fmt.Errorf("%w: not an MP4 file", errInvalidVideo)
+			}
+			sawFtyp = true
+		}
+
+		if kind == "moov" {
+			if size-headerLen > maxVideoHeaderSize {
+				return nil, fmt.Errorf("%w: moov box too large", errInvalidVideo)
+			}
+			data := make([]byte, size-headerLen)
+			if _, err := io.ReadFull(r, data); err != nil {
+				return nil, fmt.Errorf("%w: %v", errInvalidVideo, err)
+			}
+			return parseMoov(data)
+		}
+
+		if size == math.MaxInt64 {
+			return nil, fmt.Errorf("%w: no moov box", errInvalidVideo)
+		}
+		if _, err := r.Seek(size-headerLen, io.SeekCurrent); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func parseMoov(data []byte) (*VideoInfo, error) {
+	info := &VideoInfo{}
+
+	boxes, err := mp4Children(data)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, box := range boxes {
+		switch box.kind {
+		case "mvhd":
+			duration, err := parseMvhd(box.data)
+			if err != nil {
+				return nil, err
+			}
+			info.Duration = duration
+		case "trak":
+			if err := parseTrak(box.data, info); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if info.Duration <= 0 {
+		return nil, fmt.Errorf("%w: could not determine duration", errInvalidVideo)
+	}
+
+	return info, nil
+}
+
+func parseMvhd(data []byte) (time.Duration, error) {
+	if len(data) < 4 {
+		return 0, fmt.Errorf("%w: short mvhd box", errInvalidVideo)
+	}
+
+	var timescale, duration uint64
+	switch data[0] {
+	case 0:
+		if len(data) < 20 {
+			return 0, fmt.Errorf("%w: short mvhd box", errInvalidVideo)
+		}
+		timescale = uint64(binary.BigEndian.Uint32(data[12:16]))
+		duration = uint64(binary.BigEndian.Uint32(data[16:20]))
+	case 1:
+		if len(data) < 32 {
+			return 0, fmt.Errorf("%w: short mvhd box", errInvalidVideo)
+		}
+		timescale = uint64(binary.BigEndian.Uint32(data[20:24]))
+		duration = binary.BigEndian.Uint64(data[24:32])
+	default:
+		return 0, fmt.Errorf("%w: unknown mvhd version", errInvalidVideo)
+	}
+
+	if timescale == 0 {
+		return 0, fmt.Errorf("%w: zero timescale", errInvalidVideo)
+	}
+
+	return time.Duration(float64(duration) / float64(timescale) * float64(time.Second)), nil
+}
+
+// parseTrak records the codec of the first video and audio tracks, and the
+// coded size of the video.
+func parseTrak(data []byte, info *VideoInfo) error {
+	mdia, err := mp4Find(data, "mdia")
+	if err != nil || mdia == nil {
+		return err
+	}
+
+	hdlr, err := mp4Find(mdia, "hdlr")
+	if err != nil {
+		return err
+	}
+	if len(hdlr) < 12 {
+		return nil
+	}
+	handler := string(hdlr[8:12])
+	if handler != "vide" && handler != "soun" {
+		return nil
+	}
+
+	stsd, err := mp4Find(mdia, "minf", "stbl", "stsd")
+	if err != nil {
+		return err
+	}
+	// version/flags, entry count, then the first sample entry
+	if len(stsd) < 16 {
+		return fmt.Errorf("%w: short stsd box", errInvalidVideo)
+	}
+	entry := stsd[8:]
+	codec := string(entry[4:8])
+
+	switch handler {
+	case "vide":
+		if info.VideoCodec != "" {
+			return nil
+		}
+		if len(entry) < 36 {
+			return fmt.Errorf("%w: short video sample entry", errInvalidVideo)
+		}
+		info.VideoCodec = codec
+		info.Width = int(binary.BigEndian.Uint16(entry[32:34]))
+		info.Height = int(binary.BigEndian.Uint16(entry[34:36]))
+	case "soun":
+		if info.AudioCodec == "" {
+			info.AudioCodec = codec
+		}
+	}
+
+	return nil
+}
+
+// mp4Find returns the data of the box at the given path below data, or nil
+// if it does not exist.
+func mp4Find(data []byte, path ...string) ([]byte, error) {
+	for _, kind := range path {
+		boxes, err := mp4Children(data)
+		if err != nil {
+			return nil, err
+		}
+
+		data = nil
+		for _, box := range boxes {
+			if box.kind == kind {
+				data = box.data
+				break
+			}
+		}
+		if data == nil {
+			return nil, nil
+		}
+	}
+	return data, nil
+}
+
+func mp4Children(data []byte) ([]mp4Box, error) {
+	var boxes []mp4Box
+
+	for len(data) > 0 {
+		if len(data) < 8 {
+			return nil, fmt.Errorf("%w: truncated box", errInvalidVideo)
+		}
+
+		size := uint64(binary.BigEndian.Uint32(data[:4]))
+		kind := string(data[4:8])
+		headerLen := uint64(8)
+
+		switch size {
+		case 0:
+			size = uint64(len(data))
+		case 1:
+			if len(data) < 16 {
+				return nil, fmt.Errorf("%w: truncated box", errInvalidVideo)
+			}
+			size = binary.BigEndian.Uint64(data[8:16])
+			headerLen = 16
+		}
+
+		if size < headerLen || size > uint64(len(data)) {
+			return nil, fmt.Errorf("%w: bad box size", errInvalidVideo)
+		}
+
+		boxes = append(boxes, mp4Box{kind: kind, data: data[headerLen:size]})
+		data = data[size:]
+	}
+
+	return boxes, nil
+}
+
+// WebM (Matroska subset)
+
+const (
+	ebmlHeaderID     = 0x1A45DFA3
+	ebmlDocTypeID    = 0x4282
+	mkvSegmentID     = 0x18538067
+	mkvInfoID        = 0x1549A966
+	mkvTimecodeScale = 0x2AD7B1
+	mkvDurationID    = 0x4489
+	mkvTracksID      = 0x1654AE6B
+	mkvTrackEntryID  = 0xAE
+	mkvTrackTypeID   = 0x83
+	mkvCodecID       = 0x86
+	mkvVideoID       = 0xE0
+	mkvPixelWidthID  = 0xB0
+	mkvPixelHeightID = 0xBA
+	mkvClusterID     = 0x1F43B675
+	mkvTimecodeID    = 0xE7
+	mkvSimpleBlockID = 0xA3
+	mkvBlockGroupID  = 0xA0
+	mkvBlockID       = 0xA1
+)
+
+// Top-level segment elements; seeing one of these ends an unknown-size
+// cluster.
+var mkvSegmentChildren = map[uint64]bool{
+	0x114D9B74:   true, // SeekHead
+	mkvInfoID:    true,
+	mkvTracksID:  true,
+	mkvClusterID: true,
+	0x1C53BB6B:   true, // Cues
+	0x1941A469:   true, // Attachments
+	0x1043A770:   true, // Chapters
+	0x1254C367:   true, // Tags
+}
+
+type ebmlReader struct {
+	r   io.ReadSeeker
+	pos int64
+}
+
+// header reads an element ID and data size. A size of -1 means unknown.
+func (e *ebmlReader) header() (id uint64, size int64, err error) {
+	id, _, err = e.vint(true)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	raw, length, err := e.vint(false)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if raw == (uint64(1)<<(7*length))-1 {
+		return id, -1, nil
+	}
+
+	return id, int64(raw), nil
+}
+
+// vint reads an EBML variable-length integer, keeping the length marker
+// for element IDs.
+func (e *ebmlReader) vint(keepMarker bool) (uint64, int, error) {
+	var first [1]byte
+	if _, err := io.ReadFull(e.r, first[:]); err != nil {
+		return 0, 0, err
+	}
+	e.pos++
+
+	length := 1
+	for mask := byte(0x80); length <= 8 && first[0]&mask == 0; mask >>= 1 {
+		length++
+	}
+	if length > 8 {
+		return 0, 0, fmt.Errorf("%w: bad EBML integer", errInvalidVideo)
+	}
+
+	value := uint64(first[0])
+	if !keepMarker {
+		value &= uint64(0xFF) >> length
+	}
+
+	rest := make([]byte, length-1)
+	if _, err := io.ReadFull(e.r, rest); err != nil {
+		return 0, 0, err
+	}
+	e.pos += int64(length - 1)
+
+	for _, b := range rest {
+		value = value<<8 | uint64(b)
+	}
+
+	return value, length, nil
+}
+
+func (e *ebmlReader) read(size int64) ([]byte, error) {
+	if size < 0 || size > maxVideoHeaderSize {
+		return nil, fmt.Errorf("%w: element too large", errInvalidVideo)
+	}
+
+	data := make([]byte, size)
+	if _, err := io.ReadFull(e.r, data); err != nil {
+		return nil, err
+	}
+	e.pos += size
+	return data, nil
+}
+
+func (e *ebmlReader) skip(size int64) error {
+	pos, err := e.r.Seek(size, io.SeekCurrent)
+	e.pos = pos
+	return err
+}
+
+func (e *ebmlReader) seek(pos int64) error {
+	_, err := e.r.Seek(pos, io.SeekStart)
+	e.pos = pos
+	return err
+}
+
+func probeWebM(r io.ReadSeeker) (*VideoInfo, error) {
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	e := &ebmlReader{r: r}
+
+	id, size, err := e.header()
+	if err != nil || id != ebmlHeaderID {
+		return nil, fmt.Errorf("%w: not a WebM file", errInvalidVideo)
+	}
+	data, err := e.read(size)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errInvalidVideo, err)
+	}
+	if ebmlString(data, ebmlDocTypeID) != "webm" {
+		return nil, fmt.Errorf("%w: not a WebM file", errInvalidVideo)
+	}
+
+	id, size, err = e.header()
+	if err != nil || id != mkvSegmentID {
+		return nil, fmt.Errorf("%w: missing segment", errInvalidVideo)
+	}
+	end := int64(math.MaxInt64)
+	if size >= 0 {
+		end = e.pos + size
+	}
+
+	info := &VideoInfo{}
+	timecodeScale := uint64(1000000)
+	var duration float64
+	var lastTimecode int64
+	haveTracks := false
+
+	for e.pos < end {
+		start := e.pos
+		id, size, err := e.header()
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", errInvalidVideo, err)
+		}
+
+		switch id {
+		case mkvInfoID:
+			data, err := e.read(size)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %v", errInvalidVideo, err)
+			}
+			if scale, ok, err := ebmlUint(data, mkvTimecodeScale); err != nil {
+				return nil, err
+			} else if ok {
+				timecodeScale = scale
+			}
+			if duration, err = ebmlFloat(data, mkvDurationID); err != nil {
+				return nil, err
+			}
+		case mkvTracksID:
+			data, err := e.read(size)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %v", errInvalidVideo, err)
+			}
+			if err := parseWebMTracks(data, info); err != nil {
+				return nil, err
+			}
+			haveTracks = true
+		case mkvClusterID:
+			// Files recorded in the browser often omit the duration, so
+			// fall back to the timestamp of the last block
+			if duration > 0 && haveTracks {
+				end = start
+				continue
+			}
+			last, err := scanCluster(e, size)
+			if err != nil {
+				return nil, err
+			}
+			if last > lastTimecode {
+				lastTimecode = last
+			}
+		default:
+			if size < 0 {
+				return nil, fmt.Errorf("%w: unknown-size element %#x", errInvalidVideo, id)
+			}
+			if err := e.skip(size); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if duration <= 0 {
+		duration = float64(lastTimecode)
+	}
+	info.Duration = time.Duration(duration * float64(timecodeScale))
+
+	if info.Duration <= 0 {
+		return nil, fmt.Errorf("%w: could not determine duration", errInvalidVideo)
+	}
+
+	return info, nil
+}
+
+// scanCluster returns the latest block timestamp in a cluster, in timecode
+// units, leaving the reader after the cluster.
+func scanCluster(e *ebmlReader, size int64) (int64, error) {
+	end := int64(math.MaxInt64)
+	if size >= 0 {
+		end = e.pos + size
+	}
+
+	var clusterTimecode, last int64
+	for e.pos < end {
+		start := e.pos
+		id, size, err := e.header()
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			break
+		}
+		if err != nil {
+			return 0, fmt.Errorf("%w: %v", errInvalidVideo, err)
+		}
+
+		if mkvSegmentChildren[id] {
+			// An unknown-size cluster ends where the next one starts
+			return last, e.seek(start)
+		}
+		if size < 0 {
+			return 0, fmt.Errorf("%w: unknown-size element %#x", errInvalidVideo, id)
+		}
+
+		switch id {
+		case mkvTimecodeID:
+			data, err := e.read(size)
+			if err != nil {
+				return 0, fmt.Errorf("%w: %v", errInvalidVideo, err)
+			}
+			clusterTimecode = int64(beUint(data))
+		case mkvSimpleBlockID, mkvBlockGroupID:
+			data, err := e.read(size)
+			if err != nil {
+				return 0, fmt.Errorf("%w: %v", errInvalidVideo, err)
+			}
+			if id == mkvBlockGroupID {
+				if data = ebmlFind(data, mkvBlockID); data == nil {
+					continue
+				}
+			}
+			if offset, ok := blockTimecode(data); ok && clusterTimecode+offset > last {
+				last = clusterTimecode + offset
+			}
+		default:
+			if err := e.skip(size); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	return last, nil
+}
+
+// blockTimecode reads the timestamp of a block relative to its cluster.
+func blockTimecode(block []byte) (int64, bool) {
+	if len(block) == 0 {
+		return 0, false
+	}
+
+	// Track number is a size-style variable-length integer
+	length := 1
+	for mask := byte(0x80); length <= 8 && block[0]&mask == 0; mask >>= 1 {
+		length++
+	}
+	if length > 8 || len(block) < length+2 {
+		return 0, false
+	}
+
+	return int64(int16(binary.BigEndian.Uint16(block[length : length+2]))), true
+}
+
+func parseWebMTracks(data []byte, info *VideoInfo) error {
+	return ebmlEach(data, func(id uint64, entry []byte) error {
+		if id != mkvTrackEntryID {
+			return nil
+		}
+
+		trackType, _, err := ebmlUint(entry, mkvTrackTypeID)
+		if err != nil {
+			return err
+		}
+		codec := ebmlString(entry, mkvCodecID)
+
+		switch trackType {
+		case 1:
+			if info.VideoCodec != "" {
+				return nil
+			}
+			info.VideoCodec = codec
+			if video := ebmlFind(entry, mkvVideoID); video != nil {
+				width, _, err := ebmlUint(video, mkvPixelWidthID)
+				if err != nil {
+					return err
+				}
+				height, _, err := ebmlUint(video, mkvPixelHeightID)
+				if err != nil {
+					return err
+				}
+				info.Width, info.Height = int(width), int(height)
+			}
+		case 2:
+			if info.AudioCodec == "" {
+				info.AudioCodec = codec
+			}
+		}
+		return nil
+	})
+}
+
+// ebmlEach calls fn for every child element in data.
+func ebmlEach(data []byte, fn func(id uint64, value []byte) error) error {
+	e := &ebmlReader{r: bytes.NewReader(data)}
+
+	for e.pos < int64(len(data)) {
+		id, size, err := e.header()
+		if err != nil {
+			return fmt.Errorf("%w: %v", errInvalidVideo, err)
+		}
+		if size < 0 || e.pos+size > int64(len(data)) {
+			return fmt.Errorf("%w: bad element size", errInvalidVideo)
+		}
+
+		if err := fn(id, data[e.pos:e.pos+size]); err != nil {
+			return err
+		}
+		if err := e.skip(size); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func ebmlFind(data []byte, want uint64) []byte {
+	var found []byte
+	errFound := errors.New("found")
+
+	ebmlEach(data, func(id uint64, value []byte) error {
+		if id == want {
+			found = value
+			return errFound
+		}
+		return nil
+	})
+
+	return found
+}
+
+func ebmlUint(data []byte, id uint64) (uint64, bool, error) {
+	value := ebmlFind(data, id)
+	if value == nil {
+		return 0, false, nil
+	}
+	if len(value) > 8 {
+		return 0, false, fmt.Errorf("%w: bad integer element", errInvalidVideo)
+	}
+	return beUint(value), true, nil
+}
+
+func ebmlFloat(data []byte, id uint64) (float64, error) {
+	value := ebmlFind(data, id)
+	switch len(value) {
+	case 0:
+		return 0, nil
+	case 4:
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(value))), nil
+	case 8:
+		return math.Float64frombits(binary.BigEndian.Uint64(value)), nil
+	default:
+		return 0, fmt.Errorf("%w: bad float element", errInvalidVideo)
+	}
+}
+
+func ebmlString(data []byte, id uint64) string {
+	return string(bytes.TrimRight(ebmlFind(data, id), "\x00"))
+}
+
+func beUint(data []byte) uint64 {
+	var value uint64
+	for _, b := range data {
+		value = value<<8 | uint64(b)
+	}
+	return value
+}
@@ -0,0 +1,411 @@
+package services
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"recipe-backend/internal/config"
+)
+
+// MP4 fixtures are built from boxes laid out as ISO/IEC 14496-12 describes
+// them, with the sample data left out.
+
+func mp4TestBox(kind string, payload ...[]byte) []byte {
+	body := bytes.Join(payload, nil)
+	box := binary.BigEndian.AppendUint32(nil, uint32(8+len(body)))
+	return append(append(box, kind...), body...)
+}
+
+// mp4TestLargeBox writes a box with a 64-bit size, as muxers do for mdat.
+func mp4TestLargeBox(kind string, payload []byte) []byte {
+	box := binary.BigEndian.AppendUint32(nil, 1)
+	box = append(box, kind...)
+	box = binary.BigEndian.AppendUint64(box, uint64(16+len(payload)))
+	return append(box, payload...)
+}
+
+func mp4TestFtyp() []byte {
+	return mp4TestBox("ftyp", []byte("isom"), make([]byte, 4), []byte("isomiso2avc1mp41"))
+}
+
+func mp4TestMvhd(version byte, timescale uint32, duration uint64) []byte {
+	payload := []byte{version, 0, 0, 0}
+	if version == 1 {
+		payload = append(payload, make([]byte, 16)...)
+		payload = binary.BigEndian.AppendUint32(payload, timescale)
+		payload = binary.BigEndian.AppendUint64(payload, duration)
+	} else {
+		payload = append(payload, make([]byte, 8)...)
+		payload = binary.BigEndian.AppendUint32(payload, timescale)
+		payload = binary.BigEndian.AppendUint32(payload, uint32(duration))
+	}
+	// rate, volume, reserved, matrix, pre_defined, next_track_ID
+	payload = append(payload, make([]byte, 80)...)
+	return mp4TestBox("mvhd", payload)
+}
+
+func mp4TestTrak(handler string, entry []byte) []byte {
+	hdlr := append(make([]byte, 8), handler...)
+	hdlr = append(hdlr, make([]byte, 13)...)
+
+	stsd := binary.BigEndian.AppendUint32(make([]byte, 4), 1)
+	stsd = append(stsd, entry...)
+
+	return mp4TestBox("trak",
+		mp4TestBox("tkhd", make([]byte, 84)),
+		mp4TestBox("mdia",
+			mp4TestBox("mdhd", make([]byte, 24)),
+			mp4TestBox("hdlr", hdlr),
+			mp4TestBox("minf", mp4TestBox("stbl", mp4TestBox("stsd", stsd))),
+		),
+	)
+}
+
+// mp4TestVideoEntry is a VisualSampleEntry with the given coded size.
+func mp4TestVideoEntry(codec string, width, height uint16) []byte {
+	payload := make([]byte, 24)
+	payload = binary.BigEndian.AppendUint16(payload, width)
+	payload = binary.BigEndian.AppendUint16(payload, height)
+	payload = append(payload, make([]byte, 50)...)
+	return mp4TestBox(codec, payload)
+}
+
+// mp4TestAudioEntry is an AudioSampleEntry.
+func mp4TestAudioEntry(codec string) []byte {
+	return mp4TestBox(codec, make([]byte, 28))
+}
+
+func mp4TestMoov(mvhd []byte, traks ...[]byte) []byte {
+	return mp4TestBox("moov", append([][]byte{mvhd}, traks...)...)
+}
+
+// A clip as cameras and most muxers write it: media data first and the
+// index at the end.
+func mp4TestClip() []byte {
+	return bytes.Join([][]byte{
+		mp4TestFtyp(),
+		mp4TestBox("free"),
+		mp4TestBox("mdat", make([]byte, 4096)),
+		mp4TestMoov(
+			mp4TestMvhd(0, 1000, 20500),
+			mp4TestTrak("vide", mp4TestVideoEntry("avc1", 1280, 720)),
+			mp4TestTrak("soun", mp4TestAudioEntry("mp4a")),
+		),
+	}, nil)
+}
+
+func TestProbeMP4(t *testing.T) {
+	clip := mp4TestClip()
+
+	tests := []struct {
+		name    string
+		data    []byte
+		want    *VideoInfo
+		wantErr string
+	}{
+		{
+			name: "index after media data",
+			data: clip,
+			want: &VideoInfo{Width: 1280, Height: 720, Duration: 20500 * time.Millisecond, VideoCodec: "avc1", AudioCodec: "mp4a"},
+		},
+		{
+			name: "index first with a 64-bit mdat",
+			data: bytes.Join([][]byte{
+				mp4TestFtyp(),
+				mp4TestMoov(
+					mp4TestMvhd(1, 90000, 90000*30),
+					mp4TestTrak("soun", mp4TestAudioEntry("Opus")),
+					mp4TestTrak("vide", mp4TestVideoEntry("av01", 1080, 1920)),
+				),
+				mp4TestLargeBox("mdat", make([]byte, 1024)),
+			}, nil),
+			want: &VideoInfo{Width: 1080, Height: 1920, Duration: 30 * time.Second, VideoCodec: "av01", AudioCodec: "Opus"},
+		},
+		{
+			name: "first video track wins",
+			data: bytes.Join([][]byte{
+				mp4TestFtyp(),
+				mp4TestMoov(
+					mp4TestMvhd(0, 600, 600*16),
+					mp4TestTrak("vide", mp4TestVideoEntry("avc1", 640, 360)),
+					mp4TestTrak("vide", mp4TestVideoEntry("hvc1", 3840, 2160)),
+					mp4TestTrak("hint", mp4TestAudioEntry("rtp ")),
+				),
+			}, nil),
+			want: &VideoInfo{Width: 640, Height: 360, Duration: 16 * time.Second, VideoCodec: "avc1"},
+		},
+		{name: "truncated index", data: clip[:len(clip)-40], wantErr: "unexpected EOF"},
+		{name: "truncated media data", data: clip[:100], wantErr: "no moov box"},
+		{name: "not MP4", data: append(mp4TestBox("moov"), clip...), wantErr: "not an MP4 file"},
+		{name: "no index", data: append(mp4TestFtyp(), mp4TestBox("mdat", make([]byte, 64))...), wantErr: "no moov box"},
+		{
+			name:    "zero timescale",
+			data:    append(mp4TestFtyp(), mp4TestMoov(mp4TestMvhd(0, 0, 1000))...),
+			wantErr: "zero timescale",
+		},
+		{
+			name:    "box larger than its parent",
+			data:    append(mp4TestFtyp(), mp4TestBox("moov", []byte{0, 0, 1, 0, 'm', 'v', 'h', 'd'})...),
+			wantErr: "bad box size",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := bytes.NewReader(tt.data)
+			got, err := probeVideo(r, ".mp4")
+			checkProbe(t, got, err, tt.want, tt.wantErr)
+			if err == nil {
+				if pos, _ := r.Seek(0, 1); pos != 0 {
+					t.Errorf("reader left at %d, want it rewound", pos)
+				}
+			}
+		})
+	}
+}
+
+// WebM fixtures are EBML elements laid out as the Matroska specification
+// describes them.
+
+const ebmlTestUnknownSize = -1
+
+func ebmlTestElement(id uint64, payload ...[]byte) []byte {
+	body := bytes.Join(payload, nil)
+	return append(ebmlTestHeader(id, int64(len(body))), body...)
+}
+
+// ebmlTestHeader writes an element ID and an 8-byte data size, or the
+// reserved all-ones size that marks an element of unknown size.
+func ebmlTestHeader(id uint64, size int64) []byte {
+	var header []byte
+	for shift := 24; shift >= 0; shift -= 8 {
+		if b := byte(id >> shift); b != 0 || len(header) > 0 {
+			header = append(header, b)
+		}
+	}
+	if size == ebmlTestUnknownSize {
+		return append(header, 0x01, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF)
+	}
+	return append(header, 0x01, byte(size>>48), byte(size>>40), byte(size>>32), byte(size>>24), byte(size>>16), byte(size>>8), byte(size))
+}
+
+func ebmlTestUint(id, value uint64) []byte {
+	return ebmlTestElement(id, binary.BigEndian.AppendUint64(nil, value))
+}
+
+func ebmlTestFloat(id uint64, value float64) []byte {
+	return ebmlTestElement(id, binary.BigEndian.AppendUint64(nil, math.Float64bits(value)))
+}
+
+func ebmlTestString(id uint64, value string) []byte {
+	return ebmlTestElement(id, []byte(value))
+}
+
+func webmTestHeader(docType string) []byte {
+	return ebmlTestElement(ebmlHeaderID,
+		ebmlTestUint(0x4286, 1), // EBMLVersion
+		ebmlTestString(ebmlDocTypeID, docType),
+		ebmlTestUint(0x4287, 4), // DocTypeVersion
+	)
+}
+
+func webmTestInfo(duration float64) []byte {
+	children := [][]byte{ebmlTestUint(mkvTimecodeScale, 1000000)}
+	if duration > 0 {
+		children = append(children, ebmlTestFloat(mkvDurationID, duration))
+	}
+	return ebmlTestElement(mkvInfoID, children...)
+}
+
+func webmTestTracks(videoCodec string, width, height uint64, audioCodec string) []byte {
+	tracks := [][]byte{ebmlTestElement(mkvTrackEntryID,
+		ebmlTestUint(0xD7, 1), // TrackNumber
+		ebmlTestUint(mkvTrackTypeID, 1),
+		ebmlTestString(mkvCodecID, videoCodec),
+		ebmlTestElement(mkvVideoID, ebmlTestUint(mkvPixelWidthID, width), ebmlTestUint(mkvPixelHeightID, height)),
+	)}
+	if audioCodec != "" {
+		tracks = append(tracks, ebmlTestElement(mkvTrackEntryID,
+			ebmlTestUint(0xD7, 2),
+			ebmlTestUint(mkvTrackTypeID, 2),
+			ebmlTestString(mkvCodecID, audioCodec),
+		))
+	}
+	return ebmlTestElement(mkvTracksID, tracks...)
+}
+
+// webmTestBlock is a SimpleBlock of track 1 at offset ms into its cluster.
+func webmTestBlock(offset int16) []byte {
+	block := []byte{0x81}
+	block = binary.BigEndian.AppendUint16(block, uint16(offset))
+	block = append(block, 0x80)
+	return ebmlTestElement(mkvSimpleBlockID, append(block, make([]byte, 32)...))
+}
+
+func webmTestCluster(size int64, timecode uint64, offsets ...int16) []byte {
+	children := [][]byte{ebmlTestUint(mkvTimecodeID, timecode)}
+	for _, offset := range offsets {
+		children = append(children, webmTestBlock(offset))
+	}
+	body := bytes.Join(children, nil)
+	if size == ebmlTestUnknownSize {
+		return append(ebmlTestHeader(mkvClusterID, ebmlTestUnknownSize), body...)
+	}
+	return append(ebmlTestHeader(mkvClusterID, int64(len(body))), body...)
+}
+
+func webmTestSegment(size int64, children ...[]byte) []byte {
+	body := bytes.Join(children, nil)
+	if size == ebmlTestUnknownSize {
+		return append(ebmlTestHeader(mkvSegmentID, ebmlTestUnknownSize), body...)
+	}
+	return append(ebmlTestHeader(mkvSegmentID, int64(len(body))), body...)
+}
+
+func TestProbeWebM(t *testing.T) {
+	tracks := webmTestTracks("V_VP9", 640, 360, "A_OPUS")
+
+	// What MediaRecorder writes: no duration, and a live segment and
+	// clusters of unknown size
+	recorded := append(webmTestHeader("webm"), webmTestSegment(ebmlTestUnknownSize,
+		webmTestInfo(0),
+		tracks,
+		webmTestCluster(ebmlTestUnknownSize, 0, 0, 5000, 10000),
+		webmTestCluster(ebmlTestUnknownSize, 10000, 0, 8400),
+		ebmlTestElement(0x1C53BB6B), // Cues
+	)...)
+
+	tests := []struct {
+		name    string
+		data    []byte
+		want    *VideoInfo
+		wantErr string
+	}{
+		{
+			name: "duration in segment info",
+			data: append(webmTestHeader("webm"), webmTestSegment(0,
+				ebmlTestElement(0x114D9B74), // SeekHead
+				webmTestInfo(20250),
+				tracks,
+				webmTestCluster(0, 0, 0),
+			)...),
+			want: &VideoInfo{Width: 640, Height: 360, Duration: 20250 * time.Millisecond, VideoCodec: "V_VP9", AudioCodec: "A_OPUS"},
+		},
+		{
+			name: "duration from last block",
+			data: append(webmTestHeader("webm"), webmTestSegment(0,
+				webmTestInfo(0),
+				webmTestTracks("V_VP8", 1280, 720, ""),
+				webmTestCluster(0, 0, 0, 4000),
+				webmTestCluster(0, 12000, 0, 3500, 2000),
+			)...),
+			want: &VideoInfo{Width: 1280, Height: 720, Duration: 15500 * time.Millisecond, VideoCodec: "V_VP8"},
+		},
+		{
+			name: "unknown-size clusters",
+			data: recorded,
+			want: &VideoInfo{Width: 640, Height: 360, Duration: 18400 * time.Millisecond, VideoCodec: "V_VP9", AudioCodec: "A_OPUS"},
+		},
+		{
+			name: "recording cut off between elements",
+			data: recorded[:len(recorded)-len(ebmlTestElement(0x1C53BB6B))],
+			want: &VideoInfo{Width: 640, Height: 360, Duration: 18400 * time.Millisecond, VideoCodec: "V_VP9", AudioCodec: "A_OPUS"},
+		},
+		{
+			name:    "truncated tracks",
+			data:    append(webmTestHeader("webm"), webmTestSegment(0, webmTestInfo(20000), tracks)...)[:len(webmTestHeader("webm"))+40],
+			wantErr: "unexpected EOF",
+		},
+		{
+			name:    "Matroska but not WebM",
+			data:    append(webmTestHeader("matroska"), webmTestSegment(0, webmTestInfo(20000), tracks)...),
+			wantErr: "not a WebM file",
+		},
+		{name: "not EBML", data: mp4TestClip(), wantErr: "not a WebM file"},
+		{
+			name:    "no duration or blocks",
+			data:    append(webmTestHeader("webm"), webmTestSegment(0, webmTestInfo(0), tracks)...),
+			wantErr: "could not determine duration",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := probeVideo(bytes.NewReader(tt.data), ".webm")
+			checkProbe(t, got, err, tt.want, tt.wantErr)
+		})
+	}
+}
+
+func checkProbe(t *testing.T, got *VideoInfo, err error, want *VideoInfo, wantErr string) {
+	t.Helper()
+
+	if wantErr != "" {
+		var invalid *MediaError
+		if err == nil || !strings.Contains(err.Error(), wantErr) || !errors.As(err, &invalid) {
+			t.Fatalf("probeVideo() = %+v, %v, want a MediaError containing %q", got, err, wantErr)
+		}
+		return
+	}
+
+	if err != nil {
+		t.Fatalf("probeVideo() error = %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("probeVideo() = %+v, want %+v", got, want)
+	}
+}
+
+func TestValidateVideo(t *testing.T) {
+	s := &FileService{config: &config.Config{
+		VideoMinDuration:   15 * time.Second,
+		VideoMaxDuration:   time.Minute,
+		VideoMaxResolution: 1920,
+	}}
+	valid := VideoInfo{Width: 1280, Height: 720, Duration: 20 * time.Second, VideoCodec: "avc1", AudioCodec: "mp4a"}
+
+	tests := []struct {
+		name    string
+		ext     string
+		change  func(info *VideoInfo)
+		wantErr string
+	}{
+		{name: "valid", ext: ".mp4", change: func(info *VideoInfo) {}},
+		{name: "no audio", ext: ".mp4", change: func(info *VideoInfo) { info.AudioCodec = "" }},
+		{name: "WebM codecs", ext: ".webm", change: func(info *VideoInfo) { info.VideoCodec, info.AudioCodec = "V_VP9", "A_OPUS" }},
+		{name: "no video track", ext: ".mp4", change: func(info *VideoInfo) { info.VideoCodec = "" }, wantErr: "no video track"},
+		{name: "HEVC", ext: ".mp4", change: func(info *VideoInfo) { info.VideoCodec = "hvc1" }, wantErr: "unsupported video codec hvc1"},
+		{name: "MP4 codec in WebM", ext: ".webm", change: func(info *VideoInfo) {}, wantErr: "unsupported video codec avc1"},
+		{name: "AC-3 audio", ext: ".mp4", change: func(info *VideoInfo) { info.AudioCodec = "ac-3" }, wantErr: "unsupported audio codec"},
+		{name: "too short", ext: ".mp4", change: func(info *VideoInfo) { info.Duration = 14 * time.Second }, wantErr: "between 15s and 1m0s"},
+		{name: "too long", ext: ".mp4", change: func(info *VideoInfo) { info.Duration = 61 * time.Second }, wantErr: "between 15s and 1m0s"},
+		{name: "unknown resolution", ext: ".mp4", change: func(info *VideoInfo) { info.Width = 0 }, wantErr: "resolution"},
+		{name: "4K", ext: ".mp4", change: func(info *VideoInfo) { info.Width, info.Height = 3840, 2160 }, wantErr: "resolution too large"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info := valid
+			tt.change(&info)
+
+			err := s.validateVideo(&info, tt.ext)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("validateVideo() = %v", err)
+				}
+				return
+			}
+
+			var invalid *MediaError
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) || !errors.As(err, &invalid) {
+				t.Errorf("validateVideo() = %v, want a MediaError containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
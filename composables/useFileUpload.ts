@@ -6,7 +6,7 @@ export const useFileUpload = () => {
 
 	const uploadFile = async (
 		file: File
-	): Promise<{ url: string; key: string } | null> => {
+	): Promise<{ id: string; url: string; key: string } | null> => {
 		uploading.value = true;
 		uploadProgress.value = 0;
 
@@ -47,6 +47,7 @@ export const useFileUpload = () => {
 
 			if (response && response.url && response.key) {
 				return {
+					id: response.id,
 					url: response.url,
 					key: response.key,
 				};
@@ -71,7 +72,7 @@ export const useFileUpload = () => {
 		}
 	};
 
-	const uploadMultipleFiles = async (files: File[]): Promise<Array<{ url: string; key: string }>> => {
+	const uploadMultipleFiles = async (files: File[]): Promise<Array<{ id: string; url: string; key: string }>> => {
 		const results = [];
 		
 		for (const file of files) {
@@ -89,9 +90,19 @@ export const useFileUpload = () => {
 		return results;
 	};
 
-	const deleteFile = async (key: string): Promise<boolean> => {
+	const listFiles = async () => {
+		const response = await $fetch(`${config.public.backendUrl}/api/v1/files`, {
+			method: "GET",
+			headers: {
+				Authorization: `Bearer ${token.value}`,
+			},
+		});
+		return response?.files || [];
+	};
+
+	const deleteFile = async (id: string): Promise<boolean> => {
 		try {
-			await $fetch(`${config.public.backendUrl}/api/v1/files/${key}`, {
+			await $fetch(`${config.public.backendUrl}/api/v1/files/${id}`, {
 				method: "DELETE",
 				headers: {
 					Authorization: `Bearer ${token.value}`,
@@ -135,6 +146,7 @@ export const useFileUpload = () => {
 		uploadProgress: readonly(uploadProgress),
 		uploadFile,
 		uploadMultipleFiles,
+		listFiles,
 		deleteFile,
 		getFileUrl,
 		validateImageFile,
@@ -59,6 +59,10 @@ export const GET_RECIPES = gql`
 				image_url
 				is_featured
 				caption
+				width
+				height
+				blurhash
+				dominant_color
 			}
 		}
 		recipes_aggregate(where: $where) {
@@ -118,6 +122,10 @@ export const GET_RECIPE_BY_ID = gql`
 				image_url
 				is_featured
 				caption
+				width
+				height
+				blurhash
+				dominant_color
 			}
 		}
 		
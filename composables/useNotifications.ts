@@ -267,17 +267,8 @@ export const useNotifications = () => {
 					);
 				}
 
-				// Send purchase confirmation to buyer
-				await sendEmailNotification(
-					purchasedByUser.email,
-					'purchase_confirmation',
-					{
-						recipe_title: recipe.title,
-						recipe_id: recipe.id,
-						amount,
-						seller_name: recipe.user.full_name,
-					}
-				);
+				// The buyer's confirmation, with the invoice attached, is
+				// emailed by the backend when the payment completes
 			}
 		} catch (error) {
 			console.error("Failed to send recipe purchased notification:", error);
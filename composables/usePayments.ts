@@ -3,13 +3,17 @@ export const usePayments = () => {
 	const config = useRuntimeConfig();
 	const processing = ref(false);
 
+	// Pay for a recipe, or for a bundle of recipes with bundle_id
 	const initializePayment = async (paymentData: {
-		recipe_id: string;
+		recipe_id?: string;
+		bundle_id?: string;
 		amount: number;
 		email: string;
 		phone: string;
 		first_name: string;
 		last_name: string;
+		recipient_email?: string;
+		gift_message?: string;
 		callback_url?: string;
 		return_url?: string;
 	}) => {
@@ -24,9 +28,14 @@ export const usePayments = () => {
 				},
 				body: JSON.stringify({
 					recipe_id: paymentData.recipe_id,
+					bundle_id: paymentData.bundle_id,
 					amount: paymentData.amount,
+					recipient_email: paymentData.recipient_email,
+					gift_message: paymentData.gift_message,
 					callback_url: paymentData.callback_url || `${window.location.origin}/payment/callback`,
-					return_url: paymentData.return_url || `${window.location.origin}/recipes/${paymentData.recipe_id}`,
+					return_url: paymentData.return_url || (paymentData.bundle_id
+						? `${window.location.origin}/bundles/${paymentData.bundle_id}`
+						: `${window.location.origin}/recipes/${paymentData.recipe_id}`),
 				}),
 			});
 
@@ -145,11 +154,72 @@ export const usePayments = () => {
 		}
 	};
 
+	// Load the ingredients and steps the reader may see. Premium recipes come
+	// back in full to their owner, buyers and subscribers and as a teaser to
+	// everyone else.
+	const getRecipeContent = async (recipeId: string) => {
+		const headers: Record<string, string> = {};
+		if (token.value) {
+			headers.Authorization = `Bearer ${token.value}`;
+		}
+
+		try {
+			return await $fetch(`${config.public.backendUrl}/api/v1/recipes/${recipeId}/content`, {
+				method: "GET",
+				headers,
+			});
+		} catch (error) {
+			console.error("Failed to load recipe content:", error);
+			return null;
+		}
+	};
+
+	// Load a bundle on sale with its recipes
+	const getBundle = async (bundleId: string) => {
+		try {
+			return await $fetch(`${config.public.backendUrl}/api/v1/bundles/${bundleId}`, {
+				method: "GET",
+			});
+		} catch (error) {
+			console.error("Failed to load bundle:", error);
+			return null;
+		}
+	};
+
+	// Redeem a gift code, giving the signed-in user the recipe
+	const redeemGift = async (code: string) => {
+		try {
+			const response = await $fetch(`${config.public.backendUrl}/api/v1/gifts/redeem`, {
+				method: "POST",
+				headers: {
+					"Content-Type": "application/json",
+					Authorization: `Bearer ${token.value}`,
+				},
+				body: JSON.stringify({ code }),
+			});
+
+			return {
+				success: true,
+				recipe_id: response.recipe_id,
+				recipe_title: response.recipe_title,
+			};
+		} catch (error: any) {
+			console.error("Gift redemption failed:", error);
+			return {
+				success: false,
+				error: error.data?.error || "Gift redemption failed. Please try again.",
+			};
+		}
+	};
+
 	return {
 		processing: readonly(processing),
 		initializePayment,
 		verifyPayment,
 		getPaymentStatus,
 		checkRecipePurchase,
+		getRecipeContent,
+		getBundle,
+		redeemGift,
 	};
 };
\ No newline at end of file
@@ -0,0 +1,30 @@
+-- File ownership registry
+
+-- Roles for users
+ALTER TABLE users ADD COLUMN IF NOT EXISTS role text CHECK (role IN ('user', 'admin')) DEFAULT 'user';
+
+-- Uploaded files table
+CREATE TABLE IF NOT EXISTS files (
+  id uuid PRIMARY KEY DEFAULT uuid_generate_v4(),
+  user_id uuid REFERENCES users(id) ON DELETE CASCADE NOT NULL,
+  key text UNIQUE NOT NULL,
+  url text NOT NULL,
+  file_name text,
+  size bigint NOT NULL,
+  mime_type text NOT NULL,
+  reference_type text CHECK (reference_type IN ('recipe', 'recipe_image', 'recipe_step', 'avatar')),
+  reference_id uuid,
+  created_at timestamptz DEFAULT now(),
+  updated_at timestamptz DEFAULT now()
+);
+
+-- Create indexes for files
+CREATE INDEX IF NOT EXISTS idx_files_user_id ON files(user_id);
+CREATE INDEX IF NOT EXISTS idx_files_reference ON files(reference_type, reference_id);
+CREATE INDEX IF NOT EXISTS idx_files_created_at ON files(created_at DESC);
+
+-- Keep updated_at current
+CREATE TRIGGER update_files_updated_at
+  BEFORE UPDATE ON files
+  FOR EACH ROW
+  EXECUTE FUNCTION update_updated_at_column();
@@ -0,0 +1,37 @@
+-- Image placeholders and dimensions
+
+ALTER TABLE files ADD COLUMN IF NOT EXISTS width integer;
+ALTER TABLE files ADD COLUMN IF NOT EXISTS height integer;
+ALTER TABLE files ADD COLUMN IF NOT EXISTS blurhash text;
+ALTER TABLE files ADD COLUMN IF NOT EXISTS dominant_color text;
+
+ALTER TABLE recipe_images ADD COLUMN IF NOT EXISTS width integer;
+ALTER TABLE recipe_images ADD COLUMN IF NOT EXISTS height integer;
+ALTER TABLE recipe_images ADD COLUMN IF NOT EXISTS blurhash text;
+ALTER TABLE recipe_images ADD COLUMN IF NOT EXISTS dominant_color text;
+
+-- Copy placeholder data from the uploaded file when a recipe image is saved
+CREATE OR REPLACE FUNCTION fill_recipe_image_placeholder()
+RETURNS TRIGGER AS $$
+BEGIN
+  IF NEW.blurhash IS NULL THEN
+    SELECT f.width, f.height, f.blurhash, f.dominant_color
+    INTO NEW.width, NEW.height, NEW.blurhash, NEW.dominant_color
+    FROM files f
+    WHERE f.url = NEW.image_url
+    LIMIT 1;
+  END IF;
+  RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER fill_recipe_images_placeholder
+  BEFORE INSERT OR UPDATE OF image_url ON recipe_images
+  FOR EACH ROW
+  EXECUTE FUNCTION fill_recipe_image_placeholder();
+
+-- Backfill images uploaded before this migration
+UPDATE recipe_images ri
+SET width = f.width, height = f.height, blurhash = f.blurhash, dominant_color = f.dominant_color
+FROM files f
+WHERE f.url = ri.image_url AND ri.blurhash IS NULL;
@@ -0,0 +1,7 @@
+-- Private files for premium recipe media
+
+ALTER TABLE files ADD COLUMN IF NOT EXISTS visibility text CHECK (visibility IN ('public', 'private')) DEFAULT 'public';
+ALTER TABLE files ADD COLUMN IF NOT EXISTS recipe_id uuid REFERENCES recipes(id) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS idx_files_recipe_id ON files(recipe_id);
+CREATE INDEX IF NOT EXISTS idx_purchases_user_recipe ON purchases(user_id, recipe_id);
@@ -0,0 +1,56 @@
+-- Per-user storage accounting and roles for quotas
+
+-- Roles are now free, chef and admin
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_role_check;
+UPDATE users SET role = 'free' WHERE role IS NULL OR role = 'user';
+UPDATE users SET role = 'chef'
+WHERE role = 'free' AND EXISTS (SELECT 1 FROM recipes r WHERE r.user_id = users.id);
+ALTER TABLE users ALTER COLUMN role SET DEFAULT 'free';
+ALTER TABLE users ADD CONSTRAINT users_role_check CHECK (role IN ('free', 'chef', 'admin'));
+
+-- Bytes stored per user
+CREATE TABLE IF NOT EXISTS user_storage_usage (
+  user_id uuid PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+  bytes_used bigint NOT NULL DEFAULT 0,
+  file_count integer NOT NULL DEFAULT 0,
+  updated_at timestamptz DEFAULT now()
+);
+
+-- Keep usage in step with the files table
+CREATE OR REPLACE FUNCTION track_user_storage_usage()
+RETURNS TRIGGER AS $$
+BEGIN
+  IF TG_OP = 'INSERT' THEN
+    INSERT INTO user_storage_usage (user_id, bytes_used, file_count)
+    VALUES (NEW.user_id, NEW.size, 1)
+    ON CONFLICT (user_id) DO UPDATE
+    SET bytes_used = user_storage_usage.bytes_used + EXCLUDED.bytes_used,
+        file_count = user_storage_usage.file_count + 1,
+        updated_at = now();
+    RETURN NEW;
+  ELSIF TG_OP = 'DELETE' THEN
+    UPDATE user_storage_usage
+    SET bytes_used = GREATEST(bytes_used - OLD.size, 0),
+        file_count = GREATEST(file_count - 1, 0),
+        updated_at = now()
+    WHERE user_id = OLD.user_id;
+    RETURN OLD;
+  END IF;
+  RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER track_files_storage_usage
+  AFTER INSERT OR DELETE ON files
+  FOR EACH ROW
+  EXECUTE FUNCTION track_user_storage_usage();
+
+-- Backfill usage for existing files
+INSERT INTO user_storage_usage (user_id, bytes_used, file_count)
+SELECT user_id, SUM(size), COUNT(*)
+FROM files
+GROUP BY user_id
+ON CONFLICT (user_id) DO UPDATE
+SET bytes_used = EXCLUDED.bytes_used,
+    file_count = EXCLUDED.file_count,
+    updated_at = now();
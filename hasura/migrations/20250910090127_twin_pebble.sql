@@ -0,0 +1,11 @@
+-- Content-addressed storage shared between file records
+
+ALTER TABLE files ADD COLUMN IF NOT EXISTS content_hash text;
+
+-- Several users may now reference the same stored object
+ALTER TABLE files DROP CONSTRAINT IF EXISTS files_key_key;
+
+CREATE INDEX IF NOT EXISTS idx_files_key ON files(key);
+CREATE INDEX IF NOT EXISTS idx_files_content_hash ON files(content_hash, visibility);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_files_owner_content ON files(user_id, content_hash, visibility)
+  WHERE content_hash IS NOT NULL;
@@ -0,0 +1,29 @@
+-- Ordered recipe galleries built from uploaded files
+
+ALTER TABLE recipe_images ADD COLUMN IF NOT EXISTS position integer NOT NULL DEFAULT 0;
+ALTER TABLE recipe_images ADD COLUMN IF NOT EXISTS file_id uuid REFERENCES files(id) ON DELETE SET NULL;
+
+-- Number existing images in upload order
+UPDATE recipe_images ri
+SET position = ordered.position
+FROM (
+  SELECT id, row_number() OVER (PARTITION BY recipe_id ORDER BY created_at, id) - 1 AS position
+  FROM recipe_images
+) ordered
+WHERE ri.id = ordered.id;
+
+-- Keep only the earliest featured image per recipe
+UPDATE recipe_images ri
+SET is_featured = false
+WHERE ri.is_featured
+  AND EXISTS (
+    SELECT 1 FROM recipe_images other
+    WHERE other.recipe_id = ri.recipe_id
+      AND other.is_featured
+      AND (other.position, other.id) < (ri.position, ri.id)
+  );
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_recipe_images_featured ON recipe_images(recipe_id)
+  WHERE is_featured;
+CREATE INDEX IF NOT EXISTS idx_recipe_images_position ON recipe_images(recipe_id, position);
+CREATE INDEX IF NOT EXISTS idx_recipe_images_file_id ON recipe_images(file_id);
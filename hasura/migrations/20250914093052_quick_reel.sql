@@ -0,0 +1,10 @@
+-- Short video clips for recipe steps
+
+ALTER TABLE files ADD COLUMN IF NOT EXISTS duration numeric;
+ALTER TABLE files ADD COLUMN IF NOT EXISTS video_codec text;
+ALTER TABLE files ADD COLUMN IF NOT EXISTS audio_codec text;
+ALTER TABLE files ADD COLUMN IF NOT EXISTS poster_url text;
+
+ALTER TABLE recipe_steps ADD COLUMN IF NOT EXISTS video_url text;
+ALTER TABLE recipe_steps ADD COLUMN IF NOT EXISTS video_poster_url text;
+ALTER TABLE recipe_steps ADD COLUMN IF NOT EXISTS video_duration numeric;
@@ -0,0 +1,22 @@
+-- Idempotent payment initialization
+
+ALTER TABLE purchases ADD COLUMN IF NOT EXISTS idempotency_key text;
+ALTER TABLE purchases ADD COLUMN IF NOT EXISTS checkout_url text;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_purchases_idempotency_key ON purchases(user_id, idempotency_key)
+  WHERE idempotency_key IS NOT NULL;
+
+-- Close all but the newest open checkout per user and recipe
+UPDATE purchases p
+SET status = 'failed'
+WHERE p.status = 'pending'
+  AND EXISTS (
+    SELECT 1 FROM purchases newer
+    WHERE newer.user_id = p.user_id
+      AND newer.recipe_id = p.recipe_id
+      AND newer.status = 'pending'
+      AND (newer.created_at, newer.id) > (p.created_at, p.id)
+  );
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_purchases_one_pending ON purchases(user_id, recipe_id)
+  WHERE status = 'pending';
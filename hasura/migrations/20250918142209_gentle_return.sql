@@ -0,0 +1,20 @@
+-- Refunds of completed purchases
+
+CREATE TABLE IF NOT EXISTS refunds (
+  id uuid PRIMARY KEY DEFAULT uuid_generate_v4(),
+  purchase_id uuid REFERENCES purchases(id) ON DELETE CASCADE NOT NULL,
+  amount decimal(10,2) NOT NULL CHECK (amount > 0),
+  reason text NOT NULL,
+  status text CHECK (status IN ('pending', 'completed', 'failed')) DEFAULT 'pending',
+  provider_reference text,
+  requested_by uuid REFERENCES users(id) ON DELETE SET NULL,
+  created_at timestamptz DEFAULT now(),
+  updated_at timestamptz DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_refunds_purchase_id ON refunds(purchase_id);
+
+CREATE TRIGGER update_refunds_updated_at
+  BEFORE UPDATE ON refunds
+  FOR EACH ROW
+  EXECUTE FUNCTION update_updated_at_column();
@@ -0,0 +1,9 @@
+-- Reconciliation of pending purchases
+
+-- Checkouts abandoned without payment are marked expired
+ALTER TABLE purchases DROP CONSTRAINT IF EXISTS purchases_status_check;
+ALTER TABLE purchases ADD CONSTRAINT purchases_status_check
+  CHECK (status IN ('pending', 'completed', 'failed', 'refunded', 'expired'));
+
+-- Find pending purchases by age
+CREATE INDEX IF NOT EXISTS idx_purchases_pending_created_at ON purchases(created_at) WHERE status = 'pending';
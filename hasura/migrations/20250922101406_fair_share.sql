@@ -0,0 +1,43 @@
+-- Creator earnings ledger
+
+-- Double-entry ledger. Each journal (one sale or refund) is identified by its
+-- reference and its lines sum to zero; positive amounts are credits and
+-- negative amounts debits.
+CREATE TABLE IF NOT EXISTS ledger_entries (
+  id uuid PRIMARY KEY DEFAULT uuid_generate_v4(),
+  reference text NOT NULL,
+  line smallint NOT NULL,
+  entry_type text NOT NULL CHECK (entry_type IN ('sale', 'refund')),
+  account text NOT NULL CHECK (account IN ('provider_clearing', 'platform_revenue', 'creator_earnings')),
+  user_id uuid REFERENCES users(id) ON DELETE SET NULL,
+  purchase_id uuid REFERENCES purchases(id) ON DELETE SET NULL,
+  refund_id uuid REFERENCES refunds(id) ON DELETE SET NULL,
+  recipe_id uuid REFERENCES recipes(id) ON DELETE SET NULL,
+  amount decimal(12,2) NOT NULL,
+  description text,
+  available_at timestamptz NOT NULL DEFAULT now(),
+  created_at timestamptz DEFAULT now(),
+  CONSTRAINT ledger_entries_reference_line_key UNIQUE (reference, line)
+);
+
+CREATE INDEX IF NOT EXISTS idx_ledger_entries_account_user ON ledger_entries(account, user_id, available_at);
+CREATE INDEX IF NOT EXISTS idx_ledger_entries_purchase_id ON ledger_entries(purchase_id);
+
+-- Reject journals that do not balance, checked when the transaction commits
+-- so all lines of a journal can be inserted first
+CREATE OR REPLACE FUNCTION check_ledger_journal_balance()
+RETURNS TRIGGER AS $$
+BEGIN
+  IF (SELECT COALESCE(SUM(amount), 0) FROM ledger_entries WHERE reference = NEW.reference) <> 0 THEN
+    RAISE EXCEPTION 'ledger journal % does not balance', NEW.reference;
+  END IF;
+  RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS check_ledger_entries_balance ON ledger_entries;
+CREATE CONSTRAINT TRIGGER check_ledger_entries_balance
+  AFTER INSERT ON ledger_entries
+  DEFERRABLE INITIALLY DEFERRED
+  FOR EACH ROW
+  EXECUTE FUNCTION check_ledger_journal_balance();
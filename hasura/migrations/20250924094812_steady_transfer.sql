@@ -0,0 +1,68 @@
+-- Creator payouts
+
+-- Bank accounts and mobile money wallets creators are paid to
+CREATE TABLE IF NOT EXISTS payout_accounts (
+  id uuid PRIMARY KEY DEFAULT uuid_generate_v4(),
+  user_id uuid REFERENCES users(id) ON DELETE CASCADE NOT NULL,
+  method text NOT NULL CHECK (method IN ('bank', 'mobile_money')),
+  bank_code integer NOT NULL,
+  bank_name text,
+  account_name text NOT NULL,
+  account_number text NOT NULL,
+  created_at timestamptz DEFAULT now(),
+  updated_at timestamptz DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_payout_accounts_user_id ON payout_accounts(user_id);
+
+CREATE TRIGGER update_payout_accounts_updated_at
+  BEFORE UPDATE ON payout_accounts
+  FOR EACH ROW
+  EXECUTE FUNCTION update_updated_at_column();
+
+-- Payout requests; the account details are copied so later changes to the
+-- account do not affect a payout under review
+CREATE TABLE IF NOT EXISTS payouts (
+  id uuid PRIMARY KEY DEFAULT uuid_generate_v4(),
+  user_id uuid REFERENCES users(id) ON DELETE CASCADE NOT NULL,
+  payout_account_id uuid REFERENCES payout_accounts(id) ON DELETE SET NULL,
+  amount decimal(12,2) NOT NULL CHECK (amount > 0),
+  currency text NOT NULL DEFAULT 'ETB',
+  status text NOT NULL CHECK (status IN ('requested', 'processing', 'completed', 'failed', 'rejected')) DEFAULT 'requested',
+  method text NOT NULL,
+  bank_code integer NOT NULL,
+  bank_name text,
+  account_name text NOT NULL,
+  account_number text NOT NULL,
+  provider_reference text,
+  failure_reason text,
+  reviewed_by uuid REFERENCES users(id) ON DELETE SET NULL,
+  reviewed_at timestamptz,
+  created_at timestamptz DEFAULT now(),
+  updated_at timestamptz DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_payouts_user_id ON payouts(user_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_payouts_status ON payouts(status, created_at DESC);
+
+-- One payout in flight per creator
+CREATE UNIQUE INDEX IF NOT EXISTS idx_payouts_open_user ON payouts(user_id)
+  WHERE status IN ('requested', 'processing');
+
+CREATE TRIGGER update_payouts_updated_at
+  BEFORE UPDATE ON payouts
+  FOR EACH ROW
+  EXECUTE FUNCTION update_updated_at_column();
+
+-- Payout journals in the ledger
+ALTER TABLE ledger_entries ADD COLUMN IF NOT EXISTS payout_id uuid REFERENCES payouts(id) ON DELETE SET NULL;
+
+ALTER TABLE ledger_entries DROP CONSTRAINT IF EXISTS ledger_entries_entry_type_check;
+ALTER TABLE ledger_entries ADD CONSTRAINT ledger_entries_entry_type_check
+  CHECK (entry_type IN ('sale', 'refund', 'payout', 'payout_reversal'));
+
+ALTER TABLE ledger_entries DROP CONSTRAINT IF EXISTS ledger_entries_account_check;
+ALTER TABLE ledger_entries ADD CONSTRAINT ledger_entries_account_check
+  CHECK (account IN ('provider_clearing', 'platform_revenue', 'creator_earnings', 'payouts_payable'));
+
+CREATE INDEX IF NOT EXISTS idx_ledger_entries_payout_id ON ledger_entries(payout_id);
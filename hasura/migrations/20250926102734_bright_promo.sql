@@ -0,0 +1,38 @@
+-- Coupons
+
+-- Discount codes created by chefs for their recipes, or by admins sitewide.
+-- Codes are stored upper case.
+CREATE TABLE IF NOT EXISTS coupons (
+  id uuid PRIMARY KEY DEFAULT uuid_generate_v4(),
+  code text UNIQUE NOT NULL CHECK (code = upper(code)),
+  created_by uuid REFERENCES users(id) ON DELETE CASCADE NOT NULL,
+  discount_type text NOT NULL CHECK (discount_type IN ('percent', 'fixed')),
+  discount_value decimal(12,2) NOT NULL CHECK (discount_value > 0),
+  scope text NOT NULL CHECK (scope IN ('recipe', 'chef', 'sitewide')),
+  recipe_id uuid REFERENCES recipes(id) ON DELETE CASCADE,
+  chef_id uuid REFERENCES users(id) ON DELETE CASCADE,
+  expires_at timestamptz,
+  max_uses integer CHECK (max_uses > 0),
+  max_uses_per_user integer CHECK (max_uses_per_user > 0),
+  is_active boolean NOT NULL DEFAULT true,
+  created_at timestamptz DEFAULT now(),
+  updated_at timestamptz DEFAULT now(),
+  CHECK (discount_type <> 'percent' OR discount_value <= 100),
+  CHECK (scope <> 'recipe' OR recipe_id IS NOT NULL),
+  CHECK (scope <> 'chef' OR chef_id IS NOT NULL)
+);
+
+CREATE INDEX IF NOT EXISTS idx_coupons_created_by ON coupons(created_by, created_at DESC);
+
+CREATE TRIGGER update_coupons_updated_at
+  BEFORE UPDATE ON coupons
+  FOR EACH ROW
+  EXECUTE FUNCTION update_updated_at_column();
+
+-- The discount applied to a purchase; amount is what was charged
+ALTER TABLE purchases ADD COLUMN IF NOT EXISTS coupon_id uuid REFERENCES coupons(id) ON DELETE SET NULL;
+ALTER TABLE purchases ADD COLUMN IF NOT EXISTS original_amount decimal(10,2);
+ALTER TABLE purchases ADD COLUMN IF NOT EXISTS discount_amount decimal(10,2) NOT NULL DEFAULT 0;
+
+CREATE INDEX IF NOT EXISTS idx_purchases_coupon_id ON purchases(coupon_id, user_id)
+  WHERE coupon_id IS NOT NULL;
@@ -0,0 +1,92 @@
+-- Premium subscriptions
+
+-- Plans give access to every premium recipe (created by admins) or to all
+-- premium recipes of one chef (created by the chef)
+CREATE TABLE IF NOT EXISTS subscription_plans (
+  id uuid PRIMARY KEY DEFAULT uuid_generate_v4(),
+  name text NOT NULL,
+  description text,
+  scope text NOT NULL CHECK (scope IN ('all_premium', 'chef')),
+  chef_id uuid REFERENCES users(id) ON DELETE CASCADE,
+  price decimal(10,2) NOT NULL CHECK (price > 0),
+  billing_interval text NOT NULL CHECK (billing_interval IN ('month', 'year')) DEFAULT 'month',
+  is_active boolean NOT NULL DEFAULT true,
+  created_by uuid REFERENCES users(id) ON DELETE SET NULL,
+  created_at timestamptz DEFAULT now(),
+  updated_at timestamptz DEFAULT now(),
+  CHECK (scope <> 'chef' OR chef_id IS NOT NULL)
+);
+
+CREATE INDEX IF NOT EXISTS idx_subscription_plans_chef_id ON subscription_plans(chef_id);
+
+CREATE TRIGGER update_subscription_plans_updated_at
+  BEFORE UPDATE ON subscription_plans
+  FOR EACH ROW
+  EXECUTE FUNCTION update_updated_at_column();
+
+-- A subscription is pending until its first payment, then active for one
+-- billing period at a time. A failed renewal makes it past_due until the
+-- grace period ends. chef_id is copied from the plan so access checks need
+-- no join; it is null for plans covering all premium recipes.
+CREATE TABLE IF NOT EXISTS subscriptions (
+  id uuid PRIMARY KEY DEFAULT uuid_generate_v4(),
+  user_id uuid REFERENCES users(id) ON DELETE CASCADE NOT NULL,
+  plan_id uuid REFERENCES subscription_plans(id) ON DELETE CASCADE NOT NULL,
+  chef_id uuid REFERENCES users(id) ON DELETE CASCADE,
+  status text NOT NULL CHECK (status IN ('pending', 'active', 'past_due', 'canceled', 'expired')) DEFAULT 'pending',
+  current_period_start timestamptz,
+  current_period_end timestamptz,
+  grace_until timestamptz,
+  cancel_at_period_end boolean NOT NULL DEFAULT false,
+  canceled_at timestamptz,
+  created_at timestamptz DEFAULT now(),
+  updated_at timestamptz DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_subscriptions_user_id ON subscriptions(user_id, status);
+CREATE INDEX IF NOT EXISTS idx_subscriptions_period_end ON subscriptions(current_period_end)
+  WHERE status IN ('active', 'past_due');
+
+-- One open subscription per user and plan
+CREATE UNIQUE INDEX IF NOT EXISTS idx_subscriptions_open_user_plan ON subscriptions(user_id, plan_id)
+  WHERE status IN ('pending', 'active', 'past_due');
+
+CREATE TRIGGER update_subscriptions_updated_at
+  BEFORE UPDATE ON subscriptions
+  FOR EACH ROW
+  EXECUTE FUNCTION update_updated_at_column();
+
+-- One payment per billing period, made through the payment provider
+CREATE TABLE IF NOT EXISTS subscription_payments (
+  id uuid PRIMARY KEY DEFAULT uuid_generate_v4(),
+  subscription_id uuid REFERENCES subscriptions(id) ON DELETE CASCADE NOT NULL,
+  user_id uuid REFERENCES users(id) ON DELETE CASCADE NOT NULL,
+  amount decimal(10,2) NOT NULL CHECK (amount > 0),
+  transaction_id text UNIQUE NOT NULL,
+  status text NOT NULL CHECK (status IN ('pending', 'completed', 'failed', 'expired')) DEFAULT 'pending',
+  checkout_url text,
+  period_start timestamptz NOT NULL,
+  period_end timestamptz NOT NULL,
+  created_at timestamptz DEFAULT now(),
+  updated_at timestamptz DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_subscription_payments_subscription_id ON subscription_payments(subscription_id, created_at DESC);
+
+-- One open payment per subscription
+CREATE UNIQUE INDEX IF NOT EXISTS idx_subscription_payments_one_pending ON subscription_payments(subscription_id)
+  WHERE status = 'pending';
+
+CREATE TRIGGER update_subscription_payments_updated_at
+  BEFORE UPDATE ON subscription_payments
+  FOR EACH ROW
+  EXECUTE FUNCTION update_updated_at_column();
+
+-- Subscription journals in the ledger
+ALTER TABLE ledger_entries ADD COLUMN IF NOT EXISTS subscription_payment_id uuid REFERENCES subscription_payments(id) ON DELETE SET NULL;
+
+ALTER TABLE ledger_entries DROP CONSTRAINT IF EXISTS ledger_entries_entry_type_check;
+ALTER TABLE ledger_entries ADD CONSTRAINT ledger_entries_entry_type_check
+  CHECK (entry_type IN ('sale', 'refund', 'payout', 'payout_reversal', 'subscription'));
+
+CREATE INDEX IF NOT EXISTS idx_ledger_entries_subscription_payment_id ON ledger_entries(subscription_payment_id);
@@ -0,0 +1,41 @@
+-- Multi-currency pricing
+
+-- Currency a recipe is priced in
+ALTER TABLE recipes ADD COLUMN IF NOT EXISTS currency text NOT NULL DEFAULT 'ETB'
+  CHECK (currency IN ('ETB', 'USD'));
+
+-- Latest rate per currency pair: one unit of base_currency is worth rate
+-- units of quote_currency
+CREATE TABLE IF NOT EXISTS exchange_rates (
+  base_currency text NOT NULL CHECK (base_currency IN ('ETB', 'USD')),
+  quote_currency text NOT NULL CHECK (quote_currency IN ('ETB', 'USD')),
+  rate decimal(18,8) NOT NULL CHECK (rate > 0),
+  source text NOT NULL CHECK (source IN ('admin', 'csv')),
+  updated_by uuid REFERENCES users(id) ON DELETE SET NULL,
+  created_at timestamptz DEFAULT now(),
+  updated_at timestamptz DEFAULT now(),
+  PRIMARY KEY (base_currency, quote_currency),
+  CHECK (base_currency <> quote_currency)
+);
+
+CREATE TRIGGER update_exchange_rates_updated_at
+  BEFORE UPDATE ON exchange_rates
+  FOR EACH ROW
+  EXECUTE FUNCTION update_updated_at_column();
+
+-- What a purchase was listed at and what was charged. amount is charged in
+-- currency; settlement_amount is the same amount in ETB, the currency the
+-- ledger is kept in.
+ALTER TABLE purchases ADD COLUMN IF NOT EXISTS currency text NOT NULL DEFAULT 'ETB';
+ALTER TABLE purchases ADD COLUMN IF NOT EXISTS list_price decimal(10,2);
+ALTER TABLE purchases ADD COLUMN IF NOT EXISTS list_currency text;
+ALTER TABLE purchases ADD COLUMN IF NOT EXISTS exchange_rate decimal(18,8);
+ALTER TABLE purchases ADD COLUMN IF NOT EXISTS settlement_amount decimal(10,2);
+
+UPDATE purchases
+SET list_price = COALESCE(original_amount, amount), list_currency = 'ETB', exchange_rate = 1, settlement_amount = amount
+WHERE list_price IS NULL;
+
+-- Currency of fixed coupon discounts
+ALTER TABLE coupons ADD COLUMN IF NOT EXISTS currency text NOT NULL DEFAULT 'ETB'
+  CHECK (currency IN ('ETB', 'USD'));
@@ -0,0 +1,62 @@
+-- Invoices for completed purchases
+
+-- Chapa's own reference for the payment, saved when it is verified
+ALTER TABLE purchases ADD COLUMN IF NOT EXISTS provider_reference text;
+
+-- Last invoice number handed out. A single row, updated by the insert
+-- trigger, so numbers have no gaps: a failed insert rolls the update back.
+CREATE TABLE IF NOT EXISTS invoice_counter (
+  id boolean PRIMARY KEY DEFAULT true CHECK (id),
+  last_number bigint NOT NULL DEFAULT 0
+);
+
+INSERT INTO invoice_counter (id, last_number) VALUES (true, 0) ON CONFLICT DO NOTHING;
+
+-- Seller, buyer and amounts are copied when the invoice is issued so the
+-- document never changes afterwards
+CREATE TABLE IF NOT EXISTS invoices (
+  id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+  number bigint NOT NULL UNIQUE,
+  invoice_number text NOT NULL UNIQUE,
+  purchase_id uuid NOT NULL UNIQUE REFERENCES purchases(id) ON DELETE RESTRICT,
+  issued_at timestamptz NOT NULL DEFAULT now(),
+  issuer_name text NOT NULL,
+  issuer_tin text,
+  issuer_address text,
+  seller_id uuid REFERENCES users(id) ON DELETE SET NULL,
+  seller_name text NOT NULL,
+  seller_email text NOT NULL,
+  buyer_id uuid REFERENCES users(id) ON DELETE SET NULL,
+  buyer_name text NOT NULL,
+  buyer_email text NOT NULL,
+  recipe_id uuid REFERENCES recipes(id) ON DELETE SET NULL,
+  recipe_title text NOT NULL,
+  currency text NOT NULL,
+  total_amount decimal(10,2) NOT NULL CHECK (total_amount >= 0),
+  discount_amount decimal(10,2) NOT NULL DEFAULT 0,
+  vat_rate decimal(5,2) NOT NULL CHECK (vat_rate >= 0),
+  net_amount decimal(10,2) NOT NULL,
+  vat_amount decimal(10,2) NOT NULL,
+  transaction_id text NOT NULL,
+  provider_reference text,
+  created_at timestamptz DEFAULT now(),
+  CHECK (net_amount + vat_amount = total_amount)
+);
+
+CREATE INDEX IF NOT EXISTS idx_invoices_buyer_id ON invoices(buyer_id);
+
+CREATE OR REPLACE FUNCTION assign_invoice_number()
+RETURNS TRIGGER AS $$
+BEGIN
+  UPDATE invoice_counter SET last_number = last_number + 1 WHERE id
+  RETURNING last_number INTO NEW.number;
+  NEW.invoice_number := 'INV-' || lpad(NEW.number::text, 6, '0');
+  RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS assign_invoices_number ON invoices;
+CREATE TRIGGER assign_invoices_number
+  BEFORE INSERT ON invoices
+  FOR EACH ROW
+  EXECUTE FUNCTION assign_invoice_number();
@@ -0,0 +1,27 @@
+-- Recipes bought as gifts
+
+-- A gift purchase is paid for by user_id but grants access to whoever
+-- redeems gift_code before gift_expires_at, rather than to the buyer
+ALTER TABLE purchases ADD COLUMN IF NOT EXISTS recipient_email text;
+ALTER TABLE purchases ADD COLUMN IF NOT EXISTS gift_message text;
+ALTER TABLE purchases ADD COLUMN IF NOT EXISTS gift_code text UNIQUE;
+ALTER TABLE purchases ADD COLUMN IF NOT EXISTS gift_expires_at timestamptz;
+ALTER TABLE purchases ADD COLUMN IF NOT EXISTS redeemed_by uuid REFERENCES users(id) ON DELETE SET NULL;
+ALTER TABLE purchases ADD COLUMN IF NOT EXISTS redeemed_at timestamptz;
+
+ALTER TABLE purchases DROP CONSTRAINT IF EXISTS purchases_gift_check;
+ALTER TABLE purchases ADD CONSTRAINT purchases_gift_check CHECK (
+  (gift_code IS NULL) = (recipient_email IS NULL)
+  AND (gift_code IS NULL) = (gift_expires_at IS NULL)
+  AND (redeemed_by IS NULL OR gift_code IS NOT NULL)
+);
+
+CREATE INDEX IF NOT EXISTS idx_purchases_redeemed_by ON purchases(redeemed_by, recipe_id)
+  WHERE redeemed_by IS NOT NULL;
+
+-- A buyer may have one open checkout per recipe for themselves and one per
+-- gift recipient
+DROP INDEX IF EXISTS idx_purchases_one_pending;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_purchases_one_pending
+  ON purchases(user_id, recipe_id, coalesce(recipient_email, ''))
+  WHERE status = 'pending';
@@ -0,0 +1,61 @@
+-- Recipe bundles
+
+-- A chef sells several of their premium recipes together for one price
+CREATE TABLE IF NOT EXISTS bundles (
+  id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+  chef_id uuid NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  title text NOT NULL,
+  description text,
+  price decimal(10,2) NOT NULL CHECK (price > 0),
+  currency text NOT NULL DEFAULT 'ETB' CHECK (currency IN ('ETB', 'USD')),
+  is_active boolean NOT NULL DEFAULT true,
+  created_at timestamptz DEFAULT now(),
+  updated_at timestamptz DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_bundles_chef_id ON bundles(chef_id);
+
+DROP TRIGGER IF EXISTS update_bundles_updated_at ON bundles;
+CREATE TRIGGER update_bundles_updated_at
+  BEFORE UPDATE ON bundles
+  FOR EACH ROW
+  EXECUTE FUNCTION update_updated_at_column();
+
+CREATE TABLE IF NOT EXISTS bundle_recipes (
+  bundle_id uuid NOT NULL REFERENCES bundles(id) ON DELETE CASCADE,
+  recipe_id uuid NOT NULL REFERENCES recipes(id) ON DELETE CASCADE,
+  position integer NOT NULL,
+  PRIMARY KEY (bundle_id, recipe_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_bundle_recipes_recipe_id ON bundle_recipes(recipe_id);
+
+-- A purchase is of either one recipe or one bundle. Bundles cannot be
+-- bought as gifts.
+ALTER TABLE purchases ALTER COLUMN recipe_id DROP NOT NULL;
+ALTER TABLE purchases ADD COLUMN IF NOT EXISTS bundle_id uuid REFERENCES bundles(id) ON DELETE RESTRICT;
+
+ALTER TABLE purchases DROP CONSTRAINT IF EXISTS purchases_item_check;
+ALTER TABLE purchases ADD CONSTRAINT purchases_item_check CHECK (
+  num_nonnulls(recipe_id, bundle_id) = 1
+  AND (bundle_id IS NULL OR gift_code IS NULL)
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_purchases_one_pending_bundle ON purchases(user_id, bundle_id)
+  WHERE status = 'pending' AND bundle_id IS NOT NULL;
+
+-- Access to each recipe of a completed bundle purchase. Rows are written
+-- together with the completion and removed when the purchase is refunded.
+CREATE TABLE IF NOT EXISTS bundle_entitlements (
+  id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+  purchase_id uuid NOT NULL REFERENCES purchases(id) ON DELETE CASCADE,
+  bundle_id uuid REFERENCES bundles(id) ON DELETE SET NULL,
+  recipe_id uuid NOT NULL REFERENCES recipes(id) ON DELETE CASCADE,
+  user_id uuid NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  created_at timestamptz DEFAULT now(),
+  CONSTRAINT bundle_entitlements_purchase_id_recipe_id_key UNIQUE (purchase_id, recipe_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_bundle_entitlements_user_recipe ON bundle_entitlements(user_id, recipe_id);
+
+ALTER TABLE invoices ADD COLUMN IF NOT EXISTS bundle_id uuid REFERENCES bundles(id) ON DELETE SET NULL;
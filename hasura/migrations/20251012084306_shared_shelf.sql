@@ -0,0 +1,13 @@
+-- Recipes that reuse a deduplicated file
+
+-- An owner uploading content they already have gets their existing file
+-- back, which keeps the recipe it was first uploaded for. Each further
+-- recipe the file is used in is linked here so its buyers can read it too.
+CREATE TABLE IF NOT EXISTS file_recipes (
+  file_id uuid NOT NULL REFERENCES files(id) ON DELETE CASCADE,
+  recipe_id uuid NOT NULL REFERENCES recipes(id) ON DELETE CASCADE,
+  created_at timestamptz DEFAULT now(),
+  PRIMARY KEY (file_id, recipe_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_file_recipes_recipe_id ON file_recipes(recipe_id);
@@ -0,0 +1,32 @@
+-- Sales only for completed purchases
+
+-- A sale journal and a bundle's entitlements are written in the same
+-- transaction that completes their purchase. The completion only applies to
+-- pending or expired purchases, so reject the rows, and with them the whole
+-- transaction, when the purchase was failed or replaced in the meantime.
+CREATE OR REPLACE FUNCTION check_purchase_completed()
+RETURNS TRIGGER AS $$
+BEGIN
+  IF NEW.purchase_id IS NOT NULL AND NOT EXISTS (
+    SELECT 1 FROM purchases WHERE id = NEW.purchase_id AND status = 'completed'
+  ) THEN
+    RAISE EXCEPTION 'purchase % is not completed', NEW.purchase_id;
+  END IF;
+  RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS check_ledger_entries_sale_completed ON ledger_entries;
+CREATE CONSTRAINT TRIGGER check_ledger_entries_sale_completed
+  AFTER INSERT ON ledger_entries
+  DEFERRABLE INITIALLY DEFERRED
+  FOR EACH ROW
+  WHEN (NEW.entry_type = 'sale')
+  EXECUTE FUNCTION check_purchase_completed();
+
+DROP TRIGGER IF EXISTS check_bundle_entitlements_completed ON bundle_entitlements;
+CREATE CONSTRAINT TRIGGER check_bundle_entitlements_completed
+  AFTER INSERT ON bundle_entitlements
+  DEFERRABLE INITIALLY DEFERRED
+  FOR EACH ROW
+  EXECUTE FUNCTION check_purchase_completed();
@@ -0,0 +1,7 @@
+-- Refunds made but not yet recorded
+
+-- A refund the payment provider has made whose ledger journal could not be
+-- recorded stays processed until the next refund of its purchase records it
+ALTER TABLE refunds DROP CONSTRAINT IF EXISTS refunds_status_check;
+ALTER TABLE refunds ADD CONSTRAINT refunds_status_check
+  CHECK (status IN ('pending', 'processed', 'completed', 'failed'));
@@ -0,0 +1,19 @@
+-- Bundle revenue split by recipe price
+
+-- What each recipe cost on its own, in the bundle's currency, when the
+-- bundle was created. A bundle sale credits each recipe's creator in
+-- proportion to it.
+ALTER TABLE bundle_recipes ADD COLUMN IF NOT EXISTS list_price decimal(10,2) CHECK (list_price >= 0);
+
+-- Existing bundles use the recipes' current prices, converted at the latest
+-- exchange rate where needed
+UPDATE bundle_recipes br
+SET list_price = ROUND(r.price * CASE
+    WHEN r.currency = b.currency THEN 1
+    ELSE COALESCE((
+      SELECT er.rate FROM exchange_rates er
+      WHERE er.base_currency = r.currency AND er.quote_currency = b.currency
+    ), 1)
+  END, 2)
+FROM bundles b, recipes r
+WHERE br.bundle_id = b.id AND br.recipe_id = r.id AND br.list_price IS NULL AND r.price IS NOT NULL;
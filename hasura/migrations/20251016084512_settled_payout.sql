@@ -0,0 +1,33 @@
+-- Payout journals only for payouts in their outcome
+
+-- The journal recording a payout's outcome is written in the same
+-- transaction that moves the payout to it. The move only applies to a
+-- payout still in the expected status, so reject the journal, and with it
+-- the whole transaction, when the payout reached another outcome in the
+-- meantime.
+CREATE OR REPLACE FUNCTION check_payout_outcome()
+RETURNS TRIGGER AS $$
+BEGIN
+  IF NEW.entry_type = 'payout_reversal' AND NOT EXISTS (
+    SELECT 1 FROM payouts WHERE id = NEW.payout_id AND status IN ('rejected', 'failed')
+  ) THEN
+    RAISE EXCEPTION 'payout % was not rejected or failed', NEW.payout_id;
+  END IF;
+
+  IF NEW.reference LIKE 'payout-paid:%' AND NOT EXISTS (
+    SELECT 1 FROM payouts WHERE id = NEW.payout_id AND status = 'completed'
+  ) THEN
+    RAISE EXCEPTION 'payout % is not completed', NEW.payout_id;
+  END IF;
+
+  RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS check_ledger_entries_payout_outcome ON ledger_entries;
+CREATE CONSTRAINT TRIGGER check_ledger_entries_payout_outcome
+  AFTER INSERT ON ledger_entries
+  DEFERRABLE INITIALLY DEFERRED
+  FOR EACH ROW
+  WHEN (NEW.payout_id IS NOT NULL)
+  EXECUTE FUNCTION check_payout_outcome();
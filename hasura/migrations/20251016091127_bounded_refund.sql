@@ -0,0 +1,32 @@
+-- Refunds bounded by what was paid
+
+-- Refunds are checked against what is left of their purchase before they
+-- reach the payment provider. Lock the purchase while a refund is added, so
+-- concurrent refunds are added one at a time and each sees the others, and
+-- reject one that would take the refunds that are not failed past the
+-- amount paid.
+CREATE OR REPLACE FUNCTION check_refund_within_purchase()
+RETURNS TRIGGER AS $$
+DECLARE
+  paid decimal(10,2);
+  refunded decimal(10,2);
+BEGIN
+  SELECT amount INTO paid FROM purchases WHERE id = NEW.purchase_id FOR UPDATE;
+
+  SELECT COALESCE(SUM(amount), 0) INTO refunded
+  FROM refunds
+  WHERE purchase_id = NEW.purchase_id AND status <> 'failed';
+
+  IF refunded + NEW.amount > paid + 0.005 THEN
+    RAISE EXCEPTION 'refund exceeds the amount left to refund on purchase %', NEW.purchase_id;
+  END IF;
+
+  RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS check_refunds_within_purchase ON refunds;
+CREATE TRIGGER check_refunds_within_purchase
+  BEFORE INSERT ON refunds
+  FOR EACH ROW
+  EXECUTE FUNCTION check_refund_within_purchase();
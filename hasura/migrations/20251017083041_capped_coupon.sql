@@ -0,0 +1,50 @@
+-- Coupon limits enforced when purchases are recorded
+
+-- Coupon limits are checked when a checkout starts, but concurrent
+-- checkouts all pass that check before any of them is recorded, and a fully
+-- discounted one completes at once. Lock the coupon while a purchase using
+-- it is added, so concurrent purchases are added one at a time and each sees
+-- the others, and reject one that would take the coupon past max_uses or
+-- the buyer past max_uses_per_user. Uses are counted as CountCouponUses does:
+-- failed and expired checkouts do not count.
+CREATE OR REPLACE FUNCTION check_coupon_within_limits()
+RETURNS TRIGGER AS $$
+DECLARE
+  total_limit integer;
+  user_limit integer;
+  used integer;
+BEGIN
+  SELECT max_uses, max_uses_per_user INTO total_limit, user_limit
+  FROM coupons WHERE id = NEW.coupon_id FOR UPDATE;
+
+  IF total_limit IS NOT NULL THEN
+    SELECT count(*) INTO used
+    FROM purchases
+    WHERE coupon_id = NEW.coupon_id AND status IN ('pending', 'completed', 'refunded');
+
+    IF used >= total_limit THEN
+      RAISE EXCEPTION 'coupon % has reached its usage limit', NEW.coupon_id;
+    END IF;
+  END IF;
+
+  IF user_limit IS NOT NULL THEN
+    SELECT count(*) INTO used
+    FROM purchases
+    WHERE coupon_id = NEW.coupon_id AND user_id = NEW.user_id
+      AND status IN ('pending', 'completed', 'refunded');
+
+    IF used >= user_limit THEN
+      RAISE EXCEPTION 'coupon % has reached its usage limit for user %', NEW.coupon_id, NEW.user_id;
+    END IF;
+  END IF;
+
+  RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS check_purchases_coupon_limits ON purchases;
+CREATE TRIGGER check_purchases_coupon_limits
+  BEFORE INSERT ON purchases
+  FOR EACH ROW
+  WHEN (NEW.coupon_id IS NOT NULL AND NEW.status IN ('pending', 'completed'))
+  EXECUTE FUNCTION check_coupon_within_limits();
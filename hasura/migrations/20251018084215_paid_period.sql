@@ -0,0 +1,46 @@
+-- Subscription periods only for completed payments
+
+-- Completing a subscription payment marks it completed, extends its
+-- subscription and records its journal in one transaction. The completion
+-- only applies to pending or expired payments, and the subscription remembers
+-- the payment that last extended it so a payment completed twice extends it
+-- once. Reject the period and the journal, and with them the whole
+-- transaction, when the payment was failed in the meantime.
+ALTER TABLE subscriptions ADD COLUMN IF NOT EXISTS last_payment_id uuid
+  REFERENCES subscription_payments(id) ON DELETE SET NULL;
+
+CREATE OR REPLACE FUNCTION check_subscription_payment_completed()
+RETURNS TRIGGER AS $$
+DECLARE
+  payment_id uuid;
+BEGIN
+  IF TG_TABLE_NAME = 'subscriptions' THEN
+    payment_id := NEW.last_payment_id;
+  ELSE
+    payment_id := NEW.subscription_payment_id;
+  END IF;
+
+  IF payment_id IS NOT NULL AND NOT EXISTS (
+    SELECT 1 FROM subscription_payments WHERE id = payment_id AND status = 'completed'
+  ) THEN
+    RAISE EXCEPTION 'subscription payment % is not completed', payment_id;
+  END IF;
+  RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS check_ledger_entries_subscription_completed ON ledger_entries;
+CREATE CONSTRAINT TRIGGER check_ledger_entries_subscription_completed
+  AFTER INSERT ON ledger_entries
+  DEFERRABLE INITIALLY DEFERRED
+  FOR EACH ROW
+  WHEN (NEW.entry_type = 'subscription')
+  EXECUTE FUNCTION check_subscription_payment_completed();
+
+DROP TRIGGER IF EXISTS check_subscriptions_payment_completed ON subscriptions;
+CREATE CONSTRAINT TRIGGER check_subscriptions_payment_completed
+  AFTER UPDATE OF last_payment_id ON subscriptions
+  DEFERRABLE INITIALLY DEFERRED
+  FOR EACH ROW
+  WHEN (NEW.last_payment_id IS DISTINCT FROM OLD.last_payment_id)
+  EXECUTE FUNCTION check_subscription_payment_completed();
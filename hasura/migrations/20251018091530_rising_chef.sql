@@ -0,0 +1,25 @@
+-- Chef role for new recipe authors
+
+-- Free users become chefs, and get the chef storage quota, once one of their
+-- recipes is published, like those who had recipes when roles were
+-- introduced. Drafts do not count. Admins keep their role.
+CREATE OR REPLACE FUNCTION promote_recipe_author()
+RETURNS TRIGGER AS $$
+BEGIN
+  UPDATE users SET role = 'chef' WHERE id = NEW.user_id AND role = 'free';
+  RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS promote_recipes_author ON recipes;
+CREATE TRIGGER promote_recipes_author
+  AFTER INSERT OR UPDATE OF is_published ON recipes
+  FOR EACH ROW
+  WHEN (NEW.is_published)
+  EXECUTE FUNCTION promote_recipe_author();
+
+-- Promote authors who published recipes since roles were introduced
+UPDATE users SET role = 'chef'
+WHERE role = 'free' AND EXISTS (
+  SELECT 1 FROM recipes r WHERE r.user_id = users.id AND r.is_published
+);
@@ -0,0 +1,23 @@
+-- Placeholders follow a recipe image's URL
+
+-- NEW carries the old row's placeholder on an update, so checking it for NULL
+-- kept the previous image's blurhash, colour and size when image_url
+-- changed. Look them up for every new row and every changed URL; a URL no
+-- file has clears them.
+CREATE OR REPLACE FUNCTION fill_recipe_image_placeholder()
+RETURNS TRIGGER AS $$
+BEGIN
+  IF TG_OP = 'UPDATE' THEN
+    IF NEW.image_url IS NOT DISTINCT FROM OLD.image_url THEN
+      RETURN NEW;
+    END IF;
+  END IF;
+
+  SELECT f.width, f.height, f.blurhash, f.dominant_color
+  INTO NEW.width, NEW.height, NEW.blurhash, NEW.dominant_color
+  FROM files f
+  WHERE f.url = NEW.image_url
+  LIMIT 1;
+  RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
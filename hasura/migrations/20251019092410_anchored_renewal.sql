@@ -0,0 +1,10 @@
+-- Subscription billing anchor
+
+-- Billing periods are counted from the start of the first paid period, so a
+-- subscription started on the 31st renews on the last day of shorter months
+-- and on the 31st again after them. Running subscriptions are anchored at
+-- the start of their current period.
+ALTER TABLE subscriptions ADD COLUMN IF NOT EXISTS billing_anchor timestamptz;
+
+UPDATE subscriptions SET billing_anchor = current_period_start
+  WHERE billing_anchor IS NULL AND current_period_start IS NOT NULL;
@@ -0,0 +1,16 @@
+-- Payment provider of purchases
+
+-- Purchases record the payment provider that took the payment, and invoices
+-- copy it, so an invoice names the provider the buyer actually paid through.
+-- Mock payments carry MOCK references; every other paid purchase went
+-- through Chapa. Free purchases have no provider.
+ALTER TABLE purchases ADD COLUMN IF NOT EXISTS payment_provider text;
+ALTER TABLE invoices ADD COLUMN IF NOT EXISTS payment_provider text;
+
+UPDATE purchases
+  SET payment_provider = CASE WHEN provider_reference LIKE 'MOCK%' THEN 'mock' ELSE 'chapa' END
+  WHERE payment_provider IS NULL AND provider_reference IS NOT NULL;
+
+UPDATE invoices SET payment_provider = purchases.payment_provider
+  FROM purchases
+  WHERE invoices.purchase_id = purchases.id AND invoices.payment_provider IS NULL;
@@ -495,6 +495,23 @@ track_table "bookmarks"
 track_table "comments"
 track_table "ratings"
 track_table "purchases"
+track_table "files"
+track_table "user_storage_usage"
+track_table "file_recipes"
+track_table "refunds"
+track_table "ledger_entries"
+track_table "payout_accounts"
+track_table "payouts"
+track_table "coupons"
+track_table "subscription_plans"
+track_table "subscriptions"
+track_table "subscription_payments"
+track_table "exchange_rates"
+track_table "invoices"
+track_table "invoice_counter"
+track_table "bundles"
+track_table "bundle_recipes"
+track_table "bundle_entitlements"
 
 echo "Tables tracked. Now tracking functions..."
 